@@ -0,0 +1,259 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultAddonURL is where the NT addon listens unless it registers elsewhere
+const defaultAddonURL = "http://localhost:8081"
+
+// AddonConfig sets where the bridge finds NT addon instances
+type AddonConfig struct {
+	// DefaultURL is the callback base URL of an addon that hasn't registered;
+	// default http://localhost:8081
+	DefaultURL string `json:"default_url" yaml:"default_url"`
+	// HeartbeatTimeoutMs is how long a registration lasts without a heartbeat;
+	// default 30000
+	HeartbeatTimeoutMs int `json:"heartbeat_timeout_ms" yaml:"heartbeat_timeout_ms"`
+}
+
+func (c *AddonConfig) normalize() {
+	c.DefaultURL = strings.TrimRight(c.DefaultURL, "/")
+	if c.DefaultURL == "" {
+		c.DefaultURL = defaultAddonURL
+	}
+	if c.HeartbeatTimeoutMs <= 0 {
+		c.HeartbeatTimeoutMs = 30000
+	}
+}
+
+// AddonRegistration is an NT addon instance that announced itself on /v1/nt/register
+type AddonRegistration struct {
+	ID           string    `json:"id"`
+	URL          string    `json:"url"` // callback base URL, e.g. http://192.168.1.20:8081
+	Version      string    `json:"version,omitempty"`
+	Accounts     []string  `json:"accounts"`     // NT accounts the instance monitors
+	Capabilities []string  `json:"capabilities"` // e.g. notify_hedge_closed, command, mirror_trade
+	Registered   time.Time `json:"registered"`
+	LastSeen     time.Time `json:"last_seen"`
+	Expires      time.Time `json:"expires"` // when the registration lapses without a heartbeat
+}
+
+// addonRegistry keeps the registered addon instances until their heartbeats stop
+type addonRegistry struct {
+	mu      sync.Mutex
+	timeout time.Duration
+	addons  map[string]*AddonRegistration
+}
+
+func newAddonRegistry(cfg AddonConfig) *addonRegistry {
+	return &addonRegistry{
+		timeout: time.Duration(cfg.HeartbeatTimeoutMs) * time.Millisecond,
+		addons:  make(map[string]*AddonRegistration),
+	}
+}
+
+// register adds or replaces an instance. A re-registration keeps its original
+// registration time.
+func (r *addonRegistry) register(reg AddonRegistration, now time.Time) AddonRegistration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reg.Registered = now
+	if old, ok := r.addons[reg.ID]; ok && old.URL == reg.URL {
+		reg.Registered = old.Registered
+	}
+	reg.LastSeen, reg.Expires = now, now.Add(r.timeout)
+	r.addons[reg.ID] = &reg
+	return reg
+}
+
+// heartbeat extends a registration; false when the instance isn't registered
+func (r *addonRegistry) heartbeat(id string, now time.Time) (AddonRegistration, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reg, ok := r.addons[id]
+	if !ok || !now.Before(reg.Expires) {
+		return AddonRegistration{}, false
+	}
+	reg.LastSeen, reg.Expires = now, now.Add(r.timeout)
+	return *reg, true
+}
+
+// prune removes and returns the registrations whose heartbeats stopped
+func (r *addonRegistry) prune(now time.Time) []AddonRegistration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var expired []AddonRegistration
+	for id, reg := range r.addons {
+		if !now.Before(reg.Expires) {
+			expired = append(expired, *reg)
+			delete(r.addons, id)
+		}
+	}
+	return expired
+}
+
+// live returns the current registrations by id
+func (r *addonRegistry) live() []AddonRegistration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]AddonRegistration, 0, len(r.addons))
+	for _, reg := range r.addons {
+		out = append(out, *reg)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// owner returns the instance monitoring account. When several claim it, the
+// latest registration wins.
+func (r *addonRegistry) owner(account string) (AddonRegistration, bool) {
+	var found AddonRegistration
+	ok := false
+	for _, reg := range r.live() {
+		for _, acct := range reg.Accounts {
+			if strings.EqualFold(acct, account) && (!ok || reg.Registered.After(found.Registered)) {
+				found, ok = reg, true
+			}
+		}
+	}
+	return found, ok
+}
+
+// expireAddons drops the registrations whose heartbeats stopped
+func (a *App) expireAddons() {
+	for _, reg := range a.addons.prune(time.Now()) {
+		log.Printf("ADDON: %s at %s expired; no heartbeat since %s", reg.ID, reg.URL, reg.LastSeen.Format(time.RFC3339))
+		a.emit("addonExpired", reg)
+	}
+}
+
+// addonURL is the callback base URL of the addon that owns an NT account: the
+// instance monitoring it, else the only registered instance, else default_url
+func (a *App) addonURL(account string) string {
+	a.expireAddons()
+	if account != "" {
+		if reg, ok := a.addons.owner(account); ok {
+			return reg.URL
+		}
+	}
+	if live := a.addons.live(); len(live) == 1 {
+		return live[0].URL
+	}
+	return a.baseAddonURL()
+}
+
+// baseAddonURL is default_url, or the historical localhost:8081 if it was
+// never filled in, so callbacks never go to a hostless path
+func (a *App) baseAddonURL() string {
+	if a.addonBaseURL == "" {
+		return defaultAddonURL
+	}
+	return a.addonBaseURL
+}
+
+// addonURLs are the callback base URLs of every registered addon, or default_url
+// when none has registered
+func (a *App) addonURLs() []string {
+	a.expireAddons()
+	live := a.addons.live()
+	if len(live) == 0 {
+		return []string{a.baseAddonURL()}
+	}
+	urls := make([]string, len(live))
+	for i, reg := range live {
+		urls[i] = reg.URL
+	}
+	return urls
+}
+
+// addonSeen marks the addon connected, as a /log_trade or health ping does
+func (a *App) addonSeen() {
+	a.addonStatusMux.Lock()
+	a.addonConnected = true
+	a.lastAddonRequestTime = time.Now()
+	a.addonStatusMux.Unlock()
+}
+
+// addonRegisterHandler registers an addon instance:
+// POST /v1/nt/register {"id":"nt-desk-1","url":"http://127.0.0.1:8081","accounts":["Sim101"]}
+func (a *App) addonRegisterHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+	var req AddonRegistration
+	if _, ok := decodeBody(w, r, "AddonRegistration", &req); !ok {
+		return
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		writeAPIError(w, http.StatusBadRequest, errCodeValidation, "Invalid callback URL",
+			fieldError{Field: "url", Message: "must be an http(s) base URL, e.g. http://127.0.0.1:8081"})
+		return
+	}
+	req.URL = strings.TrimRight(req.URL, "/")
+	if req.ID == "" {
+		req.ID = req.URL
+	}
+	a.expireAddons()
+	for _, acct := range req.Accounts {
+		if other, ok := a.addons.owner(acct); ok && other.ID != req.ID {
+			log.Printf("WARNING: ADDON: %s also monitors account %s, owned by %s; routing it to %s", req.ID, acct, other.ID, req.ID)
+		}
+	}
+	reg := a.addons.register(req, time.Now())
+	a.addonSeen()
+	log.Printf("ADDON: %s registered at %s (version %q, accounts %v, capabilities %v)",
+		reg.ID, reg.URL, reg.Version, reg.Accounts, reg.Capabilities)
+	a.emit("addonRegistered", reg)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":               "success",
+		"id":                   reg.ID,
+		"heartbeat_timeout_ms": a.addons.timeout.Milliseconds(),
+	})
+}
+
+// addonHeartbeatHandler keeps a registration alive: POST /v1/nt/heartbeat {"id":"nt-desk-1"}.
+// An expired or unknown instance is answered 409 unknown_addon and should register again.
+func (a *App) addonHeartbeatHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+	var req struct {
+		ID string `json:"id"`
+	}
+	if _, ok := decodeBody(w, r, "AddonHeartbeat", &req); !ok {
+		return
+	}
+	a.expireAddons()
+	reg, ok := a.addons.heartbeat(req.ID, time.Now())
+	if !ok {
+		writeAPIError(w, http.StatusConflict, errCodeUnknownAddon, "Addon "+req.ID+" is not registered; register again")
+		return
+	}
+	a.addonSeen()
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "success", "id": reg.ID, "expires": reg.Expires})
+}
+
+// addonsHandler lists the registered addon instances: GET /v1/nt/addons
+func (a *App) addonsHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"addons":      a.GetAddons(),
+		"default_url": a.baseAddonURL(),
+	})
+}
+
+// GetAddons returns the registered NT addon instances
+func (a *App) GetAddons() []AddonRegistration {
+	a.expireAddons()
+	return a.addons.live()
+}
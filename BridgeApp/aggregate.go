@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxFillBreakdowns caps how many aggregated base_ids keep their breakdown
+const maxFillBreakdowns = 500
+
+// ContractFill is one NT contract folded into an aggregated hedge instruction
+type ContractFill struct {
+	ID          string    `json:"id"`
+	ContractNum int       `json:"contract_num"`
+	Quantity    float64   `json:"quantity"`
+	Price       float64   `json:"price"`
+	Time        time.Time `json:"time"`
+	// Closed is how much of this contract's hedge MT5 has reported closed
+	Closed float64 `json:"closed,omitempty"`
+}
+
+// pendingFill collects the contracts of one NT fill while the window is open
+type pendingFill struct {
+	contracts []Trade
+	timer     *time.Timer
+}
+
+// fillAggregator holds the per-contract Trades NT sends for a multi-contract fill
+// and releases them as one instruction once all TotalQuantity contracts have
+// arrived or the window expires, so the EA opens one hedge instead of n. The
+// breakdown is kept per base_id to map MT5 closures back to contracts.
+type fillAggregator struct {
+	mu        sync.Mutex
+	window    time.Duration
+	pending   map[string]*pendingFill
+	breakdown map[string][]ContractFill
+	order     []string // base_ids in breakdown, oldest first
+	release   func(Trade)
+}
+
+func newFillAggregator(window time.Duration, release func(Trade)) *fillAggregator {
+	return &fillAggregator{
+		window:    window,
+		pending:   make(map[string]*pendingFill),
+		breakdown: make(map[string][]ContractFill),
+		release:   release,
+	}
+}
+
+// aggregatable reports whether t is a contract of a multi-contract fill
+func aggregatable(t Trade) bool {
+	return t.BaseID != "" && t.TotalQuantity > 1 &&
+		(t.Action == "Buy" || t.Action == "Sell") &&
+		(t.OrderType == "" || t.OrderType == "ENTRY")
+}
+
+// add holds t until its fill is complete. The aggregated instruction is passed to
+// release, either from add itself or from the window timer.
+func (g *fillAggregator) add(t Trade) {
+	g.mu.Lock()
+	p := g.pending[t.BaseID]
+	if p != nil && (p.contracts[0].Action != t.Action || hasContract(p.contracts, t.ContractNum)) {
+		// A different fill reusing the base_id: release what we have first
+		g.releaseLocked(t.BaseID, "superseded")
+		p = nil
+	}
+	if p == nil {
+		p = &pendingFill{}
+		baseID := t.BaseID
+		p.timer = time.AfterFunc(g.window, func() { g.expire(baseID, p) })
+		g.pending[baseID] = p
+	}
+	p.contracts = append(p.contracts, t)
+	log.Printf("AGGREGATE: Holding contract %d of %d for base_id %s (%d received)", t.ContractNum, t.TotalQuantity, t.BaseID, len(p.contracts))
+	if len(p.contracts) >= t.TotalQuantity {
+		g.releaseLocked(t.BaseID, "complete")
+	}
+	g.mu.Unlock()
+}
+
+// flush releases any contracts still held for baseID, e.g. before a close for it
+// is queued
+func (g *fillAggregator) flush(baseID string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.pending[baseID] != nil {
+		g.releaseLocked(baseID, "flushed")
+	}
+}
+
+// flushAll releases every fill still held, e.g. before shutdown persists the queue
+func (g *fillAggregator) flushAll() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for baseID := range g.pending {
+		g.releaseLocked(baseID, "flushed for shutdown")
+	}
+}
+
+func (g *fillAggregator) expire(baseID string, p *pendingFill) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.pending[baseID] != p {
+		return // already released
+	}
+	total := p.contracts[0].TotalQuantity
+	log.Printf("WARNING: AGGREGATE: Window of %v expired for base_id %s with %d of %d contract(s); hedging what arrived",
+		g.window, baseID, len(p.contracts), total)
+	g.releaseLocked(baseID, "timed out")
+}
+
+// releaseLocked builds the aggregated instruction for baseID and hands it on.
+// g.mu must be held; release only queues, so holding the lock keeps the order in
+// which fills complete.
+func (g *fillAggregator) releaseLocked(baseID, why string) {
+	p := g.pending[baseID]
+	delete(g.pending, baseID)
+	p.timer.Stop()
+
+	first := p.contracts[0]
+	agg := first
+	agg.ID = baseID
+	agg.ContractNum = 1
+	agg.Quantity = 0
+	var notional float64
+	fills := make([]ContractFill, 0, len(p.contracts))
+	for _, c := range p.contracts {
+		agg.Quantity += c.Quantity
+		notional += c.Price * c.Quantity
+		if c.Time.After(agg.Time) {
+			agg.Time = c.Time
+		}
+		fills = append(fills, ContractFill{ID: c.ID, ContractNum: c.ContractNum, Quantity: c.Quantity, Price: c.Price, Time: c.Time})
+	}
+	if agg.Quantity > 0 {
+		agg.Price = notional / agg.Quantity
+	}
+	agg.TotalQuantity = int(agg.Quantity)
+	agg.Contracts = fills
+
+	if _, known := g.breakdown[baseID]; !known {
+		g.order = append(g.order, baseID)
+	}
+	g.breakdown[baseID] = append(g.breakdown[baseID], fills...)
+	for len(g.order) > maxFillBreakdowns {
+		delete(g.breakdown, g.order[0])
+		g.order = g.order[1:]
+	}
+
+	log.Printf("AGGREGATE: Releasing %s fill for base_id %s: %s %.2f @ %.5f from %d of %d contract(s)",
+		why, baseID, agg.Action, agg.Quantity, agg.Price, len(fills), first.TotalQuantity)
+	g.release(agg)
+}
+
+// closed records that MT5 closed quantity of baseID's hedge and returns the IDs
+// of the contracts it covers, oldest first
+func (g *fillAggregator) closed(baseID string, quantity float64) []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	fills := g.breakdown[baseID]
+	var ids []string
+	for i := range fills {
+		if quantity <= 0 {
+			break
+		}
+		open := fills[i].Quantity - fills[i].Closed
+		if open <= 0 {
+			continue
+		}
+		take := open
+		if take > quantity {
+			take = quantity
+		}
+		fills[i].Closed += take
+		quantity -= take
+		ids = append(ids, fills[i].ID)
+	}
+	return ids
+}
+
+// contracts returns the breakdown recorded for baseID
+func (g *fillAggregator) contracts(baseID string) ([]ContractFill, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	fills, ok := g.breakdown[baseID]
+	return append([]ContractFill(nil), fills...), ok
+}
+
+// held returns how many contracts are waiting for their fill to complete
+func (g *fillAggregator) held() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	n := 0
+	for _, p := range g.pending {
+		n += len(p.contracts)
+	}
+	return n
+}
+
+func hasContract(contracts []Trade, num int) bool {
+	for _, c := range contracts {
+		if c.ContractNum == num {
+			return true
+		}
+	}
+	return false
+}
+
+// fillsHandler returns the per-contract breakdown of an aggregated fill:
+// GET /v1/fills/{base_id}
+func (a *App) fillsHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	baseID := strings.Trim(strings.TrimPrefix(r.URL.Path, apiVersionPrefix+"/fills"), "/")
+	if baseID == "" {
+		writeAPIError(w, http.StatusBadRequest, errCodeBadRequest, "Missing base_id in path")
+		return
+	}
+	fills, ok := a.aggregator.contracts(baseID)
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, errCodeNotFound, fmt.Sprintf("No aggregated fill recorded for base_id %s", baseID))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"base_id": baseID, "contracts": fills})
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxRecentExecutions is how many per-hedge samples are kept for charts
+const maxRecentExecutions = 500
+
+// executionHistory is how long hourly execution buckets are kept
+const executionHistory = 7 * 24 * time.Hour
+
+// executionTrace follows one message from the NT fill to the MT5 fill
+type executionTrace struct {
+	id         string
+	baseID     string
+	instrument string
+	action     string
+	mt5Sign    float64 // side MT5 took: +1 buy, -1 sell
+	isClose    bool
+	ntTime     time.Time
+	ntPrice    float64
+	receivedAt time.Time
+	pulledAt   time.Time
+}
+
+// ExecutionSample is the execution quality of one hedge instruction. Latencies
+// are measured from the NT fill; a stage that wasn't observed is left out.
+type ExecutionSample struct {
+	ID          string    `json:"id"`
+	BaseID      string    `json:"base_id"`
+	Instrument  string    `json:"instrument"`
+	Symbol      string    `json:"symbol,omitempty"`
+	Action      string    `json:"action"`
+	IsClose     bool      `json:"is_close"`
+	NTTime      time.Time `json:"nt_time"`
+	NTPrice     float64   `json:"nt_price,omitempty"`
+	MT5Time     time.Time `json:"mt5_time"`
+	MT5Price    float64   `json:"mt5_price,omitempty"`
+	ReceiveMs   *float64  `json:"receive_ms,omitempty"`   // NT fill to bridge receive
+	PullMs      *float64  `json:"pull_ms,omitempty"`      // NT fill to EA pull
+	FillMs      float64   `json:"fill_ms"`                // NT fill to MT5 fill
+	SlippagePts *float64  `json:"slippage_pts,omitempty"` // positive is worse than the NT price
+}
+
+// StatSummary summarises one measure over a set of samples
+type StatSummary struct {
+	Count int     `json:"count"`
+	Mean  float64 `json:"mean"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+}
+
+type statAccumulator struct {
+	count         int
+	sum, min, max float64
+}
+
+func (s *statAccumulator) add(v float64) {
+	if s.count == 0 || v < s.min {
+		s.min = v
+	}
+	if s.count == 0 || v > s.max {
+		s.max = v
+	}
+	s.count++
+	s.sum += v
+}
+
+func (s *statAccumulator) summary() *StatSummary {
+	if s.count == 0 {
+		return nil
+	}
+	return &StatSummary{Count: s.count, Mean: s.sum / float64(s.count), Min: s.min, Max: s.max}
+}
+
+// executionBucket aggregates the samples of one instrument, overall or for one hour
+type executionBucket struct {
+	symbol                        string
+	executions                    int
+	receive, pull, fill, slippage statAccumulator
+}
+
+func (b *executionBucket) add(s ExecutionSample) {
+	b.executions++
+	if s.Symbol != "" {
+		b.symbol = s.Symbol
+	}
+	if s.ReceiveMs != nil {
+		b.receive.add(*s.ReceiveMs)
+	}
+	if s.PullMs != nil {
+		b.pull.add(*s.PullMs)
+	}
+	b.fill.add(s.FillMs)
+	if s.SlippagePts != nil {
+		b.slippage.add(*s.SlippagePts)
+	}
+}
+
+// ExecutionStats is the execution quality of one instrument, overall or for the
+// hour starting at Hour
+type ExecutionStats struct {
+	Instrument  string       `json:"instrument"`
+	Symbol      string       `json:"symbol,omitempty"`
+	Hour        *time.Time   `json:"hour,omitempty"`
+	Executions  int          `json:"executions"`
+	ReceiveMs   *StatSummary `json:"receive_ms,omitempty"`
+	PullMs      *StatSummary `json:"pull_ms,omitempty"`
+	FillMs      *StatSummary `json:"fill_ms,omitempty"`
+	SlippagePts *StatSummary `json:"slippage_pts,omitempty"`
+}
+
+func (b *executionBucket) stats(instrument string, hour *time.Time) ExecutionStats {
+	return ExecutionStats{
+		Instrument:  instrument,
+		Symbol:      b.symbol,
+		Hour:        hour,
+		Executions:  b.executions,
+		ReceiveMs:   b.receive.summary(),
+		PullMs:      b.pull.summary(),
+		FillMs:      b.fill.summary(),
+		SlippagePts: b.slippage.summary(),
+	}
+}
+
+// ExecutionReport is what GetExecutionStats and GET /v1/execution return
+type ExecutionReport struct {
+	Instruments []ExecutionStats  `json:"instruments"`
+	Hourly      []ExecutionStats  `json:"hourly"`
+	Recent      []ExecutionSample `json:"recent"`
+}
+
+type hourKey struct {
+	instrument string
+	hour       time.Time
+}
+
+// executionTracker measures latency and slippage of every hedge instruction from
+// the NT fill through the bridge to the MT5 fill
+type executionTracker struct {
+	mu       sync.Mutex
+	received map[string]time.Time // NT trade id or base_id -> bridge receive time
+	traces   map[string]*executionTrace
+	byBase   map[string]string // base_id -> id of the last message handed out for it
+	order    []string          // trace ids, oldest first, to bound memory
+	totals   map[string]*executionBucket
+	hourly   map[hourKey]*executionBucket
+	recent   []ExecutionSample
+}
+
+func newExecutionTracker() *executionTracker {
+	return &executionTracker{
+		received: make(map[string]time.Time),
+		traces:   make(map[string]*executionTrace),
+		byBase:   make(map[string]string),
+		totals:   make(map[string]*executionBucket),
+		hourly:   make(map[hourKey]*executionBucket),
+	}
+}
+
+// receivedTrade records when an NT trade reached the bridge. Aggregated fills
+// are handed out under their base_id, so that is recorded too.
+func (x *executionTracker) receivedTrade(t Trade, at time.Time) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.received[t.ID] = at
+	if _, seen := x.received[t.BaseID]; !seen && t.BaseID != "" {
+		x.received[t.BaseID] = at
+	}
+}
+
+// handedOut starts timing a message the EA pulled
+func (x *executionTracker) handedOut(t Trade, at time.Time) {
+	if t.OrderType == "TP" || t.OrderType == "SL" {
+		return // measurements are not executed
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	tr := &executionTrace{
+		id:         t.ID,
+		baseID:     t.BaseID,
+		instrument: instrumentKey(t.Instrument),
+		action:     t.Action,
+		mt5Sign:    mt5Sign(ntSign(t.Action), t.Direction),
+		isClose:    t.Action == "CLOSE_HEDGE",
+		ntTime:     t.Time,
+		ntPrice:    t.Price,
+		pulledAt:   at,
+	}
+	if rcv, ok := x.received[t.ID]; ok {
+		tr.receivedAt = rcv
+		delete(x.received, t.ID)
+	} else if rcv, ok := x.received[t.BaseID]; ok && !tr.isClose {
+		tr.receivedAt = rcv
+	}
+	if _, seen := x.traces[t.ID]; !seen {
+		x.order = append(x.order, t.ID)
+		for len(x.order) > maxTrackedDispatches {
+			if old, ok := x.traces[x.order[0]]; ok && x.byBase[old.baseID] == old.id {
+				delete(x.byBase, old.baseID)
+			}
+			delete(x.traces, x.order[0])
+			x.order = x.order[1:]
+		}
+	}
+	x.traces[t.ID] = tr
+	if t.BaseID != "" && !tr.isClose {
+		x.byBase[t.BaseID] = t.ID
+	}
+	if len(x.received) > maxTrackedDispatches {
+		// Trades that never reach the EA (rejected, expired, netted) leave receipts behind
+		x.received = make(map[string]time.Time)
+	}
+}
+
+// filled completes the trace for a trade result and returns its sample. The EA
+// reports the base_id as id for entries, so that is tried as well.
+func (x *executionTracker) filled(res MT5TradeResult, now time.Time) (ExecutionSample, bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	tr, ok := x.traces[res.ID]
+	if !ok {
+		if id, found := x.byBase[res.ID]; found {
+			tr, ok = x.traces[id]
+		}
+	}
+	if !ok {
+		return ExecutionSample{}, false
+	}
+	delete(x.traces, tr.id)
+	if x.byBase[tr.baseID] == tr.id {
+		delete(x.byBase, tr.baseID)
+	}
+
+	mt5Time := res.FillTime
+	if mt5Time.IsZero() {
+		mt5Time = now // older EAs don't report a fill time
+	}
+	s := ExecutionSample{
+		ID:         tr.id,
+		BaseID:     tr.baseID,
+		Instrument: tr.instrument,
+		Symbol:     res.Symbol,
+		Action:     tr.action,
+		IsClose:    tr.isClose,
+		NTTime:     tr.ntTime,
+		NTPrice:    tr.ntPrice,
+		MT5Time:    mt5Time,
+		MT5Price:   res.Price,
+		FillMs:     msBetween(tr.ntTime, mt5Time),
+	}
+	if !tr.receivedAt.IsZero() {
+		ms := msBetween(tr.ntTime, tr.receivedAt)
+		s.ReceiveMs = &ms
+	}
+	pull := msBetween(tr.ntTime, tr.pulledAt)
+	s.PullMs = &pull
+	if !tr.isClose && tr.ntPrice > 0 && res.Price > 0 && res.Point > 0 {
+		// Buying above or selling below the NT price is adverse, whichever side
+		// the route's direction gave MT5
+		slip := (res.Price - tr.ntPrice) * tr.mt5Sign / res.Point
+		s.SlippagePts = &slip
+	}
+	x.addLocked(s)
+	return s, true
+}
+
+func (x *executionTracker) addLocked(s ExecutionSample) {
+	total := x.totals[s.Instrument]
+	if total == nil {
+		total = &executionBucket{}
+		x.totals[s.Instrument] = total
+	}
+	total.add(s)
+
+	hour := s.NTTime.UTC().Truncate(time.Hour)
+	key := hourKey{s.Instrument, hour}
+	bucket := x.hourly[key]
+	if bucket == nil {
+		bucket = &executionBucket{}
+		x.hourly[key] = bucket
+		for k := range x.hourly {
+			if hour.Sub(k.hour) > executionHistory {
+				delete(x.hourly, k)
+			}
+		}
+	}
+	bucket.add(s)
+
+	x.recent = append(x.recent, s)
+	if len(x.recent) > maxRecentExecutions {
+		x.recent = x.recent[len(x.recent)-maxRecentExecutions:]
+	}
+}
+
+// report returns per-instrument and hourly stats, sorted by instrument and hour
+func (x *executionTracker) report() ExecutionReport {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	r := ExecutionReport{
+		Instruments: make([]ExecutionStats, 0, len(x.totals)),
+		Hourly:      make([]ExecutionStats, 0, len(x.hourly)),
+		Recent:      append([]ExecutionSample(nil), x.recent...),
+	}
+	for instrument, b := range x.totals {
+		r.Instruments = append(r.Instruments, b.stats(instrument, nil))
+	}
+	for key, b := range x.hourly {
+		hour := key.hour
+		r.Hourly = append(r.Hourly, b.stats(key.instrument, &hour))
+	}
+	sort.Slice(r.Instruments, func(i, j int) bool { return r.Instruments[i].Instrument < r.Instruments[j].Instrument })
+	sort.Slice(r.Hourly, func(i, j int) bool {
+		if r.Hourly[i].Instrument != r.Hourly[j].Instrument {
+			return r.Hourly[i].Instrument < r.Hourly[j].Instrument
+		}
+		return r.Hourly[i].Hour.Before(*r.Hourly[j].Hour)
+	})
+	return r
+}
+
+// msBetween returns the milliseconds from a to b, rounded to 0.1ms
+func msBetween(a, b time.Time) float64 {
+	return math.Round(float64(b.Sub(a))/float64(time.Millisecond)*10) / 10
+}
+
+// recordExecution times a successful trade result
+func (a *App) recordExecution(res MT5TradeResult) {
+	if res.Status != "success" {
+		return
+	}
+	s, ok := a.execution.filled(res, time.Now())
+	if !ok {
+		return
+	}
+	slip := "n/a"
+	if s.SlippagePts != nil {
+		slip = fmt.Sprintf("%.2f pts", *s.SlippagePts)
+	}
+	log.Printf("EXECUTION: %s %s %s filled %.1fms after the NT fill (slippage %s)",
+		s.Instrument, s.Action, s.ID, s.FillMs, slip)
+}
+
+// executionHandler serves the execution quality stats: GET /v1/execution
+func (a *App) executionHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, http.StatusOK, a.execution.report())
+}
+
+// GetExecutionStats returns latency and slippage per instrument and per hour for the UI charts
+func (a *App) GetExecutionStats() ExecutionReport {
+	return a.execution.report()
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// apiVersionPrefix is the path prefix of the versioned API. Requests under it are
+// validated strictly against the published schemas; the original unversioned
+// paths remain as lenient compatibility aliases for deployed EAs and addons.
+const apiVersionPrefix = "/v1"
+
+// Error codes used in the error envelope
+const (
+	errCodeBadRequest       = "bad_request"
+	errCodeInvalidJSON      = "invalid_json"
+	errCodeValidation       = "validation_failed"
+	errCodeMethodNotAllowed = "method_not_allowed"
+	errCodeNotFound         = "not_found"
+	errCodeUnknownCursor    = "unknown_cursor"
+	errCodeUnknownCommand   = "unknown_command"
+	errCodeUnknownAddon     = "unknown_addon"
+	errCodeRiskLimit        = "risk_limit"
+	errCodeUnauthorized     = "unauthorized"
+	errCodeAdminDisabled    = "admin_disabled"
+	errCodeUnrouted         = "unrouted_account"
+	errCodeTargetDisabled   = "target_disabled"
+	errCodeUpstream         = "upstream_failed"
+	errCodeShuttingDown     = "shutting_down"
+	errCodeRateLimited      = "rate_limited"
+	errCodeBodyTooLarge     = "body_too_large"
+	errCodeInternal         = "internal_error"
+)
+
+// apiError is the single error envelope every endpoint returns:
+//
+//	{"error":{"code":"validation_failed","message":"...","fields":[{"field":"quantity","message":"must be a number"}]}}
+type apiError struct {
+	Error apiErrorBody `json:"error"`
+}
+
+type apiErrorBody struct {
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Fields  []fieldError `json:"fields,omitempty"`
+}
+
+// route is one bridge endpoint, served at both /v1{path} and {path}
+type route struct {
+	path    string
+	handler http.HandlerFunc
+}
+
+// apiRoutes lists every message endpoint of the bridge
+func (a *App) apiRoutes() []route {
+	return []route{
+		{"/log_trade", a.logTradeHandler},
+		{"/mt5/get_trade", a.getTradeHandler},
+		{"/mt5/get_trades", a.getTradesHandler}, // batch variant, see batch.go
+		{"/mt5/ack_trades", a.ackTradesHandler},
+		{"/health", a.healthHandler},
+		{"/notify_hedge_close", a.handleNotifyMT5HedgeClosure}, // FROM MT5 TO NT
+		{"/nt_close_hedge", a.handleNTCloseHedgeRequest},       // FROM NT TO MT5
+		{"/mt5/trade_result", a.handleMT5TradeResult},          // MT5 trade results
+		{"/mt5/telemetry", a.eaTelemetryHandler},               // EA cushion and OHF
+		{"/mt5/manual_trade", a.manualTradeHandler},            // trades opened by hand on MT5
+	}
+}
+
+// isStrictRequest reports whether r arrived on the versioned API
+func isStrictRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, apiVersionPrefix+"/")
+}
+
+// writeJSON writes v as a JSON response with the given status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("ERROR: Failed to write JSON response: %v", err)
+	}
+}
+
+// writeAPIError writes the error envelope
+func writeAPIError(w http.ResponseWriter, status int, code, message string, fields ...fieldError) {
+	writeJSON(w, status, apiError{Error: apiErrorBody{Code: code, Message: message, Fields: fields}})
+}
+
+// requireMethod answers 405 and returns false unless r uses one of the allowed methods
+func requireMethod(w http.ResponseWriter, r *http.Request, allowed ...string) bool {
+	for _, m := range allowed {
+		if r.Method == m {
+			return true
+		}
+	}
+	log.Printf("ERROR: Invalid request method for %s: %s", r.URL.Path, r.Method)
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeAPIError(w, http.StatusMethodNotAllowed, errCodeMethodNotAllowed,
+		"Invalid request method. Only "+strings.Join(allowed, ", ")+" is allowed.")
+	return false
+}
+
+// decodeBody reads the request body, validates it against the named schema and
+// unmarshals it into v. On /v1/ every schema rule applies; on the unversioned
+// aliases only type errors are enforced, which is what the old decoders rejected.
+// It writes the error response itself and returns the raw body, also when the
+// body was read but refused, with ok false.
+func decodeBody(w http.ResponseWriter, r *http.Request, schemaName string, v interface{}) ([]byte, bool) {
+	defer r.Body.Close()
+	body, err := io.ReadAll(r.Body)
+	if limit, ok := bodyTooLarge(err); ok {
+		writeAPIError(w, http.StatusRequestEntityTooLarge, errCodeBodyTooLarge,
+			"Request body exceeds "+strconv.FormatInt(limit, 10)+" bytes for "+endpointKey(r.URL.Path))
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("ERROR: Failed to read request body from %s: %v", r.URL.Path, err)
+		writeAPIError(w, http.StatusBadRequest, errCodeBadRequest, "Failed to read request body")
+		return nil, false
+	}
+	// The EA builds bodies with StringToCharArray, which appends a NUL terminator
+	body = bytes.TrimRight(body, "\x00 \t\r\n")
+
+	strict := isStrictRequest(r)
+	var problems []fieldError
+	for _, fe := range validateJSON(schemaName, body) {
+		if strict || fe.kind == kindType {
+			problems = append(problems, fe)
+		} else {
+			log.Printf("WARNING: %s %s: field '%s' %s (accepted on unversioned route)", r.URL.Path, schemaName, fe.Field, fe.Message)
+		}
+	}
+	if len(problems) > 0 {
+		log.Printf("ERROR: %s failed %s validation: %+v. Body: %s", r.URL.Path, schemaName, problems, string(body))
+		if len(problems) == 1 && problems[0].Field == "" {
+			writeAPIError(w, http.StatusBadRequest, errCodeInvalidJSON, problems[0].Message)
+		} else {
+			writeAPIError(w, http.StatusBadRequest, errCodeValidation, "Request does not match the "+schemaName+" schema", problems...)
+		}
+		return body, false
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		log.Printf("ERROR: Failed to decode %s from %s: %v. Body: %s", schemaName, r.URL.Path, err, string(body))
+		writeAPIError(w, http.StatusBadRequest, errCodeInvalidJSON, "Invalid JSON payload: "+err.Error())
+		return body, false
+	}
+	return body, true
+}
+
+// schemaHandler publishes the message schemas: /v1/schemas lists them and
+// /v1/schemas/{name} returns one
+func (a *App) schemaHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, apiVersionPrefix+"/schemas"), "/")
+	if name == "" {
+		links := make(map[string]string)
+		for _, n := range schemaNames() {
+			links[n] = apiVersionPrefix + "/schemas/" + n
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"schemas": links})
+		return
+	}
+	if _, err := loadSchemas(); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, errCodeInternal, err.Error())
+		return
+	}
+	raw, ok := schemaRaw[strings.TrimSuffix(name, ".json")]
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, errCodeNotFound, "Unknown schema "+name)
+		return
+	}
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.Write(raw)
+}
+
+// notFoundHandler answers every path the bridge doesn't serve with the JSON
+// error envelope instead of the mux's plain-text 404
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, http.StatusNotFound, errCodeNotFound, "No endpoint at "+r.URL.Path)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUnknownPathAnswersJSON(t *testing.T) {
+	cfg := Config{DataDir: t.TempDir()}
+	cfg.normalize()
+	a := newAppWithConfig(cfg)
+	for _, path := range []string{"/nope", "/v1/nope", "/v1/mt5/nope"} {
+		rec := httptest.NewRecorder()
+		a.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var reply struct {
+			Error struct {
+				Code string `json:"code"`
+			} `json:"error"`
+		}
+		if rec.Code != http.StatusNotFound || json.Unmarshal(rec.Body.Bytes(), &reply) != nil || reply.Error.Code != errCodeNotFound {
+			t.Errorf("GET %s = %d %q; want 404 with code %q", path, rec.Code, rec.Body.String(), errCodeNotFound)
+		}
+	}
+}
@@ -7,9 +7,12 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/wailsapp/wails/v2/pkg/runtime"
@@ -18,11 +21,17 @@ import (
 // App struct
 type App struct {
 	ctx                  context.Context
-	tradeQueue           chan Trade
+	config               Config
+	tradeQueue           *routedQueue // MT5-bound messages in priority lanes, per target
 	queueMux             sync.Mutex
 	netNT                int
 	hedgeLot             float64
 	bridgeActive         bool
+	bridgeError          string // why the bridge isn't serving, shown in the UI
+	listenAddr           string // the address actually bound
+	lock                 *instanceLock
+	lockErr              error    // another bridge owns the data directory
+	addressFiles         []string // where bridge_address.json was written
 	addonConnected       bool
 	tradeHistory         []Trade
 	server               *http.Server
@@ -35,6 +44,71 @@ type App struct {
 	// HedgeBot connection tracking
 	hedgebotStatusMux sync.Mutex // Protects hedgebotActive and hedgebotLastPing
 	hedgebotLastPing  time.Time  // Timestamp of the last successful ping from Hedgebot
+
+	// Base URL of the NinjaTrader addon's HttpListener (closure and ping callbacks)
+	addonBaseURL string
+
+	// Per-session sequence tracking of NT messages, and the bridge's own
+	// global sequence stamped on every message handed to MT5
+	sequences *sequenceTracker
+	bridgeSeq atomic.Uint64
+
+	// Batch handed to each target's EA by /mt5/get_trades and awaiting acknowledgement
+	batches *targetBatches
+
+	// Folds multi-contract NT fills into one instruction (config aggregate_fills)
+	aggregator *fillAggregator
+
+	// Compares NT position with confirmed MT5 hedge volume per instrument
+	drift *driftMonitor
+
+	// Pre-trade risk limits and trades held for approval
+	risk *riskGuard
+
+	// Operator kill switch: pause/resume forwarding and flatten-all
+	control *controlState
+
+	// Holds messages for symbols outside their MT5 trading session
+	sessions *sessionCalendar
+
+	// Drops or nets queued messages that are too old to execute
+	ttl *ttlGuard
+
+	// Latency and slippage of hedges, NT fill to MT5 fill
+	execution *executionTracker
+
+	// NT account and EA cushion/OHF time series for the UI charts
+	telemetry *telemetryRecorder
+
+	// Trades opened by hand on MT5, and the NT mirrors placed for them
+	manual *manualTrades
+
+	// Commands for the NT addon, pushed or polled, until acknowledged or timed out
+	ntCommands *ntCommandChannel
+
+	// NT addon instances that registered their callback URL and accounts
+	addons *addonRegistry
+
+	// Closure notifications being forwarded to NT, saved if shutdown interrupts them
+	closures *closureForwards
+	// netting maps NT base_ids folded into net targets to the net target's hedge
+	netting *netBook
+
+	// Token buckets and body limits per client and endpoint
+	limiter *requestLimiter
+
+	// Hash-chained record of every state-changing action; nil when disabled
+	audit *auditLog
+
+	// Set once graceful shutdown begins; shutdownCh is closed at the same time
+	shuttingDown atomic.Bool
+	shutdownCh   chan struct{}
+
+	// Routes NT accounts to MT5 targets, and when each target's EA last polled
+	router   *router
+	sizing   *sizingEngine
+	pollMu   sync.Mutex
+	lastPoll map[string]time.Time
 }
 
 type Trade struct {
@@ -51,12 +125,22 @@ type Trade struct {
 	RawMeasurement  float64   `json:"raw_measurement,omitempty"`  // Raw measurement value
 	Instrument      string    `json:"instrument_name,omitempty"`  // Original NinjaTrader instrument symbol
 	AccountName     string    `json:"account_name,omitempty"`     // Original NinjaTrader account name
+	ClosureReason   string    `json:"closure_reason,omitempty"`   // Set by the addon on CLOSE_HEDGE trades
+	SessionID       string    `json:"session_id,omitempty"`       // Addon session the sequence number belongs to
+	Seq             uint64    `json:"seq,omitempty"`              // Per-session monotonic sequence number (0 = unsequenced)
+	Target          string    `json:"target,omitempty"`           // MT5 target the bridge routed this message to
+	Direction       string    `json:"direction,omitempty"`        // hedge or copy, from the route
 
 	// Enhanced NT Performance Data for Elastic Hedging
 	NTBalance       float64 `json:"nt_balance,omitempty"`        // NT account balance
 	NTDailyPnL      float64 `json:"nt_daily_pnl,omitempty"`      // NT daily P&L
 	NTTradeResult   string  `json:"nt_trade_result,omitempty"`   // "win", "loss", or "pending"
 	NTSessionTrades int     `json:"nt_session_trades,omitempty"` // Number of trades in current session
+
+	// Per-contract breakdown, set by the bridge when it aggregates a fill
+	Contracts []ContractFill `json:"contracts,omitempty"`
+	// NT base_ids a NET_TARGET entry stands for, set by netOut
+	NetOf []NetShare `json:"net_of,omitempty"`
 }
 
 // HedgeCloseNotification struct mirrors the JSON structure for hedge close notifications
@@ -69,6 +153,8 @@ type HedgeCloseNotification struct {
 	ClosedHedgeAction   string  `json:"closed_hedge_action"`
 	Timestamp           string  `json:"timestamp"`
 	ClosureReason       string  `json:"closure_reason"` // Added missing field
+	SessionID           string  `json:"session_id,omitempty"`
+	Seq                 uint64  `json:"seq,omitempty"`
 }
 
 // MT5TradeResult struct mirrors the JSON payload from MT5 EA trade execution results
@@ -78,17 +164,62 @@ type MT5TradeResult struct {
 	Volume  float64 `json:"volume"`
 	IsClose bool    `json:"is_close"`
 	ID      string  `json:"id"`
+
+	// Execution details for slippage and latency analytics; older EAs omit them
+	Price    float64   `json:"price,omitempty"`     // MT5 fill price
+	FillTime time.Time `json:"fill_time,omitempty"` // MT5 fill time (RFC 3339, UTC)
+	Symbol   string    `json:"symbol,omitempty"`    // MT5 symbol traded
+	Point    float64   `json:"point,omitempty"`     // point size of Symbol
 }
 
 // NewApp creates a new App application struct
 func NewApp() *App {
 	fmt.Println("DEBUG: app.go - In NewApp") // Added for debug
-	return &App{
-		tradeQueue:     make(chan Trade, 100),
+	return openApp(loadConfig())
+}
+
+// newAppWithConfig creates an App from explicit settings (the scenario tests use
+// this to point the spill directory at a temporary folder)
+func newAppWithConfig(cfg Config) *App {
+	a := &App{
+		config:         cfg,
+		tradeQueue:     newRoutedQueue(cfg.QueueMemoryPerLane, cfg.spillDir(), cfg.SpillSegmentRecords, cfg.Routing.Targets),
 		hedgebotActive: false, // Initialize HedgeBot as inactive
 		// addonConnected defaults to false - UNCHANGED
 		tradeLogSenderActive: false,
+		addonBaseURL:         cfg.Addons.DefaultURL,
+		sequences:            newSequenceTracker(),
+		batches:              newTargetBatches(),
+		drift:                newDriftMonitor(cfg),
+		risk:                 newRiskGuard(cfg.Risk),
+		control:              newControlState(),
+		sessions:             newSessionCalendar(cfg.Sessions),
+		ttl:                  newTTLGuard(cfg.TTL),
+		execution:            newExecutionTracker(),
+		telemetry:            newTelemetryRecorder(),
+		manual:               newManualTrades(cfg.ManualTrades),
+		ntCommands:           newNTCommandChannel(cfg.NTCommands),
+		addons:               newAddonRegistry(cfg.Addons),
+		closures:             newClosureForwards(),
+		netting:              newNetBook(),
+		limiter:              newRequestLimiter(cfg.Limits),
+		shutdownCh:           make(chan struct{}),
+		router:               newRouter(cfg.Routing),
+		sizing:               newSizingEngine(cfg.Sizing, cfg.Routing.Targets),
+		lastPoll:             make(map[string]time.Time),
 	}
+	a.aggregator = newFillAggregator(time.Duration(cfg.AggregateWindowMs)*time.Millisecond, a.tradeQueue.push)
+	a.openAudit()
+	return a
+}
+
+// emit forwards an event to the Wails runtime. It is a no-op when the App is
+// running headless (no Wails context), e.g. under the simulators in tests.
+func (a *App) emit(eventName string, optionalData ...interface{}) {
+	if a.ctx == nil {
+		return
+	}
+	runtime.EventsEmit(a.ctx, eventName, optionalData...)
 }
 
 // startup is called when the app starts. The context is saved
@@ -97,6 +228,13 @@ func (a *App) startup(ctx context.Context) {
 	fmt.Println("DEBUG: app.go - In startup") // Added for debug
 	a.ctx = ctx
 
+	if a.lockErr == nil {
+		a.restoreState()
+	}
+	go a.runDriftMonitor(nil)
+	go a.runSessionMonitor(nil)
+	go a.runCommandMonitor(nil)
+
 	// Start background goroutine to monitor addon connection status
 	go func() {
 		ticker := time.NewTicker(10 * time.Second)
@@ -119,38 +257,37 @@ func (a *App) startup(ctx context.Context) {
 	a.startServer()
 }
 
-// StartServer starts the HTTP server
-func (a *App) startServer() {
-	fmt.Println("DEBUG: app.go - In startServer") // Added for debug
+// routes builds the HTTP handler with every bridge endpoint registered
+func (a *App) routes() http.Handler {
 	mux := http.NewServeMux()
-	mux.HandleFunc("/log_trade", a.logTradeHandler)
-	mux.HandleFunc("/mt5/get_trade", a.getTradeHandler)
-	mux.HandleFunc("/health", a.healthHandler)
-	mux.HandleFunc("/notify_hedge_close", a.handleNotifyMT5HedgeClosure) // FROM MT5 TO NT
-	mux.HandleFunc("/nt_close_hedge", a.handleNTCloseHedgeRequest)       // FROM NT TO MT5 - NEW
-	mux.HandleFunc("/mt5/trade_result", a.handleMT5TradeResult)          // New route for MT5 trade results
-
-	a.server = &http.Server{
-		Addr:    "127.0.0.1:5000",
-		Handler: mux,
+	for _, rt := range a.apiRoutes() {
+		mux.HandleFunc(apiVersionPrefix+rt.path, rt.handler) // Versioned, strictly validated
+		mux.HandleFunc(rt.path, rt.handler)                  // Compatibility alias
 	}
-
-	go func() {
-		log.Printf("=== Bridge Server Starting ===")
-		log.Printf("Initial state:")
-		log.Printf("Net position: %d", a.netNT)
-		log.Printf("Hedge size: %.2f", a.hedgeLot)
-		log.Printf("Queue size: %d", len(a.tradeQueue))
-		log.Printf("Listening on 127.0.0.1:5000")
-
-		a.bridgeActive = true
-
-		fmt.Println("DEBUG: app.go - Before ListenAndServe") // Added for debug
-		if err := a.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Printf("HTTP server error: %v", err)
-			a.bridgeActive = false
-		}
-	}()
+	mux.HandleFunc(apiVersionPrefix+"/schemas", a.schemaHandler)
+	mux.HandleFunc(apiVersionPrefix+"/schemas/", a.schemaHandler)
+	mux.HandleFunc(apiVersionPrefix+"/sequence", a.sequenceHandler)
+	mux.HandleFunc(apiVersionPrefix+"/fills/", a.fillsHandler)
+	mux.HandleFunc(apiVersionPrefix+"/drift", a.driftHandler)
+	mux.HandleFunc(apiVersionPrefix+"/risk", a.riskHandler)
+	mux.HandleFunc(apiVersionPrefix+"/risk/held/", a.riskHoldHandler)
+	mux.HandleFunc(apiVersionPrefix+"/admin/", a.adminHandler)
+	mux.HandleFunc(apiVersionPrefix+"/sessions", a.sessionsHandler)
+	mux.HandleFunc(apiVersionPrefix+"/expired", a.expiredHandler)
+	mux.HandleFunc(apiVersionPrefix+"/execution", a.executionHandler)
+	mux.HandleFunc(apiVersionPrefix+"/routes", a.routesHandler)
+	mux.HandleFunc(apiVersionPrefix+"/sizing", a.sizingHandler)
+	mux.HandleFunc(apiVersionPrefix+"/telemetry", a.telemetryHandler)
+	mux.HandleFunc(apiVersionPrefix+"/manual_trades", a.manualTradesHandler)
+	mux.HandleFunc(apiVersionPrefix+"/nt/commands", a.ntCommandsHandler)
+	mux.HandleFunc(apiVersionPrefix+"/nt/commands/ack", a.ntCommandAckHandler)
+	mux.HandleFunc(apiVersionPrefix+"/nt/register", a.addonRegisterHandler)
+	mux.HandleFunc(apiVersionPrefix+"/nt/heartbeat", a.addonHeartbeatHandler)
+	mux.HandleFunc(apiVersionPrefix+"/nt/addons", a.addonsHandler)
+	mux.HandleFunc(apiVersionPrefix+"/limits", a.limitsHandler)
+	mux.HandleFunc(apiVersionPrefix+"/audit/verify", a.auditHandler)
+	mux.HandleFunc("/", notFoundHandler)
+	return a.refuseWhileShuttingDown(a.limitRequests(mux))
 }
 
 // logTradeHandler handles incoming trades
@@ -175,17 +312,35 @@ func (a *App) logTradeHandler(w http.ResponseWriter, r *http.Request) {
 	a.addonStatusMux.Unlock()
 	// --- End Addon connection tracking ---
 
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
 	var trade Trade
-	if err := json.NewDecoder(r.Body).Decode(&trade); err != nil {
-		log.Printf("ERROR: Failed to decode trade data from /log_trade: %v. Addon connection status was updated prior to this error.", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if body, ok := decodeBody(w, r, "Trade", &trade); !ok {
+		log.Printf("ERROR: Rejected trade data from /log_trade. Addon connection status was updated prior to this error.")
+		a.acceptRefusedBody(body)
+		return
+	}
+
+	// Drop retried duplicates. The seq is recorded only once the trade is
+	// accepted, and the reply flags gaps so the addon can resend from the first
+	// missing seq.
+	seqResult, fresh := a.checkSequence(trade.SessionID, trade.Seq)
+	if !fresh {
+		log.Printf("Duplicate trade ID %s (seq %d) ignored", trade.ID, trade.Seq)
+		writeJSON(w, http.StatusOK, sequenceReply(map[string]interface{}{"status": "duplicate", "seq": trade.Seq}, seqResult))
 		return
 	}
+	defer a.releaseSequence(trade.SessionID, trade.Seq)
 
 	// Set time if not provided
+	receivedAt := time.Now()
 	if trade.Time.IsZero() {
-		trade.Time = time.Now()
+		trade.Time = receivedAt
 	}
+	a.execution.receivedTrade(trade, receivedAt)
+	a.telemetry.ntTrade(trade)
 
 	log.Printf("=== Received New Trade (after addon status update) ===")
 	log.Printf("ID: %s, Base ID: %s", trade.ID, trade.BaseID)
@@ -196,6 +351,34 @@ func (a *App) logTradeHandler(w http.ResponseWriter, r *http.Request) {
 	// Add to history
 	a.tradeHistory = append(a.tradeHistory, trade)
 
+	// The fill of a manual MT5 trade mirrored to NT is already on MT5: sending
+	// it back would open a second hedge
+	if a.manual.isMirror(trade.BaseID) {
+		a.bookMirror(trade)
+		writeJSON(w, http.StatusOK, sequenceReply(map[string]interface{}{"status": "success", "forwarded": false, "mirror": true}, a.acceptSequence(trade.SessionID, trade.Seq)))
+		return
+	}
+
+	// Route to the MT5 target hedging this NT account. NT holds an unrouted
+	// fill all the same, so it is booked as one MT5 never hedges.
+	target, direction, rerr := a.router.resolve(trade.AccountName, false)
+	if rerr != nil {
+		if trade.OrderType != "TP" && trade.OrderType != "SL" {
+			a.bookRefusedFill(trade)
+		}
+		a.refuseRoute(w, trade.SessionID, trade.Seq, trade.AccountName, "account_name", rerr)
+		return
+	}
+	if direction == directionDisabled {
+		// Recorded in history only: nothing goes to MT5, so the position book is untouched
+		log.Printf("ROUTING: Not forwarding %s %.2f %s for NT account %q: direction is disabled",
+			trade.Action, trade.Quantity, trade.Instrument, trade.AccountName)
+		writeJSON(w, http.StatusOK, sequenceReply(map[string]interface{}{"status": "success", "forwarded": false}, a.acceptSequence(trade.SessionID, trade.Seq)))
+		return
+	}
+	trade.Target = target
+	trade.Direction = direction
+
 	// Handle measurement data for TP/SL orders
 	if trade.OrderType == "TP" || trade.OrderType == "SL" {
 		log.Printf("Processing %s measurement:", trade.OrderType)
@@ -203,64 +386,144 @@ func (a *App) logTradeHandler(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Converted to pips: %d", trade.MeasurementPips)
 
 		// Send to MT5 EA queue
-		select {
-		case a.tradeQueue <- trade:
-			log.Printf("Measurement queued successfully")
-			w.Write([]byte(`{"status":"success", "measurement_processed":true}`))
-		default:
-			log.Printf("ERROR: Queue full, measurement not processed")
-			http.Error(w, "queue full", http.StatusServiceUnavailable)
-		}
+		a.tradeQueue.push(trade)
+		log.Printf("Measurement queued successfully")
+		writeJSON(w, http.StatusOK, sequenceReply(map[string]interface{}{"status": "success", "measurement_processed": true}, a.acceptSequence(trade.SessionID, trade.Seq)))
 		return
 	}
 
-	// Handle regular trade data
-	select {
-	case a.tradeQueue <- trade:
-		// Update hedging state using actual quantity
-		a.queueMux.Lock()
-		oldNT := a.netNT
-		oldHedge := a.hedgeLot
+	// Pre-trade risk limits: a breaching trade is held for approval or rejected
+	// before it touches the queue or the position
+	a.risk.gate.Lock()
+	if breach := a.risk.check(trade, a.drift, a.hedgeLotsPerContract); breach != nil {
+		a.risk.gate.Unlock()
+		a.handleRiskBreach(w, trade, breach)
+		return
+	}
+	a.acceptTrade(trade)
+	a.risk.gate.Unlock()
 
-		// Check if this is a position closure
-		if (trade.Action == "Sell" && oldNT > 0) || (trade.Action == "Buy" && oldNT < 0) {
-			// For closing trades, respect the original quantity
-			log.Printf("Partial position closure detected. Closing quantity: %.2f", trade.Quantity)
-		}
+	log.Printf("Trade queued successfully")
+	log.Printf("Current queue size: %d", a.tradeQueue.len())
+	writeJSON(w, http.StatusOK, sequenceReply(map[string]interface{}{"status": "success"}, a.acceptSequence(trade.SessionID, trade.Seq)))
+}
 
-		// Update net position
-		if trade.Action == "Buy" {
-			a.netNT += int(trade.Quantity)
-			log.Printf("Adding %.0f long contracts. Net position: %d → %d", trade.Quantity, oldNT, a.netNT)
-		} else if trade.Action == "Sell" {
-			a.netNT -= int(trade.Quantity)
-			log.Printf("Adding %.0f short contracts. Net position: %d → %d", trade.Quantity, oldNT, a.netNT)
-		}
+// acceptTrade queues a regular NT trade for MT5 and updates the hedging state
+func (a *App) acceptTrade(trade Trade) {
+	// Handle regular trade data. Contracts of a multi-contract fill may be held
+	// and released as one instruction; the NT position below is updated either way.
+	if a.config.AggregateFills && aggregatable(trade) {
+		a.aggregator.add(trade)
+	} else {
+		a.tradeQueue.push(trade)
+	}
 
-		// No lot multiplier needed - pass through actual position size
-		desiredHedgeLot := float64(a.netNT)
-		if a.hedgeLot != desiredHedgeLot {
-			log.Printf("=== Hedge Position Update ===")
-			log.Printf("Previous hedge size: %.2f", oldHedge)
-			log.Printf("New hedge size: %.2f", desiredHedgeLot)
-			log.Printf("Change triggered by: %s %.2f", trade.Action, trade.Quantity)
-			a.hedgeLot = desiredHedgeLot
-		}
-		a.queueMux.Unlock()
+	// Update hedging state using actual quantity
+	a.queueMux.Lock()
+	oldNT := a.netNT
+	oldHedge := a.hedgeLot
 
-		log.Printf("Trade queued successfully")
-		log.Printf("Current queue size: %d", len(a.tradeQueue))
-		w.Write([]byte(`{"status":"success"}`))
-	default:
-		log.Printf("ERROR: Queue full, trade not processed")
-		http.Error(w, "queue full", http.StatusServiceUnavailable)
+	// Check if this is a position closure
+	if (trade.Action == "Sell" && oldNT > 0) || (trade.Action == "Buy" && oldNT < 0) {
+		// For closing trades, respect the original quantity
+		log.Printf("Partial position closure detected. Closing quantity: %.2f", trade.Quantity)
 	}
+
+	// Update net position
+	before := a.drift.expected(trade.Instrument)
+	a.drift.ntFill(trade)
+	a.risk.accepted(trade, before, a.drift.expected(trade.Instrument))
+	if trade.Action == "Buy" {
+		a.netNT += int(trade.Quantity)
+		log.Printf("Adding %.0f long contracts. Net position: %d → %d", trade.Quantity, oldNT, a.netNT)
+	} else if trade.Action == "Sell" {
+		a.netNT -= int(trade.Quantity)
+		log.Printf("Adding %.0f short contracts. Net position: %d → %d", trade.Quantity, oldNT, a.netNT)
+	}
+
+	// No lot multiplier needed - pass through actual position size
+	desiredHedgeLot := float64(a.netNT)
+	if a.hedgeLot != desiredHedgeLot {
+		log.Printf("=== Hedge Position Update ===")
+		log.Printf("Previous hedge size: %.2f", oldHedge)
+		log.Printf("New hedge size: %.2f", desiredHedgeLot)
+		log.Printf("Change triggered by: %s %.2f", trade.Action, trade.Quantity)
+		a.hedgeLot = desiredHedgeLot
+	}
+	a.recordAuditLocked(auditNTFill, "nt", map[string]interface{}{
+		"trade_id": trade.ID, "base_id": trade.BaseID, "action": trade.Action, "quantity": trade.Quantity,
+		"instrument": trade.Instrument, "account": trade.AccountName, "net_before": oldNT, "hedge_before": oldHedge,
+	})
+	a.queueMux.Unlock()
+}
+
+// eaPayload builds the message the EA receives for one queued trade and stamps it
+// with the next bridge sequence number. The quantity stays in NT contracts, which
+// the EA counts its fills and closes in; the hedge ratio of the trade's target
+// scales the lots each contract opens. Entries name the side MT5 takes and, when
+// the bridge sizes them, the lot size.
+func (a *App) eaPayload(trade Trade) map[string]interface{} {
+	ratio := a.router.ratio(trade.Target)
+	a.drift.handedOut(trade, ratio)
+	a.execution.handedOut(trade, time.Now())
+	payload := map[string]interface{}{
+		"bridge_seq":           a.bridgeSeq.Add(1), // Global bridge sequence, one per message handed out
+		"id":                   trade.ID,
+		"base_id":              trade.BaseID,
+		"time":                 trade.Time,
+		"action":               trade.Action,
+		"quantity":             trade.Quantity,
+		"price":                trade.Price,
+		"total_quantity":       trade.TotalQuantity,
+		"contract_num":         trade.ContractNum,
+		"order_type":           trade.OrderType,
+		"measurement_pips":     trade.MeasurementPips,
+		"raw_measurement":      trade.RawMeasurement,
+		"nt_instrument_symbol": trade.Instrument,  // Added new field
+		"nt_account_name":      trade.AccountName, // Added new field
+
+		// Enhanced NT Performance Data for Elastic Hedging
+		"nt_balance":        trade.NTBalance,
+		"nt_daily_pnl":      trade.NTDailyPnL,
+		"nt_trade_result":   trade.NTTradeResult,
+		"nt_session_trades": trade.NTSessionTrades,
+	}
+	if len(trade.Contracts) > 0 {
+		payload["contracts"] = trade.Contracts // per-contract breakdown of an aggregated fill
+	}
+	if trade.Target != "" {
+		payload["target"] = trade.Target
+		payload["hedge_ratio"] = ratio
+	}
+	if side := mt5Action(trade); side != "" {
+		direction := trade.Direction
+		if direction == "" {
+			direction = directionHedge
+		}
+		payload["mt5_action"] = side
+		payload["direction"] = direction
+	}
+	if lots, ok := a.lotSize(trade); ok {
+		// Per NT contract with the ratio applied; the EA opens it as is
+		payload["lot_size"] = a.sizing.config(trade.Target).roundLots(lots.Lots * ratio)
+		payload["sizing_mode"] = lots.Mode
+	}
+	return payload
 }
 
 // getTradeHandler sends trades to MT5
 func (a *App) getTradeHandler(w http.ResponseWriter, r *http.Request) {
-	select {
-	case trade := <-a.tradeQueue:
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	target, ok := a.requireEATarget(w, r)
+	if !ok {
+		return
+	}
+	a.polled(target)
+	a.recordHedgeBalance(r, target)
+
+	if trade, ok := a.nextForMT5(target); ok {
 		log.Printf("=== Sending Trade to MT5 ===")
 		log.Printf("ID: %s, Base ID: %s", trade.ID, trade.BaseID)
 		log.Printf("Action: %s, Quantity: %.2f", trade.Action, trade.Quantity)
@@ -275,27 +538,8 @@ func (a *App) getTradeHandler(w http.ResponseWriter, r *http.Request) {
 		// NOTE: hedgebotConnected field removed. Status tracked via /health pings.
 
 		// Construct the payload for the EA
-		eaPayload := map[string]interface{}{
-			"id":                   trade.ID,
-			"base_id":              trade.BaseID,
-			"time":                 trade.Time,
-			"action":               trade.Action,
-			"quantity":             trade.Quantity,
-			"price":                trade.Price,
-			"total_quantity":       trade.TotalQuantity,
-			"contract_num":         trade.ContractNum,
-			"order_type":           trade.OrderType,
-			"measurement_pips":     trade.MeasurementPips,
-			"raw_measurement":      trade.RawMeasurement,
-			"nt_instrument_symbol": trade.Instrument,  // Added new field
-			"nt_account_name":      trade.AccountName, // Added new field
-
-			// Enhanced NT Performance Data for Elastic Hedging
-			"nt_balance":        trade.NTBalance,
-			"nt_daily_pnl":      trade.NTDailyPnL,
-			"nt_trade_result":   trade.NTTradeResult,
-			"nt_session_trades": trade.NTSessionTrades,
-		}
+		eaPayload := a.eaPayload(trade)
+		a.auditHandout(eaPayload)
 
 		// CRITICAL_DEBUG: Log JSON string before sending
 		jsonBytes, err := json.Marshal(eaPayload)
@@ -308,7 +552,10 @@ func (a *App) getTradeHandler(w http.ResponseWriter, r *http.Request) {
 		// Ensure Content-Type is set
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(eaPayload)
-	default:
+	} else if a.control.isPaused() {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"no_trade","paused":true}`)) // Queued messages are held by the kill switch
+	} else {
 		w.Header().Set("Content-Type", "application/json") // Also set for "no_trade" for consistency
 		w.Write([]byte(`{"status":"no_trade"}`))
 	}
@@ -318,38 +565,28 @@ func (a *App) getTradeHandler(w http.ResponseWriter, r *http.Request) {
 func (a *App) handleNotifyMT5HedgeClosure(w http.ResponseWriter, r *http.Request) {
 	log.Println("DEBUG: Entered handleNotifyMT5HedgeClosure")
 
-	if r.Method != http.MethodPost {
-		log.Printf("ERROR: Invalid request method for /notify_mt5_hedge_closure: %s", r.Method)
-		http.Error(w, "Invalid request method. Only POST is allowed.", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// Read the raw body first to forward it later
-	bodyBytes, err := io.ReadAll(r.Body)
-	if err != nil {
-		log.Printf("ERROR: Failed to read request body from /notify_mt5_hedge_closure: %v", err)
-		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+	if !requireMethod(w, r, http.MethodPost) {
 		return
 	}
-	defer r.Body.Close() // Close the original body
 
-	// Now unmarshal from the read bytes for validation and logging
+	// Keep the raw body to forward it to NT later
 	var notification HedgeCloseNotification
-	if err := json.Unmarshal(bodyBytes, &notification); err != nil {
-		log.Printf("ERROR: Failed to decode JSON from /notify_mt5_hedge_closure: %v. Body: %s", err, string(bodyBytes))
-		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+	bodyBytes, ok := decodeBody(w, r, "HedgeCloseNotification", &notification)
+	if !ok {
 		return
 	}
 
 	// Basic Validation
 	if notification.EventType != "hedge_close_notification" {
 		log.Printf("ERROR: Invalid notification type: %s. Expected 'hedge_close_notification'. Body: %s", notification.EventType, string(bodyBytes))
-		http.Error(w, "Invalid notification type", http.StatusBadRequest)
+		writeAPIError(w, http.StatusBadRequest, errCodeValidation, "Invalid notification type",
+			fieldError{Field: "event_type", Message: `must be "hedge_close_notification"`})
 		return
 	}
 	if notification.BaseID == "" {
 		log.Printf("ERROR: Missing base_id in hedge_close_notification. Body: %s", string(bodyBytes))
-		http.Error(w, "Missing base_id", http.StatusBadRequest)
+		writeAPIError(w, http.StatusBadRequest, errCodeValidation, "Missing base_id",
+			fieldError{Field: "base_id", Message: "is required"})
 		return
 	}
 
@@ -377,6 +614,10 @@ func (a *App) handleNotifyMT5HedgeClosure(w http.ResponseWriter, r *http.Request
 	// MT5 hedge closures are just confirmations that the hedge was closed
 	log.Printf("MT5 closed %.2f %s hedge contracts. Net position remains: %d (unchanged)",
 		notification.ClosedHedgeQuantity, notification.ClosedHedgeAction, a.netNT)
+	a.drift.mt5Closed(notification)
+	if ids := a.aggregator.closed(notification.BaseID, notification.ClosedHedgeQuantity); len(ids) > 0 {
+		log.Printf("AGGREGATE: MT5 closure for base_id %s covers contract(s) %v", notification.BaseID, ids)
+	}
 
 	// Update hedge size to match the current net position (should already be correct)
 	desiredHedgeLot := float64(a.netNT)
@@ -387,59 +628,43 @@ func (a *App) handleNotifyMT5HedgeClosure(w http.ResponseWriter, r *http.Request
 		log.Printf("SYNC_FIX: Correcting hedge size to match net position after MT5 closure")
 		a.hedgeLot = desiredHedgeLot
 	}
+	a.recordAuditLocked(auditMT5Closure, "mt5", map[string]interface{}{
+		"base_id": notification.BaseID, "quantity": notification.ClosedHedgeQuantity, "action": notification.ClosedHedgeAction,
+		"instrument": notification.NTInstrumentSymbol, "account": notification.NTAccountName, "reason": notification.ClosureReason,
+		"hedge_before": oldHedge,
+	})
 	a.queueMux.Unlock()
 
 	// Emit event to UI to update displayed position/hedge size
-	runtime.EventsEmit(a.ctx, "positionUpdated", map[string]interface{}{"net_position": a.netNT, "hedge_size": a.hedgeLot})
-
-	// Forward to NinjaTrader Addon with retry logic
-	ntAddonURL := "http://localhost:8081/notify_hedge_closed" // As per specification
-
-	// Enhanced retry logic for critical closure notifications
-	maxRetries := 3
-	var lastErr error
-	var resp *http.Response
-
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		req, err := http.NewRequest(http.MethodPost, ntAddonURL, bytes.NewBuffer(bodyBytes))
-		if err != nil {
-			log.Printf("ERROR: Failed to create request to NinjaTrader Addon on attempt %d/%d: %v", attempt, maxRetries, err)
-			lastErr = err
-			continue
-		}
-		req.Header.Set("Content-Type", "application/json")
-
-		// Progressive timeout increase
-		timeout := time.Duration(5+attempt*2) * time.Second
-		client := &http.Client{Timeout: timeout}
-
-		log.Printf("MT5_TO_NT_BRIDGE: Attempt %d/%d forwarding closure notification for BaseID '%s' to NT (timeout: %v)",
-			attempt, maxRetries, notification.BaseID, timeout)
-
-		resp, err = client.Do(req)
-		if err != nil {
-			log.Printf("MT5_TO_NT_BRIDGE: Attempt %d/%d failed for BaseID '%s': %v", attempt, maxRetries, notification.BaseID, err)
-			lastErr = err
-
-			if attempt < maxRetries {
-				// Progressive backoff: 500ms, 1000ms, 1500ms
-				backoffDuration := time.Duration(500*attempt) * time.Millisecond
-				log.Printf("MT5_TO_NT_BRIDGE: Retrying in %v...", backoffDuration)
-				time.Sleep(backoffDuration)
-			}
-			continue
+	a.emit("positionUpdated", map[string]interface{}{"net_position": a.netNT, "hedge_size": a.hedgeLot})
+
+	// NT knows a net target's hedge by the base_ids it stands for: the first
+	// takes this forward, the others get their own
+	if shares := a.netting.closeNet(notification.BaseID, notification.ClosedHedgeQuantity); len(shares) > 0 {
+		bodies := netClosureBodies(bodyBytes, shares)
+		for i, s := range shares[1:] {
+			go a.redeliverClosure(a.closures.start(s.BaseID, notification.NTAccountName, bodies[i+1]), "Net target closure")
 		}
+		log.Printf("NETTING: MT5 closure of net target %s goes to NT as %v", notification.BaseID, shares)
+		notification.BaseID, bodyBytes = shares[0].BaseID, bodies[0]
+	}
 
-		// Success - break out of retry loop
-		log.Printf("MT5_TO_NT_BRIDGE: SUCCESS - Forwarded closure notification for BaseID '%s' on attempt %d", notification.BaseID, attempt)
-		break
+	// Forward to NinjaTrader Addon with retry logic
+	fwd := a.closures.start(notification.BaseID, notification.NTAccountName, bodyBytes)
+	resp, parked, lastErr := a.forwardClosure(fwd)
+	if parked {
+		writeAPIError(w, http.StatusServiceUnavailable, errCodeShuttingDown,
+			"Bridge is shutting down; the closure was saved and will be forwarded to NinjaTrader on restart")
+		return
 	}
+	a.closures.done(fwd)
+	maxRetries := closureForwardAttempts
 
 	if resp == nil {
 		log.Printf("MT5_TO_NT_BRIDGE: CRITICAL FAILURE - Failed to forward closure notification for BaseID '%s' after %d attempts. Last error: %v",
 			notification.BaseID, maxRetries, lastErr)
 		// Return error to MT5 so it knows the notification failed
-		http.Error(w, fmt.Sprintf("Failed to forward to NinjaTrader after %d attempts: %v", maxRetries, lastErr), http.StatusBadGateway)
+		writeAPIError(w, http.StatusBadGateway, errCodeUpstream, fmt.Sprintf("Failed to forward to NinjaTrader after %d attempts: %v", maxRetries, lastErr))
 		return
 	}
 	defer resp.Body.Close()
@@ -450,7 +675,7 @@ func (a *App) handleNotifyMT5HedgeClosure(w http.ResponseWriter, r *http.Request
 		respBody, err := io.ReadAll(resp.Body)
 		if err != nil {
 			log.Printf("MT5_TO_NT_BRIDGE: ERROR - Failed to read response from NinjaTrader Addon for BaseID '%s': %v", notification.BaseID, err)
-			http.Error(w, "Failed to read NinjaTrader response", http.StatusBadGateway)
+			writeAPIError(w, http.StatusBadGateway, errCodeUpstream, "Failed to read NinjaTrader response")
 			return
 		}
 
@@ -465,8 +690,7 @@ func (a *App) handleNotifyMT5HedgeClosure(w http.ResponseWriter, r *http.Request
 		log.Printf("MT5_TO_NT_BRIDGE: SUCCESS - Forwarded hedge_close_notification for BaseID '%s' to NinjaTrader Addon. Status: %s",
 			notification.BaseID, resp.Status)
 
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]string{
+		writeJSON(w, http.StatusOK, map[string]string{
 			"status":    "success",
 			"message":   "Hedge closure notification processed and forwarded successfully",
 			"base_id":   notification.BaseID,
@@ -477,47 +701,96 @@ func (a *App) handleNotifyMT5HedgeClosure(w http.ResponseWriter, r *http.Request
 		log.Printf("MT5_TO_NT_BRIDGE: ERROR - NinjaTrader Addon returned non-200 status: %s for BaseID '%s'. Response: %s",
 			resp.Status, notification.BaseID, string(body))
 		// Return error to MT5 so it knows the notification failed
-		http.Error(w, fmt.Sprintf("NinjaTrader Addon rejected notification with status %s", resp.Status), http.StatusBadGateway)
+		writeAPIError(w, http.StatusBadGateway, errCodeUpstream, fmt.Sprintf("NinjaTrader Addon rejected notification with status %s", resp.Status))
 	}
 }
 
+// closureForwardAttempts is how many times a closure is posted to the NT addon
+const closureForwardAttempts = 3
+
+// forwardClosure posts a closure notification to the NT addon instance that
+// monitors its account, retrying with backoff. It reports parked when shutdown
+// began during a backoff: the forward is then left for the state snapshot.
+func (a *App) forwardClosure(f *closureForward) (*http.Response, bool, error) {
+	// Routed to the addon instance that monitors the notification's NT account
+	ntAddonURL := a.addonURL(f.Account) + "/notify_hedge_closed"
+
+	// Enhanced retry logic for critical closure notifications
+	maxRetries := closureForwardAttempts
+	var lastErr error
+
+	for attempt := 1; attempt <= maxRetries; attempt++ {
+		req, err := http.NewRequest(http.MethodPost, ntAddonURL, bytes.NewReader(f.Body))
+		if err != nil {
+			log.Printf("ERROR: Failed to create request to NinjaTrader Addon on attempt %d/%d: %v", attempt, maxRetries, err)
+			lastErr = err
+			continue
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		// Progressive timeout increase
+		timeout := time.Duration(5+attempt*2) * time.Second
+		client := &http.Client{Timeout: timeout}
+
+		log.Printf("MT5_TO_NT_BRIDGE: Attempt %d/%d forwarding closure notification for BaseID '%s' to NT (timeout: %v)",
+			attempt, maxRetries, f.BaseID, timeout)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			log.Printf("MT5_TO_NT_BRIDGE: Attempt %d/%d failed for BaseID '%s': %v", attempt, maxRetries, f.BaseID, err)
+			lastErr = err
+
+			if attempt < maxRetries {
+				// Progressive backoff: 500ms, 1000ms, 1500ms
+				backoffDuration := time.Duration(500*attempt) * time.Millisecond
+				log.Printf("MT5_TO_NT_BRIDGE: Retrying in %v...", backoffDuration)
+				if !a.waitOrShutdown(backoffDuration) {
+					log.Printf("MT5_TO_NT_BRIDGE: Shutdown began; closure for BaseID '%s' saved for redelivery", f.BaseID)
+					a.closures.park(f)
+					a.auditClosureForward(f, ntAddonURL, attempt, "saved", fmt.Sprint(lastErr))
+					return nil, true, lastErr
+				}
+			}
+			continue
+		}
+
+		// Success - break out of retry loop
+		log.Printf("MT5_TO_NT_BRIDGE: SUCCESS - Forwarded closure notification for BaseID '%s' on attempt %d", f.BaseID, attempt)
+		a.auditClosureForward(f, ntAddonURL, attempt, "delivered", resp.Status)
+		return resp, false, nil
+	}
+	a.auditClosureForward(f, ntAddonURL, maxRetries, "failed", fmt.Sprint(lastErr))
+	return nil, false, lastErr
+}
+
 // handleNTCloseHedgeRequest handles hedge closure requests from NinjaTrader
 // This is the reverse flow: NT -> Bridge -> MT5
 func (a *App) handleNTCloseHedgeRequest(w http.ResponseWriter, r *http.Request) {
 	log.Println("DEBUG: Entered handleNTCloseHedgeRequest")
 
-	if r.Method != http.MethodPost {
-		log.Printf("ERROR: Invalid request method for /nt_close_hedge: %s", r.Method)
-		http.Error(w, "Invalid request method. Only POST is allowed.", http.StatusMethodNotAllowed)
+	if !requireMethod(w, r, http.MethodPost) {
 		return
 	}
 
-	// Read the request body
-	bodyBytes, err := io.ReadAll(r.Body)
-	if err != nil {
-		log.Printf("ERROR: Failed to read request body from /nt_close_hedge: %v", err)
-		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
-		return
-	}
-	defer r.Body.Close()
-
 	// Parse the hedge closure notification from NinjaTrader
 	var notification HedgeCloseNotification
-	if err := json.Unmarshal(bodyBytes, &notification); err != nil {
-		log.Printf("ERROR: Failed to decode JSON from /nt_close_hedge: %v. Body: %s", err, string(bodyBytes))
-		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+	bodyBytes, ok := decodeBody(w, r, "HedgeCloseNotification", &notification)
+	if !ok {
+		a.acceptRefusedBody(bodyBytes)
 		return
 	}
 
 	// Validate the notification
 	if notification.EventType != "hedge_close_notification" {
 		log.Printf("ERROR: Invalid notification type: %s. Expected 'hedge_close_notification'. Body: %s", notification.EventType, string(bodyBytes))
-		http.Error(w, "Invalid notification type", http.StatusBadRequest)
+		a.refuseSequenced(w, notification.SessionID, notification.Seq, http.StatusBadRequest, errCodeValidation, "Invalid notification type",
+			fieldError{Field: "event_type", Message: `must be "hedge_close_notification"`})
 		return
 	}
 	if notification.BaseID == "" {
 		log.Printf("ERROR: Missing base_id in NT hedge_close_notification. Body: %s", string(bodyBytes))
-		http.Error(w, "Missing base_id", http.StatusBadRequest)
+		a.refuseSequenced(w, notification.SessionID, notification.Seq, http.StatusBadRequest, errCodeValidation, "Missing base_id",
+			fieldError{Field: "base_id", Message: "is required"})
 		return
 	}
 
@@ -526,13 +799,81 @@ func (a *App) handleNTCloseHedgeRequest(w http.ResponseWriter, r *http.Request)
 	log.Printf("Closed Quantity: %.2f, Closed Action: %s, Timestamp: %s", notification.ClosedHedgeQuantity, notification.ClosedHedgeAction, notification.Timestamp)
 	log.Printf("Closure Reason: %s", notification.ClosureReason)
 
-	// Update bridge state based on NT closure
+	seqResult, fresh := a.checkSequence(notification.SessionID, notification.Seq)
+	if !fresh {
+		log.Printf("Duplicate NT closure for BaseID %s (seq %d) ignored", notification.BaseID, notification.Seq)
+		writeJSON(w, http.StatusOK, sequenceReply(map[string]interface{}{"status": "duplicate", "seq": notification.Seq}, seqResult))
+		return
+	}
+	defer a.releaseSequence(notification.SessionID, notification.Seq)
+
+	// Route before queueing anything. NT closed the position all the same, so
+	// an unroutable close is booked; nothing was hedged for it to close.
+	target, direction, rerr := a.router.resolve(notification.NTAccountName, true)
+	if rerr != nil {
+		a.bookNTClose(notification)
+		a.refuseRoute(w, notification.SessionID, notification.Seq, notification.NTAccountName, "nt_account_name", rerr)
+		return
+	}
+	if direction == directionDisabled && !a.drift.hedged(notification.BaseID) {
+		// The entry was never sent to MT5, so there is nothing to close or unbook
+		log.Printf("ROUTING: Not forwarding close of %s for NT account %q: direction is disabled", notification.BaseID, notification.NTAccountName)
+		writeJSON(w, http.StatusOK, sequenceReply(map[string]interface{}{"status": "success", "forwarded": false}, a.acceptSequence(notification.SessionID, notification.Seq)))
+		return
+	}
+
+	a.bookNTClose(notification)
+
+	// A base_id folded into a net target is hedged by its share of the net
+	// target's position, which MT5 knows by the net target's base_id
+	closeBaseID, closeQty := notification.BaseID, notification.ClosedHedgeQuantity
+	if netID, q, ok := a.netting.closeOriginal(notification.BaseID, closeQty); ok {
+		if q <= 0 {
+			log.Printf("NETTING: The share of %s in net target %s is already closed on MT5; nothing to close", notification.BaseID, netID)
+			writeJSON(w, http.StatusOK, sequenceReply(map[string]interface{}{"status": "success", "forwarded": false}, a.acceptSequence(notification.SessionID, notification.Seq)))
+			return
+		}
+		log.Printf("NETTING: Closing %.2f of net target %s for NT base_id %s", q, netID, notification.BaseID)
+		closeBaseID, closeQty = netID, q
+	}
+
+	// Add a special message to the trade queue so MT5 can pick it up and close hedges
+	closureTradeMessage := Trade{
+		ID:            fmt.Sprintf("nt_close_%s_%d", closeBaseID, time.Now().Unix()),
+		BaseID:        closeBaseID,
+		Time:          time.Now(),
+		Action:        "CLOSE_HEDGE", // Special action to indicate hedge closure
+		Quantity:      closeQty,
+		Price:         0, // Not relevant for closures
+		TotalQuantity: int(math.Ceil(closeQty)),
+		ContractNum:   1,
+		Instrument:    notification.NTInstrumentSymbol,
+		AccountName:   notification.NTAccountName,
+		OrderType:     "NT_CLOSE",
+		Target:        target,
+		Direction:     direction,
+	}
+
+	log.Printf("CLOSURE_DEBUG: Attempting to queue CLOSE_HEDGE message for MT5. BaseID: %s, Action: %s, Quantity: %.2f",
+		notification.BaseID, closureTradeMessage.Action, closureTradeMessage.Quantity)
+
+	// An aggregated entry still being collected must reach MT5 before its close
+	a.aggregator.flush(notification.BaseID)
+	a.tradeQueue.push(closureTradeMessage)
+	log.Printf("CLOSURE_SUCCESS: NT hedge closure request queued for MT5. BaseID: %s, Queue size now: %d",
+		notification.BaseID, a.tradeQueue.len())
+	writeJSON(w, http.StatusOK, sequenceReply(map[string]interface{}{"status": "success", "message": "NT closure request queued for MT5"}, a.acceptSequence(notification.SessionID, notification.Seq)))
+}
+
+// bookNTClose updates the NT position for a closure NT reported on /nt_close_hedge
+func (a *App) bookNTClose(notification HedgeCloseNotification) {
 	a.queueMux.Lock()
 	oldNT := a.netNT
 	oldHedge := a.hedgeLot
 
 	// Update net position based on the NT closure action
 	// When NT closes a position, we need to close the corresponding hedge
+	a.drift.ntClose(notification.BaseID, notification.NTInstrumentSymbol, notification.ClosedHedgeAction, notification.ClosedHedgeQuantity)
 	if notification.ClosedHedgeAction == "sell" { // NT sold (closed long), so reduce net long position
 		a.netNT -= int(notification.ClosedHedgeQuantity)
 		log.Printf("NT closed %.2f long contracts. Net position: %d → %d", notification.ClosedHedgeQuantity, oldNT, a.netNT)
@@ -549,81 +890,47 @@ func (a *App) handleNTCloseHedgeRequest(w http.ResponseWriter, r *http.Request)
 		log.Printf("New hedge size: %.2f", desiredHedgeLot)
 		a.hedgeLot = desiredHedgeLot
 	}
+	a.recordAuditLocked(auditNTClose, "nt", map[string]interface{}{
+		"base_id": notification.BaseID, "quantity": notification.ClosedHedgeQuantity, "action": notification.ClosedHedgeAction,
+		"instrument": notification.NTInstrumentSymbol, "account": notification.NTAccountName,
+		"net_before": oldNT, "hedge_before": oldHedge,
+	})
 	a.queueMux.Unlock()
 
 	// Emit event to UI to update displayed position/hedge size
-	runtime.EventsEmit(a.ctx, "positionUpdated", map[string]interface{}{"net_position": a.netNT, "hedge_size": a.hedgeLot})
-
-	// Add a special message to the trade queue so MT5 can pick it up and close hedges
-	closureTradeMessage := Trade{
-		ID:            fmt.Sprintf("nt_close_%s_%d", notification.BaseID, time.Now().Unix()),
-		BaseID:        notification.BaseID,
-		Time:          time.Now(),
-		Action:        "CLOSE_HEDGE", // Special action to indicate hedge closure
-		Quantity:      notification.ClosedHedgeQuantity,
-		Price:         0, // Not relevant for closures
-		TotalQuantity: int(notification.ClosedHedgeQuantity),
-		ContractNum:   1,
-		Instrument:    notification.NTInstrumentSymbol,
-		AccountName:   notification.NTAccountName,
-		OrderType:     "NT_CLOSE",
-	}
-
-	log.Printf("CLOSURE_DEBUG: Attempting to queue CLOSE_HEDGE message for MT5. BaseID: %s, Action: %s, Quantity: %.2f",
-		notification.BaseID, closureTradeMessage.Action, closureTradeMessage.Quantity)
-
-	select {
-	case a.tradeQueue <- closureTradeMessage:
-		log.Printf("CLOSURE_SUCCESS: NT hedge closure request queued for MT5. BaseID: %s, Queue size now: %d",
-			notification.BaseID, len(a.tradeQueue))
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]string{"status": "success", "message": "NT closure request queued for MT5"})
-	default:
-		log.Printf("CLOSURE_ERROR: Queue full, NT closure request not processed for BaseID: %s. Current queue size: %d",
-			notification.BaseID, len(a.tradeQueue))
-		http.Error(w, "queue full", http.StatusServiceUnavailable)
-	}
+	a.emit("positionUpdated", map[string]interface{}{"net_position": a.netNT, "hedge_size": a.hedgeLot})
 }
 
 // handleMT5TradeResult handles trade execution results from MT5 EA
 func (a *App) handleMT5TradeResult(w http.ResponseWriter, r *http.Request) {
 	log.Println("DEBUG: Entered handleMT5TradeResult")
 
-	if r.Method != http.MethodPost {
-		log.Printf("ERROR: Invalid request method for /mt5/trade_result: %s. Expected POST.", r.Method)
-		http.Error(w, "Invalid request method. Only POST is allowed.", http.StatusMethodNotAllowed)
+	if !requireMethod(w, r, http.MethodPost) {
 		return
 	}
-	defer r.Body.Close() // Ensure the request body is closed
 
 	var tradeResult MT5TradeResult
-	// It's good practice to limit the size of the request body to prevent potential DoS attacks.
-	// For example: r.Body = http.MaxBytesReader(w, r.Body, 1024*10) // 10KB limit
-
-	// Decode the JSON payload
-	err := json.NewDecoder(r.Body).Decode(&tradeResult)
-	if err != nil {
-		// If decoding fails, the body might have already been partially read or be in an error state.
-		log.Printf("ERROR: Failed to decode JSON from /mt5/trade_result: %v. Check incoming payload.", err)
-		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+	// Decode and validate the JSON payload
+	if _, ok := decodeBody(w, r, "MT5TradeResult", &tradeResult); !ok {
 		return
 	}
 
 	log.Printf("Received MT5 Trade Result: Status: '%s', Ticket: %d, Volume: %.2f, IsClose: %t, ID: '%s'",
 		tradeResult.Status, tradeResult.Ticket, tradeResult.Volume, tradeResult.IsClose, tradeResult.ID)
+	a.drift.result(tradeResult)
+	a.recordExecution(tradeResult)
+	a.manual.ownTicket(tradeResult.Ticket)
 
 	// Respond to the MT5 EA
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
-	_, writeErr := w.Write([]byte("MT5 trade result received"))
-	if writeErr != nil {
-		// Log error if writing response fails, but status has already been sent.
-		log.Printf("ERROR: Failed to write response body for /mt5/trade_result: %v", writeErr)
-	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success", "message": "MT5 trade result received"})
 }
 
 // healthHandler provides status information
 func (a *App) healthHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet, http.MethodHead) {
+		return
+	}
+
 	// Read source query parameter
 	sourceQuery := r.URL.Query().Get("source") // e.g., "hedgebot", "addon", or ""
 
@@ -646,10 +953,10 @@ func (a *App) healthHandler(w http.ResponseWriter, r *http.Request) {
 
 		// Emit status change event if it happened
 		if statusChanged {
-			runtime.EventsEmit(a.ctx, "hedgebotStatusChanged", map[string]interface{}{"active": true})
+			a.emit("hedgebotStatusChanged", map[string]interface{}{"active": true})
 		}
 		// Emit a specific event for hedgebot ping success
-		runtime.EventsEmit(a.ctx, "hedgebotPingSuccess") // New event for hedgebot
+		a.emit("hedgebotPingSuccess") // New event for hedgebot
 
 		// --- Process open_positions from HedgeBot ---
 		openPositionsStr := r.URL.Query().Get("open_positions")
@@ -660,10 +967,14 @@ func (a *App) healthHandler(w http.ResponseWriter, r *http.Request) {
 					a.queueMux.Lock() // Acquire lock before modifying shared state
 					if a.netNT != 0 || a.hedgeLot != 0.0 {
 						log.Println("DEBUG: HedgeBot reported 0 open positions. Resetting net position and hedge size.")
+						netBefore, hedgeBefore := a.netNT, a.hedgeLot
 						a.netNT = 0
 						a.hedgeLot = 0.0
+						a.recordAuditLocked(auditHedgebotReset, "hedgebot", map[string]interface{}{
+							"open_positions": openPositions, "net_before": netBefore, "hedge_before": hedgeBefore,
+						})
 						// Optionally emit an event to the UI to force an update
-						runtime.EventsEmit(a.ctx, "positionReset", map[string]interface{}{"net_position": 0, "hedge_size": 0.0})
+						a.emit("positionReset", map[string]interface{}{"net_position": 0, "hedge_size": 0.0})
 					}
 					a.queueMux.Unlock() // Release lock
 				}
@@ -689,7 +1000,7 @@ func (a *App) healthHandler(w http.ResponseWriter, r *http.Request) {
 		// --- End Addon connection tracking ---
 
 		// Emit event ONLY for successful ADDON ping
-		runtime.EventsEmit(a.ctx, "addonPingSuccess") // Moved inside Addon condition
+		a.emit("addonPingSuccess") // Moved inside Addon condition
 
 	} else {
 		// Log pings from unknown sources
@@ -697,14 +1008,26 @@ func (a *App) healthHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Prepare status response
+	rateLimited, tooLarge := a.limiter.totals()
 	a.queueMux.Lock() // Lock for accessing queue/trade state
+	qs := a.tradeQueue.stats()
 	status := map[string]interface{}{
-		"status":       "healthy",
-		"queue_size":   len(a.tradeQueue),
-		"net_position": a.netNT,
-		"hedge_size":   a.hedgeLot,
+		"status":               "healthy",
+		"queue_size":           a.tradeQueue.len(),
+		"queue_depths":         qs.Depths, // per priority lane, memory and disk
+		"queue_spilled":        qs.Spilled,
+		"queue_spill_bytes":    qs.SpillBytes,
+		"queue_oldest_age_ms":  qs.OldestAge.Milliseconds(),
+		"queue_unacked":        a.batches.unacked(), // sent in a batch, not yet acknowledged
+		"paused":               a.control.isPaused(),
+		"session_held":         a.sessions.heldCount(), // waiting for their MT5 session to open
+		"expired_total":        a.ttl.expiredTotal(),   // dropped or netted for exceeding their TTL
+		"rate_limited_total":   rateLimited,            // refused 429 for calling too often
+		"body_too_large_total": tooLarge,               // refused 413 for an oversized body
+		"net_position":         a.netNT,
+		"hedge_size":           a.hedgeLot,
 	}
-	queueSize := len(a.tradeQueue) // Get values while locked
+	queueSize := a.tradeQueue.len() // Get values while locked
 	netPosition := a.netNT
 	hedgeSize := a.hedgeLot
 	a.queueMux.Unlock() // Unlock queueMux
@@ -718,21 +1041,23 @@ func (a *App) healthHandler(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Current hedge size: %.2f", hedgeSize)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(status)
+	writeJSON(w, http.StatusOK, status)
 }
 
 // GetStatus returns the current status for the UI
 func (a *App) GetStatus() map[string]interface{} {
 	// log.Println("DEBUG: Entered GetStatus")
+	rateLimited, tooLarge := a.limiter.totals()
 	a.queueMux.Lock()
 	// Read fields protected by queueMux
 	bridgeActive := a.bridgeActive
+	bridgeError := a.bridgeError
+	listenAddr := a.listenAddr
 	// hedgebotConnected removed
 	netPosition := a.netNT
 	hedgeSize := a.hedgeLot
-	queueSize := len(a.tradeQueue)
+	queueSize := a.tradeQueue.len()
+	qs := a.tradeQueue.stats()
 	// hedgebotActive read below under its own mutex
 	tradeLogSenderActive := a.tradeLogSenderActive
 	a.queueMux.Unlock() // Unlock queueMux as soon as its protected fields are read
@@ -751,13 +1076,32 @@ func (a *App) GetStatus() map[string]interface{} {
 
 	return map[string]interface{}{
 		"bridgeActive": bridgeActive,
+		"bridgeError":  bridgeError, // why the bridge isn't serving: port taken, another instance running
+		"listenAddr":   listenAddr,  // the address actually bound; may be fallback_listen_addr
 		// "hedgebotConnected":    hedgebotConnected, // Removed
 		"addonConnected":       addonConnected, // Existing Addon status - UNCHANGED
 		"netPosition":          netPosition,
 		"hedgeSize":            hedgeSize,
 		"queueSize":            queueSize,
-		"hedgebotActive":       hedgebotActive, // New HedgeBot status (set once)
+		"queueDepths":          qs.Depths,  // per priority lane: close, entry, info
+		"queueSpilled":         qs.Spilled, // messages overflowed to disk
+		"queueSpillBytes":      qs.SpillBytes,
+		"queueOldestAgeMs":     qs.OldestAge.Milliseconds(), // how long the oldest queued message has waited
+		"queueUnacked":         a.batches.unacked(),         // batch sent to MT5, not yet acknowledged
+		"fillsHeld":            a.aggregator.held(),         // contracts waiting for the rest of their fill
+		"driftAlerts":          a.drift.alerting(),          // instruments whose hedge has drifted past the grace period
+		"riskHeld":             len(a.risk.heldTrades()),    // trades waiting for manual approval
+		"control":              a.control.status(),          // kill switch: paused, flatten_pending
+		"sessionHeld":          a.sessions.heldCount(),      // waiting for their MT5 session to open
+		"expired":              a.ttl.expiredTotal(),        // too old to execute, dropped or netted
+		"rateLimited":          rateLimited,                 // requests refused 429 for calling too often
+		"bodyTooLarge":         tooLarge,                    // requests refused 413 for an oversized body
+		"targets":              a.targetStatus(),            // routing targets with their queue depth
+		"hedgebotActive":       hedgebotActive,              // New HedgeBot status (set once)
 		"tradeLogSenderActive": tradeLogSenderActive,
+		"sequenceGaps":         a.sequences.outstandingGaps(), // NT messages known to be missing
+		"bridgeSeq":            a.bridgeSeq.Load(),            // Last sequence handed to MT5
+		"auditWarning":         a.auditWarning(),              // audit log broken on opening, or unsigned
 	}
 }
 
@@ -768,9 +1112,7 @@ func (a *App) GetTradeHistory() []Trade {
 
 // shutdown is called when the app is closing
 func (a *App) shutdown(ctx context.Context) {
-	if a.server != nil {
-		a.server.Shutdown(ctx)
-	}
+	a.gracefulShutdown(a.shutdownTimeout())
 }
 
 // AttemptReconnect tries to re-establish connections based on input flags.
@@ -819,22 +1161,15 @@ func (a *App) AttemptReconnect(retryBridge bool, retryHedgebot bool, retryAddon
 			}
 			a.queueMux.Unlock() // Unlock before calling startServer which manages its own state
 
-			a.startServer() // This starts the server in a new goroutine and sets bridgeActive
-
-			// Give the server goroutine a moment to start and update status
-			time.Sleep(200 * time.Millisecond)
-
-			a.queueMux.Lock() // Lock again to read the updated status
-			if a.bridgeActive {
+			if err := a.startServer(); err != nil {
+				bridgeStatus.success = false
+				bridgeStatus.message = "Failed to restart Bridge server: " + err.Error()
+				log.Println("Bridge server restart failed.")
+			} else {
 				bridgeStatus.success = true
 				bridgeStatus.message = "Bridge server restarted successfully."
 				log.Println("Bridge server restart successful.")
-			} else {
-				bridgeStatus.success = false
-				bridgeStatus.message = "Failed to restart Bridge server. Check logs for errors."
-				log.Println("Bridge server restart failed.")
 			}
-			a.queueMux.Unlock()
 		}
 	} else {
 		bridgeStatus.attempted = false
@@ -887,46 +1222,44 @@ func (a *App) AttemptReconnect(retryBridge bool, retryHedgebot bool, retryAddon
 	// --- Handle Addon Reconnection ---
 	if retryAddon || (!retryBridge && !retryHedgebot && !retryAddon) {
 		addonStatus.attempted = true
-		addonPingURL := "http://localhost:8081/ping_msm" // TODO: Make this configurable
 		client := http.Client{
 			Timeout: 5 * time.Second,
 		}
 
-		log.Printf("Attempting to ping Addon/Transmitter at %s", addonPingURL)
-		resp, err := client.Get(addonPingURL)
+		// Ping every registered addon instance, or the default URL when none registered
+		var failures []string
+		for _, base := range a.addonURLs() {
+			addonPingURL := base + "/ping_msm"
+			log.Printf("Attempting to ping Addon/Transmitter at %s", addonPingURL)
+			resp, err := client.Get(addonPingURL)
+			if err != nil {
+				log.Printf("Addon/Transmitter ping failed: %v", err)
+				failures = append(failures, fmt.Sprintf("Addon/Transmitter ping failed: %v", err))
+				continue
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				errMsg := fmt.Sprintf("Addon/Transmitter ping to %s failed: received status code %d", base, resp.StatusCode)
+				log.Println(errMsg)
+				failures = append(failures, errMsg)
+			}
+		}
 
-		if err != nil {
-			log.Printf("Addon/Transmitter ping failed: %v", err)
+		if len(failures) > 0 {
 			a.addonStatusMux.Lock()
 			a.addonConnected = false
 			a.addonStatusMux.Unlock()
 
 			addonStatus.success = false
-			addonStatus.message = fmt.Sprintf("Addon/Transmitter ping failed: %v", err)
-			runtime.EventsEmit(a.ctx, "addonRetryResult", map[string]interface{}{"success": false, "message": addonStatus.message})
+			addonStatus.message = strings.Join(failures, "; ")
+			a.emit("addonRetryResult", map[string]interface{}{"success": false, "message": addonStatus.message})
 		} else {
-			defer resp.Body.Close()
-			if resp.StatusCode == http.StatusOK {
-				log.Println("Addon/Transmitter ping successful.")
-				a.addonStatusMux.Lock()
-				a.addonConnected = true
-				a.lastAddonRequestTime = time.Now()
-				a.addonStatusMux.Unlock()
-
-				addonStatus.success = true
-				addonStatus.message = "Addon/Transmitter ping successful."
-				runtime.EventsEmit(a.ctx, "addonRetryResult", map[string]interface{}{"success": true, "message": addonStatus.message})
-			} else {
-				errMsg := fmt.Sprintf("Addon/Transmitter ping failed: received status code %d", resp.StatusCode)
-				log.Println(errMsg)
-				a.addonStatusMux.Lock()
-				a.addonConnected = false
-				a.addonStatusMux.Unlock()
+			log.Println("Addon/Transmitter ping successful.")
+			a.addonSeen()
 
-				addonStatus.success = false
-				addonStatus.message = errMsg
-				runtime.EventsEmit(a.ctx, "addonRetryResult", map[string]interface{}{"success": false, "message": addonStatus.message})
-			}
+			addonStatus.success = true
+			addonStatus.message = "Addon/Transmitter ping successful."
+			a.emit("addonRetryResult", map[string]interface{}{"success": true, "message": addonStatus.message})
 		}
 	} else {
 		addonStatus.attempted = false
@@ -936,5 +1269,9 @@ func (a *App) AttemptReconnect(retryBridge bool, retryHedgebot bool, retryAddon
 	results["addon"] = addonStatus
 
 	log.Printf("AttemptReconnect results: %+v", results)
+	a.auditOperatorAction("reconnect", map[string]interface{}{
+		"bridge": retryBridge, "hedgebot": retryHedgebot, "addon": retryAddon,
+		"bridge_ok": bridgeStatus.success, "hedgebot_ok": hedgebotStatus.success, "addon_ok": addonStatus.success,
+	}, nil)
 	return results
 }
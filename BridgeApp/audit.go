@@ -0,0 +1,475 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// auditFileName is the append-only audit log inside the data directory
+const auditFileName = "audit.jsonl"
+
+// Audit entry kinds
+const (
+	auditNTFill         = "nt_fill"         // NT fill changed the net position
+	auditNTClose        = "nt_close"        // NT closed a position
+	auditMT5Closure     = "mt5_closure"     // MT5 closed a hedge
+	auditMT5Handout     = "mt5_handout"     // a message was handed to the EA
+	auditClosureForward = "closure_forward" // an MT5 closure was forwarded to NT, or given up on
+	auditHedgebotReset  = "hedgebot_reset"  // the EA reported no open positions and the position was reset
+	auditManualMirror   = "manual_mirror"   // a manual MT5 trade was booked as its NT mirror
+	auditOperator       = "operator"        // pause, resume, flatten, approve, discard, command, reconnect
+	auditAdminRequest   = "admin_request"   // an operator call on /v1/admin
+	auditRestore        = "restore"         // the position was restored from state.json
+	auditShutdown       = "shutdown"        // the bridge shut down
+	auditChainBreak     = "chain_break"     // the log failed verification on opening; the chain continues past the break
+)
+
+// AuditConfig controls the audit log
+type AuditConfig struct {
+	// Disabled turns the audit log off; it is on by default
+	Disabled bool `json:"disabled" yaml:"disabled"`
+	// Key signs each entry with HMAC-SHA256. Without one, entries are chained
+	// with plain SHA-256. BRIDGE_AUDIT_KEY overrides it.
+	Key string `json:"key" yaml:"key"`
+}
+
+func (c *AuditConfig) normalize() {
+	if k := os.Getenv("BRIDGE_AUDIT_KEY"); k != "" {
+		c.Key = k
+	}
+}
+
+// AuditEntry is one state-changing action and the position after it
+type AuditEntry struct {
+	Seq         uint64                 `json:"seq"`
+	Time        time.Time              `json:"time"`
+	Kind        string                 `json:"kind"`
+	Actor       string                 `json:"actor"` // nt, mt5, hedgebot, bridge, operator, or admin <address>
+	Detail      map[string]interface{} `json:"detail,omitempty"`
+	NetPosition int                    `json:"net_position"`
+	HedgeSize   float64                `json:"hedge_size"`
+	Prev        string                 `json:"prev"` // hash of the previous entry; empty for the first
+}
+
+// auditLine is how an entry is stored: its exact bytes and their hash, which
+// covers the previous entry's hash through Prev
+type auditLine struct {
+	Entry json.RawMessage `json:"entry"`
+	Hash  string          `json:"hash"`
+}
+
+// auditLog appends hash-chained entries to audit.jsonl. Entries are chained in
+// the caller's order but written and synced by a writer goroutine, so callers
+// holding queueMux never wait for the disk.
+type auditLog struct {
+	mu      sync.Mutex
+	path    string
+	key     []byte
+	file    *os.File
+	seq     uint64
+	head    string   // hash of the last entry
+	pending [][]byte // chained lines not yet written
+	wake    chan struct{}
+	closing bool
+	writer  sync.Mutex // held while lines are written, and while the file is verified
+	done    chan struct{}
+	broken  *AuditBreak // the break found on opening, if any
+}
+
+// AuditBreak is a log that failed verification when the bridge opened it. The
+// broken file is kept as it was, and the new log's first entry, a chain_break,
+// names the last verified entry's hash, so the chain carries on from there and
+// the break itself is on record.
+type AuditBreak struct {
+	Time     time.Time `json:"time"`
+	File     string    `json:"file"` // where the broken log was moved
+	Line     int       `json:"line"`
+	Problem  string    `json:"problem"`
+	LastSeq  uint64    `json:"last_seq"` // last entry verified before the break
+	LastHash string    `json:"last_hash"`
+}
+
+// openAuditLog opens path for appending and picks up the chain where it ends.
+// A last line cut short by a crash is moved to a .torn file and truncated. A
+// log broken anywhere else is moved to a .broken file and a new log is started
+// with a chain_break entry continuing the chain from its last verified entry,
+// so nothing is appended to a line that can't be verified and the break stays
+// on record.
+func openAuditLog(path string, key string) (*auditLog, error) {
+	l := &auditLog{path: path, key: []byte(key), wake: make(chan struct{}, 1), done: make(chan struct{})}
+	res, err := verifyAuditLog(path, key)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+	switch {
+	case !res.OK && res.tornTail:
+		torn := fmt.Sprintf("%s.torn-%s", path, stamp)
+		log.Printf("WARNING: AUDIT: %s ends with a partial line %d (%s), left by a write cut short; moved to %s", path, res.BrokenLine, res.Problem, torn)
+		if err := saveAuditTail(path, res.validBytes, torn); err != nil {
+			return nil, err
+		}
+		if err := os.Truncate(path, res.validBytes); err != nil {
+			return nil, err
+		}
+	case !res.OK:
+		broken := fmt.Sprintf("%s.broken-%s", path, stamp)
+		log.Printf("ERROR: AUDIT: %s failed verification at line %d: %s. Moved to %s; the chain continues from seq %d with a chain_break entry.",
+			path, res.BrokenLine, res.Problem, broken, res.LastSeq)
+		if err := os.Rename(path, broken); err != nil {
+			return nil, err
+		}
+		l.broken = &AuditBreak{Time: time.Now().UTC(), File: broken, Line: res.BrokenLine, Problem: res.Problem, LastSeq: res.LastSeq, LastHash: res.LastHash}
+		res.unterminated = false
+	}
+	l.seq, l.head = res.LastSeq, res.LastHash
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	if l.file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644); err != nil {
+		return nil, err
+	}
+	if res.unterminated {
+		l.pending = append(l.pending, nil) // ends the last entry's line before the next
+	}
+	go l.run()
+	if b := l.broken; b != nil {
+		l.append(AuditEntry{Time: b.Time, Kind: auditChainBreak, Actor: "bridge", Detail: map[string]interface{}{
+			"broken_file": filepath.Base(b.File), "broken_line": b.Line, "problem": b.Problem, "last_seq": b.LastSeq, "last_hash": b.LastHash,
+		}})
+	}
+	return l, nil
+}
+
+// saveAuditTail copies what follows the first n bytes of path to dest
+func saveAuditTail(path string, n int64, dest string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if n > int64(len(data)) {
+		n = int64(len(data))
+	}
+	return os.WriteFile(dest, data[n:], 0o644)
+}
+
+// auditHash hashes an entry's bytes, signed with key when there is one
+func auditHash(key []byte, entry []byte) string {
+	var h hash.Hash
+	if len(key) > 0 {
+		h = hmac.New(sha256.New, key)
+	} else {
+		h = sha256.New()
+	}
+	h.Write(entry)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// append chains e to the log and hands it to the writer
+func (l *auditLog) append(e AuditEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closing {
+		return fmt.Errorf("audit log %s is closed", l.path)
+	}
+	e.Seq = l.seq + 1
+	e.Prev = l.head
+	entry, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(auditLine{Entry: entry, Hash: auditHash(l.key, entry)})
+	if err != nil {
+		return err
+	}
+	l.pending = append(l.pending, line)
+	l.seq, l.head = e.Seq, auditHash(l.key, entry)
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// run writes pending lines until the log is closed
+func (l *auditLog) run() {
+	defer close(l.done)
+	for range l.wake {
+		l.flush()
+	}
+}
+
+// flush writes and syncs the lines chained so far
+func (l *auditLog) flush() {
+	l.writer.Lock()
+	defer l.writer.Unlock()
+	l.mu.Lock()
+	lines, file := l.pending, l.file
+	l.pending = nil
+	l.mu.Unlock()
+	if len(lines) == 0 || file == nil {
+		return
+	}
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	_, err := file.Write(buf.Bytes())
+	if err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		log.Printf("ERROR: AUDIT: Could not write %d entr(ies) to %s: %v", len(lines), l.path, err)
+	}
+}
+
+// verify checks the chain on disk once everything appended so far is written
+func (l *auditLog) verify() (AuditVerification, error) {
+	l.flush()
+	l.writer.Lock()
+	defer l.writer.Unlock()
+	return verifyAuditLog(l.path, string(l.key))
+}
+
+// close stops appending and writes what is pending
+func (l *auditLog) close() {
+	l.mu.Lock()
+	if l.closing {
+		l.mu.Unlock()
+		return
+	}
+	l.closing = true
+	close(l.wake)
+	l.mu.Unlock()
+	<-l.done
+	l.flush()
+	l.mu.Lock()
+	l.file.Close()
+	l.file = nil
+	l.mu.Unlock()
+}
+
+// AuditVerification is the outcome of checking an audit log's chain
+type AuditVerification struct {
+	OK         bool   `json:"ok"`
+	Entries    int    `json:"entries"`
+	LastSeq    uint64 `json:"last_seq"`
+	LastHash   string `json:"last_hash"` // note it down; a log cut short before it no longer ends with it
+	Signed     bool   `json:"signed"`    // checked against a key
+	BrokenLine int    `json:"broken_line,omitempty"`
+	Problem    string `json:"problem,omitempty"`
+	// ContinuesFrom is the hash of the last verified entry of a broken log
+	// that this one carries on from, as its first entry, a chain_break, names
+	ContinuesFrom string `json:"continues_from,omitempty"`
+
+	validBytes   int64 // length of the verified lines
+	unterminated bool  // the last verified line has no newline
+	tornTail     bool  // the broken line is the last one, has no newline and isn't whole JSON: a write cut short
+}
+
+// verifyAuditLog checks every line of the audit log at path: each hash must
+// match its entry, each entry must name the previous hash, and sequence
+// numbers must follow on. It stops at the first broken line.
+func verifyAuditLog(path string, key string) (AuditVerification, error) {
+	res := AuditVerification{OK: true, Signed: key != ""}
+	f, err := os.Open(path)
+	if err != nil {
+		return res, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	for n := 1; ; n++ {
+		raw, err := r.ReadBytes('\n')
+		if err == io.EOF && len(raw) == 0 {
+			return res, nil
+		}
+		if err != nil && err != io.EOF {
+			return res, err
+		}
+		line := bytes.TrimRight(raw, "\r\n")
+		if problem := res.check(key, line); problem != "" {
+			res.OK, res.BrokenLine, res.Problem = false, n, problem
+			// A complete entry missing only its newline was edited, not torn
+			res.tornTail = err == io.EOF && !json.Valid(line)
+			return res, nil
+		}
+		res.validBytes += int64(len(raw))
+		res.unterminated = err == io.EOF
+	}
+}
+
+// check verifies one line against the chain so far and advances it
+func (res *AuditVerification) check(key string, raw []byte) string {
+	var line auditLine
+	if err := json.Unmarshal(raw, &line); err != nil || len(line.Entry) == 0 {
+		return "not an audit entry"
+	}
+	var e AuditEntry
+	if err := json.Unmarshal(line.Entry, &e); err != nil {
+		return "entry is not valid JSON: " + err.Error()
+	}
+	if want := auditHash([]byte(key), line.Entry); !hmac.Equal([]byte(want), []byte(line.Hash)) {
+		if key != "" {
+			return fmt.Sprintf("seq %d: hash does not match the entry (edited, or signed with another key)", e.Seq)
+		}
+		return fmt.Sprintf("seq %d: hash does not match the entry (edited, or the log is signed and needs its key)", e.Seq)
+	}
+	if res.Entries == 0 && e.Kind == auditChainBreak && e.Prev != "" && e.Seq > 0 {
+		// The log carries on from a broken one: its chain starts at the last
+		// entry verified there
+		res.ContinuesFrom = e.Prev
+		res.LastSeq, res.LastHash = e.Seq-1, e.Prev
+	}
+	if e.Prev != res.LastHash {
+		return fmt.Sprintf("seq %d: previous hash %.12s does not match %.12s (an entry was removed or reordered)", e.Seq, e.Prev, res.LastHash)
+	}
+	if e.Seq != res.LastSeq+1 {
+		return fmt.Sprintf("seq %d follows seq %d", e.Seq, res.LastSeq)
+	}
+	res.Entries++
+	res.LastSeq, res.LastHash = e.Seq, line.Hash
+	return ""
+}
+
+// openAudit opens the audit log of the data directory, unless it is disabled
+func (a *App) openAudit() {
+	if a.config.Audit.Disabled {
+		return
+	}
+	a.config.Audit.normalize() // BRIDGE_AUDIT_KEY, also for configs that weren't loaded from a file
+	path := filepath.Join(a.config.DataDir, auditFileName)
+	if a.config.Audit.Key == "" {
+		log.Printf("WARNING: AUDIT: No audit key is set (audit.key or BRIDGE_AUDIT_KEY). %s is chained with plain SHA-256, "+
+			"which anyone able to edit the file can recompute: it shows accidental damage, not deliberate tampering.", path)
+	}
+	l, err := openAuditLog(path, a.config.Audit.Key)
+	if err != nil {
+		log.Printf("ERROR: AUDIT: Could not open the audit log: %v. Actions are not audited.", err)
+		return
+	}
+	a.audit = l
+}
+
+// auditWarning describes what undermines the audit log, for the UI: a break
+// found on opening, or the lack of a key. It is empty when there is nothing to report.
+func (a *App) auditWarning() string {
+	if a.audit == nil {
+		return ""
+	}
+	if b := a.audit.broken; b != nil {
+		return fmt.Sprintf("Audit log failed verification at line %d (%s) and was moved to %s; the chain continues from seq %d",
+			b.Line, b.Problem, filepath.Base(b.File), b.LastSeq)
+	}
+	if len(a.audit.key) == 0 {
+		return "Audit log is not signed; set audit.key or BRIDGE_AUDIT_KEY to make tampering detectable"
+	}
+	return ""
+}
+
+// recordAudit appends an entry with the current position
+func (a *App) recordAudit(kind, actor string, detail map[string]interface{}) {
+	a.queueMux.Lock()
+	defer a.queueMux.Unlock()
+	a.recordAuditLocked(kind, actor, detail)
+}
+
+// recordAuditLocked appends an entry with the current position; queueMux is
+// held, so the entry lands in the order the position changed
+func (a *App) recordAuditLocked(kind, actor string, detail map[string]interface{}) {
+	if a.audit == nil {
+		return
+	}
+	e := AuditEntry{Time: time.Now().UTC(), Kind: kind, Actor: actor, Detail: detail, NetPosition: a.netNT, HedgeSize: a.hedgeLot}
+	if err := a.audit.append(e); err != nil {
+		log.Printf("ERROR: AUDIT: Could not record %s by %s: %v", kind, actor, err)
+	}
+}
+
+// auditOperatorAction records an operator action and its outcome
+func (a *App) auditOperatorAction(action string, detail map[string]interface{}, result map[string]interface{}) {
+	if detail == nil {
+		detail = make(map[string]interface{})
+	}
+	detail["action"] = action
+	if status, ok := result["status"]; ok {
+		detail["status"] = status
+	}
+	if msg, ok := result["message"]; ok {
+		detail["message"] = msg
+	}
+	a.recordAudit(auditOperator, "operator", detail)
+}
+
+// auditHandout records a message handed to the EA; queueMux must not be held
+func (a *App) auditHandout(payload map[string]interface{}) {
+	detail := make(map[string]interface{})
+	for _, k := range []string{"bridge_seq", "id", "base_id", "action", "quantity", "mt5_action", "lot_size", "target", "nt_instrument_symbol", "nt_account_name"} {
+		if v, ok := payload[k]; ok {
+			detail[k] = v
+		}
+	}
+	a.recordAudit(auditMT5Handout, "bridge", detail)
+}
+
+// auditClosureForward records how forwarding an MT5 closure to NT ended:
+// delivered, failed, or saved for redelivery by shutdown
+func (a *App) auditClosureForward(f *closureForward, url string, attempts int, outcome, status string) {
+	a.recordAudit(auditClosureForward, "bridge", map[string]interface{}{
+		"base_id": f.BaseID, "account": f.Account, "addon_url": url, "attempts": attempts, "outcome": outcome, "status": status,
+	})
+}
+
+// auditHandler verifies the audit log: GET /v1/audit/verify
+func (a *App) auditHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	if a.audit == nil {
+		writeAPIError(w, http.StatusNotFound, errCodeNotFound, "The audit log is disabled")
+		return
+	}
+	res, err := a.audit.verify()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, errCodeInternal, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// runAuditVerifyCLI verifies the audit log at path, or in the data directory
+// path names, and prints the result. The exit code is 0 only for an intact chain.
+func runAuditVerifyCLI(path string, key string, out io.Writer) int {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, auditFileName)
+	}
+	res, err := verifyAuditLog(path, key)
+	if err != nil {
+		fmt.Fprintf(out, "audit log %s: %v\n", path, err)
+		return 2
+	}
+	signed := "unsigned (SHA-256)"
+	if res.Signed {
+		signed = "signed (HMAC-SHA256)"
+	}
+	if !res.OK {
+		fmt.Fprintf(out, "BROKEN  %s, %s: line %d: %s\n", path, signed, res.BrokenLine, res.Problem)
+		fmt.Fprintf(out, "        %d entries verified before it, last seq %d, hash %s\n", res.Entries, res.LastSeq, res.LastHash)
+		return 1
+	}
+	fmt.Fprintf(out, "OK      %s, %s: %d entries, last seq %d, head %s\n", path, signed, res.Entries, res.LastSeq, res.LastHash)
+	return 0
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeAuditLog writes a chain of n entries to a new audit log and returns its path
+func writeAuditLog(t *testing.T, key string, n int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), auditFileName)
+	l, err := openAuditLog(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.close()
+	for i := 0; i < n; i++ {
+		if err := l.append(AuditEntry{Kind: auditNTFill, Actor: "nt", NetPosition: i + 1, HedgeSize: float64(i + 1)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func TestVerifyAuditLog(t *testing.T) {
+	lines := func(data []byte) [][]byte { return bytes.SplitAfter(data, []byte("\n")) }
+	tests := []struct {
+		name       string
+		key        string // the log is signed with "secret" and verified with key
+		tamper     func(data []byte) []byte
+		ok         bool
+		entries    int
+		brokenLine int
+	}{
+		{"intact", "secret", nil, true, 3, 0},
+		{"edited entry", "secret", func(data []byte) []byte {
+			return bytes.Replace(data, []byte(`"net_position":2`), []byte(`"net_position":9`), 1)
+		}, false, 1, 2},
+		{"removed entry", "secret", func(data []byte) []byte {
+			l := lines(data)
+			return bytes.Join(append(l[:1:1], l[2:]...), nil)
+		}, false, 1, 2},
+		{"reordered entries", "secret", func(data []byte) []byte {
+			l := lines(data)
+			return bytes.Join([][]byte{l[1], l[0], l[2]}, nil)
+		}, false, 0, 1},
+		{"truncated mid-line", "secret", func(data []byte) []byte {
+			return data[:len(data)-20]
+		}, false, 2, 3},
+		{"truncated at a line end", "secret", func(data []byte) []byte {
+			l := lines(data)
+			return bytes.Join(l[:2], nil)
+		}, true, 2, 0},
+		{"wrong key", "other", nil, false, 0, 1},
+		{"signed log checked without a key", "", nil, false, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeAuditLog(t, "secret", 3)
+			if tt.tamper != nil {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, tt.tamper(data), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			res, err := verifyAuditLog(path, tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.OK != tt.ok || res.Entries != tt.entries || res.BrokenLine != tt.brokenLine {
+				t.Errorf("verify = ok %v, %d entries, broken line %d (%s); want ok %v, %d entries, broken line %d",
+					res.OK, res.Entries, res.BrokenLine, res.Problem, tt.ok, tt.entries, tt.brokenLine)
+			}
+		})
+	}
+}
+
+func TestVerifyAuditLogMissing(t *testing.T) {
+	if _, err := verifyAuditLog(filepath.Join(t.TempDir(), auditFileName), ""); !os.IsNotExist(err) {
+		t.Errorf("err = %v, want not exist", err)
+	}
+}
+
+func TestOpenAuditLogRepairs(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  func(data []byte) []byte
+		entries int // in the log after one more entry is appended
+		moved   bool
+		torn    bool // the cut-off bytes are kept in a .torn file
+	}{
+		{"partial last line is truncated", func(data []byte) []byte { return data[:len(data)-20] }, 3, false, true},
+		{"missing final newline is added", func(data []byte) []byte { return data[:len(data)-1] }, 4, false, false},
+		// chain_break and the appended entry, continuing from seq 1
+		{"broken chain is moved aside", func(data []byte) []byte {
+			return bytes.Replace(data, []byte(`"net_position":2`), []byte(`"net_position":9`), 1)
+		}, 2, true, false},
+		{"edited last entry without its newline is moved aside", func(data []byte) []byte {
+			return bytes.Replace(data[:len(data)-1], []byte(`"net_position":3`), []byte(`"net_position":9`), 1)
+		}, 2, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeAuditLog(t, "secret", 3)
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, tt.tamper(data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			l, err := openAuditLog(path, "secret")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := l.append(AuditEntry{Kind: auditShutdown, Actor: "bridge"}); err != nil {
+				t.Fatal(err)
+			}
+			l.close()
+			res, err := verifyAuditLog(path, "secret")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !res.OK || res.Entries != tt.entries {
+				t.Errorf("verify = ok %v, %d entries (line %d: %s); want ok, %d entries", res.OK, res.Entries, res.BrokenLine, res.Problem, tt.entries)
+			}
+			moved, _ := filepath.Glob(path + ".broken-*")
+			if (len(moved) > 0) != tt.moved {
+				t.Errorf("moved aside: %v, want %v", moved, tt.moved)
+			}
+			if torn, _ := filepath.Glob(path + ".torn-*"); (len(torn) > 0) != tt.torn {
+				t.Errorf("torn tail kept: %v, want %v", torn, tt.torn)
+			}
+			if continues := res.ContinuesFrom != ""; continues != tt.moved {
+				t.Errorf("continues from %q; want a continuation: %v", res.ContinuesFrom, tt.moved)
+			}
+			if tt.moved && (l.broken == nil || l.broken.LastHash != res.ContinuesFrom) {
+				t.Errorf("break %+v does not name the hash the chain continues from (%s)", l.broken, res.ContinuesFrom)
+			}
+		})
+	}
+}
+
+func TestOpenAuditUsesKeyFromEnvironment(t *testing.T) {
+	t.Setenv("BRIDGE_AUDIT_KEY", "from-env")
+	a := &App{config: Config{DataDir: t.TempDir()}}
+	a.openAudit()
+	if a.audit == nil {
+		t.Fatal("audit log not opened")
+	}
+	a.recordAudit(auditShutdown, "bridge", nil)
+	a.audit.close()
+	path := filepath.Join(a.config.DataDir, auditFileName)
+	if res, err := verifyAuditLog(path, "from-env"); err != nil || !res.OK {
+		t.Errorf("verify with the environment key = %+v, %v; want ok", res, err)
+	}
+}
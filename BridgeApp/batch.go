@@ -0,0 +1,220 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Batch sizes for /mt5/get_trades
+const (
+	defaultBatchSize = 10
+	maxBatchSize     = 100
+)
+
+// tradeBatch is a set of messages handed to the EA in one /mt5/get_trades response
+// and not yet acknowledged
+type tradeBatch struct {
+	cursor     uint64
+	payloads   []map[string]interface{}
+	sentAt     time.Time
+	deliveries int
+}
+
+// batchState tracks the EA's outstanding batch. Only one batch is outstanding at
+// a time: until it is acknowledged every poll gets the same batch again, so a lost
+// response can't drop messages and a later batch can never overtake an earlier one
+// (which keeps the queue's per-base_id ordering intact across batches).
+type batchState struct {
+	mu         sync.Mutex
+	pending    *tradeBatch
+	lastCursor uint64
+	lastAcked  uint64
+}
+
+func newBatchState() *batchState {
+	return &batchState{}
+}
+
+// ack acknowledges the batch with the given cursor. It returns how many messages
+// were acknowledged, or ok=false if the cursor was never handed out.
+func (b *batchState) ack(cursor uint64) (acked int, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.pending != nil && b.pending.cursor == cursor {
+		acked = len(b.pending.payloads)
+		b.pending = nil
+		b.lastAcked = cursor
+		return acked, true
+	}
+	// Acknowledging an already acknowledged batch again is harmless
+	return 0, cursor != 0 && cursor <= b.lastAcked
+}
+
+// unacked returns how many messages are out with the EA awaiting acknowledgement
+func (b *batchState) unacked() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.pending == nil {
+		return 0
+	}
+	return len(b.pending.payloads)
+}
+
+// SavedBatch is an unacknowledged batch as saved in state.json
+type SavedBatch struct {
+	Target     string                   `json:"target,omitempty"`
+	Cursor     uint64                   `json:"cursor"`
+	Payloads   []map[string]interface{} `json:"payloads"`
+	SentAt     time.Time                `json:"sent_at"`
+	Deliveries int                      `json:"deliveries"`
+}
+
+// saved returns the outstanding batch of every target, ordered by target
+func (t *targetBatches) saved() []SavedBatch {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var out []SavedBatch
+	for target, b := range t.batches {
+		b.mu.Lock()
+		if p := b.pending; p != nil {
+			out = append(out, SavedBatch{Target: target, Cursor: p.cursor, Payloads: p.payloads, SentAt: p.sentAt, Deliveries: p.deliveries})
+		}
+		b.mu.Unlock()
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Target < out[j].Target })
+	return out
+}
+
+// restore makes a saved batch its target's outstanding batch again, under the
+// same cursor, so the EA's acknowledgement of it still matches
+func (t *targetBatches) restore(s SavedBatch) {
+	b := t.get(s.Target)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending = &tradeBatch{cursor: s.Cursor, payloads: s.Payloads, sentAt: s.SentAt, deliveries: s.Deliveries}
+	if s.Cursor > b.lastCursor {
+		b.lastCursor = s.Cursor
+	}
+}
+
+// getTradesHandler hands the EA up to max queued messages at once:
+//
+//	GET /mt5/get_trades?max=20&ack=41&target=ftmo-1
+//
+// The optional ack acknowledges the previous batch, saving a round-trip. Messages
+// are in the order the EA must execute them. Each routing target has its own batch.
+func (a *App) getTradesHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	target, ok := a.requireEATarget(w, r)
+	if !ok {
+		return
+	}
+	a.polled(target)
+	a.recordHedgeBalance(r, target)
+	b := a.batches.get(target)
+	max := defaultBatchSize
+	if v := r.URL.Query().Get("max"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxBatchSize {
+			writeAPIError(w, http.StatusBadRequest, errCodeValidation, "Invalid query parameter",
+				fieldError{Field: "max", Message: "must be an integer from 1 to " + strconv.Itoa(maxBatchSize)})
+			return
+		}
+		max = n
+	}
+	if v := r.URL.Query().Get("ack"); v != "" {
+		cursor, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, errCodeValidation, "Invalid query parameter",
+				fieldError{Field: "ack", Message: "must be a batch cursor"})
+			return
+		}
+		if _, ok := b.ack(cursor); !ok {
+			writeAPIError(w, http.StatusConflict, errCodeUnknownCursor, "Cursor "+v+" does not match the outstanding batch")
+			return
+		}
+	}
+
+	// Audited once b.mu is released, since auditing takes queueMux
+	var handedOut []map[string]interface{}
+	defer func() {
+		for _, p := range handedOut {
+			a.auditHandout(p)
+		}
+	}()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.pending != nil {
+		b.pending.deliveries++
+		log.Printf("BATCH: Redelivering unacknowledged batch %d (%d message(s), delivery %d, first sent %s ago)",
+			b.pending.cursor, len(b.pending.payloads), b.pending.deliveries, time.Since(b.pending.sentAt).Round(time.Millisecond))
+		writeBatch(w, b.pending, true)
+		return
+	}
+
+	var payloads []map[string]interface{}
+	for len(payloads) < max {
+		trade, ok := a.nextForMT5(target)
+		if !ok {
+			break
+		}
+		payloads = append(payloads, a.eaPayload(trade))
+	}
+	if len(payloads) == 0 {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"status": "no_trade", "count": 0, "trades": []interface{}{}, "paused": a.control.isPaused()})
+		return
+	}
+
+	b.lastCursor++
+	b.pending = &tradeBatch{cursor: b.lastCursor, payloads: payloads, sentAt: time.Now(), deliveries: 1}
+	handedOut = payloads
+	log.Printf("BATCH: Sending batch %d with %d message(s) to MT5%s. Queue size now: %d", b.pending.cursor, len(payloads), targetLabel(target), a.tradeQueue.len())
+	writeBatch(w, b.pending, false)
+}
+
+func writeBatch(w http.ResponseWriter, batch *tradeBatch, redelivered bool) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":      "success",
+		"cursor":      strconv.FormatUint(batch.cursor, 10),
+		"count":       len(batch.payloads),
+		"redelivered": redelivered,
+		"trades":      batch.payloads,
+	})
+}
+
+// ackTradesHandler acknowledges a batch: POST /mt5/ack_trades?target=ftmo-1 {"cursor":"41"}
+func (a *App) ackTradesHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+	target, ok := a.requireEATarget(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Cursor string `json:"cursor"`
+	}
+	if _, ok := decodeBody(w, r, "BatchAck", &req); !ok {
+		return
+	}
+	cursor, err := strconv.ParseUint(req.Cursor, 10, 64)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, errCodeValidation, "Request does not match the BatchAck schema",
+			fieldError{Field: "cursor", Message: "must be a batch cursor"})
+		return
+	}
+	acked, ok := a.batches.get(target).ack(cursor)
+	if !ok {
+		writeAPIError(w, http.StatusConflict, errCodeUnknownCursor, "Cursor "+req.Cursor+" does not match the outstanding batch")
+		return
+	}
+	log.Printf("BATCH: MT5%s acknowledged batch %d (%d message(s))", targetLabel(target), cursor, acked)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "success", "cursor": req.Cursor, "acked": acked})
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Commands the bridge sends to the NT addon
+const (
+	cmdFlattenAccount    = "flatten_account"
+	cmdFlattenInstrument = "flatten_instrument"
+	cmdCancelOrders      = "cancel_orders"
+	cmdPauseStrategy     = "pause_strategy"
+	cmdStatus            = "status"
+	cmdMirrorTrade       = "mirror_trade" // place the NT side of a manual MT5 trade
+)
+
+// How commands reach the addon
+const (
+	deliveryAuto = "auto" // push, and queue for polling when the addon's listener is unreachable
+	deliveryPush = "push"
+	deliveryPull = "pull"
+)
+
+// States of an NT command. A command is final once acked, failed or expired.
+const (
+	cmdPending   = "pending"   // waiting to be pushed or polled
+	cmdDelivered = "delivered" // the addon has it and hasn't acknowledged it yet
+	cmdAcked     = "acked"
+	cmdFailed    = "failed"
+	cmdExpired   = "expired" // not acknowledged within the timeout
+)
+
+// maxNTCommands is how many commands are kept, oldest final ones dropped first
+const maxNTCommands = 500
+
+// NTCommandConfig sets how the bridge delivers commands to the NT addon
+type NTCommandConfig struct {
+	// Delivery is auto (default), push or pull
+	Delivery string `json:"delivery" yaml:"delivery"`
+	// TimeoutMs is how long a command may go unacknowledged; default 10000
+	TimeoutMs int `json:"timeout_ms" yaml:"timeout_ms"`
+}
+
+func (c *NTCommandConfig) normalize() {
+	switch c.Delivery {
+	case deliveryAuto, deliveryPush, deliveryPull:
+	default:
+		if c.Delivery != "" {
+			log.Printf("WARNING: Unknown nt_commands.delivery %q; using %q", c.Delivery, deliveryAuto)
+		}
+		c.Delivery = deliveryAuto
+	}
+	if c.TimeoutMs <= 0 {
+		c.TimeoutMs = 10000
+	}
+}
+
+// NTCommand is one command for the NT addon and where it stands
+type NTCommand struct {
+	ID         string                 `json:"id"`
+	Type       string                 `json:"type"`
+	Account    string                 `json:"account,omitempty"`
+	Instrument string                 `json:"instrument,omitempty"`
+	Strategy   string                 `json:"strategy,omitempty"`
+	Reason     string                 `json:"reason,omitempty"`
+	BaseID     string                 `json:"base_id,omitempty"`    // mirror_trade: base_id the NT order fills under
+	Action     string                 `json:"action,omitempty"`     // mirror_trade: Buy or Sell
+	Quantity   float64                `json:"quantity,omitempty"`   // mirror_trade: NT contracts
+	MT5Ticket  uint64                 `json:"mt5_ticket,omitempty"` // mirror_trade: the manual MT5 deal
+	Status     map[string]interface{} `json:"status,omitempty"`     // the bridge status a status command broadcasts
+	Created    time.Time              `json:"created"`
+	Deadline   time.Time              `json:"deadline"` // acknowledge by
+	State      string                 `json:"state"`
+	Delivery   string                 `json:"delivery,omitempty"` // push or pull, once delivered
+	Message    string                 `json:"message,omitempty"`  // from the addon's ack, or why delivery failed
+	Updated    time.Time              `json:"updated"`
+}
+
+func (c *NTCommand) final() bool {
+	return c.State == cmdAcked || c.State == cmdFailed || c.State == cmdExpired
+}
+
+// ntCommandChannel keeps the commands sent to the NT addon until they are
+// acknowledged or time out
+type ntCommandChannel struct {
+	mu       sync.Mutex
+	cfg      NTCommandConfig
+	nextID   uint64
+	commands map[string]*NTCommand
+	order    []string // command ids, oldest first
+}
+
+func newNTCommandChannel(cfg NTCommandConfig) *ntCommandChannel {
+	// A zero timeout would expire every command the moment it is created
+	cfg.normalize()
+	return &ntCommandChannel{cfg: cfg, commands: make(map[string]*NTCommand)}
+}
+
+// add creates a pending command
+func (ch *ntCommandChannel) add(c NTCommand, now time.Time) NTCommand {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	ch.nextID++
+	c.ID = "cmd-" + strconv.FormatUint(ch.nextID, 10)
+	c.Created, c.Updated = now, now
+	c.Deadline = now.Add(time.Duration(ch.cfg.TimeoutMs) * time.Millisecond)
+	c.State = cmdPending
+	ch.commands[c.ID] = &c
+	ch.order = append(ch.order, c.ID)
+	ch.trimLocked()
+	return c
+}
+
+// trimLocked drops the oldest final commands beyond maxNTCommands. ch.mu must be held.
+func (ch *ntCommandChannel) trimLocked() {
+	excess := len(ch.order) - maxNTCommands
+	if excess <= 0 {
+		return
+	}
+	kept := ch.order[:0]
+	for _, id := range ch.order {
+		if excess > 0 && ch.commands[id].final() {
+			delete(ch.commands, id)
+			excess--
+			continue
+		}
+		kept = append(kept, id)
+	}
+	ch.order = kept
+}
+
+// update moves a command that isn't final yet to state and returns it
+func (ch *ntCommandChannel) update(id, state, delivery, message string) (NTCommand, bool) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	c := ch.commands[id]
+	if c == nil || c.final() {
+		return NTCommand{}, false
+	}
+	c.State, c.Message, c.Updated = state, message, time.Now()
+	if delivery != "" {
+		c.Delivery = delivery
+	}
+	return *c, true
+}
+
+// take hands up to max pending commands to a polling addon, oldest first. With
+// auto delivery a command whose push is still in flight can be polled too; the
+// addon skips an id it has already carried out.
+func (ch *ntCommandChannel) take(max int, now time.Time) []NTCommand {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	out := []NTCommand{}
+	if ch.cfg.Delivery == deliveryPush {
+		return out
+	}
+	for _, id := range ch.order {
+		if len(out) == max {
+			break
+		}
+		c := ch.commands[id]
+		if c.State != cmdPending {
+			continue
+		}
+		c.State, c.Delivery, c.Updated = cmdDelivered, deliveryPull, now
+		out = append(out, *c)
+	}
+	return out
+}
+
+// expire times out the commands not acknowledged by their deadline
+func (ch *ntCommandChannel) expire(now time.Time) []NTCommand {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	var out []NTCommand
+	for _, id := range ch.order {
+		c := ch.commands[id]
+		if c.final() || now.Before(c.Deadline) {
+			continue
+		}
+		c.State, c.Updated = cmdExpired, now
+		if c.Message == "" {
+			c.Message = "not acknowledged within " + (time.Duration(ch.cfg.TimeoutMs) * time.Millisecond).String()
+		}
+		out = append(out, *c)
+	}
+	return out
+}
+
+// list returns every command, oldest first
+func (ch *ntCommandChannel) list() []NTCommand {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	out := make([]NTCommand, 0, len(ch.order))
+	for _, id := range ch.order {
+		out = append(out, *ch.commands[id])
+	}
+	return out
+}
+
+// sendNTCommand queues a command for the addon and, unless it is to be polled,
+// pushes it to the addon's listener in the background
+func (a *App) sendNTCommand(c NTCommand) NTCommand {
+	c = a.ntCommands.add(c, time.Now())
+	log.Printf("NT_COMMAND: %s %s queued (account %q, instrument %q, delivery %s)",
+		c.ID, c.Type, c.Account, c.Instrument, a.ntCommands.cfg.Delivery)
+	a.emit("ntCommand", c)
+	if a.ntCommands.cfg.Delivery != deliveryPull {
+		go a.pushNTCommand(c)
+	}
+	return c
+}
+
+// pushNTCommand posts a command to the addon's /command listener. The addon
+// answers {"status":"done"} when it has already carried it out, or
+// {"status":"accepted"} and acknowledges it later. With auto delivery, a
+// listener that can't be reached leaves the command for the addon to poll.
+func (a *App) pushNTCommand(c NTCommand) {
+	body, _ := json.Marshal(c)
+	url := a.addonURL(c.Account) + "/command"
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		if a.ntCommands.cfg.Delivery == deliveryAuto {
+			log.Printf("NT_COMMAND: %s push to %s failed (%v); left for the addon to poll", c.ID, url, err)
+			return
+		}
+		a.finishNTCommand(c.ID, cmdFailed, deliveryPush, fmt.Sprintf("NT addon unreachable: %v", err))
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		a.finishNTCommand(c.ID, cmdFailed, deliveryPush, "NT addon answered "+resp.Status)
+		return
+	}
+	var reply struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	}
+	json.NewDecoder(resp.Body).Decode(&reply)
+	switch reply.Status {
+	case "done":
+		a.finishNTCommand(c.ID, cmdAcked, deliveryPush, reply.Message)
+	case "failed":
+		a.finishNTCommand(c.ID, cmdFailed, deliveryPush, reply.Message)
+	default:
+		if _, ok := a.ntCommands.update(c.ID, cmdDelivered, deliveryPush, reply.Message); ok {
+			log.Printf("NT_COMMAND: %s pushed to the NT addon; awaiting acknowledgement", c.ID)
+		}
+	}
+}
+
+// finishNTCommand records the outcome of a command and reports it to the UI
+func (a *App) finishNTCommand(id, state, delivery, message string) (NTCommand, bool) {
+	c, ok := a.ntCommands.update(id, state, delivery, message)
+	if !ok {
+		return c, false
+	}
+	log.Printf("NT_COMMAND: %s %s %s by the NT addon (%s)", c.ID, c.Type, c.State, c.Message)
+	a.emit("ntCommand", c)
+	if c.Type == cmdMirrorTrade && c.State == cmdFailed {
+		a.mirrorFailed(c, false)
+	}
+	return c, true
+}
+
+// expireNTCommands times out unacknowledged commands
+func (a *App) expireNTCommands() {
+	for _, c := range a.ntCommands.expire(time.Now()) {
+		log.Printf("NT_COMMAND: %s %s expired: %s", c.ID, c.Type, c.Message)
+		a.emit("ntCommand", c)
+		if c.Type == cmdMirrorTrade {
+			// The addon may still place it, so its fill stays a mirror
+			a.mirrorFailed(c, true)
+		}
+	}
+}
+
+// runCommandMonitor expires unacknowledged commands until stop is closed (nil runs forever)
+func (a *App) runCommandMonitor(stop <-chan struct{}) {
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			a.expireNTCommands()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// broadcastStatus sends the forwarding state and positions to the addon
+func (a *App) broadcastStatus(reason string) NTCommand {
+	st := a.control.status()
+	a.queueMux.Lock()
+	st["net_position"], st["hedge_size"] = a.netNT, a.hedgeLot
+	a.queueMux.Unlock()
+	st["queue_size"] = a.tradeQueue.len()
+	return a.sendNTCommand(NTCommand{Type: cmdStatus, Reason: reason, Status: st})
+}
+
+// SendNTCommand sends a command to the NT addon: flatten_account, flatten_instrument,
+// cancel_orders, pause_strategy or status
+func (a *App) SendNTCommand(kind, account, instrument, strategy, reason string) (result map[string]interface{}) {
+	var c NTCommand
+	defer func() {
+		a.auditOperatorAction("nt_command", map[string]interface{}{
+			"type": kind, "account": account, "instrument": instrument, "strategy": strategy, "reason": reason, "command_id": c.ID,
+		}, result)
+	}()
+	switch kind {
+	case cmdStatus:
+		c = a.broadcastStatus(reason)
+	case cmdFlattenAccount, cmdCancelOrders, cmdPauseStrategy, cmdFlattenInstrument:
+		if kind == cmdFlattenInstrument && instrument == "" {
+			return map[string]interface{}{"status": "error", "message": "flatten_instrument needs an instrument"}
+		}
+		if kind == cmdPauseStrategy && strategy == "" {
+			return map[string]interface{}{"status": "error", "message": "pause_strategy needs a strategy"}
+		}
+		c = a.sendNTCommand(NTCommand{Type: kind, Account: account, Instrument: instrument, Strategy: strategy, Reason: reason})
+	default:
+		return map[string]interface{}{"status": "error", "message": "unknown command " + kind}
+	}
+	return map[string]interface{}{"status": "success", "command": c}
+}
+
+// GetNTCommands returns the commands sent to the NT addon, oldest first
+func (a *App) GetNTCommands() []NTCommand {
+	return a.ntCommands.list()
+}
+
+// ntCommandsHandler hands pending commands to an addon that polls instead of
+// listening: GET /v1/nt/commands?max=10
+func (a *App) ntCommandsHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	max := 10
+	if raw := r.URL.Query().Get("max"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			writeAPIError(w, http.StatusBadRequest, errCodeValidation, "Invalid max",
+				fieldError{Field: "max", Message: "must be a positive integer"})
+			return
+		}
+		max = n
+	}
+	a.expireNTCommands()
+	commands := a.ntCommands.take(max, time.Now())
+	if len(commands) > 0 {
+		log.Printf("NT_COMMAND: NT addon polled %d command(s)", len(commands))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"count": len(commands), "commands": commands})
+}
+
+// ntCommandAckHandler takes the addon's acknowledgement of a command:
+// POST /v1/nt/commands/ack {"id":"cmd-3","status":"done","message":"..."}
+func (a *App) ntCommandAckHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+	var ack struct {
+		ID      string `json:"id"`
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	}
+	if _, ok := decodeBody(w, r, "NTCommandAck", &ack); !ok {
+		return
+	}
+	state := cmdAcked
+	if ack.Status == "failed" {
+		state = cmdFailed
+	}
+	if _, ok := a.finishNTCommand(ack.ID, state, "", ack.Message); !ok {
+		writeAPIError(w, http.StatusConflict, errCodeUnknownCommand, "Command "+ack.ID+" is unknown or already final")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "success", "id": ack.ID})
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// configFileName is the bridge settings file inside the data directory
+const configFileName = "bridge_config.json"
+
+// Config holds the bridge's settings. It is read from bridge_config.json in the
+// data directory (or the file named by BRIDGE_CONFIG); missing fields keep their
+// defaults, so an empty or absent file gives the historical behaviour.
+type Config struct {
+	// DataDir holds the config file, spill segments and other bridge state
+	DataDir string `json:"data_dir"`
+
+	// QueueMemoryPerLane is how many messages each priority lane keeps in memory
+	// before spilling to disk
+	QueueMemoryPerLane int `json:"queue_memory_per_lane"`
+	// SpillSegmentRecords is the number of messages per spill segment file
+	SpillSegmentRecords int `json:"spill_segment_records"`
+
+	// AggregateFills folds the per-contract Trades of a multi-contract NT fill into
+	// one hedge instruction
+	AggregateFills bool `json:"aggregate_fills"`
+	// AggregateWindowMs is how long to wait for the remaining contracts of a fill
+	AggregateWindowMs int `json:"aggregate_window_ms"`
+
+	// DriftTolerance is how far (in NT contracts) the confirmed MT5 hedge may differ
+	// from the NT position before it counts as drift
+	DriftTolerance float64 `json:"drift_tolerance"`
+	// DriftGraceMs is how long drift must persist before it is alerted
+	DriftGraceMs int `json:"drift_grace_ms"`
+	// DriftAutoCorrect queues a correction message for the EA when drift is alerted
+	DriftAutoCorrect bool `json:"drift_auto_correct"`
+	// DriftVolumePerContract converts MT5 result volume to NT contracts
+	DriftVolumePerContract float64 `json:"drift_volume_per_contract"`
+
+	// Risk holds the pre-trade limits; all are off by default
+	Risk RiskLimits `json:"risk"`
+
+	// Sessions are the MT5 trading-session schedules; none by default
+	Sessions SessionConfig `json:"sessions"`
+
+	// TTL is the maximum age of a queued message per type; none by default
+	TTL TTLConfig `json:"ttl"`
+
+	// ListenAddr is where the bridge serves NT and MT5. Give each bridge process
+	// its own address (and data_dir) to run several side by side.
+	ListenAddr string `json:"listen_addr"`
+	// FallbackListenAddr is bound when listen_addr is taken, e.g. "127.0.0.1:5001"
+	// or "127.0.0.1:0" for any free port; off by default
+	FallbackListenAddr string `json:"fallback_listen_addr"`
+	// AddressFiles are further paths bridge_address.json is written to, e.g. the
+	// MT5 Common\Files folder so the EA can read it
+	AddressFiles []string `json:"address_files"`
+
+	// Sizing computes the MT5 lot size of entries; off by default, leaving it to the EA
+	Sizing SizingConfig `json:"sizing"`
+
+	// Routing maps NT accounts to MT5 targets; without targets there is one
+	Routing RoutingConfig `json:"routing"`
+
+	// ManualTrades decides what happens to trades opened by hand on MT5; they are
+	// only recorded by default
+	ManualTrades ManualTradeConfig `json:"manual_trades"`
+
+	// NTCommands sets how commands reach the NT addon and how long they may go
+	// unacknowledged
+	NTCommands NTCommandConfig `json:"nt_commands"`
+
+	// Addons sets the default NT addon callback URL and how long addon
+	// registrations last without a heartbeat
+	Addons AddonConfig `json:"addons"`
+
+	// Limits caps each client's request rate per endpoint and request body sizes
+	Limits LimitsConfig `json:"limits"`
+
+	// Audit records every state-changing action in a hash-chained log; on by default
+	Audit AuditConfig `json:"audit"`
+
+	// ShutdownTimeoutMs bounds the graceful shutdown: draining closure forwards,
+	// persisting the queue and writing state.json
+	ShutdownTimeoutMs int `json:"shutdown_timeout_ms"`
+
+	// AdminToken is the bearer token of the /v1/admin operator endpoints, which
+	// are disabled while it is empty
+	AdminToken string `json:"admin_token"`
+}
+
+// defaultDataDir is %AppData%\BridgeApp on Windows (~/.config/BridgeApp elsewhere),
+// falling back to the working directory
+func defaultDataDir() string {
+	if dir, err := os.UserConfigDir(); err == nil {
+		return filepath.Join(dir, "BridgeApp")
+	}
+	return "."
+}
+
+// defaultConfig returns the settings used when no config file overrides them
+func defaultConfig() Config {
+	return Config{
+		DataDir:             defaultDataDir(),
+		ListenAddr:          "127.0.0.1:5000",
+		QueueMemoryPerLane:  100,
+		SpillSegmentRecords: 500,
+		AggregateWindowMs:   250,
+
+		DriftTolerance:         0.01,
+		DriftGraceMs:           10000,
+		DriftVolumePerContract: 1,
+
+		ShutdownTimeoutMs: 10000,
+	}
+}
+
+// configPath returns where the config file is read from
+func configPath() string {
+	if p := os.Getenv("BRIDGE_CONFIG"); p != "" {
+		return p
+	}
+	return filepath.Join(defaultDataDir(), configFileName)
+}
+
+// loadConfig reads the config file over the defaults. A missing file is not an
+// error; an unreadable or invalid one is logged and the defaults are used.
+// Either way the result is normalized, since the subsystems' defaults (request
+// limits, addon URL, command timeout, audit key) are only filled in there.
+func loadConfig() Config {
+	cfg := defaultConfig()
+	path := configPath()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("WARNING: Could not read config %s: %v. Using defaults.", path, err)
+		}
+		cfg.normalize()
+		return cfg
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		log.Printf("WARNING: Invalid config %s: %v. Using defaults.", path, err)
+		cfg = defaultConfig()
+		cfg.normalize()
+		return cfg
+	}
+	cfg.normalize()
+	log.Printf("Loaded bridge config from %s", path)
+	return cfg
+}
+
+// normalize replaces unusable values with defaults
+func (c *Config) normalize() {
+	d := defaultConfig()
+	if c.DataDir == "" {
+		c.DataDir = d.DataDir
+	}
+	if c.ListenAddr == "" {
+		c.ListenAddr = d.ListenAddr
+	}
+	if c.QueueMemoryPerLane <= 0 {
+		c.QueueMemoryPerLane = d.QueueMemoryPerLane
+	}
+	if c.SpillSegmentRecords <= 0 {
+		c.SpillSegmentRecords = d.SpillSegmentRecords
+	}
+	if c.AggregateWindowMs <= 0 {
+		c.AggregateWindowMs = d.AggregateWindowMs
+	}
+	if c.DriftTolerance < 0 {
+		c.DriftTolerance = d.DriftTolerance
+	}
+	if c.DriftGraceMs <= 0 {
+		c.DriftGraceMs = d.DriftGraceMs
+	}
+	if c.DriftVolumePerContract <= 0 {
+		c.DriftVolumePerContract = d.DriftVolumePerContract
+	}
+	if c.ShutdownTimeoutMs <= 0 {
+		c.ShutdownTimeoutMs = d.ShutdownTimeoutMs
+	}
+	if c.TTL.OnExpiry != expiryNet {
+		if c.TTL.OnExpiry != "" && c.TTL.OnExpiry != expiryDrop {
+			log.Printf("WARNING: Unknown ttl.on_expiry %q; expired messages will be dropped", c.TTL.OnExpiry)
+		}
+		c.TTL.OnExpiry = expiryDrop
+	}
+	c.Sizing.normalize()
+	c.Routing.normalize()
+	c.ManualTrades.normalize()
+	c.NTCommands.normalize()
+	c.Addons.normalize()
+	c.Limits.normalize()
+	c.Audit.normalize()
+}
+
+// spillDir is where queue lanes spill to disk
+func (c Config) spillDir() string {
+	return filepath.Join(c.DataDir, "spill")
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// flattenOrderType marks the closes queued by a flatten-all
+const flattenOrderType = "FLATTEN"
+
+// controlState is the operator's kill switch. While paused, NT trades are still
+// accepted and queued but nothing new is handed to the EA. Flatten-all closes are
+// kept apart from the queue and handed out first, even while paused.
+type controlState struct {
+	mu          sync.Mutex
+	paused      bool
+	pausedAt    time.Time
+	reason      string
+	flatten     []Trade // flatten-all closes not yet handed to the EA
+	lastFlatten time.Time
+}
+
+func newControlState() *controlState {
+	return &controlState{}
+}
+
+func (c *controlState) isPaused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.paused
+}
+
+// status returns the kill-switch state for GetStatus and /health
+func (c *controlState) status() map[string]interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st := map[string]interface{}{
+		"paused":          c.paused,
+		"flatten_pending": len(c.flatten),
+	}
+	if c.paused {
+		st["paused_at"] = c.pausedAt
+		st["reason"] = c.reason
+	}
+	if !c.lastFlatten.IsZero() {
+		st["last_flatten"] = c.lastFlatten
+	}
+	return st
+}
+
+// nextForMT5 returns the next message to hand to the EA. Messages past their
+// TTL are expired rather than sent, and messages for a symbol outside its trading
+// session are held by the session calendar instead.
+func (a *App) nextForMT5(target string) (Trade, bool) {
+	for {
+		t, ok := a.nextCandidate(target)
+		if !ok {
+			return t, false
+		}
+		if age, stale := a.ttl.stale(t, time.Now()); stale && !a.expire(t, age) {
+			continue
+		}
+		if a.sessions.admit(t) {
+			return t, true
+		}
+	}
+}
+
+// nextCandidate returns target's outstanding flatten-all closes first, then its
+// queue unless forwarding is paused
+func (a *App) nextCandidate(target string) (Trade, bool) {
+	c := a.control
+	c.mu.Lock()
+	for i, t := range c.flatten {
+		if t.Target == target {
+			c.flatten = append(c.flatten[:i:i], c.flatten[i+1:]...)
+			c.mu.Unlock()
+			return t, true
+		}
+	}
+	paused := c.paused
+	c.mu.Unlock()
+	if paused {
+		return Trade{}, false
+	}
+	return a.tradeQueue.pop(target)
+}
+
+// PauseForwarding stops handing queued messages to MT5. NT trades keep being
+// accepted, recorded and queued until ResumeForwarding.
+func (a *App) PauseForwarding(reason string) (result map[string]interface{}) {
+	defer func() { a.auditOperatorAction("pause", map[string]interface{}{"reason": reason}, result) }()
+	c := a.control
+	c.mu.Lock()
+	if c.paused {
+		c.mu.Unlock()
+		return map[string]interface{}{"status": "success", "message": "forwarding is already paused", "paused": true}
+	}
+	c.paused = true
+	c.pausedAt = time.Now()
+	c.reason = reason
+	c.mu.Unlock()
+
+	log.Printf("CONTROL: Forwarding to MT5 paused (reason: %q). %d message(s) queued.", reason, a.tradeQueue.len())
+	a.emit("forwardingPaused", a.control.status())
+	a.broadcastStatus("forwarding paused")
+	return map[string]interface{}{"status": "success", "paused": true}
+}
+
+// ResumeForwarding hands queued messages to MT5 again. With collapse set, the
+// messages queued so far are first replaced by one net entry per instrument and
+// account (see netOut).
+func (a *App) ResumeForwarding(collapse bool) (result map[string]interface{}) {
+	defer func() { a.auditOperatorAction("resume", map[string]interface{}{"collapse": collapse}, result) }()
+	c := a.control
+	c.mu.Lock()
+	if !c.paused {
+		c.mu.Unlock()
+		return map[string]interface{}{"status": "success", "message": "forwarding is not paused", "paused": false}
+	}
+	pausedFor := time.Since(c.pausedAt)
+	c.mu.Unlock()
+
+	result = map[string]interface{}{"status": "success", "paused": false}
+	if collapse {
+		var queued, msgs []Trade
+		collapsed := 0
+		a.tradeQueue.rewrite(nil, func(drained []Trade) []Trade {
+			kept, targets, n := netOut(drained, time.Now(), "net")
+			queued, msgs, collapsed = drained, append(kept, targets...), n
+			a.trackNetTargets(msgs)
+			return msgs
+		})
+		log.Printf("CONTROL: Collapsed %d of %d queued message(s) into net targets; %d message(s) queued after collapse",
+			collapsed, len(queued), len(msgs))
+		result["collapsed"] = collapsed
+	}
+
+	c.mu.Lock()
+	c.paused = false
+	c.reason = ""
+	c.mu.Unlock()
+	result["queued"] = a.tradeQueue.len()
+
+	log.Printf("CONTROL: Forwarding to MT5 resumed after %v. %d message(s) queued.", pausedFor.Round(time.Second), result["queued"])
+	a.emit("forwardingResumed", result)
+	a.broadcastStatus("forwarding resumed")
+	return result
+}
+
+// FlattenAll queues a close for every hedge MT5 has confirmed open, ahead of
+// everything else, and pauses forwarding so nothing reopens exposure until
+// ResumeForwarding. With flattenNT set every NT account is sent a flatten_account command too.
+func (a *App) FlattenAll(flattenNT bool) (result map[string]interface{}) {
+	defer func() {
+		a.auditOperatorAction("flatten", map[string]interface{}{"flatten_nt": flattenNT, "closes": result["closes"], "nt": result["nt"]}, result)
+	}()
+	now := time.Now()
+	hedges := a.drift.openHedges()
+	closes := make([]Trade, 0, len(hedges))
+	for _, h := range hedges {
+		closes = append(closes, Trade{
+			ID:            fmt.Sprintf("flatten_%s_%d", h.BaseID, now.Unix()),
+			BaseID:        h.BaseID,
+			Time:          now,
+			Action:        "CLOSE_HEDGE",
+			Quantity:      h.Quantity,
+			TotalQuantity: int(math.Ceil(h.Quantity)),
+			ContractNum:   1,
+			OrderType:     flattenOrderType,
+			Instrument:    h.Instrument,
+			AccountName:   h.Account,
+			ClosureReason: "FLATTEN_ALL",
+			Target:        h.Target,
+		})
+	}
+
+	a.PauseForwarding("flatten all")
+	c := a.control
+	c.mu.Lock()
+	c.flatten = append(c.flatten, closes...)
+	c.lastFlatten = now
+	c.mu.Unlock()
+	for _, t := range closes {
+		log.Printf("CONTROL: FLATTEN_ALL queued CLOSE_HEDGE %.2f for base_id %s (%s)", t.Quantity, t.BaseID, t.Instrument)
+	}
+	log.Printf("CONTROL: FLATTEN_ALL queued %d close(s); forwarding stays paused until resumed", len(closes))
+
+	result = map[string]interface{}{"status": "success", "closes": len(closes), "hedges": hedges, "paused": true}
+	if flattenNT {
+		cmds := a.requestAddonFlatten()
+		ids := make([]string, len(cmds))
+		for i, c := range cmds {
+			ids[i] = c.ID
+		}
+		log.Printf("CONTROL: FLATTEN_ALL sent %d flatten_account command(s) to NT", len(cmds))
+		result["nt"] = map[string]interface{}{"success": true, "commands": ids,
+			"message": fmt.Sprintf("%d flatten_account command(s) sent", len(cmds))}
+	}
+	a.emit("flattenAll", result)
+	return result
+}
+
+// requestAddonFlatten sends a flatten_account command for every account a
+// registered NT addon monitors, or one for the default addon's own account
+// when none registered. It returns the commands it queued.
+func (a *App) requestAddonFlatten() []NTCommand {
+	a.expireAddons()
+	var accounts []string
+	seen := make(map[string]bool)
+	for _, reg := range a.addons.live() {
+		for _, acct := range reg.Accounts {
+			if key := strings.ToLower(acct); acct != "" && !seen[key] {
+				seen[key] = true
+				accounts = append(accounts, acct)
+			}
+		}
+	}
+	if len(accounts) == 0 {
+		accounts = []string{""}
+	}
+	cmds := make([]NTCommand, 0, len(accounts))
+	for _, acct := range accounts {
+		cmds = append(cmds, a.sendNTCommand(NTCommand{Type: cmdFlattenAccount, Account: acct, Reason: "flatten all"}))
+	}
+	return cmds
+}
+
+// requireAdmin checks the bearer token of an operator endpoint. Operator
+// endpoints are disabled until admin_token is configured.
+func (a *App) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if a.config.AdminToken == "" {
+		writeAPIError(w, http.StatusForbidden, errCodeAdminDisabled, "Admin endpoints are disabled; set admin_token in bridge_config.json")
+		return false
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(a.config.AdminToken)) != 1 {
+		log.Printf("WARNING: Rejected %s %s from %s: missing or invalid admin token", r.Method, r.URL.Path, r.RemoteAddr)
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeAPIError(w, http.StatusUnauthorized, errCodeUnauthorized, "Missing or invalid admin token")
+		return false
+	}
+	if r.Method != http.MethodGet {
+		a.recordAudit(auditAdminRequest, "admin "+r.RemoteAddr, map[string]interface{}{"method": r.Method, "path": r.URL.Path})
+	}
+	return true
+}
+
+// adminHandler serves the kill switch to authenticated operators:
+//
+//	POST /v1/admin/pause   {"reason":"news"}
+//	POST /v1/admin/resume  {"collapse":true}
+//	POST /v1/admin/flatten {"flatten_nt":true}
+//	POST /v1/admin/nt_command {"type":"flatten_account","account":"Sim101"}
+//	GET  /v1/admin/state
+func (a *App) adminHandler(w http.ResponseWriter, r *http.Request) {
+	if !a.requireAdmin(w, r) {
+		return
+	}
+	command := strings.Trim(strings.TrimPrefix(r.URL.Path, apiVersionPrefix+"/admin"), "/")
+	if command == "state" {
+		if requireMethod(w, r, http.MethodGet) {
+			writeJSON(w, http.StatusOK, a.control.status())
+		}
+		return
+	}
+	if command != "pause" && command != "resume" && command != "flatten" && command != "nt_command" {
+		writeAPIError(w, http.StatusNotFound, errCodeNotFound, "Unknown admin command "+command)
+		return
+	}
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+	var req struct {
+		Reason     string `json:"reason"`
+		Collapse   bool   `json:"collapse"`
+		FlattenNT  bool   `json:"flatten_nt"`
+		Type       string `json:"type"`
+		Account    string `json:"account"`
+		Instrument string `json:"instrument"`
+		Strategy   string `json:"strategy"`
+	}
+	if r.ContentLength != 0 {
+		if _, ok := decodeBody(w, r, "AdminCommand", &req); !ok {
+			return
+		}
+	}
+	log.Printf("CONTROL: Admin %s requested from %s", command, r.RemoteAddr)
+	switch command {
+	case "pause":
+		writeJSON(w, http.StatusOK, a.PauseForwarding(req.Reason))
+	case "resume":
+		writeJSON(w, http.StatusOK, a.ResumeForwarding(req.Collapse))
+	case "flatten":
+		writeJSON(w, http.StatusOK, a.FlattenAll(req.FlattenNT))
+	case "nt_command":
+		res := a.SendNTCommand(req.Type, req.Account, req.Instrument, req.Strategy, req.Reason)
+		if res["status"] != "success" {
+			writeAPIError(w, http.StatusBadRequest, errCodeValidation, res["message"].(string),
+				fieldError{Field: "type", Message: "must be a known command with the fields it needs"})
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+	}
+}
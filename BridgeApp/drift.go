@@ -0,0 +1,659 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// closeDedupWindow is how long a confirmed close from one source (trade result or
+// closure notification) may absorb the same close reported by the other. The EA
+// usually reports a bridge-requested close both ways.
+const closeDedupWindow = 30 * time.Second
+
+// maxTrackedDispatches caps how many handed-out messages are remembered for
+// attributing trade results
+const maxTrackedDispatches = 5000
+
+// unknownInstrument groups messages that carry no instrument
+const unknownInstrument = "(unknown)"
+
+// InstrumentDrift compares, for one NT instrument, the position NT reports with
+// the hedge MT5 has confirmed. Both are in NT contracts and NT direction: a long
+// NT position of 2 is fully hedged when Actual is 2, whatever side MT5 holds.
+// MT5Net is the same confirmed volume on the side MT5 actually holds it.
+type InstrumentDrift struct {
+	Instrument string  `json:"instrument"`
+	Expected   float64 `json:"expected"` // NT net position
+	Actual     float64 `json:"actual"`   // confirmed MT5 opens minus confirmed closes
+	MT5Net     float64 `json:"mt5_net"`  // confirmed MT5 position, long positive, in NT contracts
+	// Refused is the part of Expected the risk limits kept from MT5. It shows as
+	// drift but is never auto-corrected.
+	Refused  float64   `json:"refused,omitempty"`
+	Drift    float64   `json:"drift"` // Expected - Actual
+	Since    time.Time `json:"since"` // when the drift left tolerance, zero while within
+	Alerting bool      `json:"alerting"`
+	// CorrectionID is the correction message queued for this drift, until MT5 reports it
+	CorrectionID string    `json:"correction_id,omitempty"`
+	Corrections  int       `json:"corrections"`
+	Updated      time.Time `json:"updated"`
+}
+
+// OpenHedge is the confirmed MT5 hedge volume still open for one base_id, in NT contracts
+type OpenHedge struct {
+	BaseID     string  `json:"base_id"`
+	Instrument string  `json:"instrument"`
+	Account    string  `json:"account,omitempty"`
+	Target     string  `json:"target,omitempty"` // MT5 target holding the hedge
+	Direction  string  `json:"direction"`        // hedge or copy
+	Quantity   float64 `json:"quantity"`
+}
+
+// dispatchedMessage is what the drift monitor remembers about a message handed to the EA
+type dispatchedMessage struct {
+	instrument string
+	account    string
+	baseID     string
+	sign       float64 // NT direction of an entry: +1 Buy, -1 Sell
+	mt5Sign    float64 // MT5 side of an entry: the opposite of sign for a hedge, the same for a copy
+	direction  string
+	isClose    bool
+	target     string
+	ratio      float64 // hedge ratio of the target: MT5 volume per NT contract, before volume_per_contract
+}
+
+// contracts converts MT5 volume executed for m into NT contracts
+func (d *driftMonitor) contracts(m dispatchedMessage, volume float64) float64 {
+	if m.ratio <= 0 {
+		return volume / d.volumePerContract
+	}
+	return volume / d.volumePerContract / m.ratio
+}
+
+// closeCredit is a confirmed close that may be reported again by the other source
+type closeCredit struct {
+	quantity   float64
+	fromResult bool
+	at         time.Time
+}
+
+// RefusedFill is the NT volume of one base_id the risk limits kept from MT5,
+// signed in NT direction
+type RefusedFill struct {
+	Instrument string  `json:"instrument"`
+	Quantity   float64 `json:"quantity"`
+}
+
+// driftEvent is an alert raised or cleared by evaluate
+type driftEvent struct {
+	name  string // driftAlert or driftResolved
+	drift InstrumentDrift
+}
+
+// driftMonitor tracks expected versus confirmed hedge volume per instrument
+type driftMonitor struct {
+	mu                sync.Mutex
+	tolerance         float64
+	grace             time.Duration
+	autoCorrect       bool
+	volumePerContract float64
+
+	instruments   map[string]*InstrumentDrift
+	dispatched    map[string]dispatchedMessage
+	dispatchOrder []string
+	bases         map[string]dispatchedMessage // entry of each base_id, for closes
+	credits       map[string][]closeCredit
+	open          map[string]*OpenHedge // confirmed open hedge per base_id
+	refused       map[string]*RefusedFill
+	awaiting      map[string]time.Time // handed out, no trade result yet, by message id
+	nextCorrID    uint64
+}
+
+func newDriftMonitor(cfg Config) *driftMonitor {
+	return &driftMonitor{
+		tolerance:         cfg.DriftTolerance,
+		grace:             time.Duration(cfg.DriftGraceMs) * time.Millisecond,
+		autoCorrect:       cfg.DriftAutoCorrect,
+		volumePerContract: cfg.DriftVolumePerContract,
+		instruments:       make(map[string]*InstrumentDrift),
+		dispatched:        make(map[string]dispatchedMessage),
+		bases:             make(map[string]dispatchedMessage),
+		credits:           make(map[string][]closeCredit),
+		open:              make(map[string]*OpenHedge),
+		refused:           make(map[string]*RefusedFill),
+		awaiting:          make(map[string]time.Time),
+	}
+}
+
+func instrumentKey(instrument string) string {
+	if instrument == "" {
+		return unknownInstrument
+	}
+	return instrument
+}
+
+// instrument returns the entry for name, creating it. d.mu must be held.
+func (d *driftMonitor) instrument(name string) *InstrumentDrift {
+	key := instrumentKey(name)
+	in := d.instruments[key]
+	if in == nil {
+		in = &InstrumentDrift{Instrument: key}
+		d.instruments[key] = in
+	}
+	in.Updated = time.Now()
+	return in
+}
+
+func ntSign(action string) float64 {
+	switch strings.ToLower(action) {
+	case "buy", "buytocover":
+		return 1
+	case "sell", "sellshort":
+		return -1
+	}
+	return 0
+}
+
+// ntFill records an NT execution from /log_trade
+func (d *driftMonitor) ntFill(t Trade) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.instrument(t.Instrument).Expected += ntSign(t.Action) * t.Quantity
+}
+
+// ntRefused records the NT fill of a trade the risk limits kept from MT5. NT
+// holds it all the same, so it counts towards the NT position.
+func (d *driftMonitor) ntRefused(t Trade) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	q := ntSign(t.Action) * t.Quantity
+	in := d.instrument(t.Instrument)
+	in.Expected += q
+	in.Refused += q
+	if t.BaseID == "" {
+		return
+	}
+	r := d.refused[t.BaseID]
+	if r == nil {
+		r = &RefusedFill{Instrument: in.Instrument}
+		d.refused[t.BaseID] = r
+	}
+	r.Quantity += q
+}
+
+// ntClose records an NT-initiated closure of baseID from /nt_close_hedge.
+// action is the NT closing side, so "sell" reduces a long.
+func (d *driftMonitor) ntClose(baseID, instrument, action string, quantity float64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.instrument(instrument).Expected += ntSign(action) * quantity
+	r := d.refused[baseID]
+	if r == nil {
+		return
+	}
+	// Closing a refused fill takes back the exposure MT5 never hedged
+	q := math.Min(quantity, math.Abs(r.Quantity))
+	if r.Quantity < 0 {
+		q = -q
+	}
+	r.Quantity -= q
+	d.instrument(r.Instrument).Refused -= q
+	if math.Abs(r.Quantity) <= 1e-9 {
+		delete(d.refused, baseID)
+	}
+}
+
+// expected returns the NT position recorded for instrument
+func (d *driftMonitor) expected(instrument string) float64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if in := d.instruments[instrumentKey(instrument)]; in != nil {
+		return in.Expected
+	}
+	return 0
+}
+
+// exposure returns the NT positions of every instrument, keyed by instrument
+func (d *driftMonitor) exposure() map[string]float64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make(map[string]float64, len(d.instruments))
+	for key, in := range d.instruments {
+		out[key] = in.Expected
+	}
+	return out
+}
+
+// handedOut remembers a message handed to the EA so its trade result can be
+// attributed. ratio is the hedge ratio the target scales MT5 volume by.
+func (d *driftMonitor) handedOut(t Trade, ratio float64) {
+	if t.OrderType == "TP" || t.OrderType == "SL" {
+		return // measurements are not executed
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	direction := t.Direction
+	if direction == "" {
+		direction = directionHedge
+	}
+	m := dispatchedMessage{instrument: instrumentKey(t.Instrument), account: t.AccountName, baseID: t.BaseID, sign: ntSign(t.Action),
+		direction: direction, isClose: t.Action == "CLOSE_HEDGE", target: t.Target, ratio: ratio}
+	m.mt5Sign = mt5Sign(m.sign, direction)
+	if _, seen := d.dispatched[t.ID]; !seen {
+		d.dispatchOrder = append(d.dispatchOrder, t.ID)
+		if len(d.dispatchOrder) > maxTrackedDispatches {
+			delete(d.dispatched, d.dispatchOrder[0])
+			delete(d.awaiting, d.dispatchOrder[0])
+			d.dispatchOrder = d.dispatchOrder[1:]
+		}
+	}
+	d.dispatched[t.ID] = m
+	d.awaiting[t.ID] = time.Now()
+	if !m.isClose && t.BaseID != "" {
+		d.bases[t.BaseID] = m
+	}
+}
+
+// result applies a trade result reported by the EA
+func (d *driftMonitor) result(res MT5TradeResult) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.awaiting, res.ID)
+	m, ok := d.dispatched[res.ID]
+	if !ok {
+		log.Printf("DRIFT: Trade result for unknown message id '%s' (ticket %d) not attributed to an instrument", res.ID, res.Ticket)
+		return
+	}
+	contracts := d.contracts(m, res.Volume)
+	if !m.isClose {
+		in := d.instrument(m.instrument)
+		in.Actual += m.sign * contracts
+		in.MT5Net += m.mt5Sign * contracts
+		d.opened(m, contracts)
+	} else if entry, ok := d.bases[m.baseID]; ok {
+		if q := d.absorb(m.baseID, contracts, true); q > 0 {
+			in := d.instrument(entry.instrument)
+			in.Actual -= entry.sign * q
+			in.MT5Net -= entry.mt5Sign * q
+			d.reduce(m.baseID, q)
+		}
+	}
+	for _, in := range d.instruments {
+		if in.CorrectionID == res.ID {
+			in.CorrectionID = ""
+		}
+	}
+}
+
+// mt5Closed applies a hedge closure the EA reported on /notify_hedge_close
+func (d *driftMonitor) mt5Closed(n HedgeCloseNotification) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	instrument, sign, side := instrumentKey(n.NTInstrumentSymbol), 0.0, 0.0
+	entry, known := d.bases[n.BaseID]
+	if known {
+		instrument, sign, side = entry.instrument, entry.sign, entry.mt5Sign
+	} else {
+		// closed_hedge_action is the MT5 side; assume a hedge, where a sell covers an NT long
+		side = ntSign(n.ClosedHedgeAction)
+		sign = -side
+	}
+	if q := d.absorb(n.BaseID, d.contracts(entry, n.ClosedHedgeQuantity), false); q > 0 {
+		in := d.instrument(instrument)
+		in.Actual -= sign * q
+		in.MT5Net -= side * q
+		d.reduce(n.BaseID, q)
+	}
+}
+
+// manualOpened books a manual MT5 trade mirrored to NT as the confirmed hedge of
+// its mirror base_id, so the mirror's NT fill doesn't show as drift
+func (d *driftMonitor) manualOpened(t ManualTrade, direction string, ratio float64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	m := dispatchedMessage{instrument: instrumentKey(t.Instrument), account: t.Account, baseID: t.BaseID,
+		sign: ntSign(t.NTAction), mt5Sign: ntSign(t.Action), direction: direction, target: t.Target, ratio: ratio}
+	in := d.instrument(m.instrument)
+	in.Actual += m.sign * t.Quantity
+	in.MT5Net += m.mt5Sign * t.Quantity
+	d.bases[t.BaseID] = m
+	d.opened(m, t.Quantity)
+}
+
+// opened adds confirmed volume to the open hedge of m's base_id. d.mu must be held.
+func (d *driftMonitor) opened(m dispatchedMessage, contracts float64) {
+	if m.baseID == "" || contracts <= 0 {
+		return
+	}
+	h := d.open[m.baseID]
+	if h == nil {
+		h = &OpenHedge{BaseID: m.baseID, Instrument: m.instrument, Account: m.account, Target: m.target, Direction: m.direction}
+		d.open[m.baseID] = h
+	}
+	h.Quantity += contracts
+}
+
+// reduce removes confirmed closed volume from baseID's open hedge. d.mu must be held.
+func (d *driftMonitor) reduce(baseID string, contracts float64) {
+	h := d.open[baseID]
+	if h == nil {
+		return
+	}
+	h.Quantity -= contracts
+	if h.Quantity <= 1e-9 {
+		delete(d.open, baseID)
+	}
+}
+
+// hedged reports whether MT5 has confirmed hedge volume still open for baseID
+func (d *driftMonitor) hedged(baseID string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.open[baseID] != nil
+}
+
+// openHedges returns the confirmed open hedge of every base_id, ordered by base_id
+func (d *driftMonitor) openHedges() []OpenHedge {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make([]OpenHedge, 0, len(d.open))
+	for _, h := range d.open {
+		out = append(out, *h)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].BaseID < out[j].BaseID })
+	return out
+}
+
+// absorb matches a confirmed close against recent closes for the same base_id
+// reported by the other source and returns the quantity not yet counted.
+// d.mu must be held.
+func (d *driftMonitor) absorb(baseID string, quantity float64, fromResult bool) float64 {
+	now := time.Now()
+	var kept []closeCredit
+	for _, c := range d.credits[baseID] {
+		if now.Sub(c.at) > closeDedupWindow {
+			continue
+		}
+		if c.fromResult != fromResult && quantity > 0 {
+			take := math.Min(c.quantity, quantity)
+			c.quantity -= take
+			quantity -= take
+		}
+		if c.quantity > 0 {
+			kept = append(kept, c)
+		}
+	}
+	if quantity > 0 {
+		kept = append(kept, closeCredit{quantity: quantity, fromResult: fromResult, at: now})
+	}
+	if len(kept) == 0 {
+		delete(d.credits, baseID)
+	} else {
+		d.credits[baseID] = kept
+	}
+	return quantity
+}
+
+// evaluate recomputes every instrument's drift. It returns the alerts raised or
+// cleared and, with auto-correct on, the correction messages to queue. While
+// queued is set, or a message handed out within the grace period has not
+// reported its result, hedge volume is still on its way to MT5: drift is alerted
+// but not corrected, as a correction would hedge it a second time.
+func (d *driftMonitor) evaluate(now time.Time, queued bool) ([]driftEvent, []Trade) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var events []driftEvent
+	var corrections []Trade
+	inFlight := queued
+	for id, at := range d.awaiting {
+		if now.Sub(at) < d.grace {
+			inFlight = true
+		} else {
+			// The EA reports only what it executed; past the grace period a
+			// message without a result counts as not executed
+			delete(d.awaiting, id)
+		}
+	}
+	for _, in := range d.instruments {
+		in.Drift = in.Expected - in.Actual
+		if math.Abs(in.Drift) <= d.tolerance {
+			if in.Alerting {
+				in.Alerting = false
+				events = append(events, driftEvent{"driftResolved", *in})
+			}
+			in.Since = time.Time{}
+			in.CorrectionID = ""
+			continue
+		}
+		if in.Since.IsZero() {
+			in.Since = now
+		}
+		if now.Sub(in.Since) < d.grace {
+			continue
+		}
+		if !in.Alerting {
+			in.Alerting = true
+			events = append(events, driftEvent{"driftAlert", *in})
+		}
+		// What the risk limits refused must not reach MT5 as a correction
+		correctable := in.Drift - in.Refused
+		if d.autoCorrect && !inFlight && in.CorrectionID == "" && in.Instrument != unknownInstrument && math.Abs(correctable) > d.tolerance {
+			d.nextCorrID++
+			action := "Buy"
+			if correctable < 0 {
+				action = "Sell"
+			}
+			id := fmt.Sprintf("drift_%d_%d", now.Unix(), d.nextCorrID)
+			qty := math.Abs(correctable)
+			in.CorrectionID = id
+			in.Corrections++
+			corrections = append(corrections, Trade{
+				ID:            id,
+				BaseID:        id,
+				Time:          now,
+				Action:        action,
+				Quantity:      qty,
+				TotalQuantity: int(math.Ceil(qty)),
+				ContractNum:   1,
+				OrderType:     "DRIFT_CORRECTION",
+				Instrument:    in.Instrument,
+			})
+		}
+	}
+	return events, corrections
+}
+
+// snapshot returns every instrument's drift, ordered by instrument
+func (d *driftMonitor) snapshot() []InstrumentDrift {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make([]InstrumentDrift, 0, len(d.instruments))
+	for _, in := range d.instruments {
+		out = append(out, *in)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Instrument < out[j].Instrument })
+	return out
+}
+
+// DriftMessage is a dispatchedMessage as saved in state.json
+type DriftMessage struct {
+	ID         string  `json:"id,omitempty"` // message id; empty for the entry of a base_id
+	Instrument string  `json:"instrument"`
+	Account    string  `json:"account,omitempty"`
+	BaseID     string  `json:"base_id,omitempty"`
+	Sign       float64 `json:"sign"`
+	MT5Sign    float64 `json:"mt5_sign"`
+	Direction  string  `json:"direction,omitempty"`
+	IsClose    bool    `json:"is_close,omitempty"`
+	Target     string  `json:"target,omitempty"`
+	Ratio      float64 `json:"ratio,omitempty"`
+}
+
+func (m dispatchedMessage) saved(id string) DriftMessage {
+	return DriftMessage{ID: id, Instrument: m.instrument, Account: m.account, BaseID: m.baseID, Sign: m.sign, MT5Sign: m.mt5Sign,
+		Direction: m.direction, IsClose: m.isClose, Target: m.target, Ratio: m.ratio}
+}
+
+func (m DriftMessage) dispatched() dispatchedMessage {
+	return dispatchedMessage{instrument: m.Instrument, account: m.Account, baseID: m.BaseID, sign: m.Sign, mt5Sign: m.MT5Sign,
+		direction: m.Direction, isClose: m.IsClose, target: m.Target, ratio: m.Ratio}
+}
+
+// DriftBook is what the drift monitor needs to carry on after a restart: the
+// positions per instrument, the open hedges and the messages they came from
+type DriftBook struct {
+	Instruments []InstrumentDrift      `json:"instruments,omitempty"`
+	Open        []OpenHedge            `json:"open,omitempty"`
+	Bases       []DriftMessage         `json:"bases,omitempty"`      // entry of each base_id
+	Dispatched  []DriftMessage         `json:"dispatched,omitempty"` // handed to the EA, oldest first
+	Refused     map[string]RefusedFill `json:"refused,omitempty"`    // by base_id
+}
+
+// book returns the monitor's state for state.json
+func (d *driftMonitor) book() DriftBook {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var b DriftBook
+	for _, in := range d.instruments {
+		b.Instruments = append(b.Instruments, *in)
+	}
+	sort.Slice(b.Instruments, func(i, j int) bool { return b.Instruments[i].Instrument < b.Instruments[j].Instrument })
+	for _, h := range d.open {
+		b.Open = append(b.Open, *h)
+	}
+	sort.Slice(b.Open, func(i, j int) bool { return b.Open[i].BaseID < b.Open[j].BaseID })
+	for _, m := range d.bases {
+		b.Bases = append(b.Bases, m.saved(""))
+	}
+	sort.Slice(b.Bases, func(i, j int) bool { return b.Bases[i].BaseID < b.Bases[j].BaseID })
+	for _, id := range d.dispatchOrder {
+		b.Dispatched = append(b.Dispatched, d.dispatched[id].saved(id))
+	}
+	if len(d.refused) > 0 {
+		b.Refused = make(map[string]RefusedFill, len(d.refused))
+		for baseID, r := range d.refused {
+			b.Refused[baseID] = *r
+		}
+	}
+	return b
+}
+
+// restore takes up the state of the last shutdown. Alerts and pending
+// corrections start over: the drift is evaluated again after the grace period.
+func (d *driftMonitor) restore(b DriftBook) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, saved := range b.Instruments {
+		in := d.instrument(saved.Instrument)
+		in.Expected, in.Actual, in.MT5Net, in.Refused, in.Corrections = saved.Expected, saved.Actual, saved.MT5Net, saved.Refused, saved.Corrections
+		in.Drift = in.Expected - in.Actual
+	}
+	for _, h := range b.Open {
+		h := h
+		d.open[h.BaseID] = &h
+	}
+	for _, m := range b.Bases {
+		d.bases[m.BaseID] = m.dispatched()
+	}
+	for baseID, r := range b.Refused {
+		r := r
+		d.refused[baseID] = &r
+	}
+	for _, m := range b.Dispatched {
+		if _, seen := d.dispatched[m.ID]; !seen {
+			d.dispatchOrder = append(d.dispatchOrder, m.ID)
+		}
+		d.dispatched[m.ID] = m.dispatched()
+	}
+}
+
+// alerting counts instruments whose drift has been out of tolerance past the grace period
+func (d *driftMonitor) alerting() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := 0
+	for _, in := range d.instruments {
+		if in.Alerting {
+			n++
+		}
+	}
+	return n
+}
+
+// checkDrift runs one drift evaluation, reporting alerts and queueing corrections.
+// It is skipped while forwarding is paused: the hedge is expected to lag then.
+func (a *App) checkDrift() {
+	if a.control.isPaused() {
+		return
+	}
+	// Messages queued, held or handed out in a batch not yet acknowledged are
+	// hedges MT5 hasn't executed yet
+	queued := a.tradeQueue.len() > 0 || a.batches.unacked() > 0 || a.aggregator.held() > 0 || a.sessions.heldCount() > 0
+	events, corrections := a.drift.evaluate(time.Now(), queued)
+	for _, ev := range events {
+		if ev.name == "driftAlert" {
+			log.Printf("DRIFT_ALERT: %s: NT position %.2f, MT5 hedge %.2f, drift %.2f for %v",
+				ev.drift.Instrument, ev.drift.Expected, ev.drift.Actual, ev.drift.Drift, time.Since(ev.drift.Since).Round(time.Millisecond))
+		} else {
+			log.Printf("DRIFT_RESOLVED: %s: NT position %.2f, MT5 hedge %.2f", ev.drift.Instrument, ev.drift.Expected, ev.drift.Actual)
+		}
+		a.emit(ev.name, ev.drift)
+	}
+	for _, t := range corrections {
+		// A correction belongs to no NT account, so it goes where unrouted accounts go
+		target, direction, rerr := a.router.resolve("", false)
+		if rerr != nil {
+			log.Printf("DRIFT_CORRECTION: Not queueing %s %.2f %s (id %s): %s", t.Action, t.Quantity, t.Instrument, t.ID, rerr.message)
+			continue
+		}
+		if direction == directionDisabled {
+			log.Printf("DRIFT_CORRECTION: Not queueing %s %.2f %s (id %s): direction is disabled", t.Action, t.Quantity, t.Instrument, t.ID)
+			continue
+		}
+		t.Target = target
+		t.Direction = direction
+		log.Printf("DRIFT_CORRECTION: Queueing %s %.2f %s for MT5%s (id %s)", t.Action, t.Quantity, t.Instrument, targetLabel(target), t.ID)
+		a.tradeQueue.push(t)
+	}
+}
+
+// runDriftMonitor evaluates drift periodically until stop is closed (nil runs forever)
+func (a *App) runDriftMonitor(stop <-chan struct{}) {
+	interval := time.Second
+	if quarter := a.drift.grace / 4; quarter > 0 && quarter < interval {
+		interval = quarter
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			a.checkDrift()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// driftHandler reports per-instrument drift: GET /v1/drift
+func (a *App) driftHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"instruments":  a.drift.snapshot(),
+		"tolerance":    a.drift.tolerance,
+		"grace_ms":     a.drift.grace.Milliseconds(),
+		"auto_correct": a.drift.autoCorrect,
+	})
+}
+
+// GetDriftStatus returns per-instrument drift for the UI
+func (a *App) GetDriftStatus() []InstrumentDrift {
+	return a.drift.snapshot()
+}
@@ -1,7 +1,33 @@
 import React, { useState, useEffect } from 'react';
 import { EventsOn } from '../wailsjs/runtime'; // Added for Wails event handling
 import './App.css';
-import { GetStatus, AttemptReconnect } from '../wailsjs/go/main/App';
+import { GetStatus, AttemptReconnect, GetRiskStatus, ApproveHeldTrade, DiscardHeldTrade, PauseForwarding, ResumeForwarding, FlattenAll, GetTelemetry } from '../wailsjs/go/main/App';
+
+// Sparkline draws one telemetry series as an SVG line with its latest value
+function Sparkline({ label, values, format = (v) => v.toFixed(2) }) {
+  const width = 240, height = 48;
+  if (values.length === 0) {
+    return (
+      <div className="telemetry-chart">
+        <label>{label}:</label> <span>no data</span>
+      </div>
+    );
+  }
+  const min = Math.min(...values), max = Math.max(...values);
+  const span = max - min || 1;
+  const step = values.length > 1 ? width / (values.length - 1) : 0;
+  const path = values
+    .map((v, i) => `${(i * step).toFixed(1)},${(height - ((v - min) / span) * height).toFixed(1)}`)
+    .join(' ');
+  return (
+    <div className="telemetry-chart">
+      <label>{label}:</label> <span>{format(values[values.length - 1])}</span>
+      <svg width={width} height={height} style={{ display: 'block' }}>
+        <polyline points={path} fill="none" stroke="#4caf50" strokeWidth="1.5" />
+      </svg>
+    </div>
+  );
+}
 
 function App() {
   // State structure based on GetStatus return value, now includes hedgebotActive and tradeLogSenderActive
@@ -13,7 +39,8 @@ function App() {
     addonConnected: false,    // Tracks Addon/Transmitter status from GetStatus
     netPosition: 0,
     hedgeSize: 0,
-    queueSize: 0
+    queueSize: 0,
+    paused: false
   });
 
   // State specifically for HedgeBot connection status (updated by polling and events)
@@ -27,6 +54,42 @@ function App() {
 
 // State for custom notification display
   const [notification, setNotification] = useState({ visible: false, message: '', type: '' });
+
+  // Trades held by the risk limits awaiting approval
+  const [heldTrades, setHeldTrades] = useState([]);
+
+  // NT balance/daily P&L and EA cushion/OHF over the session
+  const [telemetry, setTelemetry] = useState({ nt: [], ea: [] });
+
+  const fetchTelemetry = async () => {
+    try {
+      const report = await GetTelemetry();
+      setTelemetry({ nt: report?.nt ?? [], ea: report?.ea ?? [] });
+    } catch (err) {
+      console.error("Failed to fetch telemetry:", err);
+    }
+  };
+
+  const fetchRisk = async () => {
+    try {
+      const risk = await GetRiskStatus();
+      setHeldTrades(risk?.held ?? []);
+    } catch (err) {
+      console.error("Failed to fetch risk status:", err);
+    }
+  };
+
+  const handleHeldTrade = async (holdID, approve) => {
+    try {
+      const result = approve ? await ApproveHeldTrade(holdID) : await DiscardHeldTrade(holdID);
+      if (result?.status !== 'success') {
+        showNotification(result?.message || `Could not update ${holdID}`, 'error');
+      }
+    } catch (err) {
+      console.error("Failed to update held trade:", err);
+    }
+    fetchRisk();
+  };
   const fetchStatus = async () => {
     try {
       const currentStatusFromServer = await GetStatus();
@@ -44,10 +107,14 @@ function App() {
         return {
           ...prevStatus, // Keep existing state like netPosition etc.
           bridgeActive: currentStatusFromServer?.bridgeActive ?? false,
+          bridgeError: currentStatusFromServer?.bridgeError ?? '',
+          auditWarning: currentStatusFromServer?.auditWarning ?? '',
+          listenAddr: currentStatusFromServer?.listenAddr ?? '',
           addonConnected: currentStatusFromServer?.addonConnected ?? false, // Update addon status
           netPosition: currentStatusFromServer?.netPosition ?? 0,
           hedgeSize: currentStatusFromServer?.hedgeSize ?? 0,
           queueSize: currentStatusFromServer?.queueSize ?? 0,
+          paused: currentStatusFromServer?.control?.paused ?? false,
           // tradeLogSenderActive: currentStatusFromServer?.tradeLogSenderActive ?? false, // Update if needed
         };
       });
@@ -97,6 +164,29 @@ function App() {
     }
   };
 
+  // Kill switch: pause/resume forwarding to MT5 and flatten all hedges
+  const handlePauseClick = async () => {
+    if (bridgeStatus.paused) {
+      const collapse = window.confirm("Collapse the trades queued while paused into one net order per instrument?");
+      await ResumeForwarding(collapse);
+      showNotification('Forwarding to MT5 resumed', 'info');
+    } else {
+      await PauseForwarding('paused from UI');
+      showNotification('Forwarding to MT5 paused', 'info');
+    }
+    fetchStatus();
+  };
+
+  const handleFlattenClick = async () => {
+    if (!window.confirm("Close every open MT5 hedge and pause forwarding?")) {
+      return;
+    }
+    const flattenNT = window.confirm("Also flatten the NinjaTrader accounts?");
+    const result = await FlattenAll(flattenNT);
+    showNotification(`Flatten all: ${result?.closes ?? 0} close(s) queued`, 'error', 6000);
+    fetchStatus();
+  };
+
   // Placeholder for reset function - backend needs implementation
   const handleResetClick = () => {
     console.warn("Reset functionality not implemented in the backend (app.go) yet.");
@@ -107,7 +197,9 @@ function App() {
   // Fetch status on load and every 2 seconds
   useEffect(() => {
     fetchStatus();
-    const interval = setInterval(fetchStatus, 2000);
+    fetchRisk();
+    fetchTelemetry();
+    const interval = setInterval(() => { fetchStatus(); fetchRisk(); fetchTelemetry(); }, 2000);
     return () => clearInterval(interval);
   }, []);
 
@@ -132,6 +224,58 @@ function App() {
     };
     EventsOn("addonRetryResult", handleAddonRetryResult);
 
+    // Listener for "riskBreach" - a trade was rejected or held by the risk limits
+    const handleRiskBreach = (event) => {
+        const verb = event?.action === 'held' ? 'held for approval' : 'rejected';
+        showNotification(`Trade ${event?.trade_id} ${verb}: ${event?.breach?.reason}`, 'error', 6000);
+        fetchRisk();
+    };
+    EventsOn("riskBreach", handleRiskBreach);
+
+    // Listener for "tradeExpired" - a queued message was too old to send to MT5
+    const handleTradeExpired = (event) => {
+        showNotification(`${event?.kind} ${event?.trade_id} expired after ${event?.age_ms}ms and was ${event?.outcome}`, 'error', 6000);
+    };
+    EventsOn("tradeExpired", handleTradeExpired);
+
+    // Listener for "manualTrade" - a trade was opened by hand on MT5
+    const handleManualTrade = (event) => {
+        if (event?.outcome === 'recorded') {
+            return;
+        }
+        const type = event?.outcome === 'mirrored' ? 'info' : 'error';
+        showNotification(`Manual MT5 ${event?.action} ${event?.volume} ${event?.symbol} ${event?.outcome}: ${event?.reason}`, type, 6000);
+    };
+    EventsOn("manualTrade", handleManualTrade);
+
+    // Listener for "ntCommand" - a command to the NT addon changed state
+    const handleNTCommand = (event) => {
+        if (event?.state !== 'failed' && event?.state !== 'expired') {
+            return;
+        }
+        showNotification(`NT command ${event?.type} ${event?.state}: ${event?.message}`, 'error', 6000);
+    };
+    EventsOn("ntCommand", handleNTCommand);
+
+    // Listener for "addonExpired" - a registered NT addon instance stopped sending heartbeats
+    const handleAddonExpired = (event) => {
+        showNotification(`NT addon ${event?.id} at ${event?.url} stopped sending heartbeats; accounts ${(event?.accounts || []).join(', ')} fall back to the default addon`, 'error', 6000);
+    };
+    EventsOn("addonExpired", handleAddonExpired);
+
+    // Listener for "bridgeError" - the bridge could not start serving
+    const handleBridgeError = (event) => {
+        showNotification(`Bridge is not serving: ${event?.error}`, 'error', 10000);
+        fetchStatus();
+    };
+    EventsOn("bridgeError", handleBridgeError);
+
+    // Listener for "bridgeFallback" - listen_addr was taken and the bridge serves on fallback_listen_addr
+    const handleBridgeFallback = (event) => {
+        showNotification(`Listen address taken; bridge serves on ${event?.url} (written to bridge_address.json)`, 'error', 10000);
+    };
+    EventsOn("bridgeFallback", handleBridgeFallback);
+
     // Cleanup function for listeners
     // Wails v2 EventsOn listeners are generally managed by Wails and cleaned up on app close.
     // If specific cleanup (e.g., EventsOff) were required per listener, it would go here.
@@ -200,7 +344,18 @@ function App() {
           <div className="status-item">
             <span className="status-label">Bridge Status:</span>
             <span className={`status-value ${bridgeDisplay.className}`}>{bridgeDisplay.text}</span>
+            {bridgeStatus.listenAddr && <span> on {bridgeStatus.listenAddr}</span>}
           </div>
+          {bridgeStatus.bridgeError && (
+            <div className="status-item">
+              <span className="status-value disconnected">{bridgeStatus.bridgeError}</span>
+            </div>
+          )}
+          {bridgeStatus.auditWarning && (
+            <div className="status-item">
+              <span className="status-value disconnected">{bridgeStatus.auditWarning}</span>
+            </div>
+          )}
           <div className="status-item">
             <span className="status-label">Hedgebot Status:</span>
             <span className={`status-value ${hedgebotDisplay.className}`}>{hedgebotDisplay.text}</span>
@@ -225,8 +380,43 @@ function App() {
             <label>Queue Size:</label>
             <span>{bridgeStatus.queueSize}</span>
           </div>
+          <div className="state-item">
+            <label>Forwarding:</label>
+            <span className={bridgeStatus.paused ? 'disconnected' : 'healthy'}>{bridgeStatus.paused ? 'Paused' : 'Active'}</span>
+          </div>
         </div>
 
+        {/* Elastic-hedging telemetry */}
+        <div className="telemetry" style={{ marginBottom: '16px', textAlign: 'left' }}>
+          <h4>Session Telemetry:</h4>
+          <Sparkline label="NT Balance" values={telemetry.nt.map(p => p.balance)} />
+          <Sparkline label="NT Daily P&L" values={telemetry.nt.map(p => p.daily_pnl)} />
+          <Sparkline label="Cushion" values={telemetry.ea.map(p => p.cushion)} />
+          <Sparkline label="OHF" values={telemetry.ea.map(p => p.ohf)} />
+        </div>
+
+        {/* Kill switch */}
+        <button className="retry-btn" onClick={handlePauseClick}>
+          {bridgeStatus.paused ? 'Resume Forwarding' : 'Pause Forwarding'}
+        </button>
+        <button className="reset-btn" onClick={handleFlattenClick}>
+          Flatten All
+        </button>
+
+        {/* Trades held by the risk limits */}
+        {heldTrades.length > 0 && (
+          <div className="held-trades" style={{ marginBottom: '16px', textAlign: 'left' }}>
+            <h4>Held for Approval:</h4>
+            {heldTrades.map(h => (
+              <div key={h.hold_id} style={{ margin: '4px 0' }}>
+                <span>{h.trade.action} {h.trade.quantity} {h.trade.instrument_name} ({h.trade.id}): {h.breach.reason}</span>
+                <button onClick={() => handleHeldTrade(h.hold_id, true)} style={{ marginLeft: '8px' }}>Approve</button>
+                <button onClick={() => handleHeldTrade(h.hold_id, false)} style={{ marginLeft: '4px' }}>Discard</button>
+              </div>
+            ))}
+          </div>
+        )}
+
         {/* Reset Button */}
         <button className="reset-btn" onClick={handleResetClick}>
           Reset Bridge State
@@ -2,8 +2,38 @@
 // This file is automatically generated. DO NOT EDIT
 import {main} from '../models';
 
+export function ApproveHeldTrade(arg1:string):Promise<Record<string, any>>;
+
 export function AttemptReconnect(arg1:boolean,arg2:boolean,arg3:boolean):Promise<Record<string, any>>;
 
+export function DiscardHeldTrade(arg1:string):Promise<Record<string, any>>;
+
+export function FlattenAll(arg1:boolean):Promise<Record<string, any>>;
+
+export function GetAddons():Promise<Array<main.AddonRegistration>>;
+
+export function GetDriftStatus():Promise<Array<main.InstrumentDrift>>;
+
+export function GetExecutionStats():Promise<main.ExecutionReport>;
+
+export function GetExpiredTrades():Promise<Array<main.TradeExpiry>>;
+
+export function GetManualTrades():Promise<Array<main.ManualTrade>>;
+
+export function GetNTCommands():Promise<Array<main.NTCommand>>;
+
+export function GetRiskStatus():Promise<Record<string, any>>;
+
+export function GetSequenceStatus():Promise<Record<string, any>>;
+
 export function GetStatus():Promise<Record<string, any>>;
 
+export function GetTelemetry():Promise<main.TelemetryReport>;
+
 export function GetTradeHistory():Promise<Array<main.Trade>>;
+
+export function PauseForwarding(arg1:string):Promise<Record<string, any>>;
+
+export function ResumeForwarding(arg1:boolean):Promise<Record<string, any>>;
+
+export function SendNTCommand(arg1:string,arg2:string,arg3:string,arg4:string,arg5:string):Promise<Record<string, any>>;
@@ -2,14 +2,74 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function ApproveHeldTrade(arg1) {
+  return window['go']['main']['App']['ApproveHeldTrade'](arg1);
+}
+
 export function AttemptReconnect(arg1, arg2, arg3) {
   return window['go']['main']['App']['AttemptReconnect'](arg1, arg2, arg3);
 }
 
+export function DiscardHeldTrade(arg1) {
+  return window['go']['main']['App']['DiscardHeldTrade'](arg1);
+}
+
+export function FlattenAll(arg1) {
+  return window['go']['main']['App']['FlattenAll'](arg1);
+}
+
+export function GetAddons() {
+  return window['go']['main']['App']['GetAddons']();
+}
+
+export function GetDriftStatus() {
+  return window['go']['main']['App']['GetDriftStatus']();
+}
+
+export function GetExecutionStats() {
+  return window['go']['main']['App']['GetExecutionStats']();
+}
+
+export function GetExpiredTrades() {
+  return window['go']['main']['App']['GetExpiredTrades']();
+}
+
+export function GetManualTrades() {
+  return window['go']['main']['App']['GetManualTrades']();
+}
+
+export function GetNTCommands() {
+  return window['go']['main']['App']['GetNTCommands']();
+}
+
+export function GetRiskStatus() {
+  return window['go']['main']['App']['GetRiskStatus']();
+}
+
+export function GetSequenceStatus() {
+  return window['go']['main']['App']['GetSequenceStatus']();
+}
+
 export function GetStatus() {
   return window['go']['main']['App']['GetStatus']();
 }
 
+export function GetTelemetry() {
+  return window['go']['main']['App']['GetTelemetry']();
+}
+
 export function GetTradeHistory() {
   return window['go']['main']['App']['GetTradeHistory']();
 }
+
+export function PauseForwarding(arg1) {
+  return window['go']['main']['App']['PauseForwarding'](arg1);
+}
+
+export function ResumeForwarding(arg1) {
+  return window['go']['main']['App']['ResumeForwarding'](arg1);
+}
+
+export function SendNTCommand(arg1, arg2, arg3, arg4, arg5) {
+  return window['go']['main']['App']['SendNTCommand'](arg1, arg2, arg3, arg4, arg5);
+}
@@ -1,5 +1,546 @@
 export namespace main {
 	
+	export class AddonRegistration {
+	    id: string;
+	    url: string;
+	    version?: string;
+	    accounts: string[];
+	    capabilities: string[];
+	    // Go type: time
+	    registered: any;
+	    // Go type: time
+	    last_seen: any;
+	    // Go type: time
+	    expires: any;
+	
+	    static createFrom(source: any = {}) {
+	        return new AddonRegistration(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.url = source["url"];
+	        this.version = source["version"];
+	        this.accounts = source["accounts"];
+	        this.capabilities = source["capabilities"];
+	        this.registered = this.convertValues(source["registered"], null);
+	        this.last_seen = this.convertValues(source["last_seen"], null);
+	        this.expires = this.convertValues(source["expires"], null);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class ContractFill {
+	    id: string;
+	    contract_num: number;
+	    quantity: number;
+	    price: number;
+	    // Go type: time
+	    time: any;
+	    closed?: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new ContractFill(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.contract_num = source["contract_num"];
+	        this.quantity = source["quantity"];
+	        this.price = source["price"];
+	        this.time = this.convertValues(source["time"], null);
+	        this.closed = source["closed"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class EATelemetryPoint {
+	    // Go type: time
+	    time: any;
+	    target?: string;
+	    cushion: number;
+	    ohf: number;
+	    balance?: number;
+	    equity?: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new EATelemetryPoint(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.time = this.convertValues(source["time"], null);
+	        this.target = source["target"];
+	        this.cushion = source["cushion"];
+	        this.ohf = source["ohf"];
+	        this.balance = source["balance"];
+	        this.equity = source["equity"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class ExecutionReport {
+	    instruments: ExecutionStats[];
+	    hourly: ExecutionStats[];
+	    recent: ExecutionSample[];
+	
+	    static createFrom(source: any = {}) {
+	        return new ExecutionReport(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.instruments = this.convertValues(source["instruments"], ExecutionStats);
+	        this.hourly = this.convertValues(source["hourly"], ExecutionStats);
+	        this.recent = this.convertValues(source["recent"], ExecutionSample);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class ExecutionSample {
+	    id: string;
+	    base_id: string;
+	    instrument: string;
+	    symbol?: string;
+	    action: string;
+	    is_close: boolean;
+	    // Go type: time
+	    nt_time: any;
+	    nt_price?: number;
+	    // Go type: time
+	    mt5_time: any;
+	    mt5_price?: number;
+	    receive_ms?: number;
+	    pull_ms?: number;
+	    fill_ms: number;
+	    slippage_pts?: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new ExecutionSample(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.base_id = source["base_id"];
+	        this.instrument = source["instrument"];
+	        this.symbol = source["symbol"];
+	        this.action = source["action"];
+	        this.is_close = source["is_close"];
+	        this.nt_time = this.convertValues(source["nt_time"], null);
+	        this.nt_price = source["nt_price"];
+	        this.mt5_time = this.convertValues(source["mt5_time"], null);
+	        this.mt5_price = source["mt5_price"];
+	        this.receive_ms = source["receive_ms"];
+	        this.pull_ms = source["pull_ms"];
+	        this.fill_ms = source["fill_ms"];
+	        this.slippage_pts = source["slippage_pts"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class ExecutionStats {
+	    instrument: string;
+	    symbol?: string;
+	    // Go type: time
+	    hour?: any;
+	    executions: number;
+	    receive_ms?: StatSummary;
+	    pull_ms?: StatSummary;
+	    fill_ms?: StatSummary;
+	    slippage_pts?: StatSummary;
+	
+	    static createFrom(source: any = {}) {
+	        return new ExecutionStats(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.instrument = source["instrument"];
+	        this.symbol = source["symbol"];
+	        this.hour = this.convertValues(source["hour"], null);
+	        this.executions = source["executions"];
+	        this.receive_ms = this.convertValues(source["receive_ms"], StatSummary);
+	        this.pull_ms = this.convertValues(source["pull_ms"], StatSummary);
+	        this.fill_ms = this.convertValues(source["fill_ms"], StatSummary);
+	        this.slippage_pts = this.convertValues(source["slippage_pts"], StatSummary);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class InstrumentDrift {
+	    instrument: string;
+	    expected: number;
+	    actual: number;
+	    mt5_net: number;
+	    drift: number;
+	    // Go type: time
+	    since: any;
+	    alerting: boolean;
+	    correction_id?: string;
+	    corrections: number;
+	    // Go type: time
+	    updated: any;
+	
+	    static createFrom(source: any = {}) {
+	        return new InstrumentDrift(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.instrument = source["instrument"];
+	        this.expected = source["expected"];
+	        this.actual = source["actual"];
+	        this.mt5_net = source["mt5_net"];
+	        this.drift = source["drift"];
+	        this.since = this.convertValues(source["since"], null);
+	        this.alerting = source["alerting"];
+	        this.correction_id = source["correction_id"];
+	        this.corrections = source["corrections"];
+	        this.updated = this.convertValues(source["updated"], null);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class ManualTrade {
+	    // Go type: time
+	    time: any;
+	    target?: string;
+	    ticket: number;
+	    symbol: string;
+	    action: string;
+	    volume: number;
+	    price?: number;
+	    policy: string;
+	    outcome: string;
+	    reason?: string;
+	    base_id?: string;
+	    instrument?: string;
+	    account?: string;
+	    nt_action?: string;
+	    quantity?: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new ManualTrade(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.time = this.convertValues(source["time"], null);
+	        this.target = source["target"];
+	        this.ticket = source["ticket"];
+	        this.symbol = source["symbol"];
+	        this.action = source["action"];
+	        this.volume = source["volume"];
+	        this.price = source["price"];
+	        this.policy = source["policy"];
+	        this.outcome = source["outcome"];
+	        this.reason = source["reason"];
+	        this.base_id = source["base_id"];
+	        this.instrument = source["instrument"];
+	        this.account = source["account"];
+	        this.nt_action = source["nt_action"];
+	        this.quantity = source["quantity"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class NTCommand {
+	    id: string;
+	    type: string;
+	    account?: string;
+	    instrument?: string;
+	    strategy?: string;
+	    reason?: string;
+	    status?: Record<string, any>;
+	    // Go type: time
+	    created: any;
+	    // Go type: time
+	    deadline: any;
+	    state: string;
+	    delivery?: string;
+	    message?: string;
+	    // Go type: time
+	    updated: any;
+	
+	    static createFrom(source: any = {}) {
+	        return new NTCommand(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.type = source["type"];
+	        this.account = source["account"];
+	        this.instrument = source["instrument"];
+	        this.strategy = source["strategy"];
+	        this.reason = source["reason"];
+	        this.status = source["status"];
+	        this.created = this.convertValues(source["created"], null);
+	        this.deadline = this.convertValues(source["deadline"], null);
+	        this.state = source["state"];
+	        this.delivery = source["delivery"];
+	        this.message = source["message"];
+	        this.updated = this.convertValues(source["updated"], null);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class NTTelemetryPoint {
+	    // Go type: time
+	    time: any;
+	    account?: string;
+	    balance: number;
+	    daily_pnl: number;
+	    trade_result?: string;
+	    session_trades: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new NTTelemetryPoint(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.time = this.convertValues(source["time"], null);
+	        this.account = source["account"];
+	        this.balance = source["balance"];
+	        this.daily_pnl = source["daily_pnl"];
+	        this.trade_result = source["trade_result"];
+	        this.session_trades = source["session_trades"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class StatSummary {
+	    count: number;
+	    mean: number;
+	    min: number;
+	    max: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new StatSummary(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.count = source["count"];
+	        this.mean = source["mean"];
+	        this.min = source["min"];
+	        this.max = source["max"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class TelemetryReport {
+	    nt: NTTelemetryPoint[];
+	    ea: EATelemetryPoint[];
+	
+	    static createFrom(source: any = {}) {
+	        return new TelemetryReport(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.nt = this.convertValues(source["nt"], NTTelemetryPoint);
+	        this.ea = this.convertValues(source["ea"], EATelemetryPoint);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
 	export class Trade {
 	    id: string;
 	    base_id: string;
@@ -15,10 +556,14 @@ export namespace main {
 	    raw_measurement?: number;
 	    instrument_name?: string;
 	    account_name?: string;
+	    closure_reason?: string;
 	    nt_balance?: number;
 	    nt_daily_pnl?: number;
 	    nt_trade_result?: string;
 	    nt_session_trades?: number;
+	    session_id?: string;
+	    seq?: number;
+	    contracts?: ContractFill[];
 	
 	    static createFrom(source: any = {}) {
 	        return new Trade(source);
@@ -39,10 +584,61 @@ export namespace main {
 	        this.raw_measurement = source["raw_measurement"];
 	        this.instrument_name = source["instrument_name"];
 	        this.account_name = source["account_name"];
+	        this.closure_reason = source["closure_reason"];
 	        this.nt_balance = source["nt_balance"];
 	        this.nt_daily_pnl = source["nt_daily_pnl"];
 	        this.nt_trade_result = source["nt_trade_result"];
 	        this.nt_session_trades = source["nt_session_trades"];
+	        this.session_id = source["session_id"];
+	        this.seq = source["seq"];
+	        this.contracts = this.convertValues(source["contracts"], ContractFill);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class TradeExpiry {
+	    // Go type: time
+	    time: any;
+	    trade_id: string;
+	    base_id: string;
+	    kind: string;
+	    action: string;
+	    quantity: number;
+	    instrument?: string;
+	    age_ms: number;
+	    outcome: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new TradeExpiry(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.time = this.convertValues(source["time"], null);
+	        this.trade_id = source["trade_id"];
+	        this.base_id = source["base_id"];
+	        this.kind = source["kind"];
+	        this.action = source["action"];
+	        this.quantity = source["quantity"];
+	        this.instrument = source["instrument"];
+	        this.age_ms = source["age_ms"];
+	        this.outcome = source["outcome"];
 	    }
 	
 		convertValues(a: any, classs: any, asMap: boolean = false): any {
@@ -65,4 +661,3 @@ export namespace main {
 	}
 
 }
-
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	// lockFileName marks a data directory as owned by a running bridge
+	lockFileName = "bridge.lock"
+	// addressFileName tells the EA and NT addon where the bridge is listening
+	addressFileName = "bridge_address.json"
+)
+
+// processStarted tells this process's own locks from those of an earlier
+// process that had the same pid
+var processStarted = time.Now()
+
+// startSlack absorbs the coarse clock of process start times (whole seconds
+// of boot time on Linux) when comparing one with a lock's start time
+const startSlack = 2 * time.Second
+
+// instanceLock is the lock file held by the bridge that owns a data directory
+type instanceLock struct {
+	path string
+}
+
+// lockOwner is what the lock file records about its owner
+type lockOwner struct {
+	PID     int       `json:"pid"`
+	Started time.Time `json:"started"`
+}
+
+// acquireInstanceLock claims dir for this process. It fails while another live
+// bridge holds the lock; a lock left behind by a dead process is taken over.
+func acquireInstanceLock(dir string) (*instanceLock, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, lockFileName)
+	data, _ := json.Marshal(lockOwner{PID: os.Getpid(), Started: time.Now()})
+	for attempt := 0; ; attempt++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			_, err = f.Write(data)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, err
+			}
+			return &instanceLock{path: path}, nil
+		}
+		if !os.IsExist(err) || attempt > 0 {
+			return nil, fmt.Errorf("cannot lock %s: %v", dir, err)
+		}
+		var owner lockOwner
+		if raw, rerr := os.ReadFile(path); rerr == nil && json.Unmarshal(raw, &owner) == nil && owner.lives() {
+			return nil, fmt.Errorf("another bridge (pid %d, started %s) is already running with data directory %s",
+				owner.PID, owner.Started.Format(time.RFC3339), dir)
+		}
+		log.Printf("WARNING: Taking over stale lock %s (pid %d is no longer running the bridge that took it)", path, owner.PID)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("cannot remove stale lock %s: %v", path, err)
+		}
+	}
+}
+
+// lives reports whether the owner of a lock is still running. A process that
+// started after the lock was taken only reuses the owner's pid.
+func (o lockOwner) lives() bool {
+	if o.PID == os.Getpid() {
+		return !o.Started.Before(processStarted)
+	}
+	if !processAlive(o.PID) {
+		return false
+	}
+	if started, ok := processStartTime(o.PID); ok && started.After(o.Started.Add(startSlack)) {
+		return false
+	}
+	return true
+}
+
+// release removes the lock file
+func (l *instanceLock) release() {
+	if err := os.Remove(l.path); err != nil && !os.IsNotExist(err) {
+		log.Printf("WARNING: Could not remove %s: %v", l.path, err)
+	}
+}
+
+// openApp creates the bridge for cfg after locking its data directory. If
+// another bridge holds it, the App gets an empty temporary data directory so
+// it can't disturb the running one, and only reports the conflict.
+func openApp(cfg Config) *App {
+	lock, err := acquireInstanceLock(cfg.DataDir)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		tmp, terr := os.MkdirTemp("", "BridgeApp-refused-")
+		if terr != nil {
+			tmp = filepath.Join(os.TempDir(), "BridgeApp-refused-"+strconv.Itoa(os.Getpid()))
+		}
+		cfg.DataDir = tmp
+	}
+	a := newAppWithConfig(cfg)
+	a.lock, a.lockErr = lock, err
+	return a
+}
+
+// releaseInstance removes the address files and lock of this bridge, or the
+// temporary data directory of one that was refused
+func (a *App) releaseInstance() {
+	if a.lockErr != nil {
+		os.RemoveAll(a.config.DataDir)
+		return
+	}
+	a.removeAddressFiles()
+	if a.lock != nil {
+		a.lock.release()
+		a.lock = nil
+	}
+}
+
+// BridgeAddress is written to bridge_address.json once the bridge is listening
+type BridgeAddress struct {
+	URL        string    `json:"url"`         // base URL for the EA and NT addon, e.g. http://127.0.0.1:5000
+	ListenAddr string    `json:"listen_addr"` // the address actually bound
+	Fallback   bool      `json:"fallback"`    // listen_addr was taken and fallback_listen_addr is used
+	PID        int       `json:"pid"`
+	Started    time.Time `json:"started"`
+}
+
+// listen binds listen_addr, or fallback_listen_addr when that can't be bound
+func (a *App) listen() (net.Listener, bool, error) {
+	l, err := net.Listen("tcp", a.config.ListenAddr)
+	if err == nil {
+		return l, false, nil
+	}
+	err = fmt.Errorf("cannot listen on %s: %v; is another bridge or program using it?", a.config.ListenAddr, err)
+	if a.config.FallbackListenAddr == "" {
+		return nil, false, err
+	}
+	log.Printf("WARNING: %v Trying fallback_listen_addr %s", err, a.config.FallbackListenAddr)
+	l, ferr := net.Listen("tcp", a.config.FallbackListenAddr)
+	if ferr != nil {
+		return nil, false, fmt.Errorf("%v; fallback %s: %v", err, a.config.FallbackListenAddr, ferr)
+	}
+	return l, true, nil
+}
+
+// bridgeURL is the base URL clients use to reach a bound address; an
+// unspecified host (0.0.0.0 or ::) is reached through loopback
+func bridgeURL(addr net.Addr) string {
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return "http://" + addr.String()
+	}
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// setBridgeError records why the bridge isn't serving and tells the UI
+func (a *App) setBridgeError(err error) {
+	a.queueMux.Lock()
+	a.bridgeActive = false
+	a.bridgeError = err.Error()
+	a.listenAddr = ""
+	a.queueMux.Unlock()
+	log.Printf("ERROR: Bridge is not serving: %v", err)
+	a.emit("bridgeError", map[string]interface{}{"error": err.Error()})
+}
+
+// writeAddressFiles writes bridge_address.json to the data directory and to
+// every path in address_files
+func (a *App) writeAddressFiles(addr BridgeAddress) {
+	data, err := json.Marshal(addr) // one line, so the EA can read it with FileReadString
+	if err != nil {
+		log.Printf("ERROR: Could not encode the bridge address: %v", err)
+		return
+	}
+	paths := append([]string{filepath.Join(a.config.DataDir, addressFileName)}, a.config.AddressFiles...)
+	a.addressFiles = a.addressFiles[:0]
+	for _, path := range paths {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err == nil {
+			tmp := path + ".tmp"
+			if err = os.WriteFile(tmp, data, 0o644); err == nil {
+				err = os.Rename(tmp, path)
+			}
+		}
+		if err != nil {
+			log.Printf("ERROR: Could not write the bridge address to %s: %v", path, err)
+			continue
+		}
+		a.addressFiles = append(a.addressFiles, path)
+	}
+	log.Printf("Bridge address %s written to %v", addr.URL, a.addressFiles)
+}
+
+// removeAddressFiles deletes the address files so clients don't find a stopped bridge
+func (a *App) removeAddressFiles() {
+	for _, path := range a.addressFiles {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("WARNING: Could not remove %s: %v", path, err)
+		}
+	}
+	a.addressFiles = nil
+}
+
+// readBridgeAddress reads an address file written by a running bridge
+func readBridgeAddress(path string) (BridgeAddress, error) {
+	var addr BridgeAddress
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return addr, err
+	}
+	if err := json.Unmarshal(data, &addr); err != nil {
+		return addr, err
+	}
+	if addr.URL == "" {
+		return addr, errors.New("no url")
+	}
+	return addr, nil
+}
+
+// startServer binds the listen address and serves the bridge on it. Binding
+// happens before it returns, so a taken port or a second instance is reported
+// at once instead of showing a bridge that isn't serving.
+func (a *App) startServer() error {
+	if a.lockErr != nil {
+		a.setBridgeError(a.lockErr)
+		return a.lockErr
+	}
+	l, fallback, err := a.listen()
+	if err != nil {
+		a.setBridgeError(err)
+		return err
+	}
+	server := &http.Server{Handler: a.routes()}
+	addr := BridgeAddress{URL: bridgeURL(l.Addr()), ListenAddr: l.Addr().String(), Fallback: fallback, PID: os.Getpid(), Started: time.Now()}
+
+	a.queueMux.Lock()
+	a.server = server
+	a.bridgeActive = true
+	a.bridgeError = ""
+	a.listenAddr = addr.ListenAddr
+	log.Printf("=== Bridge Server Starting ===")
+	log.Printf("Initial state:")
+	log.Printf("Net position: %d", a.netNT)
+	log.Printf("Hedge size: %.2f", a.hedgeLot)
+	log.Printf("Queue size: %d", a.tradeQueue.len())
+	a.queueMux.Unlock()
+	if fallback {
+		log.Printf("WARNING: Listening on fallback address %s instead of %s", addr.ListenAddr, a.config.ListenAddr)
+		a.emit("bridgeFallback", addr)
+	} else {
+		log.Printf("Listening on %s", addr.ListenAddr)
+	}
+	a.writeAddressFiles(addr)
+
+	go func() {
+		if err := server.Serve(l); err != nil && err != http.ErrServerClosed {
+			a.setBridgeError(fmt.Errorf("HTTP server error: %v", err))
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLockOwnerLives(t *testing.T) {
+	parent := os.Getppid()
+	started, ok := processStartTime(parent)
+	if !ok {
+		t.Skip("process start times are not available here")
+	}
+	tests := []struct {
+		name  string
+		owner lockOwner
+		want  bool
+	}{
+		{"this process", lockOwner{PID: os.Getpid(), Started: time.Now()}, true},
+		{"an earlier process with this pid", lockOwner{PID: os.Getpid(), Started: processStarted.Add(-time.Minute)}, false},
+		{"a running process that took the lock", lockOwner{PID: parent, Started: started.Add(time.Second)}, true},
+		{"a running process that started after the lock", lockOwner{PID: parent, Started: started.Add(-time.Hour)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.owner.lives(); got != tt.want {
+				t.Errorf("lives() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
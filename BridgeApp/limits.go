@@ -0,0 +1,325 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LimitsConfig bounds how fast each client may call each endpoint and how
+// large its request bodies may be
+type LimitsConfig struct {
+	// RatePerSecond is the request rate a client may sustain on one endpoint;
+	// default 50, negative turns rate limiting off
+	RatePerSecond float64 `json:"rate_per_second" yaml:"rate_per_second"`
+	// Burst is how many requests a client may make at once; default 100
+	Burst int `json:"burst" yaml:"burst"`
+	// MaxBodyBytes is the body limit of endpoints not in EndpointBodyBytes;
+	// default 65536
+	MaxBodyBytes int64 `json:"max_body_bytes" yaml:"max_body_bytes"`
+	// EndpointBodyBytes sets the body limit per path, without the /v1 prefix.
+	// Bodiless GETs such as /health and /mt5/get_trade default to 1024.
+	EndpointBodyBytes map[string]int64 `json:"endpoint_body_bytes" yaml:"endpoint_body_bytes"`
+}
+
+// defaultEndpointBodyBytes are the body limits of endpoints that take no body
+var defaultEndpointBodyBytes = map[string]int64{
+	"/health":         1024,
+	"/mt5/get_trade":  1024,
+	"/mt5/get_trades": 1024,
+}
+
+func (c *LimitsConfig) normalize() {
+	if c.RatePerSecond == 0 {
+		c.RatePerSecond = 50
+	}
+	if c.Burst <= 0 {
+		c.Burst = 100
+	}
+	if c.MaxBodyBytes <= 0 {
+		c.MaxBodyBytes = 65536
+	}
+	limits := make(map[string]int64, len(defaultEndpointBodyBytes)+len(c.EndpointBodyBytes))
+	for path, n := range defaultEndpointBodyBytes {
+		limits[path] = n
+	}
+	for path, n := range c.EndpointBodyBytes {
+		if n > 0 {
+			limits[endpointKey(path)] = n
+		}
+	}
+	c.EndpointBodyBytes = limits
+}
+
+// endpointKey is path without the /v1 prefix, so both spellings share limits
+func endpointKey(path string) string {
+	if strings.HasPrefix(path, apiVersionPrefix+"/") {
+		return strings.TrimPrefix(path, apiVersionPrefix)
+	}
+	return path
+}
+
+// otherEndpoint is the endpoint of every path the bridge doesn't serve, so a
+// client can't dodge its bucket by varying the path
+const otherEndpoint = "(other)"
+
+// idleRejections is how long a client's rejection counts are listed after its
+// last refused request
+const idleRejections = time.Hour
+
+// clientKey identifies who sent r: its IP, and the routing target it polls for
+// when that is a configured target, so several EAs on one machine are limited
+// separately. Other query parameters are ignored; a client must not be able to
+// pick a fresh bucket by changing them.
+func (a *App) clientKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !a.router.active() || r.URL.Query().Get("target") == "" {
+		return host
+	}
+	if target, ok := a.router.eaTarget(r); ok {
+		return host + " target=" + target
+	}
+	return host
+}
+
+// limitedEndpoint is the endpoint r is limited on: the pattern mux serves it
+// with, without the /v1 prefix, or otherEndpoint
+func limitedEndpoint(mux *http.ServeMux, r *http.Request) string {
+	if _, pattern := mux.Handler(r); pattern != "" && pattern != "/" {
+		return endpointKey(pattern)
+	}
+	return otherEndpoint
+}
+
+// tokenBucket is one client's allowance on one endpoint
+type tokenBucket struct {
+	tokens   float64
+	last     time.Time
+	rejected int // since the last admitted request
+}
+
+// LimitRejections are the requests refused for one client and endpoint
+type LimitRejections struct {
+	Client       string    `json:"client"`
+	Endpoint     string    `json:"endpoint"`
+	RateLimited  int       `json:"rate_limited"`
+	BodyTooLarge int       `json:"body_too_large"`
+	Last         time.Time `json:"last"`
+}
+
+// requestLimiter keeps the token buckets and counts what it refused
+type requestLimiter struct {
+	cfg LimitsConfig
+
+	mu          sync.Mutex
+	buckets     map[string]*tokenBucket
+	rejections  map[string]*LimitRejections
+	lastPrune   time.Time
+	rateLimited int
+	tooLarge    int
+}
+
+func newRequestLimiter(cfg LimitsConfig) *requestLimiter {
+	return &requestLimiter{
+		cfg:        cfg,
+		buckets:    make(map[string]*tokenBucket),
+		rejections: make(map[string]*LimitRejections),
+	}
+}
+
+// bodyLimit is the largest body accepted on endpoint
+func (l *requestLimiter) bodyLimit(endpoint string) int64 {
+	if n, ok := l.cfg.EndpointBodyBytes[endpoint]; ok && n > 0 {
+		return n
+	}
+	if l.cfg.MaxBodyBytes <= 0 {
+		return 65536
+	}
+	return l.cfg.MaxBodyBytes
+}
+
+// allow takes a token from the client's bucket for endpoint. When the bucket
+// is empty it returns false and how long until the next token.
+func (l *requestLimiter) allow(client, endpoint string, now time.Time) (bool, time.Duration) {
+	// A zero rate or burst only comes from a config that skipped normalize; it
+	// must not turn into a bucket that never refills
+	if l.cfg.RatePerSecond <= 0 || l.cfg.Burst <= 0 {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.prune(now)
+	key := client + " " + endpoint
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(l.cfg.Burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(l.cfg.Burst), b.tokens+now.Sub(b.last).Seconds()*l.cfg.RatePerSecond)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		if b.rejected > 0 {
+			log.Printf("RATE_LIMIT: %s on %s admitted again after %d rejected request(s)", client, endpoint, b.rejected)
+			b.rejected = 0
+		}
+		return true, 0
+	}
+	if b.rejected == 0 {
+		log.Printf("WARNING: RATE_LIMIT: %s exceeded %.0f request(s)/s on %s; rejecting until it slows down", client, l.cfg.RatePerSecond, endpoint)
+	}
+	b.rejected++
+	l.rateLimited++
+	l.record(client, endpoint, now).RateLimited++
+	return false, time.Duration((1 - b.tokens) / l.cfg.RatePerSecond * float64(time.Second))
+}
+
+// prune drops the buckets that have refilled, which are the same as new ones,
+// and the rejection counts idle for idleRejections. It runs at most once a
+// minute, or once per refill time when that is shorter; l.mu is held.
+func (l *requestLimiter) prune(now time.Time) {
+	interval, full := time.Minute, time.Duration(0)
+	if l.cfg.RatePerSecond > 0 && l.cfg.Burst > 0 {
+		full = time.Duration(float64(l.cfg.Burst) / l.cfg.RatePerSecond * float64(time.Second))
+		interval = min(interval, full)
+	}
+	if now.Sub(l.lastPrune) < interval {
+		return
+	}
+	l.lastPrune = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, key)
+		}
+	}
+	for key, rec := range l.rejections {
+		if now.Sub(rec.Last) >= idleRejections {
+			delete(l.rejections, key)
+		}
+	}
+}
+
+// tooLargeBody counts a body refused for exceeding the endpoint's limit
+func (l *requestLimiter) tooLargeBody(client, endpoint string, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.prune(now)
+	l.tooLarge++
+	l.record(client, endpoint, now).BodyTooLarge++
+}
+
+// record returns the rejection counts of client on endpoint; l.mu is held
+func (l *requestLimiter) record(client, endpoint string, now time.Time) *LimitRejections {
+	key := client + " " + endpoint
+	rec, ok := l.rejections[key]
+	if !ok {
+		rec = &LimitRejections{Client: client, Endpoint: endpoint}
+		l.rejections[key] = rec
+	}
+	rec.Last = now
+	return rec
+}
+
+// totals returns how many requests were rate limited and how many were too large
+func (l *requestLimiter) totals() (rateLimited, tooLarge int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rateLimited, l.tooLarge
+}
+
+// list returns the rejection counts by client and endpoint
+func (l *requestLimiter) list() []LimitRejections {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make([]LimitRejections, 0, len(l.rejections))
+	for _, rec := range l.rejections {
+		out = append(out, *rec)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Client != out[j].Client {
+			return out[i].Client < out[j].Client
+		}
+		return out[i].Endpoint < out[j].Endpoint
+	})
+	return out
+}
+
+// limitRequests answers 429 rate_limited to a client calling an endpoint too
+// often and 413 body_too_large to a body over the endpoint's limit. Bodies
+// without a Content-Length are cut off at the limit and refused by decodeBody.
+func (a *App) limitRequests(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, endpoint := a.clientKey(r), limitedEndpoint(mux, r)
+		ok, wait := a.limiter.allow(client, endpoint, time.Now())
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeAPIError(w, http.StatusTooManyRequests, errCodeRateLimited,
+				"Too many requests to "+endpoint+"; retry in "+wait.Round(time.Millisecond).String())
+			return
+		}
+		limit := a.limiter.bodyLimit(endpoint)
+		tooLarge := func() {
+			a.limiter.tooLargeBody(client, endpoint, time.Now())
+			log.Printf("WARNING: RATE_LIMIT: %s sent more than %d bytes to %s; refused", client, limit, endpoint)
+		}
+		if r.ContentLength > limit {
+			tooLarge()
+			writeAPIError(w, http.StatusRequestEntityTooLarge, errCodeBodyTooLarge,
+				"Request body exceeds "+strconv.FormatInt(limit, 10)+" bytes for "+endpoint)
+			return
+		}
+		r.Body = &limitedBody{ReadCloser: http.MaxBytesReader(w, r.Body, limit), tooLarge: tooLarge}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// limitedBody counts a body cut off at its limit the first time it is read past it
+type limitedBody struct {
+	io.ReadCloser
+	tooLarge func()
+	counted  bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if _, ok := bodyTooLarge(err); ok && !b.counted {
+		b.counted = true
+		b.tooLarge()
+	}
+	return n, err
+}
+
+// bodyTooLarge reports whether err comes from reading past a body limit, and the limit
+func bodyTooLarge(err error) (int64, bool) {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return maxErr.Limit, true
+	}
+	return 0, false
+}
+
+// limitsHandler lists the requests refused per client and endpoint: GET /v1/limits
+func (a *App) limitsHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	rateLimited, tooLarge := a.limiter.totals()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"rate_per_second": a.limiter.cfg.RatePerSecond,
+		"burst":           a.limiter.cfg.Burst,
+		"rate_limited":    rateLimited,
+		"body_too_large":  tooLarge,
+		"rejections":      a.limiter.list(),
+	})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	t0 := time.Date(2025, 1, 6, 12, 0, 0, 0, time.UTC)
+	type call struct {
+		client string
+		at     time.Duration // after t0
+		want   bool
+		wait   time.Duration // retry-after of a refused call
+	}
+	tests := []struct {
+		name  string
+		cfg   LimitsConfig
+		calls []call
+	}{
+		{"burst then refill", LimitsConfig{RatePerSecond: 2, Burst: 3}, []call{
+			{"a", 0, true, 0},
+			{"a", 0, true, 0},
+			{"a", 0, true, 0},
+			{"a", 0, false, 500 * time.Millisecond},
+			{"a", 250 * time.Millisecond, false, 250 * time.Millisecond},
+			{"a", 500 * time.Millisecond, true, 0},
+			{"a", 500 * time.Millisecond, false, 500 * time.Millisecond},
+		}},
+		{"clients have their own buckets", LimitsConfig{RatePerSecond: 1, Burst: 1}, []call{
+			{"a", 0, true, 0},
+			{"a", 0, false, time.Second},
+			{"b", 0, true, 0},
+		}},
+		{"refill stops at the burst", LimitsConfig{RatePerSecond: 10, Burst: 2}, []call{
+			{"a", 0, true, 0},
+			{"a", time.Minute, true, 0},
+			{"a", time.Minute, true, 0},
+			{"a", time.Minute, false, 100 * time.Millisecond},
+		}},
+		{"zero rate doesn't limit", LimitsConfig{RatePerSecond: 0, Burst: 1}, []call{
+			{"a", 0, true, 0},
+			{"a", 0, true, 0},
+		}},
+		{"negative rate turns limiting off", LimitsConfig{RatePerSecond: -1, Burst: 1}, []call{
+			{"a", 0, true, 0},
+			{"a", 0, true, 0},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newRequestLimiter(tt.cfg)
+			for i, c := range tt.calls {
+				ok, wait := l.allow(c.client, "/log_trade", t0.Add(c.at))
+				if ok != c.want || (wait-c.wait).Abs() > time.Millisecond {
+					t.Fatalf("call %d: allow = %v, %v; want %v, %v", i+1, ok, wait, c.want, c.wait)
+				}
+			}
+		})
+	}
+}
+
+func TestLimitKeys(t *testing.T) {
+	a := &App{router: newRouter(RoutingConfig{
+		Targets:       []RouteTarget{{ID: "acct-a"}},
+		DefaultTarget: "acct-a",
+	})}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(http.ResponseWriter, *http.Request) {})
+	mux.HandleFunc(apiVersionPrefix+"/fills/", func(http.ResponseWriter, *http.Request) {})
+	tests := []struct {
+		url      string
+		client   string
+		endpoint string
+	}{
+		{"/health", "10.0.0.1", "/health"},
+		{"/health?source=x1", "10.0.0.1", "/health"},
+		{"/health?target=acct-a", "10.0.0.1 target=acct-a", "/health"},
+		{"/health?target=made-up", "10.0.0.1", "/health"},
+		{"/v1/fills/abc", "10.0.0.1", "/fills/"},
+		{"/v1/fills/def", "10.0.0.1", "/fills/"},
+		{"/nope/1", "10.0.0.1", otherEndpoint},
+		{"/nope/2", "10.0.0.1", otherEndpoint},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		r.RemoteAddr = "10.0.0.1:5555"
+		if got := a.clientKey(r); got != tt.client {
+			t.Errorf("clientKey(%s) = %q, want %q", tt.url, got, tt.client)
+		}
+		if got := limitedEndpoint(mux, r); got != tt.endpoint {
+			t.Errorf("limitedEndpoint(%s) = %q, want %q", tt.url, got, tt.endpoint)
+		}
+	}
+}
+
+func TestLimiterPrunes(t *testing.T) {
+	t0 := time.Date(2025, 1, 6, 12, 0, 0, 0, time.UTC)
+	l := newRequestLimiter(LimitsConfig{RatePerSecond: 1, Burst: 1})
+	l.allow("a", "/health", t0)
+	l.allow("a", "/health", t0) // rejected
+	l.allow("b", "/health", t0)
+	if len(l.buckets) != 2 || len(l.rejections) != 1 {
+		t.Fatalf("limiter holds %d bucket(s), %d rejection(s); want 2, 1", len(l.buckets), len(l.rejections))
+	}
+	// Both buckets have refilled a second later; the rejection is listed for an hour
+	l.allow("c", "/health", t0.Add(time.Second))
+	if len(l.buckets) != 1 || len(l.rejections) != 1 {
+		t.Fatalf("after refill limiter holds %d bucket(s), %d rejection(s); want 1, 1", len(l.buckets), len(l.rejections))
+	}
+	l.allow("c", "/health", t0.Add(idleRejections+time.Second))
+	if len(l.rejections) != 0 {
+		t.Errorf("limiter still lists %d rejection(s) after %s", len(l.rejections), idleRejections)
+	}
+	if rateLimited, _ := l.totals(); rateLimited != 1 {
+		t.Errorf("rate_limited total = %d, want 1", rateLimited)
+	}
+}
@@ -2,8 +2,11 @@ package main
 
 import (
 	"embed"
+	"flag"
 	"fmt" // Added for debug prints
+	"io"
 	"log"
+	"os"
 
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
@@ -19,6 +22,17 @@ var icon []byte
 
 func main() {
 	fmt.Println("DEBUG: main.go - Start of main") // Added for debug
+
+	// Headless tooling commands. Parse errors (e.g. flags passed by `wails dev`)
+	// are ignored so that anything unrecognised falls through to the UI.
+	cli := flag.NewFlagSet("BridgeApp", flag.ContinueOnError)
+	cli.SetOutput(io.Discard)
+	auditPath := cli.String("verify-audit", "", "verify the hash chain of this audit log (or the one in this data directory) and exit")
+	if err := cli.Parse(os.Args[1:]); err == nil && *auditPath != "" {
+		cfg := loadConfig()
+		cfg.normalize()
+		os.Exit(runAuditVerifyCLI(*auditPath, cfg.Audit.Key, os.Stdout))
+	}
 	// Create an instance of the app structure
 	app := NewApp()
 
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// What the bridge does with a trade opened by hand on MT5
+const (
+	manualRecord = "record" // keep it in the manual trade log only
+	manualAlert  = "alert"  // record it and alert the UI
+	manualMirror = "mirror" // ask the NT addon to place the same exposure
+)
+
+// Outcomes of a manual trade report
+const (
+	manualRecorded     = "recorded"
+	manualAlerted      = "alerted"
+	manualMirrored     = "mirrored"
+	manualMirrorFailed = "mirror_failed"
+)
+
+// maxManualTrades is how many manual trade reports are kept for the UI
+const maxManualTrades = 500
+
+// mirrorBaseIDPrefix starts the base_id of every NT trade mirrored from MT5
+const mirrorBaseIDPrefix = "MT5_"
+
+// ManualTradeConfig sets what happens to positions opened or scaled by hand on MT5
+type ManualTradeConfig struct {
+	// Policy is record (default), alert or mirror
+	Policy string `json:"policy" yaml:"policy"`
+	// Account is the NT account mirrored trades are placed in. Without it, the
+	// first route of the EA's target that names a single account is used.
+	Account string `json:"account" yaml:"account"`
+	// Instruments maps MT5 symbols to the NT instrument a mirror trades, e.g.
+	// {"NAS100": "NQ 03-25"}. A symbol without one is alerted instead.
+	Instruments map[string]string `json:"instruments" yaml:"instruments"`
+}
+
+func (c *ManualTradeConfig) normalize() {
+	switch c.Policy {
+	case manualRecord, manualAlert, manualMirror:
+	default:
+		if c.Policy != "" {
+			log.Printf("WARNING: Unknown manual_trades.policy %q; manual MT5 trades will only be recorded", c.Policy)
+		}
+		c.Policy = manualRecord
+	}
+}
+
+// ManualTrade is a position the trader opened or scaled by hand on MT5, and what
+// the bridge did about it
+type ManualTrade struct {
+	Time       time.Time `json:"time"`
+	Target     string    `json:"target,omitempty"`
+	Ticket     uint64    `json:"ticket"`
+	Symbol     string    `json:"symbol"`
+	Action     string    `json:"action"` // MT5 side, Buy or Sell
+	Volume     float64   `json:"volume"`
+	Price      float64   `json:"price,omitempty"`
+	Policy     string    `json:"policy"`
+	Outcome    string    `json:"outcome"`
+	Reason     string    `json:"reason,omitempty"`
+	BaseID     string    `json:"base_id,omitempty"` // of the NT mirror
+	Instrument string    `json:"instrument,omitempty"`
+	Account    string    `json:"account,omitempty"`
+	NTAction   string    `json:"nt_action,omitempty"`
+	Quantity   float64   `json:"quantity,omitempty"`   // NT contracts mirrored
+	CommandID  string    `json:"command_id,omitempty"` // of the mirror_trade NT command
+}
+
+// manualTrades logs manual MT5 trades and remembers what the bridge itself
+// caused on either side, so nothing is mirrored back where it came from
+type manualTrades struct {
+	mu      sync.Mutex
+	cfg     ManualTradeConfig
+	seen    map[string]bool // target/ticket of every report, against EA retries
+	own     map[uint64]bool // MT5 tickets of the bridge's own hedges
+	ownLog  []uint64
+	mirrors map[string]bool // base_ids of the NT trades mirrored from MT5
+	trades  []ManualTrade
+}
+
+func newManualTrades(cfg ManualTradeConfig) *manualTrades {
+	return &manualTrades{
+		cfg:     cfg,
+		seen:    make(map[string]bool),
+		own:     make(map[uint64]bool),
+		mirrors: make(map[string]bool),
+	}
+}
+
+// ownTicket remembers an MT5 ticket the EA reported as the result of a bridge message
+func (m *manualTrades) ownTicket(ticket uint64) {
+	if ticket == 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.own[ticket] {
+		return
+	}
+	m.own[ticket] = true
+	m.ownLog = append(m.ownLog, ticket)
+	if len(m.ownLog) > maxTrackedDispatches {
+		delete(m.own, m.ownLog[0])
+		m.ownLog = m.ownLog[1:]
+	}
+}
+
+// isMirror reports whether an NT trade is the fill of a mirrored manual MT5 trade
+func (m *manualTrades) isMirror(baseID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mirrors[baseID]
+}
+
+// report takes a manual trade report. It returns false for a ticket already
+// reported or one the bridge opened itself, which are not acted on again.
+func (m *manualTrades) report(target string, ticket uint64) (fresh bool, reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.own[ticket] {
+		return false, "opened by the bridge"
+	}
+	key := target + "/" + strconv.FormatUint(ticket, 10)
+	if m.seen[key] {
+		return false, "already reported"
+	}
+	m.seen[key] = true
+	return true, ""
+}
+
+// expectMirror marks baseID as a mirror before the addon is asked to place it,
+// as its NT fill may arrive before the addon has answered
+func (m *manualTrades) expectMirror(baseID string, expect bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if expect {
+		m.mirrors[baseID] = true
+	} else {
+		delete(m.mirrors, baseID)
+	}
+}
+
+func (m *manualTrades) record(t ManualTrade) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.trades = append(m.trades, t)
+	if len(m.trades) > maxManualTrades {
+		m.trades = m.trades[len(m.trades)-maxManualTrades:]
+	}
+}
+
+// failMirror marks the trade mirrored as baseID as failed and returns it. Unless
+// keep is set, a later NT fill under baseID is no longer taken as the mirror.
+func (m *manualTrades) failMirror(baseID, reason string, keep bool) (ManualTrade, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !keep {
+		delete(m.mirrors, baseID)
+	}
+	for i := len(m.trades) - 1; i >= 0; i-- {
+		if m.trades[i].BaseID == baseID {
+			m.trades[i].Outcome, m.trades[i].Reason = manualMirrorFailed, reason
+			return m.trades[i], true
+		}
+	}
+	return ManualTrade{}, false
+}
+
+// setCommand records the id of the mirror_trade command sent for baseID
+func (m *manualTrades) setCommand(baseID, id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.trades) - 1; i >= 0; i-- {
+		if m.trades[i].BaseID == baseID {
+			m.trades[i].CommandID = id
+			return
+		}
+	}
+}
+
+func (m *manualTrades) list() []ManualTrade {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]ManualTrade{}, m.trades...)
+}
+
+// accountFor returns the NT account a target's manual trades are mirrored to
+func (r *router) accountFor(target string, cfg ManualTradeConfig) string {
+	if cfg.Account != "" || !r.active() {
+		return cfg.Account
+	}
+	for _, rt := range r.cfg.Routes {
+		if rt.Target != target {
+			continue
+		}
+		if !strings.ContainsAny(rt.Account, `*?[\`) {
+			return rt.Account
+		}
+	}
+	return ""
+}
+
+// MT5ManualTrade is the body the EA posts to /mt5/manual_trade for a deal it did not place
+type MT5ManualTrade struct {
+	Ticket uint64    `json:"ticket"`
+	Symbol string    `json:"symbol"`
+	Action string    `json:"action"`
+	Volume float64   `json:"volume"`
+	Price  float64   `json:"price"`
+	Time   time.Time `json:"time"`
+}
+
+// manualTradeHandler takes a deal opened by hand on MT5 and records, alerts or
+// mirrors it: POST /mt5/manual_trade?target=ftmo-1
+func (a *App) manualTradeHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+	target, ok := a.requireEATarget(w, r)
+	if !ok {
+		return
+	}
+	var deal MT5ManualTrade
+	if _, ok := decodeBody(w, r, "MT5ManualTrade", &deal); !ok {
+		return
+	}
+	if fresh, reason := a.manual.report(target, deal.Ticket); !fresh {
+		log.Printf("MANUAL: Ignoring MT5%s ticket %d: %s", targetLabel(target), deal.Ticket, reason)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ignored", "ticket": deal.Ticket, "reason": reason})
+		return
+	}
+	if deal.Time.IsZero() {
+		deal.Time = time.Now()
+	}
+
+	t := a.handleManualTrade(target, deal)
+	a.manual.record(t)
+	if t.Outcome == manualMirrored {
+		t.CommandID = a.mirrorToNT(t)
+	}
+	if t.Outcome == manualRecorded {
+		log.Printf("MANUAL: MT5%s %s %.2f %s (ticket %d) recorded", targetLabel(target), t.Action, t.Volume, t.Symbol, t.Ticket)
+	} else {
+		log.Printf("MANUAL: MT5%s %s %.2f %s (ticket %d) %s: %s",
+			targetLabel(target), t.Action, t.Volume, t.Symbol, t.Ticket, t.Outcome, t.Reason)
+	}
+	a.emit("manualTrade", t)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "success", "outcome": t.Outcome, "base_id": t.BaseID})
+}
+
+// handleManualTrade applies the policy to a manual deal. A mirror that can't be
+// placed is alerted instead.
+func (a *App) handleManualTrade(target string, deal MT5ManualTrade) ManualTrade {
+	cfg := a.manual.cfg
+	t := ManualTrade{Time: deal.Time, Target: target, Ticket: deal.Ticket, Symbol: deal.Symbol, Action: deal.Action,
+		Volume: deal.Volume, Price: deal.Price, Policy: cfg.Policy, Outcome: manualRecorded}
+	switch cfg.Policy {
+	case manualRecord:
+		return t
+	case manualAlert:
+		t.Outcome, t.Reason = manualAlerted, "opened by hand on MT5"
+		return t
+	}
+
+	t.Outcome = manualAlerted
+	t.Instrument = cfg.Instruments[deal.Symbol]
+	if t.Instrument == "" {
+		t.Reason = "no NT instrument for symbol " + deal.Symbol
+		return t
+	}
+	t.Account = a.router.accountFor(target, cfg)
+	if t.Account == "" {
+		t.Reason = "no NT account to mirror into"
+		return t
+	}
+	_, direction, rerr := a.router.resolve(t.Account, false)
+	if rerr != nil || direction == directionDisabled {
+		t.Reason = "NT account " + t.Account + " is not hedged"
+		return t
+	}
+	t.Quantity = math.Round(deal.Volume / a.config.DriftVolumePerContract / a.router.ratio(target))
+	if t.Quantity < 1 {
+		t.Reason = fmt.Sprintf("%.2f lots is less than one NT contract", deal.Volume)
+		return t
+	}
+	// The NT side that MT5's side hedges (or copies) under the account's direction
+	side := mt5Sign(ntSign(deal.Action), direction)
+	t.NTAction = "Buy"
+	if side < 0 {
+		t.NTAction = "Sell"
+	}
+	t.BaseID = mirrorBaseIDPrefix + strconv.FormatUint(deal.Ticket, 10)
+	if target != "" {
+		t.BaseID = mirrorBaseIDPrefix + target + "_" + strconv.FormatUint(deal.Ticket, 10)
+	}
+	a.manual.expectMirror(t.BaseID, true)
+	t.Outcome, t.Reason = manualMirrored, "mirror_trade command sent; NT fills as "+t.BaseID
+	a.drift.manualOpened(t, direction, a.router.ratio(target))
+	return t
+}
+
+// mirrorToNT sends the mirror_trade command for a recorded manual trade. The
+// trade is recorded first, so a command refused at once still finds it.
+func (a *App) mirrorToNT(t ManualTrade) string {
+	c := a.sendNTCommand(NTCommand{Type: cmdMirrorTrade, Account: t.Account, Instrument: t.Instrument,
+		BaseID: t.BaseID, Action: t.NTAction, Quantity: t.Quantity, MT5Ticket: t.Ticket, Reason: "manual MT5 trade"})
+	a.manual.setCommand(t.BaseID, c.ID)
+	return c.ID
+}
+
+// mirrorFailed alerts a manual trade whose mirror_trade command the addon
+// refused or never acknowledged. The manual MT5 position stays booked, so the
+// missing NT side shows as drift.
+func (a *App) mirrorFailed(c NTCommand, keep bool) {
+	t, ok := a.manual.failMirror(c.BaseID, "mirror_trade command "+c.ID+" "+c.State+": "+c.Message, keep)
+	if !ok {
+		return
+	}
+	log.Printf("MANUAL: Mirror %s of MT5%s ticket %d failed: %s", t.BaseID, targetLabel(t.Target), t.Ticket, t.Reason)
+	a.emit("manualTrade", t)
+}
+
+// bookMirror books the NT fill of a mirrored manual trade. Its MT5 side is the
+// manual position, so nothing is queued for the EA.
+func (a *App) bookMirror(trade Trade) {
+	a.drift.ntFill(trade)
+	a.queueMux.Lock()
+	defer a.queueMux.Unlock()
+	switch trade.Action {
+	case "Buy":
+		a.netNT += int(trade.Quantity)
+	case "Sell":
+		a.netNT -= int(trade.Quantity)
+	}
+	a.hedgeLot = float64(a.netNT)
+	a.recordAuditLocked(auditManualMirror, "mt5", map[string]interface{}{
+		"trade_id": trade.ID, "base_id": trade.BaseID, "action": trade.Action, "quantity": trade.Quantity,
+		"instrument": trade.Instrument, "account": trade.AccountName,
+	})
+	log.Printf("MANUAL: NT filled mirror %s %s %.0f %s; net position %d, not forwarded to MT5",
+		trade.BaseID, trade.Action, trade.Quantity, trade.Instrument, a.netNT)
+}
+
+// manualTradesHandler lists the manual MT5 trades: GET /v1/manual_trades
+func (a *App) manualTradesHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"policy": a.manual.cfg.Policy,
+		"trades": a.manual.list(),
+	})
+}
+
+// GetManualTrades returns the trades opened by hand on MT5 and what the bridge did about them
+func (a *App) GetManualTrades() []ManualTrade {
+	return a.manual.list()
+}
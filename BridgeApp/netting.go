@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// netTargetOrderType marks an entry that replaces several queued messages with
+// their net effect. To the EA it is an ordinary entry with a base_id of its own;
+// the bridge translates between that base_id and the ones NT knows (see netBook).
+const netTargetOrderType = "NET_TARGET"
+
+// NetShare is the part of a net target's hedge that stands for one of the NT
+// base_ids folded into it
+type NetShare struct {
+	BaseID   string  `json:"base_id"`
+	Quantity float64 `json:"quantity"`
+}
+
+// netTargetSeq keeps net target ids unique when several are made in one second
+var netTargetSeq atomic.Uint64
+
+// netKey groups messages that can be netted against each other
+type netKey struct {
+	instrument string
+	account    string
+	target     string
+	direction  string
+}
+
+// netOut collapses queued messages into one entry per instrument and account for
+// the net position change they represent. Entries are netted, and so are closes
+// and measurements for base_ids whose entry is among msgs. A close for a hedge
+// opened before msgs refers to a position MT5 already holds, so it is kept as is.
+// kept holds the messages left as they were, in their original order; collapsed
+// counts the messages that were folded into targets or dropped. Each target's
+// NetOf lists the base_ids on its side whose NT position its hedge stands for.
+func netOut(msgs []Trade, now time.Time, idPrefix string) (kept, targets []Trade, collapsed int) {
+	entries := make(map[string]netKey) // base_id -> key, for entries in msgs
+	signs := make(map[string]float64)
+	open := make(map[string]float64) // base_id -> NT quantity still open after the closes in msgs
+	var order []string               // base_ids of entries, first seen first
+	net := make(map[netKey]float64)
+	for _, t := range msgs {
+		if t.Action == "CLOSE_HEDGE" || t.OrderType == "TP" || t.OrderType == "SL" {
+			continue
+		}
+		if sign := ntSign(t.Action); sign != 0 && t.BaseID != "" {
+			if _, seen := entries[t.BaseID]; !seen {
+				order = append(order, t.BaseID)
+			}
+			entries[t.BaseID] = netKey{t.Instrument, t.AccountName, t.Target, t.Direction}
+			signs[t.BaseID] = sign
+			open[t.BaseID] += t.Quantity
+		}
+	}
+
+	for _, t := range msgs {
+		switch {
+		case t.Action == "CLOSE_HEDGE":
+			key, ok := entries[t.BaseID]
+			if !ok {
+				kept = append(kept, t)
+				continue
+			}
+			net[key] -= signs[t.BaseID] * t.Quantity
+			open[t.BaseID] -= t.Quantity
+		case t.OrderType == "TP" || t.OrderType == "SL":
+			if _, ok := entries[t.BaseID]; !ok {
+				kept = append(kept, t)
+				continue
+			}
+		default:
+			sign := ntSign(t.Action)
+			if sign == 0 {
+				kept = append(kept, t)
+				continue
+			}
+			net[netKey{t.Instrument, t.AccountName, t.Target, t.Direction}] += sign * t.Quantity
+		}
+		collapsed++
+	}
+
+	keys := make([]netKey, 0, len(net))
+	for key, qty := range net {
+		if math.Abs(qty) > 1e-9 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].instrument != keys[j].instrument {
+			return keys[i].instrument < keys[j].instrument
+		}
+		return keys[i].account < keys[j].account
+	})
+	for _, key := range keys {
+		qty := net[key]
+		action := "Buy"
+		if qty < 0 {
+			action = "Sell"
+		}
+		// The sequence comes first: the EA tells base_ids apart by their first
+		// 16 characters
+		id := fmt.Sprintf("%s_%d_%d", idPrefix, netTargetSeq.Add(1), now.Unix())
+		var shares []NetShare
+		left := math.Abs(qty)
+		for _, baseID := range order {
+			if entries[baseID] != key || signs[baseID]*qty <= 0 || open[baseID] <= 1e-9 || left <= 1e-9 {
+				continue
+			}
+			q := math.Min(open[baseID], left)
+			shares = append(shares, NetShare{BaseID: baseID, Quantity: q})
+			left -= q
+		}
+		targets = append(targets, Trade{
+			ID:            id,
+			BaseID:        id,
+			Time:          now,
+			Action:        action,
+			Quantity:      math.Abs(qty),
+			TotalQuantity: int(math.Ceil(math.Abs(qty))),
+			ContractNum:   1,
+			OrderType:     netTargetOrderType,
+			Instrument:    key.instrument,
+			AccountName:   key.account,
+			Target:        key.target,
+			Direction:     key.direction,
+			NetOf:         shares,
+		})
+	}
+	return kept, targets, collapsed
+}
+
+// netBook maps the NT base_ids folded into net targets to the net target whose
+// MT5 hedge stands for them: an NT close of one of them closes its share of
+// that hedge, and an MT5 closure of that hedge reaches NT as closures of them
+type netBook struct {
+	mu       sync.Mutex
+	original map[string]string     // NT base_id -> net target base_id
+	shares   map[string][]NetShare // net target base_id -> its shares still open, oldest first
+}
+
+func newNetBook() *netBook {
+	return &netBook{original: make(map[string]string), shares: make(map[string][]NetShare)}
+}
+
+// add books the shares of net target t
+func (b *netBook) add(t Trade) {
+	if len(t.NetOf) == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.shares[t.BaseID] = append([]NetShare(nil), t.NetOf...)
+	for _, s := range t.NetOf {
+		b.original[s.BaseID] = t.BaseID
+	}
+}
+
+// closeOriginal takes an NT close of quantity of baseID off its share. ok is
+// false when baseID isn't part of a net target; otherwise netID is the hedge to
+// close and q how much of it, which is zero once the share is used up.
+func (b *netBook) closeOriginal(baseID string, quantity float64) (netID string, q float64, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	netID, ok = b.original[baseID]
+	if !ok {
+		return "", 0, false
+	}
+	shares := b.shares[netID]
+	for i := range shares {
+		if shares[i].BaseID == baseID {
+			q = math.Min(quantity, shares[i].Quantity)
+			shares[i].Quantity -= q
+			break
+		}
+	}
+	b.prune(netID)
+	return netID, q, true
+}
+
+// closeNet splits an MT5 closure of quantity of net target netID over its
+// shares, oldest first. It returns nil when netID is not a net target.
+func (b *netBook) closeNet(netID string, quantity float64) []NetShare {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	shares, ok := b.shares[netID]
+	if !ok {
+		return nil
+	}
+	var out []NetShare
+	for i := range shares {
+		if quantity <= 1e-9 {
+			break
+		}
+		if q := math.Min(quantity, shares[i].Quantity); q > 1e-9 {
+			out = append(out, NetShare{BaseID: shares[i].BaseID, Quantity: q})
+			shares[i].Quantity -= q
+			quantity -= q
+		}
+	}
+	if quantity > 1e-9 {
+		log.Printf("WARNING: NETTING: MT5 closed %.2f more of net target %s than its NT base_ids account for", quantity, netID)
+	}
+	b.prune(netID)
+	return out
+}
+
+// prune forgets the shares of netID that are closed; b.mu is held
+func (b *netBook) prune(netID string) {
+	shares := b.shares[netID][:0]
+	for _, s := range b.shares[netID] {
+		if s.Quantity > 1e-9 {
+			shares = append(shares, s)
+		} else {
+			delete(b.original, s.BaseID)
+		}
+	}
+	if len(shares) == 0 {
+		delete(b.shares, netID)
+		return
+	}
+	b.shares[netID] = shares
+}
+
+// netTargetOf returns the net target baseID was folded into
+func (b *netBook) netTargetOf(baseID string) (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	netID, ok := b.original[baseID]
+	return netID, ok
+}
+
+// snapshot returns the open shares by net target, for state.json
+func (b *netBook) snapshot() map[string][]NetShare {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := make(map[string][]NetShare, len(b.shares))
+	for netID, shares := range b.shares {
+		out[netID] = append([]NetShare(nil), shares...)
+	}
+	return out
+}
+
+// restore books the shares saved by the last shutdown
+func (b *netBook) restore(shares map[string][]NetShare) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for netID, list := range shares {
+		b.shares[netID] = append([]NetShare(nil), list...)
+		for _, s := range list {
+			b.original[s.BaseID] = netID
+		}
+	}
+}
+
+// netClosureBodies rewrites an MT5 closure notification of a net target into
+// one per share, each naming the share's base_id and quantity
+func netClosureBodies(body []byte, shares []NetShare) [][]byte {
+	out := make([][]byte, len(shares))
+	for i, s := range shares {
+		out[i] = body
+		var fields map[string]interface{}
+		if json.Unmarshal(body, &fields) != nil {
+			continue
+		}
+		fields["base_id"], fields["closed_hedge_quantity"] = s.BaseID, s.Quantity
+		if rewritten, err := json.Marshal(fields); err == nil {
+			out[i] = rewritten
+		}
+	}
+	return out
+}
+
+// queueNetted queues messages that came out of netOut, booking the shares of
+// the net targets among them
+func (a *App) queueNetted(msgs []Trade) {
+	a.trackNetTargets(msgs)
+	for _, t := range msgs {
+		a.tradeQueue.push(t)
+	}
+}
+
+// trackNetTargets records the net targets among msgs before they are queued
+func (a *App) trackNetTargets(msgs []Trade) {
+	for _, t := range msgs {
+		if t.OrderType == netTargetOrderType {
+			a.netting.add(t)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNetOut(t *testing.T) {
+	now := time.Date(2025, 1, 6, 12, 0, 0, 0, time.UTC)
+	entry := func(baseID, action string, qty float64, instrument string) Trade {
+		return Trade{ID: baseID, BaseID: baseID, Action: action, Quantity: qty, Instrument: instrument, AccountName: "Sim101"}
+	}
+	closeOf := func(baseID string, qty float64) Trade {
+		return Trade{ID: baseID + "_close", BaseID: baseID, Action: "CLOSE_HEDGE", Quantity: qty, Instrument: "NQ", AccountName: "Sim101"}
+	}
+	tp := Trade{ID: "tp", BaseID: "X", Action: "Sell", Quantity: 1, OrderType: "TP", Instrument: "NQ", AccountName: "Sim101"}
+
+	// target is what a net target should hold, without its generated id
+	type target struct {
+		instrument string
+		action     string
+		quantity   float64
+		netOf      []NetShare
+	}
+	tests := []struct {
+		name      string
+		msgs      []Trade
+		kept      []string // ids
+		targets   []target
+		collapsed int
+	}{
+		{"opposite entries net", []Trade{entry("A", "Buy", 2, "NQ"), entry("B", "Sell", 1, "NQ")},
+			nil, []target{{"NQ", "Buy", 1, []NetShare{{"A", 1}}}}, 2},
+		{"entries in one direction add up", []Trade{entry("A", "Sell", 1, "NQ"), entry("B", "Sell", 2, "NQ")},
+			nil, []target{{"NQ", "Sell", 3, []NetShare{{"A", 1}, {"B", 2}}}}, 2},
+		{"entry closed within the batch", []Trade{entry("A", "Buy", 2, "NQ"), closeOf("A", 2)},
+			nil, nil, 2},
+		{"partly closed entry", []Trade{entry("A", "Buy", 3, "NQ"), closeOf("A", 1)},
+			nil, []target{{"NQ", "Buy", 2, []NetShare{{"A", 2}}}}, 2},
+		{"close of an older hedge is kept", []Trade{closeOf("X", 1), entry("A", "Buy", 1, "NQ")},
+			[]string{"X_close"}, []target{{"NQ", "Buy", 1, []NetShare{{"A", 1}}}}, 1},
+		{"TP of an older hedge is kept", []Trade{tp, entry("A", "Buy", 1, "NQ")},
+			[]string{"tp"}, []target{{"NQ", "Buy", 1, []NetShare{{"A", 1}}}}, 1},
+		{"instruments net separately", []Trade{entry("A", "Buy", 1, "NQ"), entry("B", "Sell", 1, "ES")},
+			nil, []target{{"ES", "Sell", 1, []NetShare{{"B", 1}}}, {"NQ", "Buy", 1, []NetShare{{"A", 1}}}}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, targets, collapsed := netOut(tt.msgs, now, "NET")
+			var keptIDs []string
+			for _, k := range kept {
+				keptIDs = append(keptIDs, k.ID)
+			}
+			if !reflect.DeepEqual(keptIDs, tt.kept) {
+				t.Errorf("kept %v, want %v", keptIDs, tt.kept)
+			}
+			if collapsed != tt.collapsed {
+				t.Errorf("collapsed %d, want %d", collapsed, tt.collapsed)
+			}
+			if len(targets) != len(tt.targets) {
+				t.Fatalf("got %d targets, want %d: %+v", len(targets), len(tt.targets), targets)
+			}
+			for i, want := range tt.targets {
+				got := targets[i]
+				if got.Instrument != want.instrument || got.Action != want.action || got.Quantity != want.quantity ||
+					!reflect.DeepEqual(got.NetOf, want.netOf) {
+					t.Errorf("target %d = %s %s %v net of %v; want %s %s %v net of %v", i,
+						got.Instrument, got.Action, got.Quantity, got.NetOf, want.instrument, want.action, want.quantity, want.netOf)
+				}
+				if got.OrderType != netTargetOrderType || got.BaseID != got.ID {
+					t.Errorf("target %d: order type %q, base_id %q, id %q", i, got.OrderType, got.BaseID, got.ID)
+				}
+			}
+		})
+	}
+}
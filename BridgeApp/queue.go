@@ -0,0 +1,315 @@
+package main
+
+import (
+	"log"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// lane is a priority class of the MT5-bound queue. Lower values are served first.
+type lane int
+
+const (
+	laneClose lane = iota // CLOSE_HEDGE: risk-reducing, served first
+	laneEntry             // Buy/Sell entries and everything else
+	laneInfo              // TP/SL measurements, informational only
+	laneCount
+)
+
+var laneNames = [laneCount]string{"close", "entry", "info"}
+
+func (l lane) String() string {
+	return laneNames[l]
+}
+
+// laneFor classifies a message for the MT5 queue
+func laneFor(t Trade) lane {
+	switch {
+	case t.Action == "CLOSE_HEDGE":
+		return laneClose
+	case t.OrderType == "TP" || t.OrderType == "SL":
+		return laneInfo
+	default:
+		return laneEntry
+	}
+}
+
+// queuedTrade is a queue entry with its arrival order
+type queuedTrade struct {
+	trade    Trade
+	arrival  uint64
+	queuedAt time.Time
+	segment  uint64 // spill segment it was read from, 0 if it never left memory
+}
+
+// tradeQueue holds messages waiting for the EA in three FIFO lanes. getTradeHandler
+// serves closes first, then entries, then measurements, so a backed-up queue never
+// makes a risk-reducing close wait behind risk-increasing entries.
+//
+// Each lane keeps up to memoryPerLane messages in memory. Beyond that it spills to
+// segment files on disk and refills from them as the EA drains the queue, so a
+// burst while MT5 is offline is absorbed instead of refused. Spilled messages
+// survive a bridge restart.
+type tradeQueue struct {
+	mu            sync.Mutex
+	lanes         [laneCount][]queuedTrade // in-memory heads
+	spill         [laneCount]*spillStore   // nil when the lane could not open its spill directory
+	memoryPerLane int
+	arrivals      uint64
+}
+
+// queueStats is the queue's state as reported in status and health responses
+type queueStats struct {
+	Depths     map[string]int // per lane, memory and disk
+	Spilled    int            // messages currently on disk
+	SpillBytes int64
+	OldestAge  time.Duration // age of the oldest queued message, 0 when empty
+}
+
+// newTradeQueue creates a queue keeping memoryPerLane messages per lane in memory
+// and spilling the rest under spillDir/<lane>. An empty spillDir, or one that can't
+// be opened, keeps everything in memory.
+func newTradeQueue(memoryPerLane int, spillDir string, segmentRecords int) *tradeQueue {
+	q := &tradeQueue{memoryPerLane: memoryPerLane}
+	if spillDir == "" {
+		return q
+	}
+	for l := lane(0); l < laneCount; l++ {
+		store, err := openSpillStore(filepath.Join(spillDir, l.String()), segmentRecords)
+		if err != nil {
+			log.Printf("WARNING: Queue lane %s cannot spill to disk (%v); it will grow in memory instead", l, err)
+			continue
+		}
+		q.spill[l] = store
+		if store.maxArrival > q.arrivals {
+			q.arrivals = store.maxArrival
+		}
+		q.refill(l)
+	}
+	return q
+}
+
+// push appends t to its lane. It never refuses a message: once the lane's memory
+// is full, or while older messages are still on disk, t is written to disk.
+func (q *tradeQueue) push(t Trade) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	l := laneFor(t)
+	q.arrivals++
+	qt := queuedTrade{trade: t, arrival: q.arrivals, queuedAt: time.Now()}
+	if store := q.spill[l]; store != nil && (store.count > 0 || len(q.lanes[l]) >= q.memoryPerLane) {
+		if err := store.append(qt); err == nil {
+			return
+		} else if store.count == 0 {
+			log.Printf("WARNING: Spill to disk failed for lane %s, keeping message %s in memory: %v", l, t.ID, err)
+		} else {
+			// Older messages are on disk, so this one jumps ahead of them, but
+			// losing it would be worse
+			log.Printf("ERROR: Spill to disk failed for lane %s with %d message(s) already spilled; message %s kept in memory out of order: %v", l, store.count, t.ID, err)
+		}
+	}
+	q.lanes[l] = append(q.lanes[l], qt)
+}
+
+// pop removes the next message in priority order. A close never overtakes an
+// entry for the same base_id that was queued before it: that entry is served
+// first, so the EA doesn't try to close a hedge it hasn't opened yet.
+func (q *tradeQueue) pop() (Trade, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for l := lane(0); l < laneCount; l++ {
+		if len(q.lanes[l]) == 0 {
+			continue
+		}
+		head := q.lanes[l][0]
+		if l == laneClose {
+			if i := q.earlierEntryFor(head.trade.BaseID, head.arrival); i >= 0 {
+				entry := q.lanes[laneEntry][i]
+				q.lanes[laneEntry] = append(q.lanes[laneEntry][:i], q.lanes[laneEntry][i+1:]...)
+				q.served(laneEntry, entry)
+				q.refill(laneEntry)
+				return entry.trade, true
+			}
+			if store := q.spill[laneEntry]; store != nil && store.holdsBefore(head.trade.BaseID, head.arrival) && len(q.lanes[laneEntry]) > 0 {
+				// The entry is still on disk: work the entry lane down towards it
+				entry := q.lanes[laneEntry][0]
+				q.lanes[laneEntry] = q.lanes[laneEntry][1:]
+				q.served(laneEntry, entry)
+				q.refill(laneEntry)
+				return entry.trade, true
+			}
+		}
+		q.lanes[l] = q.lanes[l][1:]
+		q.served(l, head)
+		q.refill(l)
+		return head.trade, true
+	}
+	return Trade{}, false
+}
+
+// served records that messages read back from lane l's spill segments have left
+// the queue. q.mu must be held.
+func (q *tradeQueue) served(l lane, qts ...queuedTrade) {
+	if store := q.spill[l]; store != nil {
+		store.serve(qts...)
+	}
+}
+
+// drain removes every queued message, in memory and on disk, and returns them in
+// arrival order
+func (q *tradeQueue) drain() []Trade {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var all []queuedTrade
+	for l := lane(0); l < laneCount; l++ {
+		drained := q.lanes[l]
+		q.lanes[l] = nil
+		if store := q.spill[l]; store != nil {
+			for {
+				qt, ok := store.next()
+				if !ok {
+					break
+				}
+				drained = append(drained, qt)
+			}
+		}
+		q.served(l, drained...)
+		all = append(all, drained...)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].arrival < all[j].arrival })
+	out := make([]Trade, len(all))
+	for i, qt := range all {
+		out[i] = qt.trade
+	}
+	return out
+}
+
+// persist writes every queued message to disk in arrival order, so the queue
+// survives a restart whole. Messages moved to memory but still in a partly read
+// segment are rewritten once instead of being replayed twice. It returns how many
+// messages are on disk and those that could only stay in memory. The lanes are
+// left empty in memory, so it is only for shutdown.
+func (q *tradeQueue) persist() (int, []Trade) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	saved := 0
+	var unsaved []Trade
+	for l := lane(0); l < laneCount; l++ {
+		all := q.lanes[l]
+		q.lanes[l] = nil
+		store := q.spill[l]
+		if store == nil {
+			for _, qt := range all {
+				unsaved = append(unsaved, qt.trade)
+			}
+			continue
+		}
+		for {
+			qt, ok := store.next()
+			if !ok {
+				break
+			}
+			all = append(all, qt)
+		}
+		sort.Slice(all, func(i, j int) bool { return all[i].arrival < all[j].arrival })
+		var rewritten []queuedTrade
+		for _, qt := range all {
+			if err := store.append(qt); err != nil {
+				log.Printf("ERROR: Could not persist queued message %s in lane %s: %v", qt.trade.ID, l, err)
+				unsaved = append(unsaved, qt.trade)
+				q.lanes[l] = append(q.lanes[l], qt)
+				continue
+			}
+			rewritten = append(rewritten, qt)
+			saved++
+		}
+		// Their new copies are on disk: the records they were read from are done
+		store.serve(rewritten...)
+	}
+	return saved, unsaved
+}
+
+// refill moves spilled messages back into memory up to the lane's memory limit
+func (q *tradeQueue) refill(l lane) {
+	store := q.spill[l]
+	if store == nil {
+		return
+	}
+	for len(q.lanes[l]) < q.memoryPerLane {
+		qt, ok := store.next()
+		if !ok {
+			return
+		}
+		q.lanes[l] = append(q.lanes[l], qt)
+	}
+}
+
+// earlierEntryFor returns the index of the first in-memory entry for baseID that
+// arrived before the given arrival number, or -1
+func (q *tradeQueue) earlierEntryFor(baseID string, before uint64) int {
+	if baseID == "" {
+		return -1
+	}
+	for i, e := range q.lanes[laneEntry] {
+		if e.arrival > before {
+			break
+		}
+		if e.trade.BaseID == baseID {
+			return i
+		}
+	}
+	return -1
+}
+
+// len returns the number of queued messages across all lanes, including spilled ones
+func (q *tradeQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := 0
+	for l := lane(0); l < laneCount; l++ {
+		n += q.laneLen(l)
+	}
+	return n
+}
+
+func (q *tradeQueue) laneLen(l lane) int {
+	n := len(q.lanes[l])
+	if store := q.spill[l]; store != nil {
+		n += store.count
+	}
+	return n
+}
+
+// depths returns the number of queued messages per lane, keyed by lane name
+func (q *tradeQueue) depths() map[string]int {
+	return q.stats().Depths
+}
+
+// stats returns per-lane depths, the spill size and the oldest message's age
+func (q *tradeQueue) stats() queueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	st := queueStats{Depths: make(map[string]int, laneCount)}
+	var oldest time.Time
+	for l := lane(0); l < laneCount; l++ {
+		st.Depths[l.String()] = q.laneLen(l)
+		// The in-memory head is the lane's oldest message unless a disk write
+		// failure left memory holding newer messages than the disk
+		if len(q.lanes[l]) > 0 && (oldest.IsZero() || q.lanes[l][0].queuedAt.Before(oldest)) {
+			oldest = q.lanes[l][0].queuedAt
+		}
+		if store := q.spill[l]; store != nil {
+			st.Spilled += store.count
+			st.SpillBytes += store.bytes()
+			if at, ok := store.oldest(); ok && (oldest.IsZero() || at.Before(oldest)) {
+				oldest = at
+			}
+		}
+	}
+	if !oldest.IsZero() {
+		st.OldestAge = time.Since(oldest)
+	}
+	return st
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRoutedQueueRewriteHoldsPushes(t *testing.T) {
+	q := newRoutedQueue(10, "", 0, nil)
+	q.push(Trade{ID: "A", Action: "Buy"})
+	q.push(Trade{ID: "B", Action: "Sell"})
+
+	inRewrite := make(chan struct{})
+	release := make(chan struct{})
+	pushed := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		q.rewrite(nil, func(queued []Trade) []Trade {
+			if len(queued) != 2 {
+				t.Errorf("rewrite drained %d message(s), want 2", len(queued))
+			}
+			close(inRewrite)
+			<-release
+			return []Trade{{ID: "net", Action: "Buy"}}
+		})
+		close(done)
+	}()
+	<-inRewrite
+	go func() {
+		q.push(Trade{ID: "C", Action: "Buy"})
+		close(pushed)
+	}()
+	select {
+	case <-pushed:
+		t.Fatal("push landed while the queue was being rewritten")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-done
+	<-pushed
+
+	var got []string
+	for {
+		m, ok := q.pop("")
+		if !ok {
+			break
+		}
+		got = append(got, m.ID)
+	}
+	if len(got) != 2 || got[0] != "net" || got[1] != "C" {
+		t.Errorf("queue after rewrite = %v, want [net C]", got)
+	}
+}
+
+func TestTradeQueueReopenAfterPartialConsumption(t *testing.T) {
+	dir := t.TempDir()
+	q := newTradeQueue(1, dir, 500)
+	for _, id := range []string{"A", "B", "C", "D", "E"} {
+		q.push(Trade{ID: id, Action: "Buy"})
+	}
+	// A was kept in memory; B..E spilled. Serving A and B moves C into memory.
+	for _, want := range []string{"A", "B"} {
+		if m, ok := q.pop(); !ok || m.ID != want {
+			t.Fatalf("pop = %q, %t; want %q", m.ID, ok, want)
+		}
+	}
+
+	// Crash: reopen without persist. B was served and must not come back; C
+	// was only read into memory and must.
+	q = newTradeQueue(1, dir, 500)
+	if n := q.len(); n != 3 {
+		t.Fatalf("reopened queue holds %d message(s), want 3", n)
+	}
+	for _, want := range []string{"C", "D", "E"} {
+		if m, ok := q.pop(); !ok || m.ID != want {
+			t.Fatalf("pop after reopen = %q, %t; want %q", m.ID, ok, want)
+		}
+	}
+	if m, ok := q.pop(); ok {
+		t.Errorf("queue replayed %q after reopen", m.ID)
+	}
+}
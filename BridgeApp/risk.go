@@ -0,0 +1,381 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// What happens to a trade that breaches a risk limit
+const (
+	riskActionReject = "reject"
+	riskActionHold   = "hold"
+)
+
+// Risk limit names reported with a breach
+const (
+	limitQuantity    = "max_quantity_per_trade"
+	limitInstrument  = "max_hedge_lots_per_instrument"
+	limitTotal       = "max_hedge_lots_total"
+	limitMessageRate = "max_messages_per_minute"
+	limitFlipRate    = "max_flips_per_minute"
+)
+
+// riskRateWindow is the window of the per-minute limits
+const riskRateWindow = time.Minute
+
+// maxRiskEvents is how many recent breaches and decisions are kept for the UI
+const maxRiskEvents = 200
+
+// RiskLimits are the pre-trade checks applied to NT trades before they reach the
+// queue. Zero disables a limit. Only trades that grow exposure are checked against
+// the lot limits; reducing a position is always allowed. The lot limits are in
+// MT5 hedge lots: NT contracts times the lots each is hedged with.
+type RiskLimits struct {
+	MaxQuantityPerTrade       float64 `json:"max_quantity_per_trade" yaml:"max_quantity_per_trade"`
+	MaxHedgeLotsPerInstrument float64 `json:"max_hedge_lots_per_instrument" yaml:"max_hedge_lots_per_instrument"`
+	MaxHedgeLotsTotal         float64 `json:"max_hedge_lots_total" yaml:"max_hedge_lots_total"`
+	MaxMessagesPerMinute      int     `json:"max_messages_per_minute" yaml:"max_messages_per_minute"`
+	MaxFlipsPerMinute         int     `json:"max_flips_per_minute" yaml:"max_flips_per_minute"`
+	// OnBreach is "reject" (default) or "hold" for manual approval
+	OnBreach string `json:"on_breach" yaml:"on_breach"`
+}
+
+// RiskBreach describes why a trade was stopped
+type RiskBreach struct {
+	Limit  string  `json:"limit"`
+	Value  float64 `json:"value"` // what the trade would have caused
+	Max    float64 `json:"max"`
+	Reason string  `json:"reason"`
+}
+
+// HeldTrade is a trade waiting for manual approval
+type HeldTrade struct {
+	HoldID string     `json:"hold_id"`
+	Trade  Trade      `json:"trade"`
+	Breach RiskBreach `json:"breach"`
+	HeldAt time.Time  `json:"held_at"`
+}
+
+// RiskEvent records a breach for the UI
+type RiskEvent struct {
+	Time    time.Time  `json:"time"`
+	TradeID string     `json:"trade_id"`
+	BaseID  string     `json:"base_id"`
+	Action  string     `json:"action"` // rejected, held, approved, discarded
+	Breach  RiskBreach `json:"breach"`
+}
+
+// riskGuard enforces RiskLimits and keeps trades held for approval
+type riskGuard struct {
+	mu       sync.Mutex
+	limits   RiskLimits
+	messages []time.Time // accepted trades within the rate window
+	flips    []time.Time // position flips within the rate window
+	held     []HeldTrade
+	events   []RiskEvent
+	nextHold uint64
+	targets  map[string]string // MT5 target each instrument was last hedged on
+
+	// gate serialises check and acceptance so two concurrent trades can't both
+	// pass a limit that only one of them fits under
+	gate sync.Mutex
+}
+
+func newRiskGuard(limits RiskLimits) *riskGuard {
+	if limits.OnBreach != riskActionHold {
+		limits.OnBreach = riskActionReject
+	}
+	return &riskGuard{limits: limits, targets: make(map[string]string)}
+}
+
+// riskChecked reports whether t is subject to the limits: NT entries and exits,
+// not measurements or closes
+func riskChecked(t Trade) bool {
+	return t.OrderType != "TP" && t.OrderType != "SL" && ntSign(t.Action) != 0
+}
+
+// check returns the first limit t would breach, or nil. lotsPerContract gives
+// the hedge lots of one NT contract on a target, to weigh the NT positions
+// against the lot limits.
+func (g *riskGuard) check(t Trade, positions *driftMonitor, lotsPerContract func(target string) float64) *RiskBreach {
+	if !riskChecked(t) {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	l := g.limits
+	now := time.Now()
+	g.messages = pruneWindow(g.messages, now)
+	g.flips = pruneWindow(g.flips, now)
+
+	qty := math.Max(t.Quantity, float64(t.TotalQuantity))
+	if l.MaxQuantityPerTrade > 0 && qty > l.MaxQuantityPerTrade {
+		return &RiskBreach{Limit: limitQuantity, Value: qty, Max: l.MaxQuantityPerTrade,
+			Reason: fmt.Sprintf("quantity %.2f exceeds the per-trade maximum of %.2f", qty, l.MaxQuantityPerTrade)}
+	}
+	if l.MaxMessagesPerMinute > 0 && len(g.messages)+1 > l.MaxMessagesPerMinute {
+		return &RiskBreach{Limit: limitMessageRate, Value: float64(len(g.messages) + 1), Max: float64(l.MaxMessagesPerMinute),
+			Reason: fmt.Sprintf("more than %d trades in the last minute", l.MaxMessagesPerMinute)}
+	}
+
+	exposure := positions.exposure()
+	key := instrumentKey(t.Instrument)
+	before := exposure[key]
+	after := before + ntSign(t.Action)*t.Quantity
+	if l.MaxFlipsPerMinute > 0 && flipped(before, after) && len(g.flips)+1 > l.MaxFlipsPerMinute {
+		return &RiskBreach{Limit: limitFlipRate, Value: float64(len(g.flips) + 1), Max: float64(l.MaxFlipsPerMinute),
+			Reason: fmt.Sprintf("more than %d position flips in the last minute", l.MaxFlipsPerMinute)}
+	}
+	if math.Abs(after) <= math.Abs(before) {
+		return nil // reduces exposure
+	}
+	lots := math.Abs(after) * lotsPerContract(t.Target)
+	if l.MaxHedgeLotsPerInstrument > 0 && lots > l.MaxHedgeLotsPerInstrument {
+		return &RiskBreach{Limit: limitInstrument, Value: lots, Max: l.MaxHedgeLotsPerInstrument,
+			Reason: fmt.Sprintf("%s hedge would reach %.2f lots, above the per-instrument maximum of %.2f", key, lots, l.MaxHedgeLotsPerInstrument)}
+	}
+	if l.MaxHedgeLotsTotal > 0 {
+		total := lots
+		for k, pos := range exposure {
+			if k != key {
+				total += math.Abs(pos) * lotsPerContract(g.targets[k])
+			}
+		}
+		if total > l.MaxHedgeLotsTotal {
+			return &RiskBreach{Limit: limitTotal, Value: total, Max: l.MaxHedgeLotsTotal,
+				Reason: fmt.Sprintf("total hedge would reach %.2f lots, above the maximum of %.2f", total, l.MaxHedgeLotsTotal)}
+		}
+	}
+	return nil
+}
+
+// accepted counts a trade that passed (or was approved) against the rate limits
+func (g *riskGuard) accepted(t Trade, before, after float64) {
+	if !riskChecked(t) {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now()
+	g.targets[instrumentKey(t.Instrument)] = t.Target
+	g.messages = append(pruneWindow(g.messages, now), now)
+	if flipped(before, after) {
+		g.flips = append(pruneWindow(g.flips, now), now)
+	}
+}
+
+func flipped(before, after float64) bool {
+	return (before > 0 && after < 0) || (before < 0 && after > 0)
+}
+
+func pruneWindow(times []time.Time, now time.Time) []time.Time {
+	i := 0
+	for i < len(times) && now.Sub(times[i]) > riskRateWindow {
+		i++
+	}
+	return times[i:]
+}
+
+// hold parks t for manual approval and returns its hold id
+func (g *riskGuard) hold(t Trade, breach RiskBreach) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.nextHold++
+	id := fmt.Sprintf("hold_%d", g.nextHold)
+	g.held = append(g.held, HeldTrade{HoldID: id, Trade: t, Breach: breach, HeldAt: time.Now()})
+	return id
+}
+
+// restoreHeld holds again the trades saved by the last shutdown, under their
+// hold ids
+func (g *riskGuard) restoreHeld(saved []HeldTrade) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, h := range saved {
+		var n uint64
+		if _, err := fmt.Sscanf(h.HoldID, "hold_%d", &n); err == nil && n > g.nextHold {
+			g.nextHold = n
+		}
+		g.held = append(g.held, h)
+	}
+}
+
+// release removes a held trade and returns it
+func (g *riskGuard) release(holdID string) (HeldTrade, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i, h := range g.held {
+		if h.HoldID == holdID {
+			g.held = append(g.held[:i], g.held[i+1:]...)
+			return h, true
+		}
+	}
+	return HeldTrade{}, false
+}
+
+func (g *riskGuard) record(ev RiskEvent) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.events = append(g.events, ev)
+	if over := len(g.events) - maxRiskEvents; over > 0 {
+		g.events = g.events[over:]
+	}
+}
+
+// heldTrades returns a copy of the trades awaiting approval, oldest first
+func (g *riskGuard) heldTrades() []HeldTrade {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]HeldTrade(nil), g.held...)
+}
+
+// status returns limits, held trades and recent breaches
+func (g *riskGuard) status() map[string]interface{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now()
+	return map[string]interface{}{
+		"limits":              g.limits,
+		"held":                append([]HeldTrade(nil), g.held...),
+		"events":              append([]RiskEvent(nil), g.events...),
+		"messages_per_minute": len(pruneWindow(g.messages, now)),
+		"flips_per_minute":    len(pruneWindow(g.flips, now)),
+	}
+}
+
+// handleRiskBreach answers /log_trade for a trade that breached a limit: 202 with
+// a hold id when held for approval, 422 with the reason when rejected. Either
+// way the trade is accepted: its seq is recorded, so a retry is a duplicate.
+func (a *App) handleRiskBreach(w http.ResponseWriter, t Trade, breach *RiskBreach) {
+	seqResult := a.acceptSequence(t.SessionID, t.Seq)
+	ev := RiskEvent{Time: time.Now(), TradeID: t.ID, BaseID: t.BaseID, Breach: *breach}
+	if a.risk.limits.OnBreach == riskActionHold {
+		holdID := a.risk.hold(t, *breach)
+		ev.Action = "held"
+		a.risk.record(ev)
+		log.Printf("RISK_HOLD: Trade %s (%s %.2f %s) held as %s: %s", t.ID, t.Action, t.Quantity, t.Instrument, holdID, breach.Reason)
+		a.emit("riskBreach", ev)
+		writeJSON(w, http.StatusAccepted, sequenceReply(map[string]interface{}{
+			"status": "held", "hold_id": holdID, "limit": breach.Limit, "reason": breach.Reason}, seqResult))
+		return
+	}
+	ev.Action = "rejected"
+	a.risk.record(ev)
+	log.Printf("RISK_REJECT: Trade %s (%s %.2f %s) rejected: %s", t.ID, t.Action, t.Quantity, t.Instrument, breach.Reason)
+	a.bookRefusedFill(t)
+	a.emit("riskBreach", ev)
+	writeAPIError(w, http.StatusUnprocessableEntity, errCodeRiskLimit, breach.Reason,
+		fieldError{Field: breach.Limit, Message: fmt.Sprintf("would be %.2f, maximum %.2f", breach.Value, breach.Max)})
+}
+
+// bookRefusedFill books the NT fill of a trade whose MT5 leg was refused, by
+// the risk limits or because its account has no MT5 target: NT holds the
+// position whether or not MT5 hedges it, so it counts in the net position and
+// shows as drift
+func (a *App) bookRefusedFill(t Trade) {
+	a.drift.ntRefused(t)
+	a.queueMux.Lock()
+	oldNT := a.netNT
+	switch t.Action {
+	case "Buy":
+		a.netNT += int(t.Quantity)
+	case "Sell":
+		a.netNT -= int(t.Quantity)
+	}
+	a.hedgeLot = float64(a.netNT)
+	a.recordAuditLocked(auditNTFill, "nt", map[string]interface{}{
+		"trade_id": t.ID, "base_id": t.BaseID, "action": t.Action, "quantity": t.Quantity,
+		"instrument": t.Instrument, "account": t.AccountName, "net_before": oldNT, "refused": true,
+	})
+	log.Printf("NT fill %s booked without a hedge. Net position: %d → %d", t.ID, oldNT, a.netNT)
+	a.queueMux.Unlock()
+	a.emit("positionUpdated", map[string]interface{}{"net_position": a.netNT, "hedge_size": a.hedgeLot})
+}
+
+// hedgeLotsPerContract is the MT5 volume one NT contract routed to target is
+// hedged with: the lot size the bridge last sized for the target, or
+// drift_volume_per_contract when the EA sizes entries itself, times the
+// target's hedge ratio
+func (a *App) hedgeLotsPerContract(target string) float64 {
+	lots, ok := a.sizing.lotsPerContract(target)
+	if !ok {
+		lots = a.config.DriftVolumePerContract
+	}
+	return lots * a.router.ratio(target)
+}
+
+// ApproveHeldTrade releases a held trade to MT5, bypassing the limits it breached
+func (a *App) ApproveHeldTrade(holdID string) (result map[string]interface{}) {
+	defer func() {
+		a.auditOperatorAction("approve_held", map[string]interface{}{"hold_id": holdID, "trade_id": result["trade_id"]}, result)
+	}()
+	h, ok := a.risk.release(holdID)
+	if !ok {
+		return map[string]interface{}{"status": "error", "message": "no held trade " + holdID}
+	}
+	a.risk.gate.Lock()
+	a.acceptTrade(h.Trade)
+	a.risk.gate.Unlock()
+	a.risk.record(RiskEvent{Time: time.Now(), TradeID: h.Trade.ID, BaseID: h.Trade.BaseID, Action: "approved", Breach: h.Breach})
+	log.Printf("RISK_APPROVED: Held trade %s (%s) released to MT5", holdID, h.Trade.ID)
+	a.emit("positionUpdated", map[string]interface{}{"net_position": a.netNT, "hedge_size": a.hedgeLot})
+	return map[string]interface{}{"status": "success", "hold_id": holdID, "trade_id": h.Trade.ID}
+}
+
+// DiscardHeldTrade drops a held trade without hedging it
+func (a *App) DiscardHeldTrade(holdID string) (result map[string]interface{}) {
+	defer func() {
+		a.auditOperatorAction("discard_held", map[string]interface{}{"hold_id": holdID, "trade_id": result["trade_id"]}, result)
+	}()
+	h, ok := a.risk.release(holdID)
+	if !ok {
+		return map[string]interface{}{"status": "error", "message": "no held trade " + holdID}
+	}
+	a.risk.record(RiskEvent{Time: time.Now(), TradeID: h.Trade.ID, BaseID: h.Trade.BaseID, Action: "discarded", Breach: h.Breach})
+	log.Printf("RISK_DISCARDED: Held trade %s (%s) discarded; it will not be hedged", holdID, h.Trade.ID)
+	a.bookRefusedFill(h.Trade)
+	return map[string]interface{}{"status": "success", "hold_id": holdID, "trade_id": h.Trade.ID}
+}
+
+// GetRiskStatus returns the limits, held trades and recent breaches for the UI
+func (a *App) GetRiskStatus() map[string]interface{} {
+	return a.risk.status()
+}
+
+// riskHandler reports risk state: GET /v1/risk
+func (a *App) riskHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, http.StatusOK, a.risk.status())
+}
+
+// riskHoldHandler approves or discards a held trade:
+// POST /v1/risk/held/{hold_id}/approve or /discard. Like /v1/admin it needs the
+// admin token.
+func (a *App) riskHoldHandler(w http.ResponseWriter, r *http.Request) {
+	if !a.requireAdmin(w, r) || !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, apiVersionPrefix+"/risk/held"), "/"), "/")
+	if len(parts) != 2 || (parts[1] != "approve" && parts[1] != "discard") {
+		writeAPIError(w, http.StatusNotFound, errCodeNotFound, "Use /v1/risk/held/{hold_id}/approve or /discard")
+		return
+	}
+	var res map[string]interface{}
+	if parts[1] == "approve" {
+		res = a.ApproveHeldTrade(parts[0])
+	} else {
+		res = a.DiscardHeldTrade(parts[0])
+	}
+	if res["status"] != "success" {
+		writeAPIError(w, http.StatusNotFound, errCodeNotFound, res["message"].(string))
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,480 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// What happens to a trade from an NT account no route matches
+const (
+	unroutedReject  = "reject"
+	unroutedDefault = "default"
+)
+
+// Which side MT5 takes for an NT entry
+const (
+	directionHedge    = "hedge"    // the opposite side, offsetting NT
+	directionCopy     = "copy"     // the same side as NT
+	directionDisabled = "disabled" // nothing is sent to MT5
+)
+
+// RoutingConfig maps NT accounts to the MT5 terminals or accounts that hedge them.
+// Without targets every account goes to the one unnamed target, as before routing.
+type RoutingConfig struct {
+	Targets []RouteTarget `json:"targets" yaml:"targets"`
+	// Routes are tried in order; the first whose account pattern matches wins
+	Routes []Route `json:"routes" yaml:"routes"`
+	// Unrouted is "reject" (default) or "default", which sends accounts no route
+	// matches to DefaultTarget
+	Unrouted      string `json:"unrouted" yaml:"unrouted"`
+	DefaultTarget string `json:"default_target" yaml:"default_target"`
+	// Direction is "hedge" (default), "copy" or "disabled" for routes that set
+	// none, for unrouted accounts sent to DefaultTarget, and without targets
+	Direction string `json:"direction" yaml:"direction"`
+}
+
+// RouteTarget is one MT5 terminal or account. Its EA polls with ?target=<id>.
+type RouteTarget struct {
+	ID string `json:"id" yaml:"id"`
+	// HedgeRatio scales the quantity handed to this target's EA; default 1
+	HedgeRatio float64 `json:"hedge_ratio" yaml:"hedge_ratio"`
+	// Enabled defaults to true. A disabled target takes no new entries; closes
+	// for hedges it already holds are still sent.
+	Enabled *bool `json:"enabled" yaml:"enabled"`
+	// Sizing replaces the top-level sizing for this target's hedge account
+	Sizing *SizingConfig `json:"sizing,omitempty" yaml:"sizing"`
+}
+
+// Route sends the NT accounts matching Account to Target. Account is an account
+// name or a pattern such as "APEX-*" (see path.Match).
+type Route struct {
+	Account string `json:"account" yaml:"account"`
+	Target  string `json:"target" yaml:"target"`
+	// Direction overrides RoutingConfig.Direction for these accounts
+	Direction string `json:"direction,omitempty" yaml:"direction"`
+}
+
+func (t RouteTarget) enabled() bool {
+	return t.Enabled == nil || *t.Enabled
+}
+
+// validDirection reports whether d is a direction policy
+func validDirection(d string) bool {
+	return d == directionHedge || d == directionCopy || d == directionDisabled
+}
+
+// normalize drops routes to unknown targets and fills in defaults
+func (c *RoutingConfig) normalize() {
+	if !validDirection(c.Direction) {
+		if c.Direction != "" {
+			log.Printf("WARNING: Unknown routing.direction %q; using %q", c.Direction, directionHedge)
+		}
+		c.Direction = directionHedge
+	}
+	known := make(map[string]bool, len(c.Targets))
+	for i := range c.Targets {
+		if c.Targets[i].HedgeRatio <= 0 {
+			c.Targets[i].HedgeRatio = 1
+		}
+		if c.Targets[i].Sizing != nil {
+			c.Targets[i].Sizing.normalize()
+		}
+		known[c.Targets[i].ID] = true
+	}
+	routes := c.Routes[:0]
+	for _, r := range c.Routes {
+		if _, err := path.Match(r.Account, ""); err != nil {
+			log.Printf("WARNING: Ignoring route %q -> %q: invalid account pattern: %v", r.Account, r.Target, err)
+			continue
+		}
+		if !known[r.Target] {
+			log.Printf("WARNING: Ignoring route %q -> %q: no such target", r.Account, r.Target)
+			continue
+		}
+		if !validDirection(r.Direction) {
+			if r.Direction != "" {
+				log.Printf("WARNING: Route %q -> %q has unknown direction %q; using %q", r.Account, r.Target, r.Direction, c.Direction)
+			}
+			r.Direction = c.Direction
+		}
+		routes = append(routes, r)
+	}
+	c.Routes = routes
+	if c.DefaultTarget != "" && !known[c.DefaultTarget] {
+		log.Printf("WARNING: routing.default_target %q is not a target; unrouted accounts will be rejected", c.DefaultTarget)
+		c.DefaultTarget = ""
+	}
+	if c.Unrouted != unroutedDefault || c.DefaultTarget == "" {
+		if c.Unrouted != "" && c.Unrouted != unroutedReject && c.Unrouted != unroutedDefault {
+			log.Printf("WARNING: Unknown routing.unrouted %q; unrouted accounts will be rejected", c.Unrouted)
+		}
+		c.Unrouted = unroutedReject
+	}
+}
+
+// mt5Sign returns the MT5 side of an entry whose NT side is ntSign (+1 buy, -1
+// sell) under direction. No direction is a hedge, as before direction policies.
+func mt5Sign(ntSign float64, direction string) float64 {
+	if direction == directionCopy {
+		return ntSign
+	}
+	return -ntSign
+}
+
+// mt5Action names the MT5 side of an entry, or "" for closes, measurements and
+// actions that aren't a side
+func mt5Action(t Trade) string {
+	if t.Action == "CLOSE_HEDGE" || t.OrderType == "TP" || t.OrderType == "SL" {
+		return ""
+	}
+	switch mt5Sign(ntSign(t.Action), t.Direction) {
+	case 1:
+		return "Buy"
+	case -1:
+		return "Sell"
+	}
+	return ""
+}
+
+// routeError is why a trade could not be routed
+type routeError struct {
+	code    string
+	message string
+}
+
+// router resolves the MT5 target of each message
+type router struct {
+	cfg     RoutingConfig
+	targets map[string]RouteTarget
+}
+
+func newRouter(cfg RoutingConfig) *router {
+	r := &router{cfg: cfg, targets: make(map[string]RouteTarget, len(cfg.Targets))}
+	for _, t := range cfg.Targets {
+		r.targets[t.ID] = t
+	}
+	return r
+}
+
+// active reports whether a routing table is configured
+func (r *router) active() bool {
+	return len(r.targets) > 0
+}
+
+// resolve returns the target for an NT account and the direction MT5 takes for
+// it. Entries are refused for a disabled target; closes are not, so existing
+// hedges can still be closed.
+func (r *router) resolve(account string, isClose bool) (string, string, *routeError) {
+	direction := r.cfg.Direction
+	if direction == "" {
+		direction = directionHedge
+	}
+	if !r.active() {
+		return "", direction, nil
+	}
+	target := ""
+	for _, rt := range r.cfg.Routes {
+		if ok, _ := path.Match(rt.Account, account); ok {
+			target = rt.Target
+			if rt.Direction != "" {
+				direction = rt.Direction
+			}
+			break
+		}
+	}
+	if target == "" {
+		if r.cfg.Unrouted != unroutedDefault {
+			return "", "", &routeError{errCodeUnrouted, fmt.Sprintf("No route for NT account %q", account)}
+		}
+		target = r.cfg.DefaultTarget
+	}
+	if !isClose && !r.targets[target].enabled() {
+		return target, direction, &routeError{errCodeTargetDisabled, fmt.Sprintf("Target %q for NT account %q is disabled", target, account)}
+	}
+	return target, direction, nil
+}
+
+// ratio returns the hedge ratio of a target
+func (r *router) ratio(target string) float64 {
+	if t, ok := r.targets[target]; ok {
+		return t.HedgeRatio
+	}
+	return 1
+}
+
+// eaTarget returns the target an EA request polls for: its ?target=, or the
+// default target when it sends none
+func (r *router) eaTarget(req *http.Request) (string, bool) {
+	if !r.active() {
+		return "", true
+	}
+	target := req.URL.Query().Get("target")
+	if target == "" {
+		return r.cfg.DefaultTarget, true
+	}
+	_, ok := r.targets[target]
+	return target, ok
+}
+
+// refuseRoute answers 422 for a message from an NT account that has no MT5
+// target. field names the account in the request body. The refusal is final,
+// so the message's seq is accepted (see refuseSequenced).
+func (a *App) refuseRoute(w http.ResponseWriter, sessionID string, seq uint64, account, field string, rerr *routeError) {
+	log.Printf("ROUTING: Rejected message for NT account %q: %s", account, rerr.message)
+	a.refuseSequenced(w, sessionID, seq, http.StatusUnprocessableEntity, rerr.code, rerr.message,
+		fieldError{Field: field, Message: rerr.message})
+}
+
+// requireEATarget resolves the target of an EA request, or writes the error reply
+func (a *App) requireEATarget(w http.ResponseWriter, r *http.Request) (string, bool) {
+	target, ok := a.router.eaTarget(r)
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, errCodeNotFound, "Unknown target "+target,
+			fieldError{Field: "target", Message: "must be the id of a routing target"})
+	}
+	return target, ok
+}
+
+// targetLabel names a target in log lines; the unnamed target has no label
+func targetLabel(target string) string {
+	if target == "" {
+		return ""
+	}
+	return " target " + target
+}
+
+// routedQueue keeps one tradeQueue per target, so each EA drains only its own
+// messages and a stalled terminal can't hold up another. The unnamed target
+// spills where the single queue always did.
+type routedQueue struct {
+	mu             sync.Mutex
+	rewriting      sync.RWMutex // held by rewrite; push waits on it
+	queues         map[string]*tradeQueue
+	memoryPerLane  int
+	spillDir       string
+	segmentRecords int
+}
+
+func newRoutedQueue(memoryPerLane int, spillDir string, segmentRecords int, targets []RouteTarget) *routedQueue {
+	q := &routedQueue{
+		queues:         make(map[string]*tradeQueue),
+		memoryPerLane:  memoryPerLane,
+		spillDir:       spillDir,
+		segmentRecords: segmentRecords,
+	}
+	// Open every target now so messages spilled before a restart are found
+	q.queue("")
+	for _, t := range targets {
+		q.queue(t.ID)
+	}
+	return q
+}
+
+// queue returns the queue of target, creating it
+func (q *routedQueue) queue(target string) *tradeQueue {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	tq := q.queues[target]
+	if tq == nil {
+		dir := q.spillDir
+		if target != "" && dir != "" {
+			dir = filepath.Join(dir, "targets", target)
+		}
+		tq = newTradeQueue(q.memoryPerLane, dir, q.segmentRecords)
+		q.queues[target] = tq
+	}
+	return tq
+}
+
+// all returns every queue with its target, ordered by target
+func (q *routedQueue) all() ([]string, []*tradeQueue) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	targets := make([]string, 0, len(q.queues))
+	for target := range q.queues {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	queues := make([]*tradeQueue, len(targets))
+	for i, target := range targets {
+		queues[i] = q.queues[target]
+	}
+	return targets, queues
+}
+
+func (q *routedQueue) push(t Trade) {
+	q.rewriting.RLock()
+	defer q.rewriting.RUnlock()
+	q.queue(t.Target).push(t)
+}
+
+// rewrite drains the queues of targets, or of every target when targets is nil,
+// and queues what fn returns in place of the drained messages. No push lands
+// between the drain and the re-push, so fn sees everything that was queued and
+// nothing queued meanwhile jumps ahead of what it returns. fn must not push.
+func (q *routedQueue) rewrite(targets []string, fn func(queued []Trade) []Trade) {
+	q.rewriting.Lock()
+	defer q.rewriting.Unlock()
+	var queued []Trade
+	if targets == nil {
+		queued = q.drain()
+	} else {
+		for _, target := range targets {
+			queued = append(queued, q.queue(target).drain()...)
+		}
+	}
+	for _, t := range fn(queued) {
+		q.queue(t.Target).push(t)
+	}
+}
+
+// pop returns the next message for target's EA
+func (q *routedQueue) pop(target string) (Trade, bool) {
+	return q.queue(target).pop()
+}
+
+// persist writes every target's queue to disk; see tradeQueue.persist
+func (q *routedQueue) persist() (int, []Trade) {
+	_, queues := q.all()
+	saved := 0
+	var unsaved []Trade
+	for _, tq := range queues {
+		n, lost := tq.persist()
+		saved += n
+		unsaved = append(unsaved, lost...)
+	}
+	return saved, unsaved
+}
+
+// drain empties every queue, each in arrival order
+func (q *routedQueue) drain() []Trade {
+	_, queues := q.all()
+	var out []Trade
+	for _, tq := range queues {
+		out = append(out, tq.drain()...)
+	}
+	return out
+}
+
+// len returns the number of messages queued for all targets
+func (q *routedQueue) len() int {
+	_, queues := q.all()
+	n := 0
+	for _, tq := range queues {
+		n += tq.len()
+	}
+	return n
+}
+
+// stats sums the queue stats of all targets
+func (q *routedQueue) stats() queueStats {
+	_, queues := q.all()
+	total := queueStats{Depths: make(map[string]int)}
+	for _, tq := range queues {
+		s := tq.stats()
+		for name, n := range s.Depths {
+			total.Depths[name] += n
+		}
+		total.Spilled += s.Spilled
+		total.SpillBytes += s.SpillBytes
+		if s.OldestAge > total.OldestAge {
+			total.OldestAge = s.OldestAge
+		}
+	}
+	return total
+}
+
+// depths returns the number of messages queued per target
+func (q *routedQueue) depths() map[string]int {
+	targets, queues := q.all()
+	out := make(map[string]int, len(targets))
+	for i, target := range targets {
+		out[target] = queues[i].len()
+	}
+	return out
+}
+
+// targetBatches keeps the outstanding batch of each target's EA
+type targetBatches struct {
+	mu      sync.Mutex
+	batches map[string]*batchState
+}
+
+func newTargetBatches() *targetBatches {
+	return &targetBatches{batches: make(map[string]*batchState)}
+}
+
+func (t *targetBatches) get(target string) *batchState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := t.batches[target]
+	if b == nil {
+		b = newBatchState()
+		t.batches[target] = b
+	}
+	return b
+}
+
+// unacked returns how many messages are out with any EA awaiting acknowledgement
+func (t *targetBatches) unacked() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := 0
+	for _, b := range t.batches {
+		n += b.unacked()
+	}
+	return n
+}
+
+// TargetStatus is a routing target as reported by /v1/routes and GetStatus
+type TargetStatus struct {
+	ID         string     `json:"id"`
+	HedgeRatio float64    `json:"hedge_ratio"`
+	Enabled    bool       `json:"enabled"`
+	Queued     int        `json:"queued"`
+	LastPoll   *time.Time `json:"last_poll,omitempty"` // last time its EA polled
+}
+
+// targetStatus lists the configured targets with their queue depth and last EA poll
+func (a *App) targetStatus() []TargetStatus {
+	depths := a.tradeQueue.depths()
+	a.pollMu.Lock()
+	defer a.pollMu.Unlock()
+	out := make([]TargetStatus, 0, len(a.router.cfg.Targets))
+	for _, t := range a.router.cfg.Targets {
+		st := TargetStatus{ID: t.ID, HedgeRatio: t.HedgeRatio, Enabled: t.enabled(), Queued: depths[t.ID]}
+		if at, ok := a.lastPoll[t.ID]; ok {
+			st.LastPoll = &at
+		}
+		out = append(out, st)
+	}
+	return out
+}
+
+// polled records that target's EA polled the bridge
+func (a *App) polled(target string) {
+	a.pollMu.Lock()
+	a.lastPoll[target] = time.Now()
+	a.pollMu.Unlock()
+}
+
+// routesHandler shows the routing table: GET /v1/routes
+func (a *App) routesHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"active":         a.router.active(),
+		"routes":         a.router.cfg.Routes,
+		"unrouted":       a.router.cfg.Unrouted,
+		"default_target": a.router.cfg.DefaultTarget,
+		"direction":      a.router.cfg.Direction,
+		"targets":        a.targetStatus(),
+	})
+}
@@ -0,0 +1,1151 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"BridgeApp/simulator"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Scenario is a bridge conformance test written in YAML (see scenarios/*.yaml).
+// Each scenario runs against a fresh, headless App with a fake EA and fake NT addon.
+type Scenario struct {
+	Name        string         `yaml:"name"`
+	Description string         `yaml:"description"`
+	Bridge      ScenarioBridge `yaml:"bridge"`
+	EA          ScenarioEA     `yaml:"ea"`
+	Addon       ScenarioAddon  `yaml:"addon"`
+	Steps       []ScenarioStep `yaml:"steps"`
+
+	file string
+}
+
+// ScenarioBridge overrides bridge settings for the scenario; unset fields keep
+// the defaults. The data directory is always a fresh temporary folder.
+type ScenarioBridge struct {
+	QueueMemoryPerLane  int               `yaml:"queue_memory_per_lane"`
+	SpillSegmentRecords int               `yaml:"spill_segment_records"`
+	AggregateFills      bool              `yaml:"aggregate_fills"`
+	AggregateWindow     string            `yaml:"aggregate_window"` // e.g. "200ms"
+	DriftGrace          string            `yaml:"drift_grace"`      // e.g. "100ms"
+	DriftAutoCorrect    bool              `yaml:"drift_auto_correct"`
+	Risk                RiskLimits        `yaml:"risk"`
+	Sessions            SessionConfig     `yaml:"sessions"`
+	TTL                 TTLConfig         `yaml:"ttl"`
+	Routing             RoutingConfig     `yaml:"routing"`
+	Sizing              SizingConfig      `yaml:"sizing"`
+	ManualTrades        ManualTradeConfig `yaml:"manual_trades"`
+	NTCommands          NTCommandConfig   `yaml:"nt_commands"`
+	Addons              AddonConfig       `yaml:"addons"`
+	Limits              LimitsConfig      `yaml:"limits"`
+	Audit               AuditConfig       `yaml:"audit"`
+}
+
+// ScenarioEA configures the fake MT5 EA
+type ScenarioEA struct {
+	Hedging     *bool    `yaml:"hedging"`      // EnableHedging input, default true
+	FillRatio   float64  `yaml:"fill_ratio"`   // partial fills, e.g. 0.5
+	FailActions []string `yaml:"fail_actions"` // actions the EA refuses to execute
+	FailIDs     []string `yaml:"fail_ids"`     // message ids the EA refuses to execute
+	Slippage    float64  `yaml:"slippage"`     // points worse than the NT price entries fill at
+	Symbol      string   `yaml:"symbol"`       // MT5 symbol reported in trade results
+	Point       float64  `yaml:"point"`        // point size of the symbol, default 1
+	Balance     float64  `yaml:"balance"`      // hedge account balance reported with each poll
+}
+
+// ScenarioAddon configures the fake NT addon's HttpListener
+type ScenarioAddon struct {
+	FailFirst  int    `yaml:"fail_first"`  // first N closure callbacks fail
+	FailStatus int    `yaml:"fail_status"` // status used for failures, default 500
+	Delay      string `yaml:"delay"`       // e.g. "200ms"
+	Offline    bool   `yaml:"offline"`     // no listener at all
+	SessionID  string `yaml:"session_id"`  // stamp per-session sequence numbers
+	// IgnoreCommands takes bridge commands without ever acknowledging them
+	IgnoreCommands bool `yaml:"ignore_commands"`
+}
+
+// ScenarioStep is one line of a scenario. Exactly one action field should be set.
+type ScenarioStep struct {
+	Name string `yaml:"name"`
+
+	NTFill   *StepNTFill   `yaml:"nt_fill"`   // NT fills contracts, addon posts /log_trade
+	NTClose  *StepNTClose  `yaml:"nt_close"`  // NT closes, addon posts /nt_close_hedge
+	EAPull   *StepEAPull   `yaml:"ea_pull"`   // EA polls /mt5/get_trade and reports results
+	MT5Close *StepMT5Close `yaml:"mt5_close"` // MT5 closes a hedge, EA posts /notify_hedge_close
+	EAPing   *StepEAPing   `yaml:"ea_ping"`   // EA pings /health?source=hedgebot
+	// EATelemetry has the EA post its cushion and OHF to /mt5/telemetry
+	EATelemetry *StepEATelemetry `yaml:"ea_telemetry"`
+	// MT5Manual has the EA report a trade opened by hand on MT5 to /mt5/manual_trade
+	MT5Manual *StepMT5Manual `yaml:"mt5_manual"`
+	// NTCommand sends a command to the NT addon; AddonPollCommands has the addon
+	// poll and acknowledge its pending commands
+	NTCommand         *StepNTCommand `yaml:"nt_command"`
+	AddonPollCommands *int           `yaml:"addon_poll_commands"` // expected number of commands
+	// AddonRegister registers an addon instance, starting a further fake addon
+	// for any name but the default ""; AddonHeartbeat renews its registration
+	AddonRegister *StepAddonRegister `yaml:"addon_register"`
+	// Restart shuts the bridge down gracefully and starts a new one on the same
+	// data directory, as closing and reopening the app does
+	Restart *StepRestart `yaml:"restart"`
+	// StartInstance starts another bridge process, as launching the app twice does
+	StartInstance  *StepStartInstance  `yaml:"start_instance"`
+	AddonHeartbeat *StepAddonHeartbeat `yaml:"addon_heartbeat"`
+	// Audit verifies the audit log, after tampering with it if asked
+	Audit *StepAudit `yaml:"audit"`
+	// Request sends raw requests to the bridge, as a misbehaving client does
+	Request *StepRequest `yaml:"request"`
+	Wait    string       `yaml:"wait"`    // sleep, e.g. "100ms"
+	Pause   string       `yaml:"pause"`   // pause forwarding to MT5 with this reason
+	Resume  *StepResume  `yaml:"resume"`  // resume forwarding
+	Flatten *StepFlatten `yaml:"flatten"` // flatten every open hedge
+	// SessionClock fixes the session calendar's clock (RFC 3339) and releases
+	// whatever opened at that time
+	SessionClock string `yaml:"session_clock"`
+	// ApproveHeld approves a trade held by the risk limits, by hold_id or "all"
+	ApproveHeld string      `yaml:"approve_held"`
+	Expect      *StepExpect `yaml:"expect"` // assertions on bridge, EA and addon state
+
+	// ExpectError marks the action as expected to fail (e.g. "502" or "400")
+	ExpectError string `yaml:"expect_error"`
+}
+
+// StepNTFill posts one Trade per contract, like the addon does for a fill
+type StepNTFill struct {
+	BaseID     string  `yaml:"base_id"`
+	Action     string  `yaml:"action"` // Buy or Sell
+	Quantity   int     `yaml:"quantity"`
+	Price      float64 `yaml:"price"`
+	Instrument string  `yaml:"instrument"`
+	Account    string  `yaml:"account"`
+	OrderType  string  `yaml:"order_type"` // ENTRY (default), TP or SL
+	// Lost is how many of the fill's POSTs never reach the bridge (sequence numbers are still used)
+	Lost int `yaml:"lost"`
+	// NT account performance sent with the fill, as used by elastic hedging
+	NTBalance       float64 `yaml:"nt_balance"`
+	NTDailyPnL      float64 `yaml:"nt_daily_pnl"`
+	NTTradeResult   string  `yaml:"nt_trade_result"`
+	NTSessionTrades int     `yaml:"nt_session_trades"`
+}
+
+// StepNTClose posts an NT-initiated closure
+type StepNTClose struct {
+	BaseID     string  `yaml:"base_id"`
+	Quantity   float64 `yaml:"quantity"`
+	Action     string  `yaml:"action"` // sell (closes long) or buytocover (closes short)
+	Instrument string  `yaml:"instrument"`
+	Account    string  `yaml:"account"`
+	Reason     string  `yaml:"reason"`
+}
+
+// StepEAPull pulls and executes messages. Count 0 drains the queue.
+type StepEAPull struct {
+	Count int `yaml:"count"`
+	// Batch pulls through /mt5/get_trades with up to Batch messages per poll
+	Batch int `yaml:"batch"`
+	// SkipAck pulls a single batch and never acknowledges it, like a lost ack
+	SkipAck bool `yaml:"skip_ack"`
+	// ExpectActions asserts the actions of the pulled messages, in order
+	ExpectActions []string `yaml:"expect_actions"`
+	// Target pulls as the EA of this routing target instead of the default EA
+	Target string `yaml:"target"`
+	// Balance changes the hedge account balance the EA reports from this pull on
+	Balance float64 `yaml:"balance"`
+}
+
+// StepResume resumes forwarding, optionally netting what was queued meanwhile
+type StepResume struct {
+	Collapse bool `yaml:"collapse"`
+}
+
+// StepFlatten closes every open hedge and pauses forwarding
+type StepFlatten struct {
+	FlattenNT bool `yaml:"flatten_nt"` // also ask the addon to flatten
+}
+
+// StepMT5Close closes part of the fake EA's hedge for a base_id
+type StepMT5Close struct {
+	BaseID string `yaml:"base_id"`
+	// NetOf closes the hedge of the net target this NT base_id was folded into
+	NetOf    string  `yaml:"net_of"`
+	Quantity float64 `yaml:"quantity"`
+	Reason   string  `yaml:"reason"` // e.g. SL, TP, MANUAL
+	// Async posts the notification without waiting for the bridge's answer
+	Async bool `yaml:"async"`
+}
+
+// StepEAPing sends a hedgebot health ping
+type StepEAPing struct {
+	OpenPositions *int `yaml:"open_positions"`
+}
+
+// StepEATelemetry is the elastic-hedging state the EA reports
+type StepEATelemetry struct {
+	Target  string  `yaml:"target"`
+	Cushion float64 `yaml:"cushion"`
+	OHF     float64 `yaml:"ohf"`
+	Balance float64 `yaml:"balance"`
+}
+
+// StepMT5Manual is a deal placed by hand on MT5
+type StepMT5Manual struct {
+	Target string  `yaml:"target"`
+	Ticket uint64  `yaml:"ticket"`
+	Symbol string  `yaml:"symbol"`
+	Action string  `yaml:"action"` // MT5 side, Buy or Sell
+	Volume float64 `yaml:"volume"`
+	Price  float64 `yaml:"price"`
+	// ExpectOutcome asserts the bridge's outcome: recorded, alerted, mirrored,
+	// mirror_failed, or ignored for a repeated or bridge-owned ticket
+	ExpectOutcome string `yaml:"expect_outcome"`
+}
+
+// StepNTCommand is a command for the NT addon
+type StepNTCommand struct {
+	Type       string `yaml:"type"`
+	Account    string `yaml:"account"`
+	Instrument string `yaml:"instrument"`
+	Strategy   string `yaml:"strategy"`
+	Reason     string `yaml:"reason"`
+}
+
+// StepRestart restarts the bridge and checks what its shutdown saved
+type StepRestart struct {
+	Timeout               string `yaml:"timeout"` // shutdown deadline; default shutdown_timeout_ms
+	ExpectQueued          *int   `yaml:"expect_queued"`
+	ExpectPendingClosures *int   `yaml:"expect_pending_closures"`
+	ExpectUnsaved         *int   `yaml:"expect_unsaved"`
+}
+
+// StepStartInstance starts a bridge process with its own lock and listener.
+// Every instance shares one data directory, so a second running one is refused;
+// expect_error matches why an instance didn't start.
+type StepStartInstance struct {
+	ListenAddr         string `yaml:"listen_addr"` // "bridge" for the address the scenario bridge holds
+	FallbackListenAddr string `yaml:"fallback_listen_addr"`
+	ExpectFallback     *bool  `yaml:"expect_fallback"` // bridge_address.json names the fallback address
+}
+
+// StepAudit checks the audit log's chain and what it recorded
+type StepAudit struct {
+	// Tamper edits the position of the entry with this seq ("edit:3"), or
+	// removes it ("delete:3"), before verifying
+	Tamper      string         `yaml:"tamper"`
+	ExpectOK    *bool          `yaml:"expect_ok"`
+	ExpectKinds map[string]int `yaml:"expect_kinds"` // entries per kind
+	// ExpectBrokenLine is the first line verification rejects
+	ExpectBrokenLine int `yaml:"expect_broken_line"`
+}
+
+// StepRequest sends the same request count times and checks the statuses
+type StepRequest struct {
+	Method    string `yaml:"method"` // default GET, or POST when there is a body
+	Path      string `yaml:"path"`   // e.g. /health?source=hedgebot
+	Count     int    `yaml:"count"`  // default 1
+	BodyBytes int    `yaml:"body_bytes"`
+	// Chunked sends the body without a Content-Length
+	Chunked bool `yaml:"chunked"`
+	// ExpectStatus counts the responses per status code, e.g. {200: 5, 429: 3}
+	ExpectStatus map[int]int `yaml:"expect_status"`
+}
+
+// StepAddonRegister registers a fake addon with the bridge
+type StepAddonRegister struct {
+	Addon        string   `yaml:"addon"` // "" for the default addon
+	Accounts     []string `yaml:"accounts"`
+	Capabilities []string `yaml:"capabilities"`
+}
+
+// StepAddonHeartbeat sends a registered fake addon's heartbeat
+type StepAddonHeartbeat struct {
+	Addon string `yaml:"addon"`
+	// ExpectUnknown expects 409 unknown_addon, as after the registration expired
+	ExpectUnknown bool `yaml:"expect_unknown"`
+}
+
+// StepExpect lists assertions; unset fields are not checked
+type StepExpect struct {
+	NetPosition        *int                `yaml:"net_position"`
+	HedgeSize          *float64            `yaml:"hedge_size"`
+	QueueSize          *int                `yaml:"queue_size"`
+	QueueDepths        map[string]int      `yaml:"queue_depths"` // per lane: close, entry, info
+	QueueSpilled       *int                `yaml:"queue_spilled"`
+	QueueUnacked       *int                `yaml:"queue_unacked"`
+	FillsHeld          *int                `yaml:"fills_held"`
+	DriftAlerts        *int                `yaml:"drift_alerts"`
+	RiskHeld           *int                `yaml:"risk_held"`
+	Paused             *bool               `yaml:"paused"`
+	SessionHeld        *int                `yaml:"session_held"`
+	Expired            *int                `yaml:"expired"`
+	AddonFlattens      *int                `yaml:"addon_flattens"` // flatten_account commands the fake addon received
+	EAOpenVolume       *float64            `yaml:"ea_open_volume"`
+	EAOpenByBase       map[string]float64  `yaml:"ea_open_volume_by_base"`
+	EAOpenByTarget     map[string]float64  `yaml:"ea_open_volume_by_target"` // open volume of each target's EA
+	EAOpenSideByBase   map[string]string   `yaml:"ea_open_side_by_base"`     // side of the open hedges for a base_id, on any EA
+	MT5Net             map[string]float64  `yaml:"mt5_net"`                  // confirmed MT5 position per instrument, long positive
+	EALotSizes         map[string]float64  `yaml:"ea_lot_sizes"`             // lot_size of the last entry pulled for a base_id, on any EA
+	EAPulled           *int                `yaml:"ea_pulled"`
+	AddonNotified      *ExpectNotification `yaml:"addon_notified"`
+	AddonNotifications *int                `yaml:"addon_notifications"`
+	HedgebotActive     *bool               `yaml:"hedgebot_active"`
+	SequenceGaps       *int                `yaml:"sequence_gaps"`
+	AddonConnected     *bool               `yaml:"addon_connected"`
+	// Executions and Slippage check the execution stats per instrument: how many
+	// hedges were timed and their mean slippage in points
+	Executions map[string]int     `yaml:"executions"`
+	Slippage   map[string]float64 `yaml:"slippage"`
+	// TelemetryNT and TelemetryEA count the points of the telemetry time series
+	TelemetryNT *int `yaml:"telemetry_nt"`
+	TelemetryEA *int `yaml:"telemetry_ea"`
+	// ManualTrades counts the manual MT5 trades recorded, AddonMirrors the
+	// mirror_trade commands the fake addon received
+	ManualTrades *int `yaml:"manual_trades"`
+	AddonMirrors *int `yaml:"addon_mirrors"`
+	// NTCommands counts the bridge's NT commands per state (pending, delivered,
+	// acked, failed, expired); AddonCommands those the fake addon received
+	NTCommands    map[string]int `yaml:"nt_commands"`
+	AddonCommands *int           `yaml:"addon_commands"`
+	// AddonsRegistered counts live addon registrations; AddonClosures counts the
+	// closure notifications each fake addon accepted, by name ("default" for "")
+	AddonsRegistered *int           `yaml:"addons_registered"`
+	AddonClosures    map[string]int `yaml:"addon_closures"`
+	// RateLimited and BodyTooLarge count the requests refused 429 and 413
+	RateLimited  *int `yaml:"rate_limited"`
+	BodyTooLarge *int `yaml:"body_too_large"`
+}
+
+// ExpectNotification matches a closure the fake addon received
+type ExpectNotification struct {
+	BaseID   string   `yaml:"base_id"`
+	Quantity *float64 `yaml:"quantity"`
+	Reason   string   `yaml:"reason"`
+	Within   string   `yaml:"within"` // how long to wait, default 2s
+}
+
+// ScenarioResult is the outcome of one scenario
+type ScenarioResult struct {
+	Name     string
+	File     string
+	Passed   bool
+	Failures []string
+	Duration time.Duration
+}
+
+// LoadScenarios reads a scenario file, or every *.yaml/*.yml file in a directory
+func LoadScenarios(path string) ([]Scenario, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{path}
+	if info.IsDir() {
+		files = nil
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			ext := strings.ToLower(filepath.Ext(e.Name()))
+			if !e.IsDir() && (ext == ".yaml" || ext == ".yml") {
+				files = append(files, filepath.Join(path, e.Name()))
+			}
+		}
+		sort.Strings(files)
+	}
+
+	var scenarios []Scenario
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		var s Scenario
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true) // typos in a scenario should fail loudly, not be skipped
+		if err := dec.Decode(&s); err != nil {
+			return nil, fmt.Errorf("%s: %v", f, err)
+		}
+		if s.Name == "" {
+			s.Name = strings.TrimSuffix(filepath.Base(f), filepath.Ext(f))
+		}
+		s.file = f
+		scenarios = append(scenarios, s)
+	}
+	return scenarios, nil
+}
+
+// RunScenario executes one scenario against a fresh in-process App
+func RunScenario(s Scenario) ScenarioResult {
+	start := time.Now()
+	result := ScenarioResult{Name: s.Name, File: s.file}
+	fail := func(step int, format string, args ...interface{}) {
+		result.Failures = append(result.Failures, fmt.Sprintf("step %d: %s", step, fmt.Sprintf(format, args...)))
+	}
+
+	dataDir, err := os.MkdirTemp("", "bridge-scenario-")
+	if err != nil {
+		result.Failures = append(result.Failures, fmt.Sprintf("data dir: %v", err))
+		return result
+	}
+	defer os.RemoveAll(dataDir)
+	cfg := defaultConfig()
+	cfg.DataDir = dataDir
+	cfg.QueueMemoryPerLane = s.Bridge.QueueMemoryPerLane
+	cfg.SpillSegmentRecords = s.Bridge.SpillSegmentRecords
+	cfg.AggregateFills = s.Bridge.AggregateFills
+	if s.Bridge.AggregateWindow != "" {
+		d, err := time.ParseDuration(s.Bridge.AggregateWindow)
+		if err != nil {
+			result.Failures = append(result.Failures, fmt.Sprintf("bridge.aggregate_window: %v", err))
+			return result
+		}
+		cfg.AggregateWindowMs = int(d / time.Millisecond)
+	}
+	if s.Bridge.DriftGrace != "" {
+		d, err := time.ParseDuration(s.Bridge.DriftGrace)
+		if err != nil {
+			result.Failures = append(result.Failures, fmt.Sprintf("bridge.drift_grace: %v", err))
+			return result
+		}
+		cfg.DriftGraceMs = int(d / time.Millisecond)
+	}
+	cfg.DriftAutoCorrect = s.Bridge.DriftAutoCorrect
+	cfg.Risk = s.Bridge.Risk
+	cfg.Sessions = s.Bridge.Sessions
+	cfg.TTL = s.Bridge.TTL
+	cfg.Routing = s.Bridge.Routing
+	cfg.Sizing = s.Bridge.Sizing
+	cfg.ManualTrades = s.Bridge.ManualTrades
+	cfg.NTCommands = s.Bridge.NTCommands
+	cfg.Addons = s.Bridge.Addons
+	cfg.Limits = s.Bridge.Limits
+	cfg.Audit = s.Bridge.Audit
+	cfg.normalize()
+
+	app := newAppWithConfig(cfg)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		result.Failures = append(result.Failures, fmt.Sprintf("bridge listen: %v", err))
+		return result
+	}
+	// The handler is swapped when a restart step replaces the App
+	var handlerMu sync.Mutex
+	handler := app.routes()
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlerMu.Lock()
+		h := handler
+		handlerMu.Unlock()
+		h.ServeHTTP(w, r)
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+	app.bridgeActive = true
+	stopMonitors := make(chan struct{})
+	defer func() { close(stopMonitors) }()
+	startMonitors := func() {
+		go app.runDriftMonitor(stopMonitors)
+		go app.runSessionMonitor(stopMonitors)
+		go app.runCommandMonitor(stopMonitors)
+	}
+	startMonitors()
+	bridgeURL := "http://" + listener.Addr().String()
+
+	// One fake EA per routing target, all configured alike; "" is the default EA
+	eas := make(map[string]*simulator.FakeEA)
+	eaFor := func(target string) *simulator.FakeEA {
+		if ea, ok := eas[target]; ok {
+			return ea
+		}
+		ea := simulator.NewFakeEA(bridgeURL)
+		ea.Target = target
+		if s.EA.Hedging != nil {
+			ea.Hedging = *s.EA.Hedging
+		}
+		ea.Behaviour.FillRatio = s.EA.FillRatio
+		ea.Behaviour.FailActions = s.EA.FailActions
+		ea.Behaviour.FailIDs = s.EA.FailIDs
+		ea.Behaviour.Slippage = s.EA.Slippage
+		ea.Behaviour.Point = s.EA.Point
+		ea.Behaviour.Symbol = s.EA.Symbol
+		ea.Behaviour.Balance = s.EA.Balance
+		eas[target] = ea
+		return ea
+	}
+	ea := eaFor("")
+
+	addon := simulator.NewFakeAddon(bridgeURL)
+	addon.SessionID = s.Addon.SessionID
+	if s.Addon.Offline {
+		// Point the bridge at a port nothing listens on
+		app.addonBaseURL = "http://127.0.0.1:1"
+	} else {
+		if err := addon.Start("127.0.0.1:0"); err != nil {
+			result.Failures = append(result.Failures, fmt.Sprintf("addon listen: %v", err))
+			return result
+		}
+		defer addon.Stop()
+		app.addonBaseURL = addon.URL()
+		delay, _ := time.ParseDuration(s.Addon.Delay)
+		addon.SetBehaviour(simulator.AddonBehaviour{Delay: delay, FailFirst: s.Addon.FailFirst, FailStatus: s.Addon.FailStatus,
+			IgnoreCommands: s.Addon.IgnoreCommands})
+	}
+
+	addons := map[string]*simulator.FakeAddon{"": addon}
+	addonFor := func(name string) (*simulator.FakeAddon, error) {
+		if fa, ok := addons[name]; ok {
+			return fa, nil
+		}
+		fa := simulator.NewFakeAddon(bridgeURL)
+		if err := fa.Start("127.0.0.1:0"); err != nil {
+			return nil, err
+		}
+		addons[name] = fa
+		return fa, nil
+	}
+	defer func() {
+		for name, fa := range addons {
+			if name != "" {
+				fa.Stop()
+			}
+		}
+	}()
+
+	var instances []*App
+	defer func() {
+		for _, inst := range instances {
+			inst.server.Close()
+			inst.releaseInstance()
+		}
+	}()
+	defer func() {
+		if app.audit != nil {
+			app.audit.close()
+		}
+	}()
+
+	pulled := 0
+	for i, step := range s.Steps {
+		n := i + 1
+		var stepErr error
+		switch {
+		case step.NTFill != nil:
+			f := step.NTFill
+			if f.Quantity == 0 {
+				f.Quantity = 1
+			}
+			addon.DropNext(f.Lost)
+			addon.Performance = simulator.Performance{Balance: f.NTBalance, DailyPnL: f.NTDailyPnL,
+				TradeResult: f.NTTradeResult, SessionTrades: f.NTSessionTrades}
+			if f.OrderType != "" && f.OrderType != "ENTRY" {
+				_, stepErr = addon.SendTrade(simulator.Trade{ID: f.BaseID + "_" + f.OrderType, BaseID: f.BaseID, Action: f.Action,
+					Price: f.Price, OrderType: f.OrderType, Instrument: f.Instrument, AccountName: f.Account})
+			} else {
+				stepErr = addon.SendFill(f.BaseID, f.Action, f.Quantity, f.Price, f.Instrument, f.Account)
+			}
+		case step.NTClose != nil:
+			c := step.NTClose
+			stepErr = addon.CloseHedge(c.BaseID, c.Quantity, c.Action, c.Instrument, c.Account, c.Reason)
+		case step.EAPull != nil:
+			limit := step.EAPull.Count
+			if limit == 0 {
+				limit = 1000
+			}
+			var execs []simulator.Execution
+			ea := eaFor(step.EAPull.Target)
+			if step.EAPull.Balance > 0 {
+				ea.Behaviour.Balance = step.EAPull.Balance
+			}
+			switch {
+			case step.EAPull.Batch > 0 && step.EAPull.SkipAck:
+				execs, stepErr = ea.StepBatch(step.EAPull.Batch, true)
+			case step.EAPull.Batch > 0:
+				execs, stepErr = ea.DrainBatches(step.EAPull.Batch, limit)
+			default:
+				execs, stepErr = ea.Drain(limit)
+			}
+			pulled += len(execs)
+			if step.EAPull.Count > 0 && len(execs) != step.EAPull.Count && stepErr == nil {
+				fail(n, "ea_pull expected %d messages, got %d", step.EAPull.Count, len(execs))
+			}
+			if len(step.EAPull.ExpectActions) > 0 {
+				var got []string
+				for _, e := range execs {
+					got = append(got, e.Message.Action)
+				}
+				if strings.Join(got, ",") != strings.Join(step.EAPull.ExpectActions, ",") {
+					fail(n, "ea_pull expected actions %v, got %v", step.EAPull.ExpectActions, got)
+				}
+			}
+		case step.MT5Close != nil:
+			c := step.MT5Close
+			baseID := c.BaseID
+			if c.NetOf != "" {
+				var ok bool
+				if baseID, ok = app.netting.netTargetOf(c.NetOf); !ok {
+					stepErr = fmt.Errorf("%s is not part of a net target", c.NetOf)
+					break
+				}
+			}
+			if c.Async {
+				go ea.CloseHedge(baseID, c.Quantity, c.Reason)
+				break
+			}
+			stepErr = ea.CloseHedge(baseID, c.Quantity, c.Reason)
+		case step.EAPing != nil:
+			open := -1
+			if step.EAPing.OpenPositions != nil {
+				open = *step.EAPing.OpenPositions
+			}
+			_, stepErr = ea.Ping(open)
+		case step.MT5Manual != nil:
+			m := step.MT5Manual
+			var reply map[string]interface{}
+			reply, stepErr = eaFor(m.Target).ReportManualTrade(simulator.ManualTrade{Ticket: m.Ticket, Symbol: m.Symbol,
+				Action: m.Action, Volume: m.Volume, Price: m.Price})
+			if stepErr == nil && m.ExpectOutcome != "" {
+				got, _ := reply["outcome"].(string)
+				if reply["status"] == "ignored" {
+					got = "ignored"
+				}
+				if got != m.ExpectOutcome {
+					fail(n, "mt5_manual expected outcome %s, got %s (%v)", m.ExpectOutcome, got, reply)
+				}
+			}
+		case step.NTCommand != nil:
+			c := step.NTCommand
+			if res := app.SendNTCommand(c.Type, c.Account, c.Instrument, c.Strategy, c.Reason); res["status"] != "success" {
+				stepErr = fmt.Errorf("nt_command: %v", res["message"])
+			}
+		case step.AddonPollCommands != nil:
+			var got int
+			got, stepErr = addon.PollCommands()
+			if stepErr == nil && got != *step.AddonPollCommands {
+				fail(n, "addon_poll_commands expected %d commands, got %d", *step.AddonPollCommands, got)
+			}
+		case step.AddonRegister != nil:
+			reg := step.AddonRegister
+			var fa *simulator.FakeAddon
+			if fa, stepErr = addonFor(reg.Addon); stepErr == nil {
+				stepErr = fa.Register(reg.Addon, reg.Accounts, reg.Capabilities)
+			}
+		case step.AddonHeartbeat != nil:
+			hb := step.AddonHeartbeat
+			var fa *simulator.FakeAddon
+			if fa, stepErr = addonFor(hb.Addon); stepErr == nil {
+				err := fa.Heartbeat(hb.Addon)
+				switch {
+				case hb.ExpectUnknown && (err == nil || !strings.Contains(err.Error(), errCodeUnknownAddon)):
+					fail(n, "addon_heartbeat expected %s, got %v", errCodeUnknownAddon, err)
+				case !hb.ExpectUnknown:
+					stepErr = err
+				}
+			}
+		case step.Restart != nil:
+			rs := step.Restart
+			timeout := app.shutdownTimeout()
+			if rs.Timeout != "" {
+				if timeout, stepErr = time.ParseDuration(rs.Timeout); stepErr != nil {
+					break
+				}
+			}
+			report := app.gracefulShutdown(timeout)
+			if rs.ExpectQueued != nil && report.Queued != *rs.ExpectQueued {
+				fail(n, "restart expected %d queued message(s) saved, got %d", *rs.ExpectQueued, report.Queued)
+			}
+			if rs.ExpectPendingClosures != nil && report.PendingClosures != *rs.ExpectPendingClosures {
+				fail(n, "restart expected %d pending closure(s) saved, got %d", *rs.ExpectPendingClosures, report.PendingClosures)
+			}
+			if rs.ExpectUnsaved != nil && len(report.Unsaved) != *rs.ExpectUnsaved {
+				fail(n, "restart expected %d unsaved item(s), got %v", *rs.ExpectUnsaved, report.Unsaved)
+			}
+			close(stopMonitors)
+			stopMonitors = make(chan struct{})
+			next := newAppWithConfig(cfg)
+			next.addonBaseURL = app.addonBaseURL
+			next.bridgeActive = true
+			next.sessions.now = app.sessions.now
+			next.restoreState()
+			app = next
+			handlerMu.Lock()
+			handler = app.routes()
+			handlerMu.Unlock()
+			startMonitors()
+		case step.StartInstance != nil:
+			si := step.StartInstance
+			icfg := cfg
+			icfg.DataDir = filepath.Join(cfg.DataDir, "instances")
+			icfg.ListenAddr, icfg.FallbackListenAddr = si.ListenAddr, si.FallbackListenAddr
+			if icfg.ListenAddr == "bridge" {
+				icfg.ListenAddr = listener.Addr().String()
+			}
+			inst := openApp(icfg)
+			if stepErr = inst.startServer(); stepErr != nil {
+				inst.releaseInstance()
+				break
+			}
+			instances = append(instances, inst)
+			addr, err := readBridgeAddress(filepath.Join(icfg.DataDir, addressFileName))
+			if err != nil {
+				stepErr = fmt.Errorf("bridge address: %v", err)
+				break
+			}
+			if addr.ListenAddr != inst.listenAddr {
+				fail(n, "bridge_address.json names %s, the instance listens on %s", addr.ListenAddr, inst.listenAddr)
+			}
+			if si.ExpectFallback != nil && addr.Fallback != *si.ExpectFallback {
+				fail(n, "expected fallback %v, bridge_address.json says %v (%s)", *si.ExpectFallback, addr.Fallback, addr.ListenAddr)
+			}
+			resp, err := http.Get(addr.URL + "/health")
+			if err != nil {
+				stepErr = err
+				break
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				fail(n, "instance at %s answered /health with %s", addr.URL, resp.Status)
+			}
+		case step.EATelemetry != nil:
+			t := step.EATelemetry
+			stepErr = eaFor(t.Target).ReportTelemetry(simulator.Telemetry{Cushion: t.Cushion, OHF: t.OHF, Balance: t.Balance})
+		case step.ApproveHeld != "":
+			ids := []string{step.ApproveHeld}
+			if step.ApproveHeld == "all" {
+				ids = nil
+				for _, h := range app.risk.heldTrades() {
+					ids = append(ids, h.HoldID)
+				}
+			}
+			for _, id := range ids {
+				if res := app.ApproveHeldTrade(id); res["status"] != "success" {
+					stepErr = fmt.Errorf("approve %s: %v", id, res["message"])
+				}
+			}
+		case step.Pause != "":
+			app.PauseForwarding(step.Pause)
+		case step.Resume != nil:
+			app.ResumeForwarding(step.Resume.Collapse)
+		case step.Flatten != nil:
+			res := app.FlattenAll(step.Flatten.FlattenNT)
+			if nt, ok := res["nt"].(map[string]interface{}); ok && nt["success"] != true {
+				stepErr = fmt.Errorf("flatten NT: %v", nt["message"])
+			}
+		case step.SessionClock != "":
+			at, err := time.Parse(time.RFC3339, step.SessionClock)
+			if err != nil {
+				fail(n, "invalid session_clock %q: %v", step.SessionClock, err)
+				continue
+			}
+			app.sessions.mu.Lock()
+			app.sessions.now = func() time.Time { return at }
+			app.sessions.mu.Unlock()
+			app.checkSessions()
+		case step.Audit != nil:
+			if app.audit != nil {
+				app.audit.flush()
+			}
+			stepErr = checkAuditStep(filepath.Join(cfg.DataDir, auditFileName), cfg.Audit.Key, step.Audit,
+				func(format string, args ...interface{}) { fail(n, format, args...) })
+		case step.Request != nil:
+			stepErr = runRequestStep(bridgeURL, step.Request, func(format string, args ...interface{}) { fail(n, format, args...) })
+		case step.Wait != "":
+			d, err := time.ParseDuration(step.Wait)
+			if err != nil {
+				fail(n, "invalid wait %q: %v", step.Wait, err)
+				continue
+			}
+			time.Sleep(d)
+		case step.Expect != nil:
+			for _, msg := range checkExpect(app, eas, addons, pulled, step.Expect) {
+				fail(n, "%s", msg)
+			}
+		default:
+			fail(n, "step has no action")
+		}
+
+		if step.ExpectError != "" {
+			if stepErr == nil {
+				fail(n, "expected error %q, action succeeded", step.ExpectError)
+			} else if !strings.Contains(stepErr.Error(), step.ExpectError) {
+				fail(n, "expected error %q, got %v", step.ExpectError, stepErr)
+			}
+		} else if stepErr != nil {
+			fail(n, "%v", stepErr)
+		}
+		addonErrors(addons, func(err error) { fail(n, "%v", err) })
+	}
+	for _, fa := range addons {
+		fa.Wait()
+	}
+	addonErrors(addons, func(err error) { fail(len(s.Steps), "%v", err) })
+
+	result.Passed = len(result.Failures) == 0
+	result.Duration = time.Since(start)
+	return result
+}
+
+// addonErrors reports what each addon's background work failed with
+func addonErrors(addons map[string]*simulator.FakeAddon, report func(error)) {
+	names := make([]string, 0, len(addons))
+	for name := range addons {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, err := range addons[name].Errors() {
+			if name != "" {
+				err = fmt.Errorf("addon %s: %w", name, err)
+			}
+			report(err)
+		}
+	}
+}
+
+// checkExpect compares the live state against an expect step and returns mismatches
+func checkExpect(app *App, eas map[string]*simulator.FakeEA, addons map[string]*simulator.FakeAddon, pulled int, exp *StepExpect) []string {
+	ea := eas[""]
+	addon := addons[""]
+	var failures []string
+	status := app.GetStatus()
+
+	if exp.NetPosition != nil && status["netPosition"] != *exp.NetPosition {
+		failures = append(failures, fmt.Sprintf("net_position: expected %d, got %v", *exp.NetPosition, status["netPosition"]))
+	}
+	if exp.HedgeSize != nil && !floatEqual(status["hedgeSize"].(float64), *exp.HedgeSize) {
+		failures = append(failures, fmt.Sprintf("hedge_size: expected %.2f, got %v", *exp.HedgeSize, status["hedgeSize"]))
+	}
+	if exp.QueueSize != nil && status["queueSize"] != *exp.QueueSize {
+		failures = append(failures, fmt.Sprintf("queue_size: expected %d, got %v", *exp.QueueSize, status["queueSize"]))
+	}
+	if exp.QueueSpilled != nil && status["queueSpilled"] != *exp.QueueSpilled {
+		failures = append(failures, fmt.Sprintf("queue_spilled: expected %d, got %v", *exp.QueueSpilled, status["queueSpilled"]))
+	}
+	if exp.QueueUnacked != nil && status["queueUnacked"] != *exp.QueueUnacked {
+		failures = append(failures, fmt.Sprintf("queue_unacked: expected %d, got %v", *exp.QueueUnacked, status["queueUnacked"]))
+	}
+	if exp.FillsHeld != nil && status["fillsHeld"] != *exp.FillsHeld {
+		failures = append(failures, fmt.Sprintf("fills_held: expected %d, got %v", *exp.FillsHeld, status["fillsHeld"]))
+	}
+	if exp.DriftAlerts != nil && status["driftAlerts"] != *exp.DriftAlerts {
+		failures = append(failures, fmt.Sprintf("drift_alerts: expected %d, got %v", *exp.DriftAlerts, status["driftAlerts"]))
+	}
+	if exp.RiskHeld != nil && status["riskHeld"] != *exp.RiskHeld {
+		failures = append(failures, fmt.Sprintf("risk_held: expected %d, got %v", *exp.RiskHeld, status["riskHeld"]))
+	}
+	if exp.Paused != nil && app.control.isPaused() != *exp.Paused {
+		failures = append(failures, fmt.Sprintf("paused: expected %t, got %t", *exp.Paused, app.control.isPaused()))
+	}
+	if exp.SessionHeld != nil && status["sessionHeld"] != *exp.SessionHeld {
+		failures = append(failures, fmt.Sprintf("session_held: expected %d, got %v", *exp.SessionHeld, status["sessionHeld"]))
+	}
+	if exp.Expired != nil && status["expired"] != *exp.Expired {
+		failures = append(failures, fmt.Sprintf("expired: expected %d, got %v", *exp.Expired, status["expired"]))
+	}
+	if exp.AddonFlattens != nil && addon.Flattens() != *exp.AddonFlattens {
+		failures = append(failures, fmt.Sprintf("addon_flattens: expected %d, got %d", *exp.AddonFlattens, addon.Flattens()))
+	}
+	if exp.SequenceGaps != nil && status["sequenceGaps"] != *exp.SequenceGaps {
+		failures = append(failures, fmt.Sprintf("sequence_gaps: expected %d, got %v", *exp.SequenceGaps, status["sequenceGaps"]))
+	}
+	if exp.QueueDepths != nil {
+		depths, _ := status["queueDepths"].(map[string]int)
+		for laneName, want := range exp.QueueDepths {
+			if depths[laneName] != want {
+				failures = append(failures, fmt.Sprintf("queue_depths[%s]: expected %d, got %d", laneName, want, depths[laneName]))
+			}
+		}
+	}
+	if exp.HedgebotActive != nil && status["hedgebotActive"] != *exp.HedgebotActive {
+		failures = append(failures, fmt.Sprintf("hedgebot_active: expected %t, got %v", *exp.HedgebotActive, status["hedgebotActive"]))
+	}
+	if exp.AddonConnected != nil && status["addonConnected"] != *exp.AddonConnected {
+		failures = append(failures, fmt.Sprintf("addon_connected: expected %t, got %v", *exp.AddonConnected, status["addonConnected"]))
+	}
+	if exp.EAOpenVolume != nil && !floatEqual(ea.OpenVolume(""), *exp.EAOpenVolume) {
+		failures = append(failures, fmt.Sprintf("ea_open_volume: expected %.2f, got %.2f", *exp.EAOpenVolume, ea.OpenVolume("")))
+	}
+	if exp.Executions != nil || exp.Slippage != nil {
+		stats := make(map[string]ExecutionStats)
+		for _, st := range app.execution.report().Instruments {
+			stats[st.Instrument] = st
+		}
+		for instrument, want := range exp.Executions {
+			if got := stats[instrument].Executions; got != want {
+				failures = append(failures, fmt.Sprintf("executions[%s]: expected %d, got %d", instrument, want, got))
+			}
+		}
+		for instrument, want := range exp.Slippage {
+			got := stats[instrument].SlippagePts
+			if got == nil || !floatEqual(got.Mean, want) {
+				failures = append(failures, fmt.Sprintf("slippage[%s]: expected %.2f, got %+v", instrument, want, got))
+			}
+		}
+	}
+	for target, want := range exp.EAOpenByTarget {
+		var got float64
+		if tea := eas[target]; tea != nil {
+			got = tea.OpenVolume("")
+		}
+		if !floatEqual(got, want) {
+			failures = append(failures, fmt.Sprintf("ea_open_volume_by_target[%s]: expected %.2f, got %.2f", target, want, got))
+		}
+	}
+	for baseID, want := range exp.EALotSizes {
+		got := 0.0
+		for _, tea := range eas {
+			for _, ex := range tea.Executions() {
+				if ex.Message.BaseID == baseID && ex.Message.Action != "CLOSE_HEDGE" {
+					got = ex.Message.LotSize
+				}
+			}
+		}
+		if !floatEqual(got, want) {
+			failures = append(failures, fmt.Sprintf("ea_lot_sizes[%s]: expected %.2f, got %.2f", baseID, want, got))
+		}
+	}
+	for baseID, want := range exp.EAOpenSideByBase {
+		got := ""
+		for _, tea := range eas {
+			for _, h := range tea.OpenHedges() {
+				if h.BaseID == baseID {
+					got = h.Action
+				}
+			}
+		}
+		if !strings.EqualFold(got, want) {
+			failures = append(failures, fmt.Sprintf("ea_open_side_by_base[%s]: expected %s, got %q", baseID, want, got))
+		}
+	}
+	if exp.MT5Net != nil {
+		book := make(map[string]float64)
+		for _, in := range app.drift.snapshot() {
+			book[in.Instrument] = in.MT5Net
+		}
+		for instrument, want := range exp.MT5Net {
+			if got := book[instrument]; !floatEqual(got, want) {
+				failures = append(failures, fmt.Sprintf("mt5_net[%s]: expected %.2f, got %.2f", instrument, want, got))
+			}
+		}
+	}
+	for baseID, want := range exp.EAOpenByBase {
+		if got := ea.OpenVolume(baseID); !floatEqual(got, want) {
+			failures = append(failures, fmt.Sprintf("ea_open_volume_by_base[%s]: expected %.2f, got %.2f", baseID, want, got))
+		}
+	}
+	if exp.TelemetryNT != nil || exp.TelemetryEA != nil {
+		tel := app.GetTelemetry()
+		if exp.TelemetryNT != nil && len(tel.NT) != *exp.TelemetryNT {
+			failures = append(failures, fmt.Sprintf("telemetry_nt: expected %d points, got %d", *exp.TelemetryNT, len(tel.NT)))
+		}
+		if exp.TelemetryEA != nil && len(tel.EA) != *exp.TelemetryEA {
+			failures = append(failures, fmt.Sprintf("telemetry_ea: expected %d points, got %d", *exp.TelemetryEA, len(tel.EA)))
+		}
+	}
+	if exp.ManualTrades != nil && len(app.GetManualTrades()) != *exp.ManualTrades {
+		failures = append(failures, fmt.Sprintf("manual_trades: expected %d, got %d", *exp.ManualTrades, len(app.GetManualTrades())))
+	}
+	if exp.AddonMirrors != nil && len(addon.Mirrors()) != *exp.AddonMirrors {
+		failures = append(failures, fmt.Sprintf("addon_mirrors: expected %d, got %d", *exp.AddonMirrors, len(addon.Mirrors())))
+	}
+	if exp.NTCommands != nil {
+		states := make(map[string]int)
+		for _, c := range app.GetNTCommands() {
+			states[c.State]++
+		}
+		for state, want := range exp.NTCommands {
+			if states[state] != want {
+				failures = append(failures, fmt.Sprintf("nt_commands[%s]: expected %d, got %d", state, want, states[state]))
+			}
+		}
+	}
+	if exp.AddonCommands != nil && len(addon.Commands()) != *exp.AddonCommands {
+		failures = append(failures, fmt.Sprintf("addon_commands: expected %d, got %d", *exp.AddonCommands, len(addon.Commands())))
+	}
+	if exp.AddonsRegistered != nil && len(app.GetAddons()) != *exp.AddonsRegistered {
+		failures = append(failures, fmt.Sprintf("addons_registered: expected %d, got %d", *exp.AddonsRegistered, len(app.GetAddons())))
+	}
+	for name, want := range exp.AddonClosures {
+		key := name
+		if name == "default" {
+			key = ""
+		}
+		got := 0
+		if fa := addons[key]; fa != nil {
+			got = len(fa.Closures())
+		}
+		if got != want {
+			failures = append(failures, fmt.Sprintf("addon_closures[%s]: expected %d, got %d", name, want, got))
+		}
+	}
+	rateLimited, tooLarge := app.limiter.totals()
+	if exp.RateLimited != nil && rateLimited != *exp.RateLimited {
+		failures = append(failures, fmt.Sprintf("rate_limited: expected %d, got %d", *exp.RateLimited, rateLimited))
+	}
+	if exp.BodyTooLarge != nil && tooLarge != *exp.BodyTooLarge {
+		failures = append(failures, fmt.Sprintf("body_too_large: expected %d, got %d", *exp.BodyTooLarge, tooLarge))
+	}
+	if exp.EAPulled != nil && pulled != *exp.EAPulled {
+		failures = append(failures, fmt.Sprintf("ea_pulled: expected %d, got %d", *exp.EAPulled, pulled))
+	}
+	if n := exp.AddonNotified; n != nil {
+		within := 2 * time.Second
+		if n.Within != "" {
+			if d, err := time.ParseDuration(n.Within); err == nil {
+				within = d
+			}
+		}
+		got, ok := addon.WaitForClosure(n.BaseID, within)
+		switch {
+		case !ok:
+			failures = append(failures, fmt.Sprintf("addon_notified: no closure for base_id %s within %v", n.BaseID, within))
+		case n.Quantity != nil && !floatEqual(got.ClosedHedgeQuantity, *n.Quantity):
+			failures = append(failures, fmt.Sprintf("addon_notified: expected quantity %.2f, got %.2f", *n.Quantity, got.ClosedHedgeQuantity))
+		case n.Reason != "" && got.ClosureReason != n.Reason:
+			failures = append(failures, fmt.Sprintf("addon_notified: expected reason %q, got %q", n.Reason, got.ClosureReason))
+		}
+	}
+	// Counted after waiting for addon_notified, which may still be on its way
+	if exp.AddonNotifications != nil && len(addon.Closures()) != *exp.AddonNotifications {
+		failures = append(failures, fmt.Sprintf("addon_notifications: expected %d, got %d", *exp.AddonNotifications, len(addon.Closures())))
+	}
+	return failures
+}
+
+func floatEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+// checkAuditStep tampers with the audit log if asked, verifies it and counts its kinds
+func checkAuditStep(path, key string, st *StepAudit, fail func(string, ...interface{})) error {
+	if st.Tamper != "" {
+		if err := tamperAuditLog(path, st.Tamper); err != nil {
+			return err
+		}
+	}
+	res, err := verifyAuditLog(path, key)
+	if err != nil {
+		return err
+	}
+	if st.ExpectOK != nil && res.OK != *st.ExpectOK {
+		fail("audit: expected ok %v, got %v (line %d: %s)", *st.ExpectOK, res.OK, res.BrokenLine, res.Problem)
+	}
+	if st.ExpectBrokenLine != 0 && res.BrokenLine != st.ExpectBrokenLine {
+		fail("audit: expected line %d to break the chain, got line %d (%s)", st.ExpectBrokenLine, res.BrokenLine, res.Problem)
+	}
+	if len(st.ExpectKinds) == 0 {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	kinds := make(map[string]int)
+	for _, raw := range bytes.Split(bytes.TrimSpace(data), []byte("\n")) {
+		var line auditLine
+		var e AuditEntry
+		if json.Unmarshal(raw, &line) == nil && json.Unmarshal(line.Entry, &e) == nil {
+			kinds[e.Kind]++
+		}
+	}
+	for kind, want := range st.ExpectKinds {
+		if kinds[kind] != want {
+			fail("audit: expected %d %s entr(ies), got %d (%v)", want, kind, kinds[kind], kinds)
+		}
+	}
+	return nil
+}
+
+// tamperAuditLog alters the entry with a given seq: "edit:N" changes its net
+// position without fixing the hash, "delete:N" removes its line
+func tamperAuditLog(path, how string) error {
+	op, seqStr, _ := strings.Cut(how, ":")
+	var seq uint64
+	if _, err := fmt.Sscan(seqStr, &seq); err != nil || (op != "edit" && op != "delete") {
+		return fmt.Errorf("tamper must be edit:N or delete:N, got %q", how)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var out [][]byte
+	found := false
+	for _, raw := range bytes.Split(bytes.TrimSpace(data), []byte("\n")) {
+		var line auditLine
+		var e AuditEntry
+		if json.Unmarshal(raw, &line) != nil || json.Unmarshal(line.Entry, &e) != nil || e.Seq != seq {
+			out = append(out, raw)
+			continue
+		}
+		found = true
+		if op == "delete" {
+			continue
+		}
+		e.NetPosition += 100
+		line.Entry, _ = json.Marshal(e)
+		raw, _ = json.Marshal(line)
+		out = append(out, raw)
+	}
+	if !found {
+		return fmt.Errorf("no audit entry with seq %d", seq)
+	}
+	return os.WriteFile(path, append(bytes.Join(out, []byte("\n")), '\n'), 0o644)
+}
+
+// runRequestStep sends a StepRequest and reports status counts that differ
+func runRequestStep(bridgeURL string, rq *StepRequest, fail func(string, ...interface{})) error {
+	count := rq.Count
+	if count <= 0 {
+		count = 1
+	}
+	method := rq.Method
+	if method == "" {
+		method = http.MethodGet
+		if rq.BodyBytes > 0 {
+			method = http.MethodPost
+		}
+	}
+	var body []byte
+	if rq.BodyBytes > 0 {
+		// {"pad":"xxx..."} of exactly body_bytes
+		body = []byte(`{"pad":"` + strings.Repeat("x", max(rq.BodyBytes-10, 0)) + `"}`)
+	}
+	got := make(map[int]int)
+	for i := 0; i < count; i++ {
+		var r io.Reader
+		if body != nil {
+			r = bytes.NewReader(body)
+			if rq.Chunked {
+				r = io.MultiReader(r) // hides the length, so the body is sent chunked
+			}
+		}
+		req, err := http.NewRequest(method, bridgeURL+rq.Path, r)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		got[resp.StatusCode]++
+	}
+	for status, want := range rq.ExpectStatus {
+		if got[status] != want {
+			fail("request %s %s: expected %d response(s) with status %d, got %v", method, rq.Path, want, status, got)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"testing"
+)
+
+// TestMain keeps the bridge's request logging out of test output
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// TestScenarios runs the conformance scenarios under scenarios/, one subtest each
+func TestScenarios(t *testing.T) {
+	scenarios, err := LoadScenarios("scenarios")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scenarios) == 0 {
+		t.Fatal("no scenarios found in scenarios/")
+	}
+	for _, s := range scenarios {
+		t.Run(s.Name, func(t *testing.T) {
+			r := RunScenario(s)
+			for _, f := range r.Failures {
+				t.Error(f)
+			}
+		})
+	}
+}
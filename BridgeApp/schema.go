@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The published JSON Schemas for the /v1/ API, one per message type. They are
+// served from /v1/schemas/{name} and are the single source of truth for request
+// validation.
+//
+//go:embed schemas/*.schema.json
+var schemaFiles embed.FS
+
+// jsonSchema is the subset of JSON Schema (draft 2020-12) the bridge's message
+// schemas use: flat objects of scalar properties.
+type jsonSchema struct {
+	ID                   string                 `json:"$id"`
+	Title                string                 `json:"title"`
+	Type                 string                 `json:"type"`
+	Required             []string               `json:"required"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+	Enum                 []interface{}          `json:"enum"`
+	Format               string                 `json:"format"`
+	Minimum              *float64               `json:"minimum"`
+	ExclusiveMinimum     *float64               `json:"exclusiveMinimum"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+}
+
+// Kinds of schema violation. Lenient (unversioned) routes only enforce kindType.
+const (
+	kindType     = "type"
+	kindRequired = "required"
+	kindUnknown  = "unknown_field"
+	kindValue    = "value"
+)
+
+// fieldError is one field-level validation failure in the error envelope
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+	kind    string
+}
+
+var (
+	schemasOnce sync.Once
+	schemas     map[string]*jsonSchema
+	schemaRaw   map[string][]byte
+	schemasErr  error
+)
+
+// loadSchemas parses the embedded schema files once
+func loadSchemas() (map[string]*jsonSchema, error) {
+	schemasOnce.Do(func() {
+		schemas = make(map[string]*jsonSchema)
+		schemaRaw = make(map[string][]byte)
+		entries, err := schemaFiles.ReadDir("schemas")
+		if err != nil {
+			schemasErr = err
+			return
+		}
+		for _, e := range entries {
+			data, err := schemaFiles.ReadFile(path.Join("schemas", e.Name()))
+			if err != nil {
+				schemasErr = err
+				return
+			}
+			var s jsonSchema
+			if err := json.Unmarshal(data, &s); err != nil {
+				schemasErr = fmt.Errorf("schema %s: %v", e.Name(), err)
+				return
+			}
+			schemas[s.Title] = &s
+			schemaRaw[s.Title] = data
+		}
+	})
+	return schemas, schemasErr
+}
+
+// schemaNames lists the published schemas in name order
+func schemaNames() []string {
+	loaded, _ := loadSchemas()
+	names := make([]string, 0, len(loaded))
+	for name := range loaded {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateJSON checks body against the named schema and returns every violation,
+// sorted by field. A body that is not a JSON object yields a single error on "".
+func validateJSON(schemaName string, body []byte) []fieldError {
+	loaded, err := loadSchemas()
+	if err != nil {
+		return []fieldError{{Field: "", Message: "schemas unavailable: " + err.Error(), kind: kindType}}
+	}
+	schema, ok := loaded[schemaName]
+	if !ok {
+		return []fieldError{{Field: "", Message: "unknown schema " + schemaName, kind: kindType}}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return []fieldError{{Field: "", Message: "body is not valid JSON: " + err.Error(), kind: kindType}}
+	}
+	obj, ok := doc.(map[string]interface{})
+	if !ok {
+		return []fieldError{{Field: "", Message: "body must be a JSON object", kind: kindType}}
+	}
+
+	var errs []fieldError
+	for _, name := range schema.Required {
+		value, present := obj[name]
+		switch {
+		case !present:
+			errs = append(errs, fieldError{Field: name, Message: "is required", kind: kindRequired})
+		case value == nil:
+			errs = append(errs, fieldError{Field: name, Message: "is required and must not be null", kind: kindRequired})
+		}
+	}
+	for name, value := range obj {
+		prop, known := schema.Properties[name]
+		if !known {
+			if schema.AdditionalProperties != nil && !*schema.AdditionalProperties {
+				errs = append(errs, fieldError{Field: name, Message: "is not a known field of " + schema.Title, kind: kindUnknown})
+			}
+			continue
+		}
+		if fe := validateValue(name, prop, value); fe != nil {
+			errs = append(errs, *fe)
+		}
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+	return errs
+}
+
+// validateValue checks one scalar property. JSON null is treated like an absent
+// value; validateJSON refuses it for required properties.
+func validateValue(field string, s *jsonSchema, value interface{}) *fieldError {
+	if value == nil {
+		return nil
+	}
+	typeErr := &fieldError{Field: field, Message: "must be " + article(s.Type), kind: kindType}
+
+	switch s.Type {
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return typeErr
+		}
+		if s.MinLength != nil && len(str) < *s.MinLength {
+			if *s.MinLength == 1 {
+				return &fieldError{Field: field, Message: "must not be empty", kind: kindValue}
+			}
+			return &fieldError{Field: field, Message: fmt.Sprintf("must be at least %d characters", *s.MinLength), kind: kindValue}
+		}
+		if s.MaxLength != nil && len(str) > *s.MaxLength {
+			return &fieldError{Field: field, Message: fmt.Sprintf("must be at most %d characters", *s.MaxLength), kind: kindValue}
+		}
+		if s.Format == "date-time" && str != "" {
+			if _, err := time.Parse(time.RFC3339, str); err != nil {
+				return &fieldError{Field: field, Message: "must be an RFC 3339 date-time, e.g. 2025-01-04T15:30:00Z", kind: kindValue}
+			}
+		}
+	case "number", "integer":
+		num, ok := value.(json.Number)
+		if !ok {
+			return typeErr
+		}
+		f, err := num.Float64()
+		if err != nil {
+			return typeErr
+		}
+		if s.Type == "integer" {
+			if _, err := num.Int64(); err != nil {
+				return typeErr
+			}
+		}
+		if s.Minimum != nil && f < *s.Minimum {
+			return &fieldError{Field: field, Message: fmt.Sprintf("must be >= %g", *s.Minimum), kind: kindValue}
+		}
+		if s.ExclusiveMinimum != nil && f <= *s.ExclusiveMinimum {
+			return &fieldError{Field: field, Message: fmt.Sprintf("must be > %g", *s.ExclusiveMinimum), kind: kindValue}
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return typeErr
+		}
+	}
+
+	if len(s.Enum) > 0 {
+		for _, allowed := range s.Enum {
+			if fmt.Sprint(allowed) == fmt.Sprint(value) {
+				return nil
+			}
+		}
+		options := make([]string, len(s.Enum))
+		for i, allowed := range s.Enum {
+			options[i] = fmt.Sprintf("%q", allowed)
+		}
+		return &fieldError{Field: field, Message: "must be one of " + strings.Join(options, ", "), kind: kindValue}
+	}
+	return nil
+}
+
+func article(jsonType string) string {
+	switch jsonType {
+	case "integer":
+		return "an integer"
+	case "object", "array":
+		return "an " + jsonType
+	}
+	return "a " + jsonType
+}
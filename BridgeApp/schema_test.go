@@ -0,0 +1,35 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateJSON(t *testing.T) {
+	longID := strings.Repeat("a", 60)
+	tests := []struct {
+		name   string
+		body   string
+		errors []string // field:kind of each violation, in field order
+	}{
+		{"valid", `{"event_type":"hedge_close_notification","base_id":"B1","closed_hedge_quantity":1,"closed_hedge_action":"sell"}`, nil},
+		{"long base_id is left to the cleanup", `{"event_type":"hedge_close_notification","base_id":"` + longID + `","closed_hedge_quantity":1,"closed_hedge_action":"sell"}`, nil},
+		{"required field missing", `{"event_type":"hedge_close_notification","closed_hedge_quantity":1,"closed_hedge_action":"sell"}`, []string{"base_id:required"}},
+		{"required field null", `{"event_type":"hedge_close_notification","base_id":null,"closed_hedge_quantity":null,"closed_hedge_action":"sell"}`, []string{"base_id:required", "closed_hedge_quantity:required"}},
+		{"optional field null", `{"event_type":"hedge_close_notification","base_id":"B1","closed_hedge_quantity":1,"closed_hedge_action":"sell","closure_reason":null}`, nil},
+		{"wrong type", `{"event_type":"hedge_close_notification","base_id":7,"closed_hedge_quantity":1,"closed_hedge_action":"sell"}`, []string{"base_id:type"}},
+		{"empty base_id", `{"event_type":"hedge_close_notification","base_id":"","closed_hedge_quantity":1,"closed_hedge_action":"sell"}`, []string{"base_id:value"}},
+		{"unknown field", `{"event_type":"hedge_close_notification","base_id":"B1","closed_hedge_quantity":1,"closed_hedge_action":"sell","extra":1}`, []string{"extra:unknown_field"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, fe := range validateJSON("HedgeCloseNotification", []byte(tt.body)) {
+				got = append(got, fe.Field+":"+fe.kind)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.errors, ",") {
+				t.Errorf("violations = %v, want %v", got, tt.errors)
+			}
+		})
+	}
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Sequence event kinds reported to the UI and in /v1/sequence
+const (
+	seqEventGap       = "gap"
+	seqEventGapFilled = "gap_filled"
+	seqEventDuplicate = "duplicate"
+	seqEventReset     = "session_reset"
+)
+
+// maxSequenceEvents is how many recent sequence events are kept for the UI
+const maxSequenceEvents = 200
+
+// SequenceEvent records a gap, a late arrival that fills a gap, or a duplicate
+type SequenceEvent struct {
+	Time       time.Time `json:"time"`
+	Source     string    `json:"source"`
+	Kind       string    `json:"kind"`
+	Seq        uint64    `json:"seq"`
+	Expected   uint64    `json:"expected,omitempty"`
+	ResendFrom uint64    `json:"resend_from,omitempty"`
+	Message    string    `json:"message"`
+}
+
+// SeqRange is a run of missing sequence numbers, From to To inclusive. Gaps are
+// kept as ranges so a wild jump costs one entry and none of it is forgotten.
+type SeqRange struct {
+	From uint64 `json:"from"`
+	To   uint64 `json:"to"`
+}
+
+// SourceSequence is the sequencing state of one addon session
+type SourceSequence struct {
+	Source     string     `json:"source"`
+	LastSeq    uint64     `json:"last_seq"`
+	Missing    []SeqRange `json:"missing,omitempty"`     // oldest first
+	ResendFrom uint64     `json:"resend_from,omitempty"` // lowest missing sequence, 0 when complete
+	Received   uint64     `json:"received"`
+	Duplicates uint64     `json:"duplicates"`
+	Gaps       uint64     `json:"gaps"`
+	LastSeen   time.Time  `json:"last_seen"`
+}
+
+// sequenceResult tells the handler what to do with one sequenced message
+type sequenceResult struct {
+	Duplicate  bool
+	ResendFrom uint64 // non-zero while the source has outstanding gaps
+}
+
+// sequenceTracker follows the per-session sequence numbers sent by the NT addon
+// and detects gaps (a lost POST) and duplicates (a retried POST)
+type sequenceTracker struct {
+	mu       sync.Mutex
+	sources  map[string]*SourceSequence
+	events   []SequenceEvent
+	inFlight map[string]map[uint64]bool // claimed sequences not yet accepted or released
+}
+
+func newSequenceTracker() *sequenceTracker {
+	return &sequenceTracker{sources: make(map[string]*SourceSequence), inFlight: make(map[string]map[uint64]bool)}
+}
+
+// claim checks seq before its message is processed. A duplicate, or a retry of
+// a message still being processed, is recorded as a duplicate; anything else
+// is held in flight until observe accepts it or release gives it up, so a
+// message the bridge refuses can be sent again.
+func (t *sequenceTracker) claim(source string, seq uint64) (sequenceResult, []SequenceEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, known := t.sources[source]
+	if !known {
+		s = &SourceSequence{Source: source}
+	}
+	reset := known && seq == 1 && s.LastSeq > 1
+	if t.inFlight[source][seq] || (!reset && seq <= s.LastSeq && !s.missing(seq)) {
+		if !known {
+			t.sources[source] = s
+		}
+		s.Duplicates++
+		s.LastSeen = time.Now()
+		events := []SequenceEvent{{Time: s.LastSeen, Source: source, Kind: seqEventDuplicate, Seq: seq,
+			Message: fmt.Sprintf("seq %d already received (last %d); message dropped", seq, s.LastSeq)}}
+		t.record(events)
+		return sequenceResult{Duplicate: true, ResendFrom: s.resendFrom()}, events
+	}
+	if t.inFlight[source] == nil {
+		t.inFlight[source] = make(map[uint64]bool)
+	}
+	t.inFlight[source][seq] = true
+	return sequenceResult{ResendFrom: s.resendFrom()}, nil
+}
+
+// release gives up a claimed seq whose message was refused
+func (t *sequenceTracker) release(source string, seq uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.inFlight[source], seq)
+}
+
+// observe records seq for source. It returns the events generated so the caller
+// can forward them to the UI.
+func (t *sequenceTracker) observe(source string, seq uint64) (sequenceResult, []SequenceEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.inFlight[source], seq)
+
+	now := time.Now()
+	var events []SequenceEvent
+	s, known := t.sources[source]
+	if !known {
+		s = &SourceSequence{Source: source}
+		t.sources[source] = s
+	}
+	s.LastSeen = now
+
+	// Sessions count from 1, so a new source starting above 1 is a gap too.
+	// A known source sending 1 again means the addon restarted its counter.
+	if known && seq == 1 && s.LastSeq > 1 {
+		events = append(events, SequenceEvent{Time: now, Source: source, Kind: seqEventReset, Seq: seq,
+			Message: fmt.Sprintf("sequence restarted at 1 after %d; outstanding gaps discarded", s.LastSeq)})
+		s.LastSeq = 0
+		s.Missing = nil
+	}
+
+	switch {
+	case seq == s.LastSeq+1:
+		s.LastSeq = seq
+		s.Received++
+	case seq > s.LastSeq+1:
+		expected := s.LastSeq + 1
+		s.Missing = append(s.Missing, SeqRange{From: expected, To: seq - 1})
+		s.Gaps++
+		s.LastSeq = seq
+		s.Received++
+		events = append(events, SequenceEvent{Time: now, Source: source, Kind: seqEventGap, Seq: seq, Expected: expected,
+			ResendFrom: s.resendFrom(), Message: fmt.Sprintf("expected seq %d, got %d: %d message(s) missing", expected, seq, seq-expected)})
+	default:
+		// seq <= LastSeq: either a late arrival filling a gap or a duplicate
+		if s.missing(seq) {
+			s.fill(seq)
+			s.Received++
+			events = append(events, SequenceEvent{Time: now, Source: source, Kind: seqEventGapFilled, Seq: seq,
+				Message: fmt.Sprintf("missing seq %d arrived; %d still missing", seq, s.missingCount())})
+		} else {
+			s.Duplicates++
+			events = append(events, SequenceEvent{Time: now, Source: source, Kind: seqEventDuplicate, Seq: seq,
+				Message: fmt.Sprintf("seq %d already received (last %d); message dropped", seq, s.LastSeq)})
+			t.record(events)
+			return sequenceResult{Duplicate: true, ResendFrom: s.resendFrom()}, events
+		}
+	}
+
+	s.ResendFrom = s.resendFrom()
+	t.record(events)
+	return sequenceResult{ResendFrom: s.ResendFrom}, events
+}
+
+func (s *SourceSequence) resendFrom() uint64 {
+	if len(s.Missing) == 0 {
+		return 0
+	}
+	return s.Missing[0].From
+}
+
+// missing reports whether seq is in one of the source's gaps
+func (s *SourceSequence) missing(seq uint64) bool {
+	for _, r := range s.Missing {
+		if seq >= r.From && seq <= r.To {
+			return true
+		}
+	}
+	return false
+}
+
+// fill takes seq out of the gap holding it, splitting the gap when seq is inside it
+func (s *SourceSequence) fill(seq uint64) {
+	for i, r := range s.Missing {
+		if seq < r.From || seq > r.To {
+			continue
+		}
+		var rest []SeqRange
+		if seq > r.From {
+			rest = append(rest, SeqRange{From: r.From, To: seq - 1})
+		}
+		if seq < r.To {
+			rest = append(rest, SeqRange{From: seq + 1, To: r.To})
+		}
+		s.Missing = append(s.Missing[:i], append(rest, s.Missing[i+1:]...)...)
+		return
+	}
+}
+
+// missingCount counts the sequence numbers in the source's gaps
+func (s *SourceSequence) missingCount() uint64 {
+	var n uint64
+	for _, r := range s.Missing {
+		n += r.To - r.From + 1
+	}
+	return n
+}
+
+func (t *sequenceTracker) record(events []SequenceEvent) {
+	t.events = append(t.events, events...)
+	if over := len(t.events) - maxSequenceEvents; over > 0 {
+		t.events = t.events[over:]
+	}
+}
+
+// snapshot returns a copy of every source's state, ordered by source
+func (t *sequenceTracker) snapshot() []SourceSequence {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]SourceSequence, 0, len(t.sources))
+	for _, s := range t.sources {
+		c := *s
+		c.Missing = append([]SeqRange(nil), s.Missing...)
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Source < out[j].Source })
+	return out
+}
+
+// restore reinstates the sources saved by snapshot, so a message sent before a
+// restart is still recognised as a duplicate and a gap can still be filled
+func (t *sequenceTracker) restore(sources []SourceSequence) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, saved := range sources {
+		s := saved
+		s.Missing = append([]SeqRange(nil), saved.Missing...)
+		t.sources[s.Source] = &s
+	}
+}
+
+// recentEvents returns a copy of the recent event log, oldest first
+func (t *sequenceTracker) recentEvents() []SequenceEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]SequenceEvent(nil), t.events...)
+}
+
+// outstandingGaps counts missing messages across all sources
+func (t *sequenceTracker) outstandingGaps() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := 0
+	for _, s := range t.sources {
+		n += int(s.missingCount())
+	}
+	return n
+}
+
+func indexOf(list []uint64, v uint64) int {
+	for i, x := range list {
+		if x == v {
+			return i
+		}
+	}
+	return -1
+}
+
+// sequenceSource names the sequence stream a message belongs to
+func sequenceSource(sessionID string) string {
+	if sessionID == "" {
+		return "addon"
+	}
+	return sessionID
+}
+
+// checkSequence claims an inbound NT message's seq before it is processed. ok
+// is false for duplicates, which the caller must not process again. The caller
+// records the seq with acceptSequence once the message is accepted, and must
+// call releaseSequence either way.
+func (a *App) checkSequence(sessionID string, seq uint64) (res sequenceResult, ok bool) {
+	if seq == 0 {
+		return sequenceResult{}, true // unsequenced (older addon)
+	}
+	res, events := a.sequences.claim(sequenceSource(sessionID), seq)
+	a.sequenceEvents(events)
+	return res, !res.Duplicate
+}
+
+// acceptSequence records the seq of a message the bridge acted on, logging and
+// emitting any gap it reveals or fills, and returns what the reply should ask for
+func (a *App) acceptSequence(sessionID string, seq uint64) sequenceResult {
+	if seq == 0 {
+		return sequenceResult{}
+	}
+	res, events := a.sequences.observe(sequenceSource(sessionID), seq)
+	a.sequenceEvents(events)
+	return res
+}
+
+// refuseSequenced answers a final 4xx refusal of a sequenced NT message. The
+// addon doesn't send such a message again, so its seq is accepted: left
+// unaccepted it would show as a gap nothing can fill.
+func (a *App) refuseSequenced(w http.ResponseWriter, sessionID string, seq uint64, status int, code, message string, fields ...fieldError) {
+	a.acceptSequence(sessionID, seq)
+	writeAPIError(w, status, code, message, fields...)
+}
+
+// acceptRefusedBody accepts the seq of an NT message decodeBody refused, read
+// from whatever of its body still parses, for the same reason
+func (a *App) acceptRefusedBody(body []byte) {
+	var stamp struct {
+		SessionID string `json:"session_id"`
+		Seq       uint64 `json:"seq"`
+	}
+	// A type error elsewhere in the body still leaves the stamp decoded
+	json.Unmarshal(body, &stamp)
+	a.acceptSequence(stamp.SessionID, stamp.Seq)
+}
+
+// releaseSequence frees the seq of a message that was not accepted, so the
+// addon can send it again; it does nothing once the seq was accepted
+func (a *App) releaseSequence(sessionID string, seq uint64) {
+	if seq != 0 {
+		a.sequences.release(sequenceSource(sessionID), seq)
+	}
+}
+
+func (a *App) sequenceEvents(events []SequenceEvent) {
+	for _, ev := range events {
+		log.Printf("SEQUENCE_%s: source=%s %s", ev.Kind, ev.Source, ev.Message)
+		a.emit("sequenceEvent", ev)
+	}
+}
+
+// sequenceReply adds the "resend from N" request to a /log_trade or /nt_close_hedge
+// response while the sender's session has outstanding gaps
+func sequenceReply(reply map[string]interface{}, res sequenceResult) map[string]interface{} {
+	if res.ResendFrom > 0 {
+		reply["resend_from"] = res.ResendFrom
+	}
+	return reply
+}
+
+// sequenceHandler reports sequencing state so the addon can resend what the
+// bridge is missing: GET /v1/sequence?source=<session_id>
+func (a *App) sequenceHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	source := r.URL.Query().Get("source")
+	sources := a.sequences.snapshot()
+	if source == "" {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"sources":    sources,
+			"events":     a.sequences.recentEvents(),
+			"bridge_seq": a.bridgeSeq.Load(),
+		})
+		return
+	}
+	for _, s := range sources {
+		if s.Source == source {
+			writeJSON(w, http.StatusOK, s)
+			return
+		}
+	}
+	writeAPIError(w, http.StatusNotFound, errCodeNotFound, "No sequenced messages received from source "+source)
+}
+
+// GetSequenceStatus returns per-source sequencing state and recent events for the UI
+func (a *App) GetSequenceStatus() map[string]interface{} {
+	return map[string]interface{}{
+		"sources":   a.sequences.snapshot(),
+		"events":    a.sequences.recentEvents(),
+		"bridgeSeq": a.bridgeSeq.Load(),
+	}
+}
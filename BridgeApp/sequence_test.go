@@ -0,0 +1,147 @@
+package main
+
+import "testing"
+
+func TestSequenceTracker(t *testing.T) {
+	type step struct {
+		source     string
+		seq        uint64
+		kind       string // event raised, if any
+		duplicate  bool
+		resendFrom uint64
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"in order", []step{
+			{"s1", 1, "", false, 0},
+			{"s1", 2, "", false, 0},
+		}},
+		{"gap filled late", []step{
+			{"s1", 1, "", false, 0},
+			{"s1", 4, seqEventGap, false, 2},
+			{"s1", 3, seqEventGapFilled, false, 2},
+			{"s1", 2, seqEventGapFilled, false, 0},
+			{"s1", 5, "", false, 0},
+		}},
+		{"duplicates", []step{
+			{"s1", 1, "", false, 0},
+			{"s1", 3, seqEventGap, false, 2},
+			{"s1", 3, seqEventDuplicate, true, 2},
+			{"s1", 4, "", false, 2},
+			{"s1", 3, seqEventDuplicate, true, 2},
+		}},
+		{"wide gap keeps every missing seq", []step{
+			{"s1", 1, "", false, 0},
+			{"s1", 5000, seqEventGap, false, 2},
+			{"s1", 4999, seqEventGapFilled, false, 2},
+			{"s1", 3000, seqEventGapFilled, false, 2},
+			{"s1", 2, seqEventGapFilled, false, 3},
+			{"s1", 3000, seqEventDuplicate, true, 3},
+			{"s1", 4998, seqEventGapFilled, false, 3},
+		}},
+		{"new source starting late", []step{
+			{"s1", 3, seqEventGap, false, 1},
+		}},
+		{"reset discards gaps", []step{
+			{"s1", 1, "", false, 0},
+			{"s1", 5, seqEventGap, false, 2},
+			{"s1", 1, seqEventReset, false, 0},
+			{"s1", 2, "", false, 0},
+		}},
+		{"sources are separate", []step{
+			{"s1", 1, "", false, 0},
+			{"s2", 2, seqEventGap, false, 1},
+			{"s1", 2, "", false, 0},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := newSequenceTracker()
+			for i, st := range tt.steps {
+				res, events := tr.observe(st.source, st.seq)
+				kind := ""
+				if len(events) > 0 {
+					kind = events[0].Kind
+				}
+				if kind != st.kind || res.Duplicate != st.duplicate || res.ResendFrom != st.resendFrom {
+					t.Fatalf("step %d (%s seq %d): event %q, duplicate %v, resend_from %d; want %q, %v, %d",
+						i+1, st.source, st.seq, kind, res.Duplicate, res.ResendFrom, st.kind, st.duplicate, st.resendFrom)
+				}
+			}
+		})
+	}
+}
+
+func TestSequenceGapRanges(t *testing.T) {
+	tr := newSequenceTracker()
+	tr.observe("s1", 1)
+	tr.observe("s1", 10)
+	tr.observe("s1", 5)
+	if n := tr.outstandingGaps(); n != 7 {
+		t.Fatalf("outstanding gaps = %d, want 7", n)
+	}
+	got := tr.snapshot()[0].Missing
+	want := []SeqRange{{2, 4}, {6, 9}}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("missing = %v, want %v", got, want)
+	}
+}
+
+func TestSequenceClaim(t *testing.T) {
+	type step struct {
+		op        string // claim, accept or release
+		seq       uint64
+		duplicate bool // of a claim
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"retry while in flight", []step{
+			{"claim", 1, false},
+			{"claim", 1, true},
+			{"accept", 1, false},
+			{"claim", 1, true},
+		}},
+		{"refused message can be sent again", []step{
+			{"claim", 1, false},
+			{"release", 1, false},
+			{"claim", 1, false},
+			{"accept", 1, false},
+			{"claim", 2, false},
+		}},
+		{"refused message leaves a gap", []step{
+			{"claim", 1, false},
+			{"accept", 1, false},
+			{"claim", 2, false},
+			{"release", 2, false},
+			{"claim", 3, false},
+			{"accept", 3, false},
+			{"claim", 2, false},
+		}},
+		{"reset is not a duplicate", []step{
+			{"claim", 3, false},
+			{"accept", 3, false},
+			{"claim", 1, false},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := newSequenceTracker()
+			for i, st := range tt.steps {
+				switch st.op {
+				case "claim":
+					if res, _ := tr.claim("s1", st.seq); res.Duplicate != st.duplicate {
+						t.Fatalf("step %d: claim seq %d duplicate %v, want %v", i+1, st.seq, res.Duplicate, st.duplicate)
+					}
+				case "accept":
+					tr.observe("s1", st.seq)
+				case "release":
+					tr.release("s1", st.seq)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata" // session time zones must resolve on Windows installs without zoneinfo
+)
+
+// sessionSearchLimit bounds how far ahead nextOpen looks for a session open
+const sessionSearchLimit = 14 * 24 * time.Hour
+
+// SessionConfig holds the trading-session schedules the bridge checks before
+// handing a message to MT5. Instruments without a schedule are always open.
+type SessionConfig struct {
+	// NetOut collapses what was held during a closed session into net entries at the open
+	NetOut bool `json:"net_out" yaml:"net_out"`
+	// Schedules are keyed by NT instrument ("NQ 03-25"), instrument root ("NQ"), or "*" for all
+	Schedules map[string]SessionSchedule `json:"schedules" yaml:"schedules"`
+}
+
+// SessionSchedule is the weekly quoting schedule of one MT5 symbol
+type SessionSchedule struct {
+	Timezone string           `json:"timezone" yaml:"timezone"` // IANA name, default UTC
+	Windows  []SessionWindow  `json:"windows" yaml:"windows"`
+	Holidays []SessionHoliday `json:"holidays" yaml:"holidays"`
+}
+
+// SessionWindow opens on each of Days at Open and closes at Close. A Close at or
+// before Open is on the following day, e.g. {"days":"Sun-Thu","open":"17:00","close":"16:00"}
+// for the CME Globex week with its daily maintenance break.
+type SessionWindow struct {
+	Days  string `json:"days" yaml:"days"` // "Mon-Fri", "Sun,Tue", "Sat"
+	Open  string `json:"open" yaml:"open"` // "HH:MM"
+	Close string `json:"close" yaml:"close"`
+}
+
+// SessionHoliday overrides the schedule for one calendar date. Without hours the
+// symbol is closed all day; otherwise it is open only from Open to Close ("24:00"
+// for midnight).
+type SessionHoliday struct {
+	Date  string `json:"date" yaml:"date"` // "2025-12-25"
+	Open  string `json:"open,omitempty" yaml:"open"`
+	Close string `json:"close,omitempty" yaml:"close"`
+}
+
+// minuteRange is [open, close) in minutes after midnight
+type minuteRange struct {
+	open, close int
+}
+
+type compiledWindow struct {
+	days [7]bool
+	minuteRange
+}
+
+// compiledSchedule is a SessionSchedule ready for lookups
+type compiledSchedule struct {
+	loc      *time.Location
+	windows  []compiledWindow
+	holidays map[string]minuteRange // by local date
+}
+
+// SessionState reports one schedule for /v1/sessions
+type SessionState struct {
+	Schedule string    `json:"schedule"`
+	Open     bool      `json:"open"`
+	NextOpen time.Time `json:"next_open,omitempty"` // while closed
+	Held     int       `json:"held"`
+	HeldFrom time.Time `json:"held_from,omitempty"` // when the first held message was held
+}
+
+// sessionCalendar holds messages for symbols MT5 isn't quoting and releases them
+// at the next session open
+type sessionCalendar struct {
+	mu        sync.Mutex
+	netOut    bool
+	schedules map[string]*compiledSchedule
+	held      map[string][]Trade // by schedule key, in the order they were popped
+	heldFrom  map[string]time.Time
+	now       func() time.Time // replaced by the scenario runner
+}
+
+// newSessionCalendar compiles the configured schedules. A schedule that doesn't
+// parse is logged and skipped, leaving its instruments always open.
+func newSessionCalendar(cfg SessionConfig) *sessionCalendar {
+	c := &sessionCalendar{
+		netOut:    cfg.NetOut,
+		schedules: make(map[string]*compiledSchedule),
+		held:      make(map[string][]Trade),
+		heldFrom:  make(map[string]time.Time),
+		now:       time.Now,
+	}
+	for key, s := range cfg.Schedules {
+		compiled, err := compileSchedule(s)
+		if err != nil {
+			log.Printf("WARNING: Session schedule %q is invalid and was ignored: %v", key, err)
+			continue
+		}
+		c.schedules[key] = compiled
+	}
+	return c
+}
+
+func compileSchedule(s SessionSchedule) (*compiledSchedule, error) {
+	loc := time.UTC
+	if s.Timezone != "" {
+		l, err := time.LoadLocation(s.Timezone)
+		if err != nil {
+			return nil, err
+		}
+		loc = l
+	}
+	cs := &compiledSchedule{loc: loc, holidays: make(map[string]minuteRange)}
+	for i, w := range s.Windows {
+		days, err := parseDays(w.Days)
+		if err != nil {
+			return nil, fmt.Errorf("window %d: %v", i+1, err)
+		}
+		open, err := parseClock(w.Open)
+		if err != nil {
+			return nil, fmt.Errorf("window %d open: %v", i+1, err)
+		}
+		close, err := parseClock(w.Close)
+		if err != nil {
+			return nil, fmt.Errorf("window %d close: %v", i+1, err)
+		}
+		cs.windows = append(cs.windows, compiledWindow{days: days, minuteRange: minuteRange{open, close}})
+	}
+	for _, h := range s.Holidays {
+		if _, err := time.Parse("2006-01-02", h.Date); err != nil {
+			return nil, fmt.Errorf("holiday %q: %v", h.Date, err)
+		}
+		var r minuteRange
+		if h.Open != "" || h.Close != "" {
+			var err error
+			if r.open, err = parseClock(h.Open); err != nil {
+				return nil, fmt.Errorf("holiday %s open: %v", h.Date, err)
+			}
+			if r.close, err = parseClock(h.Close); err != nil {
+				return nil, fmt.Errorf("holiday %s close: %v", h.Date, err)
+			}
+		}
+		cs.holidays[h.Date] = r
+	}
+	return cs, nil
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// parseDays reads "Mon-Fri", "Sun,Tue" or a single day; ranges may wrap ("Fri-Mon")
+func parseDays(spec string) ([7]bool, error) {
+	var days [7]bool
+	if strings.TrimSpace(spec) == "" {
+		return days, fmt.Errorf("no days given")
+	}
+	for _, part := range strings.Split(spec, ",") {
+		from, to, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		first, ok := weekdayNames[strings.ToLower(strings.TrimSpace(from))]
+		if !ok {
+			return days, fmt.Errorf("unknown day %q", from)
+		}
+		last := first
+		if isRange {
+			if last, ok = weekdayNames[strings.ToLower(strings.TrimSpace(to))]; !ok {
+				return days, fmt.Errorf("unknown day %q", to)
+			}
+		}
+		for d := first; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// parseClock reads "HH:MM" (00:00 to 24:00) as minutes after midnight
+func parseClock(s string) (int, error) {
+	h, m, ok := strings.Cut(strings.TrimSpace(s), ":")
+	hours, err1 := strconv.Atoi(h)
+	mins, err2 := strconv.Atoi(m)
+	if !ok || err1 != nil || err2 != nil || hours < 0 || mins < 0 || mins > 59 || hours*60+mins > 24*60 {
+		return 0, fmt.Errorf("invalid time %q, want HH:MM", s)
+	}
+	return hours*60 + mins, nil
+}
+
+// openAt reports whether the symbol is quoted at t. A holiday replaces every
+// window on its date, including the overnight part of the previous day's window.
+func (s *compiledSchedule) openAt(t time.Time) bool {
+	local := t.In(s.loc)
+	mins := local.Hour()*60 + local.Minute()
+	if h, ok := s.holidays[local.Format("2006-01-02")]; ok {
+		return mins >= h.open && mins < h.close
+	}
+	today := local.Weekday()
+	yesterday := (today + 6) % 7
+	for _, w := range s.windows {
+		if w.open < w.close {
+			if w.days[today] && mins >= w.open && mins < w.close {
+				return true
+			}
+			continue
+		}
+		// Crosses midnight: the evening part opens today, the morning part opened yesterday
+		if (w.days[today] && mins >= w.open) || (w.days[yesterday] && mins < w.close) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextOpen returns the first minute after t at which the symbol is quoted, or the
+// zero time if it doesn't open within sessionSearchLimit
+func (s *compiledSchedule) nextOpen(t time.Time) time.Time {
+	for m := t.Truncate(time.Minute).Add(time.Minute); m.Sub(t) <= sessionSearchLimit; m = m.Add(time.Minute) {
+		if s.openAt(m) {
+			return m
+		}
+	}
+	return time.Time{}
+}
+
+// scheduleFor returns the schedule key for an instrument: the full name, then its
+// root, then "*". ok is false when the instrument has no schedule.
+func (c *sessionCalendar) scheduleFor(instrument string) (string, bool) {
+	if instrument != "" {
+		if _, ok := c.schedules[instrument]; ok {
+			return instrument, true
+		}
+		if fields := strings.Fields(instrument); len(fields) > 0 && fields[0] != instrument {
+			if _, ok := c.schedules[fields[0]]; ok {
+				return fields[0], true
+			}
+		}
+	}
+	if _, ok := c.schedules["*"]; ok {
+		return "*", true
+	}
+	return "", false
+}
+
+// admit reports whether t may be handed to the EA now. Otherwise t is held until
+// its session opens; once a symbol holds messages, later ones queue behind them.
+// Measurements are never held, since nothing is executed for them.
+func (c *sessionCalendar) admit(t Trade) bool {
+	if t.OrderType == "TP" || t.OrderType == "SL" {
+		return true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key, ok := c.scheduleFor(t.Instrument)
+	if !ok {
+		return true
+	}
+	now := c.now()
+	if len(c.held[key]) == 0 {
+		if c.schedules[key].openAt(now) {
+			return true
+		}
+		c.heldFrom[key] = now
+		log.Printf("SESSION: %s is outside its %q session; holding messages until %s",
+			instrumentKey(t.Instrument), key, c.schedules[key].nextOpen(now).Format(time.RFC3339))
+	}
+	c.held[key] = append(c.held[key], t)
+	log.Printf("SESSION: Holding %s %s %.2f (id %s) for session %q", t.Action, instrumentKey(t.Instrument), t.Quantity, t.ID, key)
+	return false
+}
+
+// releasable removes and returns the held messages of every schedule that is open
+// now, netted per schedule when net_out is on
+func (c *sessionCalendar) releasable() map[string][]Trade {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	out := make(map[string][]Trade)
+	for key, msgs := range c.held {
+		if len(msgs) == 0 || !c.schedules[key].openAt(now) {
+			continue
+		}
+		if c.netOut {
+			kept, targets, collapsed := netOut(msgs, now, "session")
+			netted := append(kept, targets...)
+			log.Printf("SESSION: Netted %d of %d message(s) held for %q into %d", collapsed, len(msgs), key, len(netted))
+			msgs = netted
+		}
+		out[key] = msgs
+		delete(c.held, key)
+		delete(c.heldFrom, key)
+	}
+	return out
+}
+
+// heldTrades returns the held messages of every schedule, ordered by schedule
+// and then in the order they were held
+func (c *sessionCalendar) heldTrades() []Trade {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := make([]string, 0, len(c.held))
+	for key := range c.held {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var out []Trade
+	for _, key := range keys {
+		out = append(out, c.held[key]...)
+	}
+	return out
+}
+
+// restoreHeld holds again the messages saved by the last shutdown, ahead of
+// anything held since. It returns those whose instrument no longer has a
+// schedule, for the caller to queue.
+func (c *sessionCalendar) restoreHeld(msgs []Trade) (unscheduled []Trade) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	restored := make(map[string][]Trade)
+	for _, t := range msgs {
+		key, ok := c.scheduleFor(t.Instrument)
+		if !ok {
+			unscheduled = append(unscheduled, t)
+			continue
+		}
+		restored[key] = append(restored[key], t)
+	}
+	now := c.now()
+	for key, list := range restored {
+		c.held[key] = append(list, c.held[key]...)
+		if _, ok := c.heldFrom[key]; !ok {
+			c.heldFrom[key] = now
+		}
+	}
+	return unscheduled
+}
+
+// heldCount returns how many messages are waiting for their session to open
+func (c *sessionCalendar) heldCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, msgs := range c.held {
+		n += len(msgs)
+	}
+	return n
+}
+
+// states reports every schedule, ordered by key
+func (c *sessionCalendar) states() []SessionState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	out := make([]SessionState, 0, len(c.schedules))
+	for key, s := range c.schedules {
+		st := SessionState{Schedule: key, Open: s.openAt(now), Held: len(c.held[key]), HeldFrom: c.heldFrom[key]}
+		if !st.Open {
+			st.NextOpen = s.nextOpen(now)
+		}
+		out = append(out, st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Schedule < out[j].Schedule })
+	return out
+}
+
+// checkSessions requeues the messages of every session that has opened
+func (a *App) checkSessions() {
+	for key, msgs := range a.sessions.releasable() {
+		a.queueNetted(msgs)
+		log.Printf("SESSION: Session %q is open; released %d held message(s) to the queue", key, len(msgs))
+		a.emit("sessionReleased", map[string]interface{}{"schedule": key, "released": len(msgs)})
+	}
+}
+
+// runSessionMonitor releases held messages as sessions open, until stop is closed
+// (nil runs forever)
+func (a *App) runSessionMonitor(stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			a.checkSessions()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// sessionsHandler reports each session schedule: GET /v1/sessions
+func (a *App) sessionsHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"sessions": a.sessions.states(), "net_out": a.sessions.netOut})
+}
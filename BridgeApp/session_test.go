@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOpenAt(t *testing.T) {
+	// CME Globex week with its daily break, a closed Christmas Day and an early
+	// close on Christmas Eve. 2025-12-21 is a Sunday.
+	s, err := compileSchedule(SessionSchedule{
+		Windows: []SessionWindow{{Days: "Sun-Thu", Open: "17:00", Close: "16:00"}},
+		Holidays: []SessionHoliday{
+			{Date: "2025-12-24", Open: "00:00", Close: "13:00"},
+			{Date: "2025-12-25"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		at   string
+		want bool
+	}{
+		{"Saturday", "2025-12-20T12:00:00Z", false},
+		{"Sunday before the open", "2025-12-21T16:59:00Z", false},
+		{"Sunday open", "2025-12-21T17:00:00Z", true},
+		{"overnight into Monday", "2025-12-22T03:00:00Z", true},
+		{"daily break", "2025-12-22T16:30:00Z", false},
+		{"Friday morning after Thursday's open", "2025-12-19T15:59:00Z", true},
+		{"Friday close", "2025-12-19T16:00:00Z", false},
+		{"early close holiday, open", "2025-12-24T12:59:00Z", true},
+		{"early close holiday, closed", "2025-12-24T13:00:00Z", false},
+		{"early close holiday replaces the evening open", "2025-12-24T18:00:00Z", false},
+		{"closed holiday replaces the overnight part", "2025-12-25T03:00:00Z", false},
+		{"closed holiday evening", "2025-12-25T18:00:00Z", false},
+		{"morning after a holiday follows the schedule", "2025-12-26T03:00:00Z", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at, err := time.Parse(time.RFC3339, tt.at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.openAt(at); got != tt.want {
+				t.Errorf("openAt(%s) = %v, want %v", tt.at, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenAtTimezone(t *testing.T) {
+	s, err := compileSchedule(SessionSchedule{
+		Timezone: "America/Chicago",
+		Windows:  []SessionWindow{{Days: "Sun-Thu", Open: "17:00", Close: "16:00"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Sunday 17:00 in Chicago is 23:00 UTC in winter
+	if s.openAt(time.Date(2025, 12, 21, 22, 59, 0, 0, time.UTC)) {
+		t.Error("open before 17:00 Chicago time")
+	}
+	if !s.openAt(time.Date(2025, 12, 21, 23, 0, 0, 0, time.UTC)) {
+		t.Error("closed at 17:00 Chicago time")
+	}
+}
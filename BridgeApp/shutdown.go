@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stateFileName is the snapshot written on shutdown and restored on startup
+const stateFileName = "state.json"
+
+// closureForward is an MT5 closure notification on its way to the NT addon
+type closureForward struct {
+	id      uint64
+	BaseID  string          `json:"base_id"`
+	Account string          `json:"nt_account_name,omitempty"`
+	Body    json.RawMessage `json:"body"` // the notification as the EA posted it
+	parked  bool            // waiting out a retry backoff when shutdown began
+}
+
+// closureForwards tracks the closure notifications still being forwarded, so
+// shutdown can wait for them and save the ones it interrupted
+type closureForwards struct {
+	mu       sync.Mutex
+	nextID   uint64
+	forwards map[uint64]*closureForward
+}
+
+func newClosureForwards() *closureForwards {
+	return &closureForwards{forwards: make(map[uint64]*closureForward)}
+}
+
+func (c *closureForwards) start(baseID, account string, body []byte) *closureForward {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextID++
+	f := &closureForward{id: c.nextID, BaseID: baseID, Account: account, Body: append(json.RawMessage(nil), body...)}
+	c.forwards[f.id] = f
+	return f
+}
+
+// done stops tracking a forward that was delivered or given up on
+func (c *closureForwards) done(f *closureForward) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.forwards, f.id)
+}
+
+// park marks a forward interrupted by shutdown; it is saved in the snapshot
+func (c *closureForwards) park(f *closureForward) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f.parked = true
+}
+
+// active counts the forwards still talking to the addon
+func (c *closureForwards) active() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, f := range c.forwards {
+		if !f.parked {
+			n++
+		}
+	}
+	return n
+}
+
+// pending returns every forward not yet delivered, oldest first
+func (c *closureForwards) pending() []closureForward {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]closureForward, 0, len(c.forwards))
+	for _, f := range c.forwards {
+		out = append(out, *f)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].id < out[j].id })
+	return out
+}
+
+// BridgeSnapshot is the state written to state.json on shutdown
+type BridgeSnapshot struct {
+	Time        time.Time `json:"time"`
+	NetPosition int       `json:"net_position"`
+	HedgeSize   float64   `json:"hedge_size"`
+	// Queued is how many MT5-bound messages were left in the on-disk queue
+	Queued int `json:"queued"`
+	// PendingClosures are MT5 closures not yet forwarded to NT; they are
+	// forwarded again on startup
+	PendingClosures []closureForward `json:"pending_closures,omitempty"`
+	// SessionHeld are the messages held for their trading session to open;
+	// they are held again on startup
+	SessionHeld []Trade `json:"session_held,omitempty"`
+	// RiskHeld are the trades held for approval by the risk limits; they are
+	// held again on startup
+	RiskHeld []HeldTrade `json:"risk_held,omitempty"`
+	// Sequences is the sequencing state of every addon session, so a message
+	// retried across the restart is still a duplicate
+	Sequences []SourceSequence `json:"sequences,omitempty"`
+	// Batches are the batches handed to the EA and not yet acknowledged; they
+	// are redelivered under the same cursor
+	Batches []SavedBatch `json:"batches,omitempty"`
+	// Drift is the drift monitor's book of positions and open hedges
+	Drift DriftBook `json:"drift"`
+	// NetTargets are the open shares of each net target's hedge
+	NetTargets map[string][]NetShare `json:"net_targets,omitempty"`
+	// Unsaved lists what the snapshot could not keep
+	Unsaved []string `json:"unsaved,omitempty"`
+}
+
+// ShutdownReport is the outcome of a graceful shutdown
+type ShutdownReport struct {
+	Snapshot        string        `json:"snapshot"` // path of state.json, empty if it couldn't be written
+	Queued          int           `json:"queued"`
+	PendingClosures int           `json:"pending_closures"`
+	Unsaved         []string      `json:"unsaved,omitempty"`
+	TimedOut        bool          `json:"timed_out"`
+	Duration        time.Duration `json:"duration"`
+}
+
+// refuseWhileShuttingDown answers every request but /health with 503 once
+// shutdown has begun, so no new work is accepted
+func (a *App) refuseWhileShuttingDown(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.shuttingDown.Load() && r.URL.Path != "/health" && r.URL.Path != apiVersionPrefix+"/health" {
+			w.Header().Set("Retry-After", "5")
+			writeAPIError(w, http.StatusServiceUnavailable, errCodeShuttingDown, "Bridge is shutting down")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// waitOrShutdown sleeps for d and reports false if shutdown began meanwhile
+func (a *App) waitOrShutdown(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-a.shutdownCh:
+		return false
+	}
+}
+
+// gracefulShutdown stops accepting work, tells the NT addon, lets in-flight
+// closure forwards finish, moves the queue to disk and writes state.json, all
+// within timeout, then gives up the data directory lock. Anything it couldn't
+// save is logged and reported.
+func (a *App) gracefulShutdown(timeout time.Duration) ShutdownReport {
+	start := time.Now()
+	var report ShutdownReport
+	if !a.shuttingDown.CompareAndSwap(false, true) {
+		return report
+	}
+	close(a.shutdownCh)
+	log.Printf("SHUTDOWN: Shutting down within %v", timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// Tell the NT addon while there is still time; the EA sees 503 on its next poll
+	notified := make(chan struct{})
+	go func() {
+		defer close(notified)
+		a.notifyAddonShutdown()
+	}()
+
+	if a.server != nil {
+		if err := a.server.Shutdown(ctx); err != nil {
+			log.Printf("SHUTDOWN: HTTP server did not stop cleanly: %v", err)
+		}
+	}
+	for a.closures.active() > 0 && ctx.Err() == nil {
+		time.Sleep(20 * time.Millisecond)
+	}
+	select {
+	case <-notified:
+	case <-ctx.Done():
+	}
+	report.TimedOut = ctx.Err() != nil
+
+	a.aggregator.flushAll()
+	saved, unsaved := a.tradeQueue.persist()
+	report.Queued = saved
+	for _, t := range unsaved {
+		report.Unsaved = append(report.Unsaved, fmt.Sprintf("queued %s %s (%s) could not be written to disk", t.Action, t.ID, t.BaseID))
+	}
+	if n := a.closures.active(); n > 0 {
+		report.Unsaved = append(report.Unsaved, fmt.Sprintf("%d closure forward(s) still in progress at the deadline; saved, but NT may receive them twice", n))
+	}
+	for _, c := range a.ntCommands.list() {
+		// Status broadcasts, this shutdown's included, are stale after a restart
+		if c.Type != cmdStatus && (c.State == cmdPending || c.State == cmdDelivered) {
+			report.Unsaved = append(report.Unsaved, fmt.Sprintf("NT command %s %s was %s and is dropped", c.ID, c.Type, c.State))
+		}
+	}
+
+	a.queueMux.Lock()
+	snap := BridgeSnapshot{Time: time.Now(), NetPosition: a.netNT, HedgeSize: a.hedgeLot}
+	a.queueMux.Unlock()
+	snap.Queued = saved
+	snap.PendingClosures = a.closures.pending()
+	snap.SessionHeld = a.sessions.heldTrades()
+	snap.RiskHeld = a.risk.heldTrades()
+	snap.Sequences = a.sequences.snapshot()
+	snap.Batches = a.batches.saved()
+	snap.Drift = a.drift.book()
+	snap.NetTargets = a.netting.snapshot()
+	snap.Unsaved = report.Unsaved
+	report.PendingClosures = len(snap.PendingClosures)
+	path := filepath.Join(a.config.DataDir, stateFileName)
+	if err := writeSnapshot(path, snap); err != nil {
+		log.Printf("ERROR: SHUTDOWN: Could not write %s: %v", path, err)
+		report.Unsaved = append(report.Unsaved, fmt.Sprintf("state snapshot: %v (net position %d, hedge size %.2f, %d pending closure(s), %d session-held message(s), %d risk-held trade(s), %d unacknowledged batch(es))",
+			err, snap.NetPosition, snap.HedgeSize, len(snap.PendingClosures), len(snap.SessionHeld), len(snap.RiskHeld), len(snap.Batches)))
+	} else {
+		report.Snapshot = path
+	}
+
+	report.Duration = time.Since(start)
+	a.recordAudit(auditShutdown, "bridge", map[string]interface{}{
+		"queued": report.Queued, "pending_closures": report.PendingClosures, "unsaved": len(report.Unsaved), "timed_out": report.TimedOut,
+	})
+	if a.audit != nil {
+		a.audit.close()
+	}
+	a.releaseInstance()
+	for _, u := range report.Unsaved {
+		log.Printf("WARNING: SHUTDOWN: Not saved: %s", u)
+	}
+	log.Printf("SHUTDOWN: Done in %v: net position %d, %d queued message(s) on disk, %d pending closure(s), %d unsaved item(s)",
+		report.Duration.Round(time.Millisecond), snap.NetPosition, report.Queued, report.PendingClosures, len(report.Unsaved))
+	a.emit("bridgeShutdown", report)
+	return report
+}
+
+// notifyAddonShutdown pushes a status command telling the NT addon the bridge is going down
+func (a *App) notifyAddonShutdown() {
+	st := a.control.status()
+	a.queueMux.Lock()
+	st["net_position"], st["hedge_size"] = a.netNT, a.hedgeLot
+	a.queueMux.Unlock()
+	st["shutting_down"] = true
+	c := a.ntCommands.add(NTCommand{Type: cmdStatus, Reason: "bridge shutting down", Status: st}, time.Now())
+	if a.ntCommands.cfg.Delivery != deliveryPull {
+		a.pushNTCommand(c)
+	}
+}
+
+// writeSnapshot writes snap to path through a temporary file
+func writeSnapshot(path string, snap BridgeSnapshot) error {
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// restoreState loads the snapshot of the last shutdown, if any: it restores the
+// position and forwards the closures that were interrupted. The snapshot is
+// removed so a later crash doesn't restore stale state.
+func (a *App) restoreState() {
+	path := filepath.Join(a.config.DataDir, stateFileName)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		log.Printf("ERROR: Could not read %s: %v", path, err)
+		return
+	}
+	var snap BridgeSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		log.Printf("ERROR: %s is not a valid snapshot and was ignored: %v", path, err)
+		return
+	}
+	if err := os.Remove(path); err != nil {
+		log.Printf("WARNING: Could not remove %s after restoring it: %v", path, err)
+	}
+	a.queueMux.Lock()
+	a.netNT, a.hedgeLot = snap.NetPosition, snap.HedgeSize
+	a.recordAuditLocked(auditRestore, "bridge", map[string]interface{}{
+		"snapshot_time": snap.Time, "pending_closures": len(snap.PendingClosures), "unsaved": len(snap.Unsaved),
+	})
+	a.queueMux.Unlock()
+	a.drift.restore(snap.Drift)
+	a.netting.restore(snap.NetTargets)
+	a.sequences.restore(snap.Sequences)
+	a.risk.restoreHeld(snap.RiskHeld)
+	for _, b := range snap.Batches {
+		a.batches.restore(b)
+	}
+	for _, t := range a.sessions.restoreHeld(snap.SessionHeld) {
+		log.Printf("SESSION: %s no longer has a session schedule; queueing %s %s held before the restart", instrumentKey(t.Instrument), t.Action, t.ID)
+		a.tradeQueue.push(t)
+	}
+	log.Printf("Restored state from %s: net position %d, hedge size %.2f, %d pending closure(s), %d session-held message(s), %d risk-held trade(s), %d unacknowledged batch(es), %d sequence source(s)",
+		snap.Time.Format(time.RFC3339), snap.NetPosition, snap.HedgeSize, len(snap.PendingClosures), len(snap.SessionHeld), len(snap.RiskHeld), len(snap.Batches), len(snap.Sequences))
+	for _, u := range snap.Unsaved {
+		log.Printf("WARNING: Not restored from the last shutdown: %s", u)
+	}
+	for _, f := range snap.PendingClosures {
+		go a.redeliverClosure(a.closures.start(f.BaseID, f.Account, f.Body), "Saved closure")
+	}
+}
+
+// redeliverClosure forwards a closure outside the EA's request: one saved by
+// the last shutdown, or a further share of a net target's closure
+func (a *App) redeliverClosure(f *closureForward, what string) {
+	resp, parked, err := a.forwardClosure(f)
+	if parked {
+		return
+	}
+	a.closures.done(f)
+	if resp == nil {
+		log.Printf("MT5_TO_NT_BRIDGE: CRITICAL FAILURE - %s for BaseID '%s' could not be forwarded: %v", what, f.BaseID, err)
+		return
+	}
+	resp.Body.Close()
+	log.Printf("MT5_TO_NT_BRIDGE: Forwarded %s for BaseID '%s' (%s)", strings.ToLower(what), f.BaseID, resp.Status)
+}
+
+// shutdownTimeout bounds the whole graceful shutdown
+func (a *App) shutdownTimeout() time.Duration {
+	return time.Duration(a.config.ShutdownTimeoutMs) * time.Millisecond
+}
@@ -0,0 +1,532 @@
+package simulator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Trade mirrors the body the addon posts to /log_trade
+type Trade struct {
+	ID              string    `json:"id"`
+	BaseID          string    `json:"base_id"`
+	Time            time.Time `json:"time,omitempty"`
+	Action          string    `json:"action"`
+	Quantity        float64   `json:"quantity"`
+	Price           float64   `json:"price"`
+	TotalQuantity   int       `json:"total_quantity"`
+	ContractNum     int       `json:"contract_num"`
+	OrderType       string    `json:"order_type,omitempty"`
+	MeasurementPips int       `json:"measurement_pips,omitempty"`
+	RawMeasurement  float64   `json:"raw_measurement,omitempty"`
+	Instrument      string    `json:"instrument_name,omitempty"`
+	AccountName     string    `json:"account_name,omitempty"`
+	NTBalance       float64   `json:"nt_balance,omitempty"`
+	NTDailyPnL      float64   `json:"nt_daily_pnl,omitempty"`
+	NTTradeResult   string    `json:"nt_trade_result,omitempty"`
+	NTSessionTrades int       `json:"nt_session_trades,omitempty"`
+	SessionID       string    `json:"session_id,omitempty"`
+	Seq             uint64    `json:"seq,omitempty"`
+}
+
+// Performance is the NT account data the addon attaches to trades for elastic hedging
+type Performance struct {
+	Balance       float64
+	DailyPnL      float64
+	TradeResult   string // win or loss
+	SessionTrades int
+}
+
+// NTCommand is a bridge command, as pushed to /command or polled from /v1/nt/commands
+type NTCommand struct {
+	ID         string                 `json:"id"`
+	Type       string                 `json:"type"`
+	Account    string                 `json:"account,omitempty"`
+	Instrument string                 `json:"instrument,omitempty"`
+	Strategy   string                 `json:"strategy,omitempty"`
+	Reason     string                 `json:"reason,omitempty"`
+	BaseID     string                 `json:"base_id,omitempty"`
+	Action     string                 `json:"action,omitempty"`
+	Quantity   float64                `json:"quantity,omitempty"`
+	MT5Ticket  uint64                 `json:"mt5_ticket,omitempty"`
+	Status     map[string]interface{} `json:"status,omitempty"`
+}
+
+// AddonBehaviour scripts how the fake addon's HttpListener answers the bridge
+type AddonBehaviour struct {
+	// Delay is slept before answering any callback
+	Delay time.Duration
+	// FailFirst makes the first N /notify_hedge_closed calls answer FailStatus
+	FailFirst int
+	// FailStatus is the status used for scripted failures (default 500)
+	FailStatus int
+	// PingDown makes /ping_msm answer 503, like an addon whose listener is up but not ready
+	PingDown bool
+	// IgnoreCommands takes bridge commands but never carries out or acknowledges them
+	IgnoreCommands bool
+}
+
+// FakeAddon is the NinjaTrader side: it posts trades to the bridge and serves the
+// /notify_hedge_closed, /ping_msm and /command callbacks the bridge calls on the addon's listener.
+type FakeAddon struct {
+	BridgeURL string
+	Client    *http.Client
+	// SessionID, when set, makes the addon stamp a per-session sequence number on
+	// every /log_trade and /nt_close_hedge message
+	SessionID string
+	// Performance is the NT account performance sent with every fill
+	Performance Performance
+
+	mu        sync.Mutex
+	behaviour AddonBehaviour
+	closures  []HedgeClose
+	attempts  int
+	pings     int
+	commands  []NTCommand
+	listener  net.Listener
+	server    *http.Server
+	notifyCh  chan HedgeClose
+	seq       uint64
+	dropNext  int
+
+	// background tracks mirror fills posted after their command was answered;
+	// errs holds what they failed with until Errors takes it
+	background sync.WaitGroup
+	errs       []error
+}
+
+// NewFakeAddon creates a fake addon that posts to bridgeURL. Call Start to open its listener.
+func NewFakeAddon(bridgeURL string) *FakeAddon {
+	return &FakeAddon{
+		BridgeURL: strings.TrimRight(bridgeURL, "/"),
+		Client:    &http.Client{Timeout: 5 * time.Second},
+		notifyCh:  make(chan HedgeClose, 100),
+	}
+}
+
+// Start opens the callback listener on addr. Use "127.0.0.1:0" for a free port;
+// URL reports the resulting base URL to hand to the bridge.
+func (n *FakeAddon) Start(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/notify_hedge_closed", n.handleNotifyHedgeClosed)
+	mux.HandleFunc("/ping_msm", n.handlePing)
+	mux.HandleFunc("/command", n.handleCommand)
+
+	n.mu.Lock()
+	n.listener = l
+	n.server = &http.Server{Handler: mux}
+	n.mu.Unlock()
+
+	go n.server.Serve(l)
+	return nil
+}
+
+// Stop closes the callback listener
+func (n *FakeAddon) Stop() error {
+	n.mu.Lock()
+	srv := n.server
+	n.mu.Unlock()
+	if srv == nil {
+		return nil
+	}
+	return srv.Close()
+}
+
+// URL returns the base URL of the callback listener, e.g. "http://127.0.0.1:53121"
+func (n *FakeAddon) URL() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.listener == nil {
+		return ""
+	}
+	return "http://" + n.listener.Addr().String()
+}
+
+// SetBehaviour replaces the scripted callback behaviour
+func (n *FakeAddon) SetBehaviour(b AddonBehaviour) {
+	n.mu.Lock()
+	n.behaviour = b
+	n.attempts = 0
+	n.mu.Unlock()
+}
+
+// SendTrade posts one execution to /log_trade. Quantity, contract numbering and time
+// default to the single-contract values the addon uses.
+func (n *FakeAddon) SendTrade(t Trade) (map[string]interface{}, error) {
+	if t.Quantity == 0 {
+		t.Quantity = 1
+	}
+	if t.TotalQuantity == 0 {
+		t.TotalQuantity = 1
+	}
+	if t.ContractNum == 0 {
+		t.ContractNum = 1
+	}
+	if t.Time.IsZero() {
+		t.Time = time.Now().UTC()
+	}
+	t.SessionID, t.Seq = n.nextSeq()
+	if n.consumeDrop() {
+		return nil, nil
+	}
+	var reply map[string]interface{}
+	err := n.postJSON("/log_trade", t, &reply)
+	return reply, err
+}
+
+// DropNext makes the next count outbound messages vanish, like a failed POST the
+// addon never retries. Their sequence numbers are still consumed.
+func (n *FakeAddon) DropNext(count int) {
+	n.mu.Lock()
+	n.dropNext += count
+	n.mu.Unlock()
+}
+
+// Resend re-posts a trade unchanged, e.g. a retry of a request whose response was lost
+func (n *FakeAddon) Resend(t Trade) (map[string]interface{}, error) {
+	var reply map[string]interface{}
+	err := n.postJSON("/log_trade", t, &reply)
+	return reply, err
+}
+
+func (n *FakeAddon) nextSeq() (string, uint64) {
+	if n.SessionID == "" {
+		return "", 0
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.seq++
+	return n.SessionID, n.seq
+}
+
+func (n *FakeAddon) consumeDrop() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.dropNext > 0 {
+		n.dropNext--
+		return true
+	}
+	return false
+}
+
+// SendFill posts a fill of quantity contracts the way the addon does: one Trade per
+// contract sharing baseID, numbered 1..quantity.
+func (n *FakeAddon) SendFill(baseID, action string, quantity int, price float64, instrument, account string) error {
+	for k := 1; k <= quantity; k++ {
+		_, err := n.SendTrade(Trade{
+			ID:            fmt.Sprintf("%s_%d", baseID, k),
+			BaseID:        baseID,
+			Action:        action,
+			Quantity:      1,
+			Price:         price,
+			TotalQuantity: quantity,
+			ContractNum:   k,
+			OrderType:     "ENTRY",
+			Instrument:    instrument,
+			AccountName:   account,
+
+			NTBalance:       n.Performance.Balance,
+			NTDailyPnL:      n.Performance.DailyPnL,
+			NTTradeResult:   n.Performance.TradeResult,
+			NTSessionTrades: n.Performance.SessionTrades,
+		})
+		if err != nil {
+			return fmt.Errorf("contract %d of %d: %w", k, quantity, err)
+		}
+	}
+	return nil
+}
+
+// CloseHedge posts an NT-initiated closure to /nt_close_hedge. action is the NT
+// closing side: "sell" closes a long, "buytocover" closes a short.
+func (n *FakeAddon) CloseHedge(baseID string, quantity float64, action, instrument, account, reason string) error {
+	session, seq := n.nextSeq()
+	if n.consumeDrop() {
+		return nil
+	}
+	return n.postJSON("/nt_close_hedge", HedgeClose{
+		EventType:           "hedge_close_notification",
+		BaseID:              baseID,
+		NTInstrumentSymbol:  instrument,
+		NTAccountName:       account,
+		ClosedHedgeQuantity: quantity,
+		ClosedHedgeAction:   action,
+		Timestamp:           time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		ClosureReason:       reason,
+		SessionID:           session,
+		Seq:                 seq,
+	}, nil)
+}
+
+// Ping sends the addon's /health?source=addon heartbeat
+func (n *FakeAddon) Ping() error {
+	resp, err := n.Client.Get(n.BridgeURL + "/health?source=addon")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return decodeResponse(resp, nil)
+}
+
+// Closures returns every closure notification the addon accepted
+func (n *FakeAddon) Closures() []HedgeClose {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]HedgeClose(nil), n.closures...)
+}
+
+// Attempts returns how many /notify_hedge_closed calls arrived, including failed ones
+func (n *FakeAddon) Attempts() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.attempts
+}
+
+// Pings returns how many /ping_msm calls arrived
+func (n *FakeAddon) Pings() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.pings
+}
+
+// WaitForClosure blocks until a closure notification for baseID is accepted or timeout elapses
+func (n *FakeAddon) WaitForClosure(baseID string, timeout time.Duration) (HedgeClose, bool) {
+	for _, c := range n.Closures() {
+		if c.BaseID == baseID {
+			return c, true
+		}
+	}
+	deadline := time.After(timeout)
+	for {
+		select {
+		case c := <-n.notifyCh:
+			if c.BaseID == baseID {
+				return c, true
+			}
+		case <-deadline:
+			return HedgeClose{}, false
+		}
+	}
+}
+
+func (n *FakeAddon) handleNotifyHedgeClosed(w http.ResponseWriter, r *http.Request) {
+	n.mu.Lock()
+	b := n.behaviour
+	n.attempts++
+	attempt := n.attempts
+	n.mu.Unlock()
+
+	if b.Delay > 0 {
+		time.Sleep(b.Delay)
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if attempt <= b.FailFirst {
+		status := b.FailStatus
+		if status == 0 {
+			status = http.StatusInternalServerError
+		}
+		http.Error(w, "scripted failure", status)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var c HedgeClose
+	if err := json.Unmarshal(body, &c); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	n.mu.Lock()
+	n.closures = append(n.closures, c)
+	n.mu.Unlock()
+	select {
+	case n.notifyCh <- c:
+	default:
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success", "base_id": c.BaseID})
+}
+
+// Flattens returns how many flatten_account commands the bridge has sent
+func (n *FakeAddon) Flattens() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	count := 0
+	for _, c := range n.commands {
+		if c.Type == "flatten_account" {
+			count++
+		}
+	}
+	return count
+}
+
+// Mirrors returns every mirror_trade command the bridge has sent
+func (n *FakeAddon) Mirrors() []NTCommand {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var out []NTCommand
+	for _, c := range n.commands {
+		if c.Type == "mirror_trade" {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Register announces the addon's callback listener and accounts on /v1/nt/register
+func (n *FakeAddon) Register(id string, accounts, capabilities []string) error {
+	reg := map[string]interface{}{
+		"id":           id,
+		"url":          n.URL(),
+		"version":      "simulator",
+		"accounts":     accounts,
+		"capabilities": capabilities,
+	}
+	return n.postJSON("/v1/nt/register", reg, nil)
+}
+
+// Heartbeat keeps the addon's registration alive; it fails with 409
+// unknown_addon once the registration expired
+func (n *FakeAddon) Heartbeat(id string) error {
+	return n.postJSON("/v1/nt/heartbeat", map[string]string{"id": id}, nil)
+}
+
+// Commands returns every bridge command the addon received, pushed or polled
+func (n *FakeAddon) Commands() []NTCommand {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]NTCommand(nil), n.commands...)
+}
+
+// takeCommand records a command and reports whether the addon carries it out.
+// A mirror_trade it carries out is placed like NT would: its fill is posted
+// back to /log_trade under the command's base_id.
+func (n *FakeAddon) takeCommand(c NTCommand) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.commands = append(n.commands, c)
+	if n.behaviour.IgnoreCommands {
+		return false
+	}
+	if c.Type == "mirror_trade" {
+		n.background.Add(1)
+		go func() {
+			defer n.background.Done()
+			if err := n.SendFill(c.BaseID, c.Action, int(c.Quantity), 0, c.Instrument, c.Account); err != nil {
+				n.mu.Lock()
+				n.errs = append(n.errs, fmt.Errorf("mirror fill of %s: %w", c.BaseID, err))
+				n.mu.Unlock()
+			}
+		}()
+	}
+	return true
+}
+
+// Wait blocks until the mirror fills the addon is posting are done
+func (n *FakeAddon) Wait() {
+	n.background.Wait()
+}
+
+// Errors returns what the addon's background work failed with since the last
+// call, e.g. a mirror fill the bridge refused
+func (n *FakeAddon) Errors() []error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	errs := n.errs
+	n.errs = nil
+	return errs
+}
+
+// handleCommand carries out a pushed command and answers done, which acknowledges it
+func (n *FakeAddon) handleCommand(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var c NTCommand
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil || c.ID == "" {
+		http.Error(w, "invalid command", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !n.takeCommand(c) {
+		w.Write([]byte(`{"status":"accepted"}`))
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "done", "message": c.Type + " carried out"})
+}
+
+// PollCommands fetches pending commands from /v1/nt/commands, as an addon whose
+// HttpListener can't bind does, and acknowledges each it carries out. It returns
+// how many it received.
+func (n *FakeAddon) PollCommands() (int, error) {
+	resp, err := n.Client.Get(n.BridgeURL + "/v1/nt/commands")
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	var reply struct {
+		Commands []NTCommand `json:"commands"`
+	}
+	if err := decodeResponse(resp, &reply); err != nil {
+		return 0, err
+	}
+	for _, c := range reply.Commands {
+		if !n.takeCommand(c) {
+			continue
+		}
+		ack := map[string]string{"id": c.ID, "status": "done", "message": c.Type + " carried out"}
+		if err := n.postJSON("/v1/nt/commands/ack", ack, nil); err != nil {
+			return len(reply.Commands), fmt.Errorf("ack %s: %w", c.ID, err)
+		}
+	}
+	return len(reply.Commands), nil
+}
+
+func (n *FakeAddon) handlePing(w http.ResponseWriter, r *http.Request) {
+	n.mu.Lock()
+	b := n.behaviour
+	n.pings++
+	n.mu.Unlock()
+
+	if b.Delay > 0 {
+		time.Sleep(b.Delay)
+	}
+	if b.PingDown {
+		http.Error(w, "addon not ready", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"status":"ok"}`))
+}
+
+func (n *FakeAddon) postJSON(path string, v interface{}, reply interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	resp, err := n.Client.Post(n.BridgeURL+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return decodeResponse(resp, reply)
+}
@@ -0,0 +1,707 @@
+// Package simulator provides stand-ins for the MT5 EA (ACHedgeMaster) and the
+// NinjaTrader addon (MultiStratManager) that speak the bridge's HTTP protocol.
+// They let the full NT -> Bridge -> MT5 -> Bridge -> NT flow run under
+// `go test` on Linux without either trading platform installed.
+package simulator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoTrade is returned by FakeEA.Poll when the bridge answers {"status":"no_trade"}
+var ErrNoTrade = errors.New("no trade queued")
+
+// EAMessage mirrors the payload the bridge hands to the EA from /mt5/get_trade
+type EAMessage struct {
+	BridgeSeq          uint64    `json:"bridge_seq"`
+	ID                 string    `json:"id"`
+	BaseID             string    `json:"base_id"`
+	Time               time.Time `json:"time"`
+	Action             string    `json:"action"`
+	Quantity           float64   `json:"quantity"`
+	Price              float64   `json:"price"`
+	TotalQuantity      int       `json:"total_quantity"`
+	ContractNum        int       `json:"contract_num"`
+	OrderType          string    `json:"order_type"`
+	MeasurementPips    int       `json:"measurement_pips"`
+	RawMeasurement     float64   `json:"raw_measurement"`
+	NTInstrumentSymbol string    `json:"nt_instrument_symbol"`
+	NTAccountName      string    `json:"nt_account_name"`
+	NTBalance          float64   `json:"nt_balance"`
+	NTDailyPnL         float64   `json:"nt_daily_pnl"`
+	NTTradeResult      string    `json:"nt_trade_result"`
+	NTSessionTrades    int       `json:"nt_session_trades"`
+	// Contracts is the per-contract breakdown when the bridge aggregated a fill
+	Contracts []ContractFill `json:"contracts,omitempty"`
+	// MT5Action is the side the bridge wants MT5 to take for an entry, from the
+	// route's Direction (hedge or copy)
+	MT5Action string `json:"mt5_action,omitempty"`
+	Direction string `json:"direction,omitempty"`
+	// LotSize is the lots per contract when the bridge sizes entries
+	LotSize    float64 `json:"lot_size,omitempty"`
+	SizingMode string  `json:"sizing_mode,omitempty"`
+	// HedgeRatio scales the lots per contract the EA sizes itself
+	HedgeRatio float64 `json:"hedge_ratio,omitempty"`
+
+	// Raw holds every field of the payload, including ones this struct doesn't know about
+	Raw map[string]interface{} `json:"-"`
+}
+
+// ContractFill is one NT contract inside an aggregated message
+type ContractFill struct {
+	ID          string  `json:"id"`
+	ContractNum int     `json:"contract_num"`
+	Quantity    float64 `json:"quantity"`
+	Price       float64 `json:"price"`
+}
+
+// TradeResult mirrors the body the EA posts to /mt5/trade_result (see SendTradeResult)
+type TradeResult struct {
+	Status  string  `json:"status"`
+	Ticket  uint64  `json:"ticket"`
+	Volume  float64 `json:"volume"`
+	IsClose bool    `json:"is_close"`
+	ID      string  `json:"id,omitempty"`
+
+	// Execution details for the bridge's analytics
+	Price    float64   `json:"price,omitempty"`
+	FillTime time.Time `json:"fill_time,omitempty"`
+	Symbol   string    `json:"symbol,omitempty"`
+	Point    float64   `json:"point,omitempty"`
+}
+
+// Telemetry mirrors the body the EA posts to /mt5/telemetry (see SendTelemetry)
+type Telemetry struct {
+	Cushion float64 `json:"cushion"`
+	OHF     float64 `json:"ohf"`
+	Balance float64 `json:"balance,omitempty"`
+	Equity  float64 `json:"equity,omitempty"`
+}
+
+// ManualTrade mirrors the body the EA posts to /mt5/manual_trade for a deal it
+// did not place (see SendManualTrade)
+type ManualTrade struct {
+	Ticket uint64  `json:"ticket"`
+	Symbol string  `json:"symbol"`
+	Action string  `json:"action"`
+	Volume float64 `json:"volume"`
+	Price  float64 `json:"price,omitempty"`
+}
+
+// HedgeClose mirrors the hedge_close_notification the EA posts to /notify_hedge_close
+// and the one the addon posts to /nt_close_hedge
+type HedgeClose struct {
+	EventType           string  `json:"event_type"`
+	BaseID              string  `json:"base_id"`
+	NTInstrumentSymbol  string  `json:"nt_instrument_symbol"`
+	NTAccountName       string  `json:"nt_account_name"`
+	ClosedHedgeQuantity float64 `json:"closed_hedge_quantity"`
+	ClosedHedgeAction   string  `json:"closed_hedge_action"`
+	Timestamp           string  `json:"timestamp"`
+	ClosureReason       string  `json:"closure_reason"`
+	SessionID           string  `json:"session_id,omitempty"`
+	Seq                 uint64  `json:"seq,omitempty"`
+}
+
+// EABehaviour scripts how the fake EA reacts to the messages it pulls
+type EABehaviour struct {
+	// PollDelay is slept before every /mt5/get_trade request
+	PollDelay time.Duration
+	// ExecDelay is slept between pulling a message and reporting its result
+	ExecDelay time.Duration
+	// FillRatio scales the executed volume of entries, e.g. 0.5 fills half. Zero means a full fill.
+	FillRatio float64
+	// FailActions lists actions ("Buy", "Sell", "CLOSE_HEDGE") the EA refuses to execute.
+	// A refused message is pulled but no trade result is reported, like a rejected OrderSend.
+	FailActions []string
+	// FailIDs lists message IDs the EA refuses to execute
+	FailIDs []string
+	// ResultStatus overrides the "status" reported in trade results (default "success")
+	ResultStatus string
+	// Slippage is how many points worse than the NT price entries are filled
+	Slippage float64
+	// Point is the point size of Symbol reported in trade results; zero means 1
+	Point float64
+	// Symbol is the MT5 symbol reported in trade results
+	Symbol string
+	// Balance is the hedge account balance reported with every poll; zero reports none
+	Balance float64
+}
+
+// Execution records what the fake EA did with one pulled message
+type Execution struct {
+	Message  EAMessage
+	Ticket   uint64
+	Volume   float64
+	Price    float64 // fill price of an entry, when the message carried the NT price
+	IsClose  bool
+	Failed   bool
+	Reported bool
+}
+
+// OpenHedge is a hedge position the fake EA currently holds
+type OpenHedge struct {
+	Ticket     uint64
+	BaseID     string
+	Instrument string
+	Account    string
+	Action     string // side of the MT5 hedge: "Buy" or "Sell"
+	Volume     float64
+	Contracts  float64 // NT contracts the hedge stands for
+}
+
+// FakeEA polls the bridge the way ACHedgeMaster does and keeps a book of open hedges
+type FakeEA struct {
+	BridgeURL string
+	Client    *http.Client
+	Behaviour EABehaviour
+	// Hedging mirrors the EA's EnableHedging input: true opens the opposite side of NT
+	Hedging bool
+	// Target is the bridge routing target this EA polls for; empty polls the default
+	Target string
+
+	mu         sync.Mutex
+	nextTicket uint64
+	executions []Execution
+	open       []OpenHedge
+}
+
+// NewFakeEA creates a fake EA pointed at bridgeURL (e.g. "http://127.0.0.1:5000")
+func NewFakeEA(bridgeURL string) *FakeEA {
+	return &FakeEA{
+		BridgeURL:  strings.TrimRight(bridgeURL, "/"),
+		Client:     &http.Client{Timeout: 5 * time.Second},
+		Hedging:    true,
+		nextTicket: 1000,
+	}
+}
+
+// Ping sends the periodic hedgebot health ping. A negative openPositions omits the parameter.
+func (e *FakeEA) Ping(openPositions int) (map[string]interface{}, error) {
+	url := e.BridgeURL + "/health?source=hedgebot"
+	if openPositions >= 0 {
+		url += fmt.Sprintf("&open_positions=%d", openPositions)
+	}
+	resp, err := e.Client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var status map[string]interface{}
+	if err := decodeResponse(resp, &status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// Poll performs a single /mt5/get_trade request. It returns ErrNoTrade when nothing is queued.
+func (e *FakeEA) Poll() (*EAMessage, error) {
+	if e.Behaviour.PollDelay > 0 {
+		time.Sleep(e.Behaviour.PollDelay)
+	}
+	resp, err := e.Client.Get(e.BridgeURL + "/mt5/get_trade" + e.pollQuery("?"))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get_trade returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, fmt.Errorf("get_trade returned invalid JSON: %v", err)
+	}
+	if status, _ := raw["status"].(string); status == "no_trade" {
+		return nil, ErrNoTrade
+	}
+
+	var msg EAMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, fmt.Errorf("get_trade payload does not match the EA message shape: %v", err)
+	}
+	msg.Raw = raw
+	return &msg, nil
+}
+
+// ReportResult posts a trade result to /mt5/trade_result
+func (e *FakeEA) ReportResult(result TradeResult) error {
+	if result.Status == "" {
+		result.Status = "success"
+	}
+	return e.postJSON("/mt5/trade_result", result)
+}
+
+// ReportTelemetry posts the EA's cushion and over-hedge factor to /mt5/telemetry
+func (e *FakeEA) ReportTelemetry(t Telemetry) error {
+	return e.postJSON("/mt5/telemetry"+e.targetQuery("?"), t)
+}
+
+// ReportManualTrade posts a trade opened by hand on MT5 to /mt5/manual_trade and
+// returns the bridge's reply
+func (e *FakeEA) ReportManualTrade(t ManualTrade) (map[string]interface{}, error) {
+	body, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := e.Client.Post(e.BridgeURL+"/mt5/manual_trade"+e.targetQuery("?"), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var reply map[string]interface{}
+	if err := decodeResponse(resp, &reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// NotifyHedgeClose posts a hedge_close_notification to /notify_hedge_close
+func (e *FakeEA) NotifyHedgeClose(n HedgeClose) error {
+	if n.EventType == "" {
+		n.EventType = "hedge_close_notification"
+	}
+	if n.Timestamp == "" {
+		n.Timestamp = time.Now().UTC().Format("2006-01-02T15:04:05Z")
+	}
+	return e.postJSON("/notify_hedge_close", n)
+}
+
+// Batch is one /mt5/get_trades response
+type Batch struct {
+	Cursor      string
+	Redelivered bool
+	Messages    []EAMessage
+}
+
+// PollBatch performs one /mt5/get_trades request for up to max messages, first
+// acknowledging the batch with cursor ack when it is non-empty. It returns
+// ErrNoTrade when nothing is queued.
+func (e *FakeEA) PollBatch(max int, ack string) (*Batch, error) {
+	if e.Behaviour.PollDelay > 0 {
+		time.Sleep(e.Behaviour.PollDelay)
+	}
+	url := fmt.Sprintf("%s/mt5/get_trades?max=%d", e.BridgeURL, max)
+	if ack != "" {
+		url += "&ack=" + ack
+	}
+	url += e.pollQuery("&")
+	resp, err := e.Client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var reply struct {
+		Status      string            `json:"status"`
+		Cursor      string            `json:"cursor"`
+		Redelivered bool              `json:"redelivered"`
+		Trades      []json.RawMessage `json:"trades"`
+	}
+	if err := decodeResponse(resp, &reply); err != nil {
+		return nil, err
+	}
+	if reply.Status == "no_trade" {
+		return nil, ErrNoTrade
+	}
+	batch := &Batch{Cursor: reply.Cursor, Redelivered: reply.Redelivered}
+	for _, raw := range reply.Trades {
+		var msg EAMessage
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			return nil, fmt.Errorf("get_trades payload does not match the EA message shape: %v", err)
+		}
+		json.Unmarshal(raw, &msg.Raw)
+		batch.Messages = append(batch.Messages, msg)
+	}
+	return batch, nil
+}
+
+// AckBatch posts the acknowledgement for a batch to /mt5/ack_trades
+func (e *FakeEA) AckBatch(cursor string) error {
+	return e.postJSON("/mt5/ack_trades"+e.targetQuery("?"), map[string]string{"cursor": cursor})
+}
+
+// point returns the point size of the EA's symbol
+func (e *FakeEA) point() float64 {
+	if e.Behaviour.Point > 0 {
+		return e.Behaviour.Point
+	}
+	return 1
+}
+
+// targetQuery returns the target query parameter, led by sep, or "" without a target
+func (e *FakeEA) targetQuery(sep string) string {
+	if e.Target == "" {
+		return ""
+	}
+	return sep + "target=" + url.QueryEscape(e.Target)
+}
+
+// pollQuery returns the query of a poll: the target and the account balance,
+// led by sep, or "" when there is neither
+func (e *FakeEA) pollQuery(sep string) string {
+	q := url.Values{}
+	if e.Target != "" {
+		q.Set("target", e.Target)
+	}
+	if e.Behaviour.Balance > 0 {
+		q.Set("balance", strconv.FormatFloat(e.Behaviour.Balance, 'f', 2, 64))
+	}
+	if len(q) == 0 {
+		return ""
+	}
+	return sep + q.Encode()
+}
+
+// StepBatch pulls one batch of up to max messages, executes them in order and
+// acknowledges it unless skipAck is set. Messages of a redelivered batch that were
+// already executed (same bridge_seq) are skipped, as the EA would.
+func (e *FakeEA) StepBatch(max int, skipAck bool) ([]Execution, error) {
+	batch, err := e.PollBatch(max, "")
+	if err != nil {
+		return nil, err
+	}
+	var done []Execution
+	for i := range batch.Messages {
+		msg := &batch.Messages[i]
+		if batch.Redelivered && e.executed(msg.BridgeSeq) {
+			continue
+		}
+		exec, err := e.Execute(msg)
+		done = append(done, *exec)
+		if err != nil {
+			return done, err
+		}
+	}
+	if skipAck {
+		return done, nil
+	}
+	return done, e.AckBatch(batch.Cursor)
+}
+
+// DrainBatches calls StepBatch until the bridge has nothing left or limit messages were processed
+func (e *FakeEA) DrainBatches(max, limit int) ([]Execution, error) {
+	var done []Execution
+	for len(done) < limit {
+		n := max
+		if left := limit - len(done); left < n {
+			n = left
+		}
+		execs, err := e.StepBatch(n, false)
+		done = append(done, execs...)
+		if errors.Is(err, ErrNoTrade) {
+			return done, nil
+		}
+		if err != nil {
+			return done, err
+		}
+	}
+	return done, nil
+}
+
+func (e *FakeEA) executed(bridgeSeq uint64) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, ex := range e.executions {
+		if ex.Message.BridgeSeq == bridgeSeq {
+			return true
+		}
+	}
+	return false
+}
+
+// Step pulls one message and executes it according to Behaviour.
+// It returns ErrNoTrade when the queue is empty.
+func (e *FakeEA) Step() (*Execution, error) {
+	msg, err := e.Poll()
+	if err != nil {
+		return nil, err
+	}
+	return e.Execute(msg)
+}
+
+// Execute carries out one pulled message according to Behaviour and reports the result
+func (e *FakeEA) Execute(msg *EAMessage) (*Execution, error) {
+	if e.Behaviour.ExecDelay > 0 {
+		time.Sleep(e.Behaviour.ExecDelay)
+	}
+
+	exec := Execution{Message: *msg}
+	if e.shouldFail(msg) {
+		exec.Failed = true
+		e.record(exec)
+		return &exec, nil
+	}
+
+	switch {
+	case msg.Action == "CLOSE_HEDGE":
+		exec.IsClose = true
+		exec.Ticket, exec.Volume = e.closeHedges(msg.BaseID, msg.Quantity, true)
+	case msg.OrderType == "TP" || msg.OrderType == "SL":
+		// Measurements only adjust the EA's SL/TP distances, nothing is executed
+		e.record(exec)
+		return &exec, nil
+	case msg.Action == "Buy" || msg.Action == "Sell":
+		var side string
+		exec.Ticket, exec.Volume, side = e.openHedge(msg)
+		if msg.Price > 0 {
+			exec.Price = msg.Price - e.Behaviour.Slippage*e.point()
+			if side == "Buy" {
+				exec.Price = msg.Price + e.Behaviour.Slippage*e.point()
+			}
+		}
+	default:
+		e.record(exec)
+		return &exec, nil
+	}
+
+	result := TradeResult{
+		Status:   e.Behaviour.ResultStatus,
+		Ticket:   exec.Ticket,
+		Volume:   exec.Volume,
+		IsClose:  exec.IsClose,
+		ID:       msg.ID,
+		Price:    exec.Price,
+		FillTime: time.Now().UTC(),
+		Symbol:   e.Behaviour.Symbol,
+		Point:    e.point(),
+	}
+	if err := e.ReportResult(result); err != nil {
+		e.record(exec)
+		return &exec, err
+	}
+	exec.Reported = true
+	e.record(exec)
+	return &exec, nil
+}
+
+// Drain calls Step until the bridge has nothing left or limit messages were processed
+func (e *FakeEA) Drain(limit int) ([]Execution, error) {
+	var done []Execution
+	for i := 0; i < limit; i++ {
+		exec, err := e.Step()
+		if errors.Is(err, ErrNoTrade) {
+			return done, nil
+		}
+		if exec != nil {
+			done = append(done, *exec)
+		}
+		if err != nil {
+			return done, err
+		}
+	}
+	return done, nil
+}
+
+// CloseHedge simulates MT5 closing quantity lots of the hedge for baseID (by SL, TP,
+// trailing stop or manual action) and notifies the bridge like the EA does.
+func (e *FakeEA) CloseHedge(baseID string, quantity float64, reason string) error {
+	e.mu.Lock()
+	var template *OpenHedge
+	for i := range e.open {
+		if e.open[i].BaseID == baseID {
+			template = &e.open[i]
+			break
+		}
+	}
+	if template == nil {
+		e.mu.Unlock()
+		return fmt.Errorf("no open hedge for base_id %s", baseID)
+	}
+	n := HedgeClose{
+		BaseID:             baseID,
+		NTInstrumentSymbol: template.Instrument,
+		NTAccountName:      template.Account,
+		// Like the EA, report the side of the MT5 position that was closed
+		ClosedHedgeAction: strings.ToLower(template.Action),
+		ClosureReason:     reason,
+	}
+	e.mu.Unlock()
+
+	_, closed := e.closeHedges(baseID, quantity, false)
+	n.ClosedHedgeQuantity = closed
+	return e.NotifyHedgeClose(n)
+}
+
+// Executions returns a copy of everything the fake EA has processed
+func (e *FakeEA) Executions() []Execution {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]Execution(nil), e.executions...)
+}
+
+// OpenHedges returns a copy of the fake EA's open hedge book
+func (e *FakeEA) OpenHedges() []OpenHedge {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]OpenHedge(nil), e.open...)
+}
+
+// OpenVolume returns the total open hedge volume, optionally filtered by base_id
+func (e *FakeEA) OpenVolume(baseID string) float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var total float64
+	for _, h := range e.open {
+		if baseID == "" || h.BaseID == baseID {
+			total += h.Volume
+		}
+	}
+	return total
+}
+
+func (e *FakeEA) shouldFail(msg *EAMessage) bool {
+	for _, a := range e.Behaviour.FailActions {
+		if strings.EqualFold(a, msg.Action) {
+			return true
+		}
+	}
+	for _, id := range e.Behaviour.FailIDs {
+		if id == msg.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// openHedge opens msg.Quantity contracts at the bridge's lot_size, or like the
+// EA's own sizing at one lot per contract times the hedge ratio
+func (e *FakeEA) openHedge(msg *EAMessage) (uint64, float64, string) {
+	lots := msg.LotSize
+	if lots <= 0 {
+		lots = 1
+		if msg.HedgeRatio > 0 {
+			lots *= msg.HedgeRatio
+		}
+	}
+	contracts := msg.Quantity
+	if e.Behaviour.FillRatio > 0 {
+		contracts = msg.Quantity * e.Behaviour.FillRatio
+	}
+	volume := contracts * lots
+	side := msg.Action
+	switch {
+	case msg.MT5Action != "":
+		side = msg.MT5Action // the bridge's direction policy wins over the input
+	case e.Hedging:
+		side = opposite(msg.Action)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.nextTicket++
+	e.open = append(e.open, OpenHedge{
+		Ticket:     e.nextTicket,
+		BaseID:     msg.BaseID,
+		Instrument: msg.NTInstrumentSymbol,
+		Account:    msg.NTAccountName,
+		Action:     side,
+		Volume:     volume,
+		Contracts:  contracts,
+	})
+	return e.nextTicket, volume, side
+}
+
+// closeHedges reduces open hedges for baseID by up to quantity, oldest first:
+// NT contracts when inContracts, as the EA counts a CLOSE_HEDGE, else lots.
+// It returns the ticket of the last position touched and the volume actually closed.
+func (e *FakeEA) closeHedges(baseID string, quantity float64, inContracts bool) (uint64, float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var ticket uint64
+	var closed float64
+	remaining := quantity
+	kept := e.open[:0]
+	for _, h := range e.open {
+		if h.BaseID == baseID && remaining > 0 {
+			perContract := h.Volume / h.Contracts
+			take := h.Volume
+			if inContracts {
+				take = math.Min(h.Contracts, remaining) * perContract
+				remaining -= take / perContract
+			} else {
+				take = math.Min(take, remaining)
+				remaining -= take
+			}
+			h.Volume -= take
+			h.Contracts -= take / perContract
+			closed += take
+			ticket = h.Ticket
+		}
+		if h.Volume > 1e-9 {
+			kept = append(kept, h)
+		}
+	}
+	e.open = kept
+	return ticket, closed
+}
+
+func (e *FakeEA) record(exec Execution) {
+	e.mu.Lock()
+	e.executions = append(e.executions, exec)
+	e.mu.Unlock()
+}
+
+func (e *FakeEA) postJSON(path string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	resp, err := e.Client.Post(e.BridgeURL+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return decodeResponse(resp, nil)
+}
+
+// decodeResponse turns non-2xx responses into errors and optionally decodes a JSON body
+func decodeResponse(resp *http.Response, v interface{}) error {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &HTTPError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+	if v == nil || len(body) == 0 {
+		return nil
+	}
+	return json.Unmarshal(body, v)
+}
+
+// HTTPError is returned when the bridge answers with a non-2xx status
+type HTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("bridge returned HTTP %d: %s", e.StatusCode, e.Body)
+}
+
+func opposite(action string) string {
+	switch strings.ToLower(action) {
+	case "buy":
+		return "Sell"
+	case "sell":
+		return "Buy"
+	}
+	return action
+}
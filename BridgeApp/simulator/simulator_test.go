@@ -0,0 +1,129 @@
+package simulator
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// stubBridge records the bodies posted to it and answers /log_trade with status
+type stubBridge struct {
+	mu     sync.Mutex
+	trades []Trade
+	posts  map[string][]map[string]interface{}
+	status int
+	queued []EAMessage
+}
+
+func newStubBridge(t *testing.T, status int) (*stubBridge, string) {
+	b := &stubBridge{posts: make(map[string][]map[string]interface{}), status: status}
+	srv := httptest.NewServer(http.HandlerFunc(b.serve))
+	t.Cleanup(srv.Close)
+	return b, srv.URL
+}
+
+func (b *stubBridge) serve(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch r.URL.Path {
+	case "/log_trade":
+		var tr Trade
+		json.NewDecoder(r.Body).Decode(&tr)
+		b.trades = append(b.trades, tr)
+		w.WriteHeader(b.status)
+		w.Write([]byte(`{"status":"success"}`))
+	case "/mt5/get_trade":
+		if len(b.queued) == 0 {
+			w.Write([]byte(`{"status":"no_trade"}`))
+			return
+		}
+		json.NewEncoder(w).Encode(b.queued[0])
+		b.queued = b.queued[1:]
+	default:
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		b.posts[r.URL.Path] = append(b.posts[r.URL.Path], body)
+		w.Write([]byte(`{"status":"success"}`))
+	}
+}
+
+func TestSendFillPostsOneTradePerContract(t *testing.T) {
+	b, url := newStubBridge(t, http.StatusOK)
+	n := NewFakeAddon(url)
+	n.SessionID = "s1"
+	if err := n.SendFill("A", "Buy", 3, 21000, "NQ 03-25", "Sim101"); err != nil {
+		t.Fatal(err)
+	}
+	if len(b.trades) != 3 {
+		t.Fatalf("bridge got %d trade(s), want 3", len(b.trades))
+	}
+	for i, tr := range b.trades {
+		k := i + 1
+		if tr.BaseID != "A" || tr.ContractNum != k || tr.TotalQuantity != 3 || tr.Quantity != 1 || tr.Seq != uint64(k) {
+			t.Errorf("trade %d = %+v; want contract %d of 3, seq %d", k, tr, k, k)
+		}
+	}
+}
+
+func TestMirrorFillErrorIsReported(t *testing.T) {
+	_, url := newStubBridge(t, http.StatusUnprocessableEntity)
+	n := NewFakeAddon(url)
+	if !n.takeCommand(NTCommand{ID: "c1", Type: "mirror_trade", BaseID: "M1", Action: "Buy", Quantity: 1}) {
+		t.Fatal("mirror_trade was not carried out")
+	}
+	n.Wait()
+	errs := n.Errors()
+	var httpErr *HTTPError
+	if len(errs) != 1 || !errors.As(errs[0], &httpErr) || httpErr.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("Errors() = %v, want the bridge's 422", errs)
+	}
+	if errs := n.Errors(); len(errs) != 0 {
+		t.Errorf("Errors() kept %v after it was read", errs)
+	}
+}
+
+func TestEAHedgesAndCloses(t *testing.T) {
+	b, url := newStubBridge(t, http.StatusOK)
+	b.queued = []EAMessage{
+		{BridgeSeq: 1, ID: "A_1", BaseID: "A", Action: "Buy", Quantity: 2, Price: 100},
+		{BridgeSeq: 2, ID: "A_close", BaseID: "A", Action: "CLOSE_HEDGE", Quantity: 1},
+	}
+	e := NewFakeEA(url)
+	e.Behaviour.Slippage = 2
+	e.Behaviour.Point = 0.5
+
+	exec, err := e.Step()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := e.OpenHedges(); len(got) != 1 || got[0].Action != "Sell" || got[0].Contracts != 2 {
+		t.Fatalf("open hedges after entry = %+v; want one Sell of 2 contracts", got)
+	}
+	if exec.Price != 99 {
+		t.Errorf("hedge filled at %v, want 99 (2 points of 0.5 below 100)", exec.Price)
+	}
+	if _, err := e.Step(); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.OpenVolume("A"); got <= 0 || got >= exec.Volume {
+		t.Errorf("open volume after closing 1 of 2 contracts = %v, want a part of %v", got, exec.Volume)
+	}
+	if _, err := e.Step(); !errors.Is(err, ErrNoTrade) {
+		t.Errorf("Step on an empty queue = %v, want ErrNoTrade", err)
+	}
+
+	results := b.posts["/mt5/trade_result"]
+	if len(results) != 2 {
+		t.Fatalf("EA reported %d result(s), want 2", len(results))
+	}
+	if results[0]["point"] != 0.5 || results[0]["is_close"] != false || results[1]["is_close"] != true {
+		t.Errorf("trade results = %v", results)
+	}
+	if !strings.HasPrefix(results[0]["fill_time"].(string), "20") {
+		t.Errorf("fill_time = %v, want an RFC 3339 time", results[0]["fill_time"])
+	}
+}
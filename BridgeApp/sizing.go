@@ -0,0 +1,470 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Lot sizing modes, ACHedgeMaster's LotSizingMode computed by the bridge. With
+// no mode the bridge sends no lot size and the EA sizes entries itself.
+const (
+	sizingAsymmetric = "asymmetric_compounding"
+	sizingFixed      = "fixed_lot"
+	sizingElastic    = "elastic_hedging"
+)
+
+// OHFBand is one cushion band of elastic hedging: a cushion of at most
+// MaxCushion selects the over-hedge factor OHF
+type OHFBand struct {
+	MaxCushion float64 `json:"max_cushion" yaml:"max_cushion"`
+	OHF        float64 `json:"ohf" yaml:"ohf"`
+}
+
+// defaultOHFBands are SelectOHF's bands for a ≈$300 hedge account
+var defaultOHFBands = []OHFBand{{18, 0.25}, {36, 0.20}, {54, 0.15}, {72, 0.10}}
+
+// SizingConfig selects the lot sizing mode and holds its parameters. Lots are
+// per NT contract; the EA opens one order of that size per contract.
+type SizingConfig struct {
+	// Mode is asymmetric_compounding, fixed_lot or elastic_hedging; empty leaves
+	// sizing to the EA
+	Mode string `json:"mode" yaml:"mode"`
+	// DefaultLot is the fixed lot, and elastic hedging's base lot without a point value
+	DefaultLot float64 `json:"default_lot" yaml:"default_lot"`
+	// MinLot, MaxLot and LotStep are the MT5 symbol's volume limits
+	MinLot  float64 `json:"min_lot" yaml:"min_lot"`
+	MaxLot  float64 `json:"max_lot" yaml:"max_lot"`
+	LotStep float64 `json:"lot_step" yaml:"lot_step"`
+	// PointValue is the hedge account's profit per point per lot
+	PointValue float64 `json:"point_value" yaml:"point_value"`
+
+	// StopLossPoints is the stop distance asymmetric compounding risks its
+	// percentage over; required by that mode
+	StopLossPoints float64 `json:"stop_loss_points" yaml:"stop_loss_points"`
+	// BaseRiskPct is the risk per trade after a loss, in percent of the hedge balance
+	BaseRiskPct float64 `json:"base_risk_pct" yaml:"base_risk_pct"`
+	// BaseReward is the reward target as a multiple of the risk
+	BaseReward float64 `json:"base_reward" yaml:"base_reward"`
+	// CompoundingWins is how many wins compound before risk returns to the base
+	CompoundingWins int `json:"compounding_wins" yaml:"compounding_wins"`
+
+	// CushionBand is the trailing drawdown allowed below the hedge balance high-water
+	CushionBand float64 `json:"cushion_band" yaml:"cushion_band"`
+	// OHFBands are tried in order; a cushion above the last band gets SafeOHF
+	OHFBands []OHFBand `json:"ohf_bands" yaml:"ohf_bands"`
+	SafeOHF  float64   `json:"safe_ohf" yaml:"safe_ohf"`
+	// ExpectedMovePoints is the move elastic hedging's profit target is sized for
+	ExpectedMovePoints float64 `json:"expected_move_points" yaml:"expected_move_points"`
+}
+
+// normalize fills in the EA's default inputs and turns off an unusable mode
+func (c *SizingConfig) normalize() {
+	if c.DefaultLot <= 0 {
+		c.DefaultLot = 15
+	}
+	if c.MinLot <= 0 {
+		c.MinLot = 0.01
+	}
+	if c.MaxLot < c.MinLot {
+		c.MaxLot = 100
+	}
+	if c.LotStep <= 0 {
+		c.LotStep = 0.01
+	}
+	if c.BaseRiskPct <= 0 {
+		c.BaseRiskPct = 1
+	}
+	if c.BaseReward <= 0 {
+		c.BaseReward = 3
+	}
+	if c.CompoundingWins <= 0 {
+		c.CompoundingWins = 2
+	}
+	if c.CushionBand <= 0 {
+		c.CushionBand = 90
+	}
+	if len(c.OHFBands) == 0 {
+		c.OHFBands = append([]OHFBand(nil), defaultOHFBands...)
+	}
+	sort.Slice(c.OHFBands, func(i, j int) bool { return c.OHFBands[i].MaxCushion < c.OHFBands[j].MaxCushion })
+	if c.SafeOHF <= 0 {
+		c.SafeOHF = 0.05
+	}
+	if c.ExpectedMovePoints <= 0 {
+		c.ExpectedMovePoints = 100
+	}
+	switch c.Mode {
+	case "", sizingFixed, sizingElastic:
+	case sizingAsymmetric:
+		if c.StopLossPoints <= 0 || c.PointValue <= 0 {
+			log.Printf("WARNING: sizing mode %q needs stop_loss_points and point_value; leaving sizing to the EA", c.Mode)
+			c.Mode = ""
+		}
+	default:
+		log.Printf("WARNING: Unknown sizing mode %q; leaving sizing to the EA", c.Mode)
+		c.Mode = ""
+	}
+}
+
+// roundLots floors lots to the lot step and clamps them to the volume limits
+func (c SizingConfig) roundLots(lots float64) float64 {
+	lots = math.Floor(lots/c.LotStep+1e-9) * c.LotStep
+	lots = math.Max(lots, c.MinLot)
+	lots = math.Min(lots, c.MaxLot)
+	return math.Round(lots*1e8) / 1e8
+}
+
+// SizingInput is what a Sizer sizes one hedge entry from: the NT performance
+// data the addon sends with each trade and the balance the hedge EA reports
+type SizingInput struct {
+	NTBalance       float64
+	NTDailyPnL      float64
+	NTTradeResult   string // win or loss
+	NTSessionTrades int
+	HedgeBalance    float64
+}
+
+// LotSize is a Sizer's decision for one entry
+type LotSize struct {
+	Lots   float64 `json:"lots"` // per NT contract
+	Mode   string  `json:"mode"`
+	Reason string  `json:"reason"`
+}
+
+// Sizer computes the MT5 lot size of hedge entries. Sizers may keep state
+// between calls, one instance per hedge account; they are not safe for
+// concurrent use.
+type Sizer interface {
+	// Size returns the lots for one NT contract, or false when it lacks what the
+	// mode needs
+	Size(in SizingInput) (LotSize, bool)
+}
+
+// newSizer returns the Sizer for cfg.Mode, or nil when sizing is left to the EA
+func newSizer(cfg SizingConfig) Sizer {
+	switch cfg.Mode {
+	case sizingFixed:
+		return fixedLotSizer{cfg}
+	case sizingAsymmetric:
+		return newAsymmetricSizer(cfg)
+	case sizingElastic:
+		return &elasticSizer{cfg: cfg}
+	}
+	return nil
+}
+
+// fixedLotSizer always opens DefaultLot
+type fixedLotSizer struct {
+	cfg SizingConfig
+}
+
+func (s fixedLotSizer) Size(in SizingInput) (LotSize, bool) {
+	return LotSize{Lots: s.cfg.roundLots(s.cfg.DefaultLot), Mode: sizingFixed, Reason: "fixed lot"}, true
+}
+
+// asymmetricSizer risks a percentage of the hedge balance over the stop
+// distance. Each hedge win compounds the risk by the last reward target, up to
+// CompoundingWins wins; a loss, or the last compounding win, resets it.
+type asymmetricSizer struct {
+	cfg         SizingConfig
+	risk        float64 // percent of the hedge balance
+	reward      float64 // percent profit a win must reach to compound
+	wins        int
+	lastBalance float64
+}
+
+func newAsymmetricSizer(cfg SizingConfig) *asymmetricSizer {
+	s := &asymmetricSizer{cfg: cfg}
+	s.reset()
+	return s
+}
+
+func (s *asymmetricSizer) reset() {
+	s.wins = 0
+	s.risk = s.cfg.BaseRiskPct
+	s.reward = s.risk * s.cfg.BaseReward
+}
+
+// result applies a closed hedge trade, seen as a change in the hedge balance
+func (s *asymmetricSizer) result(profit, balance float64) {
+	if profit <= 0 {
+		s.reset()
+		return
+	}
+	s.wins++
+	if s.wins >= s.cfg.CompoundingWins {
+		s.reset() // cycle complete: start over from the base risk
+		return
+	}
+	if entry := balance - profit; entry > 0 && profit/entry*100 < s.reward {
+		return // a win below the reward target doesn't compound
+	}
+	if s.wins == 1 {
+		s.risk = s.cfg.BaseRiskPct * (1 + s.cfg.BaseReward)
+	} else {
+		s.risk += s.reward
+	}
+	s.reward = s.risk * s.cfg.BaseReward
+}
+
+func (s *asymmetricSizer) Size(in SizingInput) (LotSize, bool) {
+	if in.HedgeBalance <= 0 {
+		return LotSize{}, false
+	}
+	if s.lastBalance > 0 && math.Abs(in.HedgeBalance-s.lastBalance) >= 0.01 {
+		s.result(in.HedgeBalance-s.lastBalance, in.HedgeBalance)
+	}
+	s.lastBalance = in.HedgeBalance
+	riskAmount := in.HedgeBalance * s.risk / 100
+	lots := riskAmount / (s.cfg.StopLossPoints * s.cfg.PointValue)
+	return LotSize{
+		Lots:   s.cfg.roundLots(lots),
+		Mode:   sizingAsymmetric,
+		Reason: fmt.Sprintf("risk %.2f%% of %.2f over %.0f points", s.risk, in.HedgeBalance, s.cfg.StopLossPoints),
+	}, true
+}
+
+// elasticSizer sizes the hedge to recover NT's losses: the profit target grows
+// with the NT loss streak and is scaled down as the hedge account's cushion
+// above its trailing drawdown shrinks
+type elasticSizer struct {
+	cfg            SizingConfig
+	highWater      float64 // highest hedge balance seen
+	lossStreak     int
+	cumulativeLoss float64
+	seenNT         bool
+	lastResult     string
+	lastTrades     int
+}
+
+// selectOHF maps the cushion to its over-hedge factor
+func (s *elasticSizer) selectOHF(cushion float64) float64 {
+	for _, b := range s.cfg.OHFBands {
+		if cushion <= b.MaxCushion {
+			return b.OHF
+		}
+	}
+	return s.cfg.SafeOHF
+}
+
+// ntResult updates the loss streak when NT reports a new trade result
+func (s *elasticSizer) ntResult(in SizingInput) {
+	if in.NTTradeResult == "" && in.NTBalance == 0 && in.NTSessionTrades == 0 {
+		return // no NT performance data in this trade
+	}
+	if s.seenNT && in.NTTradeResult == s.lastResult && in.NTSessionTrades == s.lastTrades {
+		return
+	}
+	s.seenNT, s.lastResult, s.lastTrades = true, in.NTTradeResult, in.NTSessionTrades
+	switch in.NTTradeResult {
+	case "loss":
+		s.lossStreak++
+		if in.NTDailyPnL < 0 {
+			s.cumulativeLoss -= in.NTDailyPnL
+		}
+	case "win":
+		s.lossStreak = 0
+	}
+}
+
+// target is the hedge profit to aim for given NT's recent results
+func (s *elasticSizer) target() float64 {
+	if !s.seenNT {
+		return 60
+	}
+	target := 30.0 // no loss streak: minimal hedging
+	switch {
+	case s.lossStreak == 1:
+		target = 60
+	case s.lossStreak >= 2 && s.lastResult == "loss":
+		target = 200 + float64(s.lossStreak-2)*50
+	case s.lossStreak >= 2:
+		target = 80 // NT won after losses
+	}
+	if s.cumulativeLoss > 500 {
+		target *= 1.5
+	}
+	return target
+}
+
+func (s *elasticSizer) Size(in SizingInput) (LotSize, bool) {
+	if in.HedgeBalance <= 0 {
+		return LotSize{}, false
+	}
+	s.ntResult(in)
+	s.highWater = math.Max(s.highWater, in.HedgeBalance)
+	cushion := in.HedgeBalance - (s.highWater - s.cfg.CushionBand)
+	ohf := s.selectOHF(cushion)
+
+	multiplier := 1.0
+	var lots float64
+	var reason string
+	if s.cfg.PointValue > 0 {
+		// Conservative scaling: double up with a safe cushion, halve when stressed
+		switch {
+		case ohf <= 0.10:
+			multiplier = 2
+		case ohf >= 0.20:
+			multiplier = 0.5
+		}
+		target := s.target()
+		lots = s.cfg.roundLots(target/(s.cfg.PointValue*s.cfg.ExpectedMovePoints)) * multiplier
+		reason = fmt.Sprintf("target %.2f, cushion %.2f, OHF %.2f, x%.1f", target, cushion, ohf, multiplier)
+	} else {
+		switch {
+		case ohf <= 0.10:
+			multiplier = 1.5
+		case ohf >= 0.20:
+			multiplier = 0.7
+		}
+		lots = s.cfg.roundLots(s.cfg.DefaultLot) * multiplier
+		reason = fmt.Sprintf("default lot, cushion %.2f, OHF %.2f, x%.1f", cushion, ohf, multiplier)
+	}
+	return LotSize{Lots: s.cfg.roundLots(lots), Mode: sizingElastic, Reason: reason}, true
+}
+
+// sizingEngine keeps one Sizer per target, since each target is its own hedge
+// account, and the hedge balance each target's EA last reported
+type sizingEngine struct {
+	mu       sync.Mutex
+	cfg      SizingConfig
+	targets  map[string]SizingConfig // targets with their own sizing
+	sizers   map[string]Sizer
+	balances map[string]float64
+	last     map[string]LotSize
+}
+
+func newSizingEngine(cfg SizingConfig, targets []RouteTarget) *sizingEngine {
+	e := &sizingEngine{
+		cfg:      cfg,
+		targets:  make(map[string]SizingConfig),
+		sizers:   make(map[string]Sizer),
+		balances: make(map[string]float64),
+		last:     make(map[string]LotSize),
+	}
+	for _, t := range targets {
+		if t.Sizing != nil {
+			e.targets[t.ID] = *t.Sizing
+		}
+	}
+	return e
+}
+
+// config returns the sizing settings of target
+func (e *sizingEngine) config(target string) SizingConfig {
+	if cfg, ok := e.targets[target]; ok {
+		return cfg
+	}
+	return e.cfg
+}
+
+// reportBalance records the hedge account balance target's EA sent with a poll
+func (e *sizingEngine) reportBalance(target string, balance float64) {
+	e.mu.Lock()
+	e.balances[target] = balance
+	e.mu.Unlock()
+}
+
+// size returns the lot size for an entry handed to target's EA
+func (e *sizingEngine) size(target string, in SizingInput) (LotSize, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s, ok := e.sizers[target]
+	if !ok {
+		s = newSizer(e.config(target))
+		e.sizers[target] = s
+	}
+	if s == nil {
+		return LotSize{}, false
+	}
+	in.HedgeBalance = e.balances[target]
+	lots, ok := s.Size(in)
+	if ok {
+		e.last[target] = lots
+	}
+	return lots, ok
+}
+
+// lotsPerContract returns the lots target's entries are opened with per NT
+// contract: the last size decided, or the fixed lot before the first. ok is
+// false when the EA sizes the target's entries itself.
+func (e *sizingEngine) lotsPerContract(target string) (float64, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if last, ok := e.last[target]; ok {
+		return last.Lots, true
+	}
+	if cfg := e.config(target); cfg.Mode == sizingFixed {
+		return cfg.roundLots(cfg.DefaultLot), true
+	}
+	return 0, false
+}
+
+// SizingStatus is one target's sizing as reported by /v1/sizing
+type SizingStatus struct {
+	Target       string   `json:"target"`
+	Mode         string   `json:"mode"`
+	HedgeBalance float64  `json:"hedge_balance"` // last reported by its EA
+	Last         *LotSize `json:"last,omitempty"`
+}
+
+func (e *sizingEngine) status(targets []string) []SizingStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	out := make([]SizingStatus, 0, len(targets))
+	for _, target := range targets {
+		st := SizingStatus{Target: target, Mode: e.config(target).Mode, HedgeBalance: e.balances[target]}
+		if last, ok := e.last[target]; ok {
+			st.Last = &last
+		}
+		out = append(out, st)
+	}
+	return out
+}
+
+// recordHedgeBalance takes the hedge account balance an EA poll reports as ?balance=
+func (a *App) recordHedgeBalance(r *http.Request, target string) {
+	raw := r.URL.Query().Get("balance")
+	if raw == "" {
+		return
+	}
+	balance, err := strconv.ParseFloat(raw, 64)
+	if err != nil || balance < 0 {
+		log.Printf("SIZING: Ignoring invalid balance %q from the EA%s", raw, targetLabel(target))
+		return
+	}
+	a.sizing.reportBalance(target, balance)
+}
+
+// lotSize sizes an entry for its target's EA. Closes and measurements are not sized.
+func (a *App) lotSize(t Trade) (LotSize, bool) {
+	if mt5Action(t) == "" {
+		return LotSize{}, false
+	}
+	lots, ok := a.sizing.size(t.Target, SizingInput{
+		NTBalance:       t.NTBalance,
+		NTDailyPnL:      t.NTDailyPnL,
+		NTTradeResult:   t.NTTradeResult,
+		NTSessionTrades: t.NTSessionTrades,
+	})
+	if ok {
+		log.Printf("SIZING: %s%s: %.2f lots per contract (%s: %s)", t.ID, targetLabel(t.Target), lots.Lots, lots.Mode, lots.Reason)
+	}
+	return lots, ok
+}
+
+// sizingHandler shows each target's sizing mode, hedge balance and last lot size: GET /v1/sizing
+func (a *App) sizingHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	targets, _ := a.tradeQueue.all()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"targets": a.sizing.status(targets),
+	})
+}
@@ -0,0 +1,92 @@
+package main
+
+import "testing"
+
+func TestRoundLots(t *testing.T) {
+	cfg := SizingConfig{MinLot: 0.01, MaxLot: 100, LotStep: 0.01}
+	coarse := SizingConfig{MinLot: 0.1, MaxLot: 5, LotStep: 0.1}
+	tests := []struct {
+		name string
+		cfg  SizingConfig
+		lots float64
+		want float64
+	}{
+		{"floors to the step", cfg, 0.128, 0.12},
+		{"exact step survives float error", cfg, 1.0, 1},
+		{"below the minimum", cfg, 0.005, 0.01},
+		{"above the maximum", cfg, 250, 100},
+		{"coarse step", coarse, 0.29, 0.2},
+		{"coarse exact step", coarse, 0.3, 0.3},
+		{"coarse maximum", coarse, 7.77, 5},
+		{"zero clamps to the minimum", coarse, 0, 0.1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.roundLots(tt.lots); got != tt.want {
+				t.Errorf("roundLots(%v) = %v, want %v", tt.lots, got, tt.want)
+			}
+		})
+	}
+}
+
+// sizingStep is one entry sized in order by the same Sizer
+type sizingStep struct {
+	name string
+	in   SizingInput
+	want float64
+	ok   bool
+}
+
+func runSizingSteps(t *testing.T, s Sizer, steps []sizingStep) {
+	t.Helper()
+	for _, st := range steps {
+		got, ok := s.Size(st.in)
+		if ok != st.ok {
+			t.Fatalf("%s: ok = %v, want %v", st.name, ok, st.ok)
+		}
+		if ok && got.Lots != st.want {
+			t.Fatalf("%s: lots = %v (%s), want %v", st.name, got.Lots, got.Reason, st.want)
+		}
+	}
+}
+
+func TestAsymmetricSizer(t *testing.T) {
+	cfg := SizingConfig{Mode: sizingAsymmetric, StopLossPoints: 100, PointValue: 1}
+	cfg.normalize()
+	runSizingSteps(t, newSizer(cfg), []sizingStep{
+		{"no hedge balance", SizingInput{}, 0, false},
+		{"base risk", SizingInput{HedgeBalance: 1000}, 0.1, true},
+		{"win above the reward target compounds", SizingInput{HedgeBalance: 1040}, 0.41, true},
+		{"loss resets", SizingInput{HedgeBalance: 1000}, 0.1, true},
+		{"win below the reward target doesn't compound", SizingInput{HedgeBalance: 1010}, 0.1, true},
+		{"last compounding win resets", SizingInput{HedgeBalance: 1100}, 0.11, true},
+	})
+}
+
+func TestElasticSizer(t *testing.T) {
+	t.Run("point value", func(t *testing.T) {
+		cfg := SizingConfig{Mode: sizingElastic, PointValue: 1}
+		cfg.normalize()
+		runSizingSteps(t, newSizer(cfg), []sizingStep{
+			{"no hedge balance", SizingInput{}, 0, false},
+			{"no NT data, safe cushion doubles", SizingInput{HedgeBalance: 1000}, 1.2, true},
+			{"one loss, mid cushion",
+				SizingInput{HedgeBalance: 950, NTTradeResult: "loss", NTDailyPnL: -100, NTSessionTrades: 1}, 0.6, true},
+			{"same NT result isn't counted twice",
+				SizingInput{HedgeBalance: 950, NTTradeResult: "loss", NTDailyPnL: -100, NTSessionTrades: 1}, 0.6, true},
+			{"loss streak, stressed cushion halves",
+				SizingInput{HedgeBalance: 920, NTTradeResult: "loss", NTDailyPnL: -200, NTSessionTrades: 2}, 1, true},
+			{"win after losses",
+				SizingInput{HedgeBalance: 920, NTTradeResult: "win", NTDailyPnL: -150, NTSessionTrades: 3}, 0.15, true},
+		})
+	})
+	t.Run("default lot", func(t *testing.T) {
+		cfg := SizingConfig{Mode: sizingElastic}
+		cfg.normalize()
+		runSizingSteps(t, newSizer(cfg), []sizingStep{
+			{"safe cushion", SizingInput{HedgeBalance: 1000}, 22.5, true},
+			{"mid cushion", SizingInput{HedgeBalance: 950}, 15, true},
+			{"stressed cushion", SizingInput{HedgeBalance: 920}, 10.5, true},
+		})
+	})
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// spillRecord is the on-disk form of a queued message, one JSON object per line
+type spillRecord struct {
+	Trade    Trade     `json:"trade"`
+	Arrival  uint64    `json:"arrival"`
+	QueuedAt time.Time `json:"queued_at"`
+}
+
+// spillSegment is one append-only file of spilled messages. Its .served file
+// lists the arrival numbers of the records that have left the queue.
+type spillSegment struct {
+	id       uint64
+	path     string
+	records  int       // records written to the file
+	size     int64     // bytes on disk
+	firstAt  time.Time // queuedAt of the first record
+	sealed   bool      // no more appends; set once the reader loads it
+	buf      []queuedTrade
+	consumed int
+	served   map[uint64]bool // arrival numbers recorded in the .served file
+}
+
+// servedPath is the file recording which of the segment's records were served
+func (seg *spillSegment) servedPath() string {
+	return strings.TrimSuffix(seg.path, ".jsonl") + ".served"
+}
+
+// spillStore is the disk overflow of one queue lane: a FIFO of segment files in
+// dir. Writers append to the newest segment and the reader moves records from
+// the oldest one into memory. A segment is deleted once every record in it has
+// been served (see serve), so a restart queues again what was read into memory
+// but never what already left the queue. Existing segments are picked up again
+// on startup.
+type spillStore struct {
+	dir          string
+	maxRecords   int
+	segments     []*spillSegment          // segments with records not read yet, oldest first
+	files        map[uint64]*spillSegment // every segment on disk, by id
+	nextID       uint64
+	count        int
+	maxArrival   uint64              // highest arrival number ever stored
+	baseArrivals map[string][]uint64 // arrival numbers of spilled messages per base_id, oldest first
+}
+
+// openSpillStore creates dir if needed and recovers any segments left in it
+func openSpillStore(dir string, maxRecords int) (*spillStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &spillStore{dir: dir, maxRecords: maxRecords, nextID: 1, files: make(map[uint64]*spillSegment),
+		baseArrivals: make(map[string][]uint64)}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), "seg-") && strings.HasSuffix(e.Name(), ".jsonl") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names) // zero-padded ids sort in creation order
+	for _, name := range names {
+		var id uint64
+		if _, err := fmt.Sscanf(name, "seg-%d.jsonl", &id); err != nil {
+			continue
+		}
+		seg := &spillSegment{id: id, path: filepath.Join(dir, name), sealed: true}
+		if id >= s.nextID {
+			s.nextID = id + 1
+		}
+		records, err := readSpillSegment(seg.path)
+		if err != nil {
+			log.Printf("ERROR: Spill segment %s is unreadable and was skipped: %v", seg.path, err)
+			continue
+		}
+		seg.served, err = readServed(seg.servedPath())
+		if err != nil {
+			log.Printf("WARNING: Could not read %s, its served messages may be queued again: %v", seg.servedPath(), err)
+		}
+		seg.records = len(records)
+		var unserved []queuedTrade
+		for _, r := range records {
+			if !seg.served[r.arrival] {
+				unserved = append(unserved, r)
+			}
+		}
+		if len(unserved) == 0 {
+			seg.remove()
+			continue
+		}
+		if info, err := os.Stat(seg.path); err == nil {
+			seg.size = info.Size()
+		}
+		seg.firstAt = unserved[0].queuedAt
+		for _, r := range unserved {
+			s.track(r)
+		}
+		s.count += len(unserved)
+		s.segments = append(s.segments, seg)
+		s.files[id] = seg
+	}
+	if s.count > 0 {
+		log.Printf("Recovered %d spilled message(s) from %s", s.count, dir)
+	}
+	return s, nil
+}
+
+// append writes q to the newest segment, starting a new one when needed
+func (s *spillStore) append(q queuedTrade) error {
+	line, err := json.Marshal(spillRecord{Trade: q.trade, Arrival: q.arrival, QueuedAt: q.queuedAt})
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	var tail *spillSegment
+	if n := len(s.segments); n > 0 {
+		tail = s.segments[n-1]
+	}
+	if tail == nil || tail.sealed || tail.records >= s.maxRecords {
+		tail = &spillSegment{id: s.nextID, path: filepath.Join(s.dir, fmt.Sprintf("seg-%012d.jsonl", s.nextID)), firstAt: q.queuedAt}
+		s.nextID++
+		s.segments = append(s.segments, tail)
+		s.files[tail.id] = tail
+	}
+
+	f, err := os.OpenFile(tail.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	_, werr := f.Write(line)
+	serr := f.Sync()
+	cerr := f.Close()
+	if werr != nil {
+		return werr
+	}
+	if serr != nil {
+		return serr
+	}
+	if cerr != nil {
+		return cerr
+	}
+
+	tail.records++
+	tail.size += int64(len(line))
+	s.count++
+	s.track(q)
+	return nil
+}
+
+func (s *spillStore) track(q queuedTrade) {
+	s.baseArrivals[q.trade.BaseID] = append(s.baseArrivals[q.trade.BaseID], q.arrival)
+	if q.arrival > s.maxArrival {
+		s.maxArrival = q.arrival
+	}
+}
+
+func (s *spillStore) untrack(q queuedTrade) {
+	arrivals := s.baseArrivals[q.trade.BaseID]
+	if i := indexOf(arrivals, q.arrival); i >= 0 {
+		arrivals = append(arrivals[:i], arrivals[i+1:]...)
+	}
+	if len(arrivals) == 0 {
+		delete(s.baseArrivals, q.trade.BaseID)
+	} else {
+		s.baseArrivals[q.trade.BaseID] = arrivals
+	}
+}
+
+// next removes and returns the oldest spilled message. It stays on disk until
+// it is served. A segment that can no longer be read is logged and skipped so
+// one bad file can't wedge the lane.
+func (s *spillStore) next() (queuedTrade, bool) {
+	for len(s.segments) > 0 {
+		head := s.segments[0]
+		if head.buf == nil {
+			head.sealed = true // later appends go to a fresh segment
+			records, err := readSpillSegment(head.path)
+			if err != nil {
+				log.Printf("ERROR: Spill segment %s could not be read, %d message(s) lost: %v", head.path, head.records-len(head.served), err)
+				s.count -= head.records - len(head.served)
+				s.segments = s.segments[1:]
+				delete(s.files, head.id)
+				head.remove()
+				continue
+			}
+			head.buf = []queuedTrade{}
+			for _, r := range records {
+				if !head.served[r.arrival] {
+					r.segment = head.id
+					head.buf = append(head.buf, r)
+				}
+			}
+		}
+		if head.consumed < len(head.buf) {
+			q := head.buf[head.consumed]
+			head.consumed++
+			s.count--
+			s.untrack(q)
+			if head.consumed == len(head.buf) {
+				s.segments = s.segments[1:]
+				head.buf = head.buf[:0:0]
+			}
+			return q, true
+		}
+		s.segments = s.segments[1:]
+		if len(head.served) >= head.records {
+			delete(s.files, head.id)
+			head.remove()
+		}
+	}
+	return queuedTrade{}, false
+}
+
+// serve records that qts, read from disk by next, have left the queue, so a
+// restart doesn't queue them again. Each segment's .served file is synced
+// before serve returns; a segment whose records are all served is deleted.
+func (s *spillStore) serve(qts ...queuedTrade) {
+	bySegment := make(map[uint64][]uint64)
+	var order []uint64
+	for _, q := range qts {
+		if q.segment == 0 {
+			continue // never spilled, or rewritten since
+		}
+		if _, ok := bySegment[q.segment]; !ok {
+			order = append(order, q.segment)
+		}
+		bySegment[q.segment] = append(bySegment[q.segment], q.arrival)
+	}
+	for _, id := range order {
+		seg := s.files[id]
+		if seg == nil {
+			continue
+		}
+		if seg.served == nil {
+			seg.served = make(map[uint64]bool)
+		}
+		for _, arrival := range bySegment[id] {
+			seg.served[arrival] = true
+		}
+		if len(seg.served) >= seg.records {
+			delete(s.files, id)
+			seg.remove()
+			continue
+		}
+		if err := appendServed(seg.servedPath(), bySegment[id]); err != nil {
+			log.Printf("WARNING: Could not record %d served message(s) of spill segment %s; a restart may queue them again: %v",
+				len(bySegment[id]), seg.path, err)
+		}
+	}
+}
+
+// remove deletes the segment's files
+func (seg *spillSegment) remove() {
+	for _, path := range []string{seg.path, seg.servedPath()} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("WARNING: Could not delete drained spill segment %s: %v", path, err)
+		}
+	}
+}
+
+// oldest returns the queue time of the oldest spilled message
+func (s *spillStore) oldest() (time.Time, bool) {
+	if len(s.segments) == 0 {
+		return time.Time{}, false
+	}
+	head := s.segments[0]
+	if head.buf != nil && head.consumed < len(head.buf) {
+		return head.buf[head.consumed].queuedAt, true
+	}
+	return head.firstAt, true
+}
+
+// bytes returns the disk space used by segments not served entirely
+func (s *spillStore) bytes() int64 {
+	var n int64
+	for _, seg := range s.files {
+		n += seg.size
+	}
+	return n
+}
+
+// holdsBefore reports whether a message for baseID that arrived before the
+// given arrival number is on disk
+func (s *spillStore) holdsBefore(baseID string, before uint64) bool {
+	arrivals := s.baseArrivals[baseID]
+	return len(arrivals) > 0 && arrivals[0] < before
+}
+
+// readSpillSegment loads every record of a segment file. A torn last line (crash
+// mid-write) is ignored.
+func readSpillSegment(path string) ([]queuedTrade, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var out []queuedTrade
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var r spillRecord
+		if err := json.Unmarshal(line, &r); err != nil {
+			log.Printf("WARNING: Skipping corrupt record in spill segment %s: %v", path, err)
+			continue
+		}
+		out = append(out, queuedTrade{trade: r.Trade, arrival: r.Arrival, queuedAt: r.QueuedAt})
+	}
+	return out, sc.Err()
+}
+
+// readServed loads the arrival numbers listed in a segment's .served file. A
+// missing file means nothing was served; a torn last line is ignored.
+func readServed(path string) (map[uint64]bool, error) {
+	served := make(map[uint64]bool)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return served, nil
+	}
+	if err != nil {
+		return served, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if arrival, err := strconv.ParseUint(strings.TrimSpace(line), 10, 64); err == nil {
+			served[arrival] = true
+		}
+	}
+	return served, nil
+}
+
+// appendServed appends arrival numbers to a segment's .served file and syncs it
+func appendServed(path string, arrivals []uint64) error {
+	var buf bytes.Buffer
+	for _, arrival := range arrivals {
+		fmt.Fprintf(&buf, "%d\n", arrival)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	_, werr := f.Write(buf.Bytes())
+	serr := f.Sync()
+	cerr := f.Close()
+	if werr != nil {
+		return werr
+	}
+	if serr != nil {
+		return serr
+	}
+	return cerr
+}
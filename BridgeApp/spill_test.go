@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSpillStoreReopenSkipsServed(t *testing.T) {
+	dir := t.TempDir()
+	s, err := openSpillStore(dir, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(1); i <= 5; i++ {
+		if err := s.append(queuedTrade{trade: Trade{ID: string(rune('A' + i - 1))}, arrival: i, queuedAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Read three into memory, serve two of them: the third was only moved to memory
+	var read []queuedTrade
+	for i := 0; i < 3; i++ {
+		q, ok := s.next()
+		if !ok {
+			t.Fatalf("next %d: store empty", i)
+		}
+		read = append(read, q)
+	}
+	s.serve(read[0], read[1])
+
+	// Crash: reopen without persisting
+	s, err = openSpillStore(dir, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.count != 3 {
+		t.Fatalf("reopened store holds %d message(s), want 3", s.count)
+	}
+	var got []uint64
+	for {
+		q, ok := s.next()
+		if !ok {
+			break
+		}
+		got = append(got, q.arrival)
+		s.serve(q)
+	}
+	if len(got) != 3 || got[0] != 3 || got[1] != 4 || got[2] != 5 {
+		t.Errorf("reopened store served arrivals %v, want [3 4 5]", got)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "seg-*")); len(files) != 0 {
+		t.Errorf("segments left after serving everything: %v", files)
+	}
+}
+
+func TestSpillStoreDeletesServedSegment(t *testing.T) {
+	dir := t.TempDir()
+	s, err := openSpillStore(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(1); i <= 2; i++ {
+		if err := s.append(queuedTrade{trade: Trade{ID: "m"}, arrival: i, queuedAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	seg := s.segments[0]
+	a, _ := s.next()
+	b, _ := s.next()
+	s.serve(a)
+	if _, err := os.Stat(seg.path); err != nil {
+		t.Fatalf("segment deleted before all its records were served: %v", err)
+	}
+	s.serve(b)
+	if _, err := os.Stat(seg.path); !os.IsNotExist(err) {
+		t.Errorf("served segment still on disk (%v)", err)
+	}
+	if _, err := os.Stat(seg.servedPath()); !os.IsNotExist(err) {
+		t.Errorf("served file still on disk (%v)", err)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxTelemetryPoints is how many points of each series are kept for charts
+const maxTelemetryPoints = 2000
+
+// NTTelemetryPoint is the NT account state a trade reported
+type NTTelemetryPoint struct {
+	Time          time.Time `json:"time"`
+	Account       string    `json:"account,omitempty"`
+	Balance       float64   `json:"balance"`
+	DailyPnL      float64   `json:"daily_pnl"`
+	TradeResult   string    `json:"trade_result,omitempty"` // "win", "loss" or "pending"
+	SessionTrades int       `json:"session_trades"`
+}
+
+// EATelemetryPoint is the elastic-hedging state an EA posted
+type EATelemetryPoint struct {
+	Time    time.Time `json:"time"`
+	Target  string    `json:"target,omitempty"`
+	Cushion float64   `json:"cushion"`
+	OHF     float64   `json:"ohf"`
+	Balance float64   `json:"balance,omitempty"`
+	Equity  float64   `json:"equity,omitempty"`
+}
+
+// TelemetryReport is what GetTelemetry and GET /v1/telemetry return, oldest first
+type TelemetryReport struct {
+	NT []NTTelemetryPoint `json:"nt"`
+	EA []EATelemetryPoint `json:"ea"`
+}
+
+// telemetryRecorder keeps the session's NT account and EA hedging state as
+// time series. A point that repeats the previous one for the same account or
+// target isn't stored, so every contract of a fill doesn't add a point.
+type telemetryRecorder struct {
+	mu     sync.Mutex
+	nt     []NTTelemetryPoint
+	ea     []EATelemetryPoint
+	lastNT map[string]NTTelemetryPoint
+	lastEA map[string]EATelemetryPoint
+}
+
+func newTelemetryRecorder() *telemetryRecorder {
+	return &telemetryRecorder{
+		lastNT: make(map[string]NTTelemetryPoint),
+		lastEA: make(map[string]EATelemetryPoint),
+	}
+}
+
+// ntTrade records the account state carried by t. Trades without NT data are ignored.
+func (x *telemetryRecorder) ntTrade(t Trade) {
+	if t.NTBalance == 0 && t.NTDailyPnL == 0 && t.NTTradeResult == "" && t.NTSessionTrades == 0 {
+		return
+	}
+	p := NTTelemetryPoint{
+		Time:          t.Time,
+		Account:       t.AccountName,
+		Balance:       t.NTBalance,
+		DailyPnL:      t.NTDailyPnL,
+		TradeResult:   t.NTTradeResult,
+		SessionTrades: t.NTSessionTrades,
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if last, ok := x.lastNT[p.Account]; ok {
+		last.Time = p.Time
+		if last == p {
+			return
+		}
+	}
+	x.lastNT[p.Account] = p
+	x.nt = append(x.nt, p)
+	if len(x.nt) > maxTelemetryPoints {
+		x.nt = x.nt[len(x.nt)-maxTelemetryPoints:]
+	}
+}
+
+// eaReport records the hedging state an EA posted
+func (x *telemetryRecorder) eaReport(p EATelemetryPoint) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if last, ok := x.lastEA[p.Target]; ok {
+		last.Time = p.Time
+		if last == p {
+			return
+		}
+	}
+	x.lastEA[p.Target] = p
+	x.ea = append(x.ea, p)
+	if len(x.ea) > maxTelemetryPoints {
+		x.ea = x.ea[len(x.ea)-maxTelemetryPoints:]
+	}
+}
+
+func (x *telemetryRecorder) report() TelemetryReport {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return TelemetryReport{
+		NT: append([]NTTelemetryPoint{}, x.nt...),
+		EA: append([]EATelemetryPoint{}, x.ea...),
+	}
+}
+
+// eaTelemetryHandler takes the EA's cushion and over-hedge factor:
+// POST /mt5/telemetry?target=ftmo-1 {"cushion":42.5,"ohf":0.15,"balance":312.4}
+func (a *App) eaTelemetryHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+	target, ok := a.requireEATarget(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Cushion float64 `json:"cushion"`
+		OHF     float64 `json:"ohf"`
+		Balance float64 `json:"balance"`
+		Equity  float64 `json:"equity"`
+	}
+	if _, ok := decodeBody(w, r, "EATelemetry", &req); !ok {
+		return
+	}
+	a.telemetry.eaReport(EATelemetryPoint{
+		Time:    time.Now(),
+		Target:  target,
+		Cushion: req.Cushion,
+		OHF:     req.OHF,
+		Balance: req.Balance,
+		Equity:  req.Equity,
+	})
+	log.Printf("TELEMETRY: MT5%s cushion %.2f, OHF %.2f", targetLabel(target), req.Cushion, req.OHF)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "success"})
+}
+
+// telemetryHandler serves the telemetry time series: GET /v1/telemetry
+func (a *App) telemetryHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, http.StatusOK, a.telemetry.report())
+}
+
+// GetTelemetry returns the NT balance and daily P&L and the EA cushion and OHF
+// over the session for the UI charts
+func (a *App) GetTelemetry() TelemetryReport {
+	return a.telemetry.report()
+}
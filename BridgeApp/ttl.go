@@ -0,0 +1,214 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// What happens to a queued message that is too old to execute
+const (
+	expiryDrop = "drop"
+	expiryNet  = "net"
+)
+
+// maxExpiryRecords is how many recent expiries are kept for the UI and /v1/expired
+const maxExpiryRecords = 200
+
+// TTLConfig sets how old a queued message may be when the EA pulls it. Age is
+// measured from Trade.Time, the NT fill time. Zero disables a limit. Closes and
+// TP/SL measurements concern hedges MT5 already holds, so past their limit they
+// are reported but still sent.
+type TTLConfig struct {
+	EntryMs       int `json:"entry_ms" yaml:"entry_ms"`
+	CloseMs       int `json:"close_ms" yaml:"close_ms"`
+	MeasurementMs int `json:"measurement_ms" yaml:"measurement_ms"`
+	// OnExpiry is "drop" (default) or "net", which replaces the expired entries
+	// with one fresh net-target entry per instrument and account
+	OnExpiry string `json:"on_expiry" yaml:"on_expiry"`
+}
+
+// TradeExpiry records a queued message that was too old to execute
+type TradeExpiry struct {
+	Time       time.Time `json:"time"`
+	TradeID    string    `json:"trade_id"`
+	BaseID     string    `json:"base_id"`
+	Kind       string    `json:"kind"` // entry, close or measurement
+	Action     string    `json:"action"`
+	Quantity   float64   `json:"quantity"`
+	Instrument string    `json:"instrument,omitempty"`
+	AgeMs      int64     `json:"age_ms"`
+	Outcome    string    `json:"outcome"` // dropped, netted or sent_late
+}
+
+// ttlGuard applies the message time-to-live and keeps the record of expiries
+type ttlGuard struct {
+	mu      sync.Mutex
+	cfg     TTLConfig
+	records []TradeExpiry
+	total   int
+}
+
+func newTTLGuard(cfg TTLConfig) *ttlGuard {
+	return &ttlGuard{cfg: cfg}
+}
+
+// ttlKind names the message type a TTL applies to
+func ttlKind(t Trade) string {
+	switch laneFor(t) {
+	case laneClose:
+		return "close"
+	case laneInfo:
+		return "measurement"
+	default:
+		return "entry"
+	}
+}
+
+// stale reports whether t is older than the TTL for its type, and its age
+func (g *ttlGuard) stale(t Trade, now time.Time) (time.Duration, bool) {
+	var ms int
+	switch ttlKind(t) {
+	case "close":
+		ms = g.cfg.CloseMs
+	case "measurement":
+		ms = g.cfg.MeasurementMs
+	default:
+		ms = g.cfg.EntryMs
+	}
+	if ms <= 0 || t.Time.IsZero() {
+		return 0, false
+	}
+	age := now.Sub(t.Time)
+	return age, age > time.Duration(ms)*time.Millisecond
+}
+
+func (g *ttlGuard) record(e TradeExpiry) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.total++
+	g.records = append(g.records, e)
+	if len(g.records) > maxExpiryRecords {
+		g.records = g.records[len(g.records)-maxExpiryRecords:]
+	}
+}
+
+// expiredTotal returns how many messages have expired since startup
+func (g *ttlGuard) expiredTotal() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.total
+}
+
+// recent returns the latest expiries, oldest first
+func (g *ttlGuard) recent() []TradeExpiry {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]TradeExpiry(nil), g.records...)
+}
+
+// mustDeliver reports whether t acts on a hedge MT5 already holds: dropping a
+// close or TP/SL would leave that hedge open while the bridge counts it closed
+func mustDeliver(t Trade) bool {
+	return laneFor(t) != laneEntry
+}
+
+// expire disposes of t, which was pulled for the EA past its TTL, and reports
+// whether it is to be sent anyway. Closes and TP/SL always are. An expired entry
+// is dropped, or with on_expiry "net" swept out together with every expired
+// message still queued for its target, the entries among them replaced by fresh
+// net targets.
+func (a *App) expire(t Trade, age time.Duration) bool {
+	now := time.Now()
+	if mustDeliver(t) {
+		a.recordExpiry(t, age, "sent_late", now)
+		return true
+	}
+	if a.ttl.cfg.OnExpiry != expiryNet {
+		a.recordExpiry(t, age, "dropped", now)
+		return false
+	}
+
+	var expired, targets []Trade
+	netted := make(map[string]bool)
+	a.tradeQueue.rewrite([]string{t.Target}, func(queued []Trade) []Trade {
+		expired = []Trade{t}
+		for _, q := range queued {
+			if _, stale := a.ttl.stale(q, now); stale {
+				expired = append(expired, q)
+			}
+		}
+		var kept []Trade
+		kept, targets, _ = netOut(expired, now, "ttl")
+		for _, e := range expired {
+			netted[e.ID] = true
+		}
+		for _, k := range kept {
+			delete(netted, k.ID)
+		}
+		// Whatever wasn't netted goes back in its original order; stale closes
+		// among it are sent late when they come up
+		var requeue []Trade
+		for _, q := range queued {
+			if !netted[q.ID] {
+				requeue = append(requeue, q)
+			}
+		}
+		a.trackNetTargets(targets)
+		return append(requeue, targets...)
+	})
+
+	for _, e := range expired {
+		if netted[e.ID] {
+			a.recordExpiry(e, now.Sub(e.Time), "netted", now)
+		}
+	}
+	if !netted[t.ID] {
+		a.recordExpiry(t, age, "dropped", now)
+	}
+	for _, q := range targets {
+		log.Printf("TTL: Queued net target %s %.2f %s (id %s) for expired entries", q.Action, q.Quantity, q.Instrument, q.ID)
+	}
+	return false
+}
+
+func (a *App) recordExpiry(t Trade, age time.Duration, outcome string, now time.Time) {
+	e := TradeExpiry{
+		Time:       now,
+		TradeID:    t.ID,
+		BaseID:     t.BaseID,
+		Kind:       ttlKind(t),
+		Action:     t.Action,
+		Quantity:   t.Quantity,
+		Instrument: t.Instrument,
+		AgeMs:      age.Milliseconds(),
+		Outcome:    outcome,
+	}
+	a.ttl.record(e)
+	if outcome == "sent_late" {
+		log.Printf("WARNING: TTL_EXPIRED: %s %s %s %.2f %s is %v old; sent to MT5 anyway, its hedge is still open",
+			e.Kind, t.ID, t.Action, t.Quantity, instrumentKey(t.Instrument), age.Round(time.Millisecond))
+	} else {
+		log.Printf("TTL_EXPIRED: %s %s %s %.2f %s is %v old; %s instead of sent to MT5",
+			e.Kind, t.ID, t.Action, t.Quantity, instrumentKey(t.Instrument), age.Round(time.Millisecond), outcome)
+	}
+	a.emit("tradeExpired", e)
+}
+
+// expiredHandler lists recent expiries: GET /v1/expired
+func (a *App) expiredHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"total":  a.ttl.expiredTotal(),
+		"recent": a.ttl.recent(),
+		"ttl":    a.ttl.cfg,
+	})
+}
+
+// GetExpiredTrades returns recent expiries for the UI
+func (a *App) GetExpiredTrades() []TradeExpiry {
+	return a.ttl.recent()
+}
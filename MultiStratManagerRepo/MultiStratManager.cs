@@ -209,6 +209,32 @@ namespace NinjaTrader.NinjaScript.AddOns
         private const string PingPath = "/ping_msm";
         private const int ListenerPort = 8081;
         private const string NotifyHedgeClosedPath = "/notify_hedge_closed";
+        private const string CommandPath = "/command";
+
+        // Bridge command polling, used when the HTTP listener can't bind
+        private System.Threading.Timer commandPollTimer;
+        private int commandPollBusy = 0;
+        private const int CommandPollIntervalMs = 2000;
+
+        // Orders placed for the bridge's mirror_trade commands are named with this
+        // prefix and the mirror's base_id, which their fills are reported under
+        private const string MirrorOrderPrefix = "MT5Mirror_";
+        private readonly HashSet<string> mirroredCommandIds = new HashSet<string>();
+
+        // Registration with the bridge, renewed by heartbeats
+        private System.Threading.Timer registrationTimer;
+        private volatile bool isRegisteredWithBridge = false;
+        private readonly string addonInstanceId = $"{Environment.MachineName}-{ListenerPort}";
+        private const int HeartbeatIntervalMs = 10000;
+
+        // Trades and closures carry this session's sequence numbers, so the bridge
+        // drops retried duplicates and names the first message it is missing in
+        // resend_from. Messages it hasn't accepted are kept until it does.
+        private readonly string sequenceSessionId = $"{Environment.MachineName}-{ListenerPort}-{DateTime.UtcNow:yyyyMMddHHmmss}";
+        private long lastSequence = 0;
+        private readonly ConcurrentDictionary<long, KeyValuePair<string, string>> unacceptedMessages = new ConcurrentDictionary<long, KeyValuePair<string, string>>(); // seq -> (path, JSON)
+        private const int MaxUnacceptedMessages = 500;
+        private int resendBusy = 0;
 
         // Class to store original NT trade details
         public class OriginalTradeDetails // Renamed from OriginalNtTradeInfo
@@ -315,6 +341,8 @@ private HashSet<string> trackedHedgeClosingOrderIds;
             {
                 NinjaTrader.Code.Output.Process("MultiStratManager Terminated", PrintTo.OutputTab1);
                 StopHttpListener();
+                StopCommandPolling();
+                StopBridgeRegistration();
                 StopAutoLaunchTimer();
                 sltpRemovalLogic?.Cleanup(); // Cleanup SLTP logic
                 SetMonitoredAccount(null); // ADDED FOR CLEANUP
@@ -606,6 +634,32 @@ private HashSet<string> trackedHedgeClosingOrderIds;
             Application.Current.Dispatcher.BeginInvoke(new Action(delegate() { ShowWindow(); }));
         }
 
+        /// <summary>
+        /// Returns the bridge URL from the bridge_address.json the running bridge
+        /// writes to %AppData%\BridgeApp, or fallbackUrl when there is none.
+        /// </summary>
+        public static string DiscoverBridgeUrl(string fallbackUrl)
+        {
+            string path = Path.Combine(Environment.GetFolderPath(Environment.SpecialFolder.ApplicationData), "BridgeApp", "bridge_address.json");
+            try
+            {
+                if (!File.Exists(path))
+                    return fallbackUrl;
+                var address = SimpleJson.DeserializeObject<Dictionary<string, object>>(File.ReadAllText(path));
+                object url;
+                if (address != null && address.TryGetValue("url", out url) && url != null && !string.IsNullOrWhiteSpace(url.ToString()))
+                {
+                    NinjaTrader.Code.Output.Process($"[MultiStratManager] Discovered bridge at {url} from {path}", PrintTo.OutputTab1);
+                    return url.ToString().TrimEnd('/');
+                }
+            }
+            catch (Exception ex)
+            {
+                NinjaTrader.Code.Output.Process($"[MultiStratManager] Could not read {path}: {ex.Message}. Using {fallbackUrl}", PrintTo.OutputTab1);
+            }
+            return fallbackUrl;
+        }
+
         public void SetBridgeUrl(string url)
         {
             if (!string.IsNullOrEmpty(url))
@@ -625,12 +679,8 @@ private HashSet<string> trackedHedgeClosingOrderIds;
 
             try
             {
-                string jsonPayload = SimpleJson.SerializeObject(data);
-                HttpContent content = new StringContent(jsonPayload, Encoding.UTF8, "application/json");
-
-                NinjaTrader.Code.Output.Process($"[MultiStratManager] Sending data to bridge: {jsonPayload}", PrintTo.OutputTab1); // Log payload
-                string tradeUrl = $"{bridgeServerUrl}/log_trade";
-                HttpResponseMessage response = await httpClient.PostAsync(tradeUrl, content);
+                NinjaTrader.Code.Output.Process($"[MultiStratManager] Sending data to bridge: {SimpleJson.SerializeObject(data)}", PrintTo.OutputTab1); // Log payload
+                HttpResponseMessage response = await PostSequenced("/log_trade", data);
 
                 if (response.IsSuccessStatusCode)
                 {
@@ -648,6 +698,95 @@ private HashSet<string> trackedHedgeClosingOrderIds;
             }
         }
 
+        /// <summary>
+        /// Stamps data with the next sequence number of this session and posts it
+        /// to path on the bridge. The message is kept for resending until the
+        /// bridge accepts it.
+        /// </summary>
+        private async Task<HttpResponseMessage> PostSequenced(string path, Dictionary<string, object> data)
+        {
+            long seq = Interlocked.Increment(ref lastSequence);
+            data["seq"] = seq;
+            data["session_id"] = sequenceSessionId;
+            string json = SimpleJson.SerializeObject(data);
+            unacceptedMessages[seq] = new KeyValuePair<string, string>(path, json);
+            if (unacceptedMessages.Count > MaxUnacceptedMessages)
+            {
+                long oldest = unacceptedMessages.Keys.Min();
+                if (unacceptedMessages.TryRemove(oldest, out _))
+                    LogAndPrint($"SEQUENCE: More than {MaxUnacceptedMessages} messages unaccepted; seq {oldest} can no longer be resent");
+            }
+            return await PostSequencedJson(seq, path, json, true);
+        }
+
+        /// <summary>
+        /// Posts one sequenced message. A 2xx answer, or a 4xx refusal a resend
+        /// would only repeat, retires it; a server error or a lost request keeps it
+        /// for the bridge's resend_from. followResend acts on that request.
+        /// </summary>
+        private async Task<HttpResponseMessage> PostSequencedJson(long seq, string path, string json, bool followResend)
+        {
+            HttpResponseMessage response = await httpClient.PostAsync($"{bridgeServerUrl}{path}", new StringContent(json, Encoding.UTF8, "application/json"));
+            int status = (int)response.StatusCode;
+            if (status < 500 && status != 408 && status != 429)
+                unacceptedMessages.TryRemove(seq, out _);
+            if (!response.IsSuccessStatusCode || !followResend)
+                return response;
+
+            long resendFrom = 0;
+            try
+            {
+                var reply = SimpleJson.DeserializeObject<Dictionary<string, object>>(await response.Content.ReadAsStringAsync());
+                object value;
+                if (reply != null && reply.TryGetValue("resend_from", out value) && value != null)
+                    resendFrom = Convert.ToInt64(value, CultureInfo.InvariantCulture);
+            }
+            catch (Exception ex)
+            {
+                LogAndPrint($"SEQUENCE: Could not read the bridge's reply to seq {seq}: {ex.Message}");
+            }
+            if (resendFrom > 0)
+                _ = Task.Run(() => ResendFrom(resendFrom));
+            return response;
+        }
+
+        /// <summary>
+        /// Resends, in order, the unaccepted messages from seq from on, after the
+        /// bridge reported it is missing from. One resend runs at a time.
+        /// </summary>
+        private async Task ResendFrom(long from)
+        {
+            if (Interlocked.Exchange(ref resendBusy, 1) == 1)
+                return;
+            try
+            {
+                var pending = unacceptedMessages.Keys.Where(seq => seq >= from).OrderBy(seq => seq).ToList();
+                if (pending.Count == 0 || pending[0] != from)
+                    LogAndPrint($"SEQUENCE: Bridge is missing seq {from}, which this session no longer holds");
+                foreach (long seq in pending)
+                {
+                    KeyValuePair<string, string> message;
+                    if (!unacceptedMessages.TryGetValue(seq, out message))
+                        continue;
+                    LogAndPrint($"SEQUENCE: Resending seq {seq} to {message.Key} (bridge asked to resend from {from})");
+                    HttpResponseMessage response = await PostSequencedJson(seq, message.Key, message.Value, false);
+                    if ((int)response.StatusCode >= 500)
+                    {
+                        LogAndPrint($"SEQUENCE: Resend of seq {seq} failed with {response.StatusCode}; the rest waits for the next resend_from");
+                        break;
+                    }
+                }
+            }
+            catch (Exception ex)
+            {
+                LogAndPrint($"SEQUENCE: Resend from seq {from} failed: {ex.Message}");
+            }
+            finally
+            {
+                Interlocked.Exchange(ref resendBusy, 0);
+            }
+        }
+
     public void SetMonitoredAccount(Account account)
     {
         // Unsubscribe from previous account if necessary
@@ -660,6 +799,7 @@ private HashSet<string> trackedHedgeClosingOrderIds;
         }
 
         monitoredAccount = account;
+        isRegisteredWithBridge = false; // Announce the new account on the next heartbeat
 
         // Subscribe to new account if not null
         if (monitoredAccount != null)
@@ -751,8 +891,12 @@ private HashSet<string> trackedHedgeClosingOrderIds;
             }
 
             // OFFICIAL NINJATRADER BEST PRACTICE: Comprehensive Trade Classification
-            bool isClosingExecution = DetectTradeClosureByExecution(e);
-            bool isNewEntryTrade = IsNewEntryTrade(e);
+            // A mirror of a manual MT5 trade is always reported as a fill under its
+            // base_id, even when it reduces the NT position; the bridge books it
+            // without sending anything back to MT5
+            bool isMirrorFill = e.Execution?.Order?.Name != null && e.Execution.Order.Name.StartsWith(MirrorOrderPrefix);
+            bool isClosingExecution = !isMirrorFill && DetectTradeClosureByExecution(e);
+            bool isNewEntryTrade = isMirrorFill || IsNewEntryTrade(e);
 
             LogAndPrint($"TRADE_CLASSIFICATION: Closure={isClosingExecution}, Entry={isNewEntryTrade}");
 
@@ -808,6 +952,9 @@ private HashSet<string> trackedHedgeClosingOrderIds;
                 
                 // We use e.OrderId as the base_id - declare it here for use in both sections
                 string baseId = e.OrderId;
+                bool isMirrorOrder = e.Execution.Order != null && e.Execution.Order.Name != null && e.Execution.Order.Name.StartsWith(MirrorOrderPrefix);
+                if (isMirrorOrder)
+                    baseId = e.Execution.Order.Name.Substring(MirrorOrderPrefix.Length);
 
                 // MULTI_TRADE_GROUP_FIX: Store original trade info and handle multiple trades with same BaseID
                 if (e.Execution.Order != null && e.Execution.Order.OrderState == OrderState.Filled)
@@ -950,7 +1097,7 @@ private HashSet<string> trackedHedgeClosingOrderIds;
                             { "nt_session_trades", _sessionTradeCount }
                         };
 
-                        if (e.Execution.Order != null && !string.IsNullOrEmpty(e.Execution.Order.Name))
+                        if (!isMirrorOrder && e.Execution.Order != null && !string.IsNullOrEmpty(e.Execution.Order.Name))
                         {
                             if (e.Execution.Order.Name.Contains("TP")) tradeData["order_type"] = "TP";
                             else if (e.Execution.Order.Name.Contains("SL")) tradeData["order_type"] = "SL";
@@ -1045,6 +1192,8 @@ private HashSet<string> trackedHedgeClosingOrderIds;
             listenerThread.IsBackground = true; // Ensure thread exits when app exits
             listenerThread.Name = "MultiStratManagerHttpListenerThread";
             listenerThread.Start();
+
+            StartBridgeRegistration();
         }
         catch (HttpListenerException hle) when (hle.ErrorCode == 5) // ERROR_ACCESS_DENIED
         {
@@ -1056,6 +1205,8 @@ private HashSet<string> trackedHedgeClosingOrderIds;
                 try { httpListener.Close(); } catch { /* Ignore */ }
                 httpListener = null;
             }
+            // The bridge can't push commands to us, so fetch them instead
+            StartCommandPolling();
         }
         catch (Exception ex)
         {
@@ -1102,6 +1253,10 @@ private HashSet<string> trackedHedgeClosingOrderIds;
                 {
                     HandleNotifyHedgeClosedRequest(request, response);
                 }
+                else if (request.HttpMethod == "POST" && request.Url.AbsolutePath.Equals(CommandPath, StringComparison.OrdinalIgnoreCase))
+                {
+                    HandleCommandRequest(request, response);
+                }
                 else
                 {
                     response.StatusCode = (int)HttpStatusCode.NotFound; // Changed from MethodNotAllowed to NotFound for unhandled paths
@@ -1667,6 +1822,305 @@ private HashSet<string> trackedHedgeClosingOrderIds;
         }
     }
 
+    // Bridge command channel. The bridge pushes commands to /command and
+    // expects {"status":"done"} or {"status":"failed"} back; when the listener
+    // can't bind they are polled from /v1/nt/commands and acknowledged on
+    // /v1/nt/commands/ack instead.
+    private void HandleCommandRequest(HttpListenerRequest request, HttpListenerResponse response)
+    {
+        string requestBody;
+        using (StreamReader reader = new StreamReader(request.InputStream, request.ContentEncoding))
+        {
+            requestBody = reader.ReadToEnd();
+        }
+        NinjaTrader.Code.Output.Process($"[MultiStratManager] BRIDGE_COMMAND: Received /command POST data: {requestBody}", PrintTo.OutputTab1);
+
+        var reply = new Dictionary<string, object>();
+        var command = SimpleJson.DeserializeObject<Dictionary<string, object>>(requestBody);
+        if (command == null || !command.ContainsKey("id"))
+        {
+            response.StatusCode = (int)HttpStatusCode.BadRequest;
+            reply["status"] = "error";
+            reply["message"] = "Command has no id";
+        }
+        else
+        {
+            string message;
+            bool ok = ExecuteBridgeCommand(command, out message);
+            response.StatusCode = (int)HttpStatusCode.OK;
+            reply["status"] = ok ? "done" : "failed";
+            reply["message"] = message;
+        }
+
+        byte[] buffer = Encoding.UTF8.GetBytes(SimpleJson.SerializeObject(reply));
+        response.ContentType = "application/json";
+        response.ContentLength64 = buffer.Length;
+        using (System.IO.Stream output = response.OutputStream)
+        {
+            output.Write(buffer, 0, buffer.Length);
+        }
+    }
+
+    private static string CommandField(Dictionary<string, object> command, string key)
+    {
+        object value;
+        return command.TryGetValue(key, out value) && value != null ? value.ToString() : "";
+    }
+
+    /// <summary>
+    /// Carries out a bridge command: flatten_account, flatten_instrument,
+    /// cancel_orders, pause_strategy, status or mirror_trade.
+    /// </summary>
+    private bool ExecuteBridgeCommand(Dictionary<string, object> command, out string message)
+    {
+        string id = CommandField(command, "id");
+        string type = CommandField(command, "type");
+        string accountName = CommandField(command, "account");
+        string instrumentName = CommandField(command, "instrument");
+        string strategyName = CommandField(command, "strategy");
+        LogAndPrint($"BRIDGE_COMMAND: {id} {type} (account '{accountName}', instrument '{instrumentName}', strategy '{strategyName}', reason '{CommandField(command, "reason")}')");
+
+        try
+        {
+            if (type == "status")
+            {
+                message = "status received";
+                LogAndPrint($"BRIDGE_COMMAND: Bridge status: {CommandField(command, "status")}");
+                return true;
+            }
+            if (type == "pause_strategy")
+            {
+                var strategy = monitoredStrategies.FirstOrDefault(st => st.Name == strategyName);
+                if (strategy == null)
+                {
+                    message = $"Strategy '{strategyName}' is not monitored";
+                    return false;
+                }
+                RequestStrategyStateChange(strategy, State.Terminated);
+                message = $"Strategy '{strategyName}' disabled";
+                return true;
+            }
+
+            Account account = string.IsNullOrEmpty(accountName) ? monitoredAccount : Account.All.FirstOrDefault(a => a.Name == accountName);
+            if (account == null)
+            {
+                message = $"Account '{accountName}' not found";
+                return false;
+            }
+            switch (type)
+            {
+                case "flatten_account":
+                    var instruments = account.Positions.Where(pos => pos.MarketPosition != MarketPosition.Flat).Select(pos => pos.Instrument).ToList();
+                    if (instruments.Count > 0)
+                        account.Flatten(instruments);
+                    message = $"Flattened {instruments.Count} position(s) on {account.Name}";
+                    return true;
+                case "flatten_instrument":
+                    Instrument instrument = Instrument.GetInstrument(instrumentName);
+                    if (instrument == null)
+                    {
+                        message = $"Instrument '{instrumentName}' not found";
+                        return false;
+                    }
+                    account.Flatten(new List<Instrument> { instrument });
+                    message = $"Flattened {instrument.FullName} on {account.Name}";
+                    return true;
+                case "mirror_trade":
+                    return ExecuteMirrorTrade(id, command, account, instrumentName, out message);
+                case "cancel_orders":
+                    var working = account.Orders.Where(o => o.OrderState == OrderState.Working || o.OrderState == OrderState.Accepted || o.OrderState == OrderState.Submitted).ToList();
+                    if (working.Count > 0)
+                        account.Cancel(working);
+                    message = $"Cancelled {working.Count} working order(s) on {account.Name}";
+                    return true;
+                default:
+                    message = $"Unknown command '{type}'";
+                    return false;
+            }
+        }
+        catch (Exception ex)
+        {
+            message = $"{type} failed: {ex.Message}";
+            LogAndPrint($"BRIDGE_COMMAND: {id} {message}");
+            return false;
+        }
+    }
+
+    /// <summary>
+    /// Places the NT side of a trade opened by hand on MT5. The market order is
+    /// named after the mirror's base_id so its fill reaches the bridge under it.
+    /// A command already carried out, pushed and then polled, is not placed twice.
+    /// </summary>
+    private bool ExecuteMirrorTrade(string id, Dictionary<string, object> command, Account account, string instrumentName, out string message)
+    {
+        string baseId = CommandField(command, "base_id");
+        if (string.IsNullOrEmpty(baseId))
+        {
+            message = "mirror_trade has no base_id";
+            return false;
+        }
+        Instrument instrument = Instrument.GetInstrument(instrumentName);
+        if (instrument == null)
+        {
+            message = $"Instrument '{instrumentName}' not found";
+            return false;
+        }
+        OrderAction action;
+        if (!Enum.TryParse(CommandField(command, "action"), out action) || (action != OrderAction.Buy && action != OrderAction.Sell))
+        {
+            message = $"Invalid mirror_trade action '{CommandField(command, "action")}'";
+            return false;
+        }
+        double quantity;
+        if (!double.TryParse(CommandField(command, "quantity"), System.Globalization.NumberStyles.Float, System.Globalization.CultureInfo.InvariantCulture, out quantity) || quantity < 1)
+        {
+            message = $"Invalid mirror_trade quantity '{CommandField(command, "quantity")}'";
+            return false;
+        }
+        lock (mirroredCommandIds)
+        {
+            if (!mirroredCommandIds.Add(id))
+            {
+                message = $"Mirror {baseId} already placed";
+                return true;
+            }
+        }
+
+        Order order = account.CreateOrder(instrument, action, OrderType.Market, OrderEntry.Manual, TimeInForce.Day, (int)Math.Round(quantity), 0, 0, string.Empty, MirrorOrderPrefix + baseId, default(DateTime), null);
+        if (order == null)
+        {
+            lock (mirroredCommandIds) mirroredCommandIds.Remove(id);
+            message = $"Could not create the mirror order for {baseId}";
+            return false;
+        }
+        account.Submit(new[] { order });
+        message = $"Mirror {baseId} submitted: {action} {(int)Math.Round(quantity)} {instrument.FullName} on {account.Name} (MT5 ticket {CommandField(command, "mt5_ticket")})";
+        LogAndPrint($"BRIDGE_COMMAND: {id} {message}");
+        return true;
+    }
+
+    private void StartCommandPolling()
+    {
+        if (commandPollTimer != null) return;
+        NinjaTrader.Code.Output.Process($"[MultiStratManager] BRIDGE_COMMAND: Polling {bridgeServerUrl}/v1/nt/commands every {CommandPollIntervalMs}ms", PrintTo.OutputTab1);
+        commandPollTimer = new System.Threading.Timer(_ => { var unused = PollBridgeCommands(); }, null, CommandPollIntervalMs, CommandPollIntervalMs);
+    }
+
+    private void StopCommandPolling()
+    {
+        if (commandPollTimer == null) return;
+        commandPollTimer.Dispose();
+        commandPollTimer = null;
+    }
+
+    /// <summary>
+    /// Fetches the next pending bridge command, carries it out and acknowledges it.
+    /// One command is taken per poll since SimpleJson only parses flat objects.
+    /// </summary>
+    private async Task PollBridgeCommands()
+    {
+        if (Interlocked.Exchange(ref commandPollBusy, 1) == 1) return;
+        try
+        {
+            string body = await httpClient.GetStringAsync($"{bridgeServerUrl}/v1/nt/commands?max=1");
+            int start = body.IndexOf("\"commands\":[", StringComparison.Ordinal);
+            int end = body.LastIndexOf(']');
+            if (start < 0 || end < 0) return;
+            start += "\"commands\":[".Length;
+            string item = body.Substring(start, end - start).Trim();
+            if (item.Length == 0) return;
+
+            var command = SimpleJson.DeserializeObject<Dictionary<string, object>>(item);
+            string message;
+            bool ok = ExecuteBridgeCommand(command, out message);
+            var ack = new Dictionary<string, object>
+            {
+                { "id", CommandField(command, "id") },
+                { "status", ok ? "done" : "failed" },
+                { "message", message }
+            };
+            HttpContent content = new StringContent(SimpleJson.SerializeObject(ack), Encoding.UTF8, "application/json");
+            HttpResponseMessage response = await httpClient.PostAsync($"{bridgeServerUrl}/v1/nt/commands/ack", content);
+            if (!response.IsSuccessStatusCode)
+            {
+                NinjaTrader.Code.Output.Process($"[MultiStratManager] BRIDGE_COMMAND: Ack of {ack["id"]} failed. Status: {response.StatusCode}", PrintTo.OutputTab1);
+            }
+        }
+        catch (Exception ex)
+        {
+            NinjaTrader.Code.Output.Process($"[MultiStratManager] BRIDGE_COMMAND: Polling the bridge failed: {ex.Message}", PrintTo.OutputTab1);
+        }
+        finally
+        {
+            Interlocked.Exchange(ref commandPollBusy, 0);
+        }
+    }
+
+    private void StartBridgeRegistration()
+    {
+        if (registrationTimer != null) return;
+        registrationTimer = new System.Threading.Timer(_ => { var unused = RegisterOrHeartbeat(); }, null, 0, HeartbeatIntervalMs);
+    }
+
+    private void StopBridgeRegistration()
+    {
+        if (registrationTimer == null) return;
+        registrationTimer.Dispose();
+        registrationTimer = null;
+        isRegisteredWithBridge = false;
+    }
+
+    /// <summary>
+    /// Registers this instance's listener and monitored account with the bridge,
+    /// then keeps the registration alive with heartbeats. The bridge answers a
+    /// heartbeat for an expired registration with 409, so register again.
+    /// </summary>
+    private async Task RegisterOrHeartbeat()
+    {
+        try
+        {
+            if (isRegisteredWithBridge)
+            {
+                var heartbeat = new Dictionary<string, object> { { "id", addonInstanceId } };
+                HttpContent heartbeatContent = new StringContent(SimpleJson.SerializeObject(heartbeat), Encoding.UTF8, "application/json");
+                HttpResponseMessage heartbeatResponse = await httpClient.PostAsync($"{bridgeServerUrl}/v1/nt/heartbeat", heartbeatContent);
+                if (heartbeatResponse.IsSuccessStatusCode) return;
+                NinjaTrader.Code.Output.Process($"[MultiStratManager] ADDON_REGISTRATION: Heartbeat answered {heartbeatResponse.StatusCode}; registering again", PrintTo.OutputTab1);
+                isRegisteredWithBridge = false;
+            }
+
+            var accounts = new List<string>();
+            if (monitoredAccount != null)
+                accounts.Add(monitoredAccount.Name);
+            var registration = new Dictionary<string, object>
+            {
+                { "id", addonInstanceId },
+                { "url", $"http://localhost:{ListenerPort}" },
+                { "version", "1.0" },
+                { "accounts", accounts },
+                { "capabilities", new List<string> { "notify_hedge_closed", "command", "ping_msm", "mirror_trade" } }
+            };
+            HttpContent content = new StringContent(SimpleJson.SerializeObject(registration), Encoding.UTF8, "application/json");
+            HttpResponseMessage response = await httpClient.PostAsync($"{bridgeServerUrl}/v1/nt/register", content);
+            if (response.IsSuccessStatusCode)
+            {
+                isRegisteredWithBridge = true;
+                NinjaTrader.Code.Output.Process($"[MultiStratManager] ADDON_REGISTRATION: Registered {addonInstanceId} with accounts [{string.Join(", ", accounts)}]", PrintTo.OutputTab1);
+            }
+            else
+            {
+                string responseContent = await response.Content.ReadAsStringAsync();
+                NinjaTrader.Code.Output.Process($"[MultiStratManager] ADDON_REGISTRATION: Registration failed. Status: {response.StatusCode}, Response: {responseContent}", PrintTo.OutputTab1);
+            }
+        }
+        catch (Exception ex)
+        {
+            // The bridge may not be running yet; the next tick retries
+            isRegisteredWithBridge = false;
+            NinjaTrader.Code.Output.Process($"[MultiStratManager] ADDON_REGISTRATION: Bridge unreachable: {ex.Message}", PrintTo.OutputTab1);
+        }
+    }
+
     private void StopHttpListener()
     {
         if (!isListenerRunning && httpListener == null) // If already stopped or never started
@@ -2577,14 +3031,10 @@ private HashSet<string> trackedHedgeClosingOrderIds;
     {
         try
         {
-            string json = SimpleJson.SerializeObject(closureData);
-            var content = new StringContent(json, Encoding.UTF8, "application/json");
-
             // Send to bridge's NT hedge closure endpoint (reverse flow: NT -> Bridge -> MT5)
-            string url = $"{bridgeServerUrl}/nt_close_hedge";
-            LogAndPrint($"NT_CLOSURE: Sending hedge closure notification to {url}");
+            LogAndPrint($"NT_CLOSURE: Sending hedge closure notification to {bridgeServerUrl}/nt_close_hedge");
 
-            var response = await httpClient.PostAsync(url, content);
+            var response = await PostSequenced("/nt_close_hedge", closureData);
 
             if (response.IsSuccessStatusCode)
             {
@@ -64,7 +64,7 @@ namespace NinjaTrader.NinjaScript.AddOns
         private DateTime lastResetDate;
         private System.Windows.Threading.DispatcherTimer strategyStatePollTimer;
         private bool dailyLimitHitForSelectedAccountToday = false; // Flag to track if daily P&L limit is hit
-        private string bridgeServerUrl = "http://127.0.0.1:5000"; // Default base URL, will be updated later
+        private string bridgeServerUrl = MultiStratManager.DiscoverBridgeUrl("http://127.0.0.1:5000"); // From bridge_address.json when the bridge is running
         private TextBox bridgeUrlInput; // Added for Bridge URL input
         private Button pingBridgeButton; // Added for Ping Bridge button
         private CheckBox enableSLTPRemovalCheckBox;